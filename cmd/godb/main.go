@@ -2,16 +2,176 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/Argentum88/godb/internal/executor"
+	"github.com/Argentum88/godb/internal/server"
 	"github.com/Argentum88/godb/internal/shell"
 	"github.com/Argentum88/godb/internal/storage"
+	"github.com/Argentum88/godb/internal/storage/page"
 )
 
+// version задается при сборке: go build -ldflags "-X main.version=v0.1.0"
+var version = "dev"
+
 func main() {
-	inMemoryKVEngine := storage.NewInMemoryKVEngine()
-	kvExecutor := executor.NewKVExecutor(inMemoryKVEngine)
-	sh := shell.NewShell(kvExecutor)
-	sh.Run(context.Background(), os.Stdin, os.Stdout)
+	engineType := flag.String("engine", "memory", "storage engine: memory, mvcc or disk")
+	dbPath := flag.String("path", "godb.db", "database file path for the disk engine")
+	listenAddr := flag.String("listen", "", "TCP address to serve clients on instead of the interactive shell")
+	scriptPath := flag.String("script", "", "run commands from the file and exit, stopping at the first error")
+	continueOnError := flag.Bool("continue-on-error", false, "keep running the script after a failed command")
+	maxKeySize := flag.Int("max-key-size", 0, "largest accepted key in bytes, 0 for the engine default")
+	maxValueSize := flag.Int("max-value-size", 0, "largest accepted value in bytes, 0 for the engine default (no limit in memory, one page on disk)")
+	keysLimit := flag.Int("keys-limit", 1000, "largest number of keys the keys command prints, 0 for no limit")
+	commandTimeout := flag.Duration("command-timeout", 0, "longest time a single command may run, 0 for no limit")
+	readOnly := flag.Bool("read-only", false, "reject commands that modify data")
+	snapshotDir := flag.String("snapshot-dir", "", "directory that save and load paths are confined to; in server mode defaults to the working directory")
+	scrubInterval := flag.Duration("scrub-interval", 0, "how often the disk engine checks its pages and index in the background, 0 to disable")
+	scrubBatch := flag.Int("scrub-batch", 16, "pages and index entries the disk engine checks per scrub interval")
+	format := flag.String("format", "text", "shell output format: text or json (one JSON object per command)")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg := config{
+		engineType:      *engineType,
+		dbPath:          *dbPath,
+		listenAddr:      *listenAddr,
+		scriptPath:      *scriptPath,
+		continueOnError: *continueOnError,
+		maxKeySize:      *maxKeySize,
+		maxValueSize:    *maxValueSize,
+		keysLimit:       *keysLimit,
+		commandTimeout:  *commandTimeout,
+		format:          *format,
+		snapshotDir:     *snapshotDir,
+		readOnly:        *readOnly,
+		scrubInterval:   *scrubInterval,
+		scrubBatch:      *scrubBatch,
+	}
+	// Прерывание сигналом — штатное завершение, а не ошибка
+	if err := run(ctx, cfg); err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintf(os.Stderr, "godb: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// config — параметры запуска из флагов командной строки.
+type config struct {
+	engineType      string
+	dbPath          string
+	listenAddr      string
+	scriptPath      string
+	continueOnError bool
+	maxKeySize      int
+	maxValueSize    int
+	keysLimit       int
+	commandTimeout  time.Duration
+	format          string
+	readOnly        bool
+	snapshotDir     string
+	scrubInterval   time.Duration
+	scrubBatch      int
+}
+
+// closableExecutor — исполнитель, который при завершении закрывает движок.
+type closableExecutor interface {
+	executor.Executor
+	Close(ctx context.Context) error
+}
+
+// run открывает движок и запускает выбранный режим работы.
+func run(ctx context.Context, cfg config) error {
+	engine, buildInfo, err := openEngine(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	opts := []executor.Option{
+		executor.WithBuildInfo(buildInfo),
+		executor.WithKeysLimit(cfg.keysLimit),
+		executor.WithCommandTimeout(cfg.commandTimeout),
+	}
+	if cfg.readOnly {
+		opts = append(opts, executor.WithReadOnly())
+	}
+	snapshotDir := cfg.snapshotDir
+	if snapshotDir == "" && cfg.listenAddr != "" {
+		// Клиенты сервера не должны записывать и читать произвольные файлы
+		snapshotDir = "."
+	}
+	if snapshotDir != "" {
+		opts = append(opts, executor.WithSnapshotDir(snapshotDir))
+	}
+	kvExecutor := executor.NewKVExecutor(engine, opts...)
+	return serve(ctx, cfg, kvExecutor, os.Stdin, os.Stdout)
+}
+
+// openEngine создает движок, выбранный в cfg.
+func openEngine(ctx context.Context, cfg config) (storage.Engine, executor.BuildInfo, error) {
+	buildInfo := executor.BuildInfo{Version: version, PageSize: page.DefaultPageSize}
+	limits := []storage.Option{storage.WithMaxKeySize(cfg.maxKeySize), storage.WithMaxValueSize(cfg.maxValueSize)}
+	switch cfg.engineType {
+	case "memory":
+		buildInfo.Engine = "in-memory"
+		return storage.NewInMemoryKVEngine(limits...), buildInfo, nil
+	case "mvcc":
+		buildInfo.Engine = "mvcc"
+		return storage.NewMVCCKVEngine(limits...), buildInfo, nil
+	case "disk":
+		opts := append(limits, storage.WithScrubber(cfg.scrubInterval, cfg.scrubBatch))
+		diskKVEngine, err := storage.NewDiskKVEngine(ctx, cfg.dbPath, opts...)
+		if err != nil {
+			return nil, buildInfo, err
+		}
+		buildInfo.Engine = "disk"
+		buildInfo.PageSize = diskKVEngine.PageSize()
+		return diskKVEngine, buildInfo, nil
+	default:
+		return nil, buildInfo, fmt.Errorf("unknown engine %q", cfg.engineType)
+	}
+}
+
+// serve выполняет команды в выбранном режиме до его завершения или отмены ctx,
+// после чего закрывает исполнитель, чтобы движок сбросил данные на диск.
+func serve(ctx context.Context, cfg config, exec closableExecutor, in io.Reader, out io.Writer) (err error) {
+	defer func() {
+		// ctx к этому моменту может быть отменен сигналом, а сбросить данные нужно все равно
+		if closeErr := exec.Close(context.WithoutCancel(ctx)); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close engine: %w", closeErr)
+		}
+	}()
+
+	if cfg.listenAddr != "" {
+		return server.ListenAndServe(ctx, cfg.listenAddr, exec)
+	}
+
+	var shellOpts []shell.Option
+	if cfg.continueOnError {
+		shellOpts = append(shellOpts, shell.WithContinueOnError())
+	}
+	switch cfg.format {
+	case "", "text":
+	case "json":
+		shellOpts = append(shellOpts, shell.WithJSONOutput())
+	default:
+		return fmt.Errorf("unknown output format %q", cfg.format)
+	}
+	sh := shell.NewShell(exec, shellOpts...)
+	if cfg.scriptPath != "" {
+		f, err := os.Open(cfg.scriptPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return sh.RunScript(ctx, f, out)
+	}
+	return sh.Run(ctx, in, out)
 }
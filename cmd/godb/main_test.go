@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Argentum88/godb/internal/executor"
+	"github.com/Argentum88/godb/internal/storage"
+)
+
+// closeRecordingEngine — движок в памяти, запоминающий вызов Close
+type closeRecordingEngine struct {
+	storage.Engine
+	mu       sync.Mutex
+	closed   bool
+	closeErr error // Ошибка контекста, переданного в Close
+}
+
+func (e *closeRecordingEngine) Close(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	e.closeErr = ctx.Err()
+	return nil
+}
+
+func TestServe_ClosesEngineOnCancel(t *testing.T) {
+	t.Parallel()
+	engine := &closeRecordingEngine{Engine: storage.NewInMemoryKVEngine()}
+	exec := executor.NewKVExecutor(engine)
+
+	// Ввод никогда не заканчивается: shell может завершиться только по сигналу
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, config{}, exec, pr, io.Discard)
+	}()
+	if _, err := io.WriteString(pw, "set foo bar\n"); err != nil {
+		t.Fatalf("failed to write command: %v", err)
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected %v, got %v", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("serve did not return after cancellation")
+	}
+
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+	if !engine.closed {
+		t.Fatalf("expected engine to be closed on shutdown")
+	}
+	if engine.closeErr != nil {
+		t.Fatalf("expected Close to get a live context, got %v", engine.closeErr)
+	}
+}
+
+func TestServe_ClosesEngineOnExit(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := &closeRecordingEngine{Engine: storage.NewInMemoryKVEngine()}
+	exec := executor.NewKVExecutor(engine)
+
+	if err := serve(context.Background(), config{}, exec, strings.NewReader("begin\nset foo bar\nexit\n"), io.Discard); err != nil {
+		t.Fatalf("serve failed: %v", err)
+	}
+	if !engine.closed {
+		t.Fatalf("expected engine to be closed on exit")
+	}
+	// Незафиксированная транзакция отбрасывается при закрытии
+	if _, err := engine.Get(ctx, []byte("foo")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected open transaction to be rolled back, got %v", err)
+	}
+}
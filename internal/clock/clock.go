@@ -0,0 +1,54 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock сообщает текущее время. Код, зависящий от времени, получает Clock извне,
+// чтобы тесты могли управлять временем через ManualClock.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Real возвращает системные часы.
+func Real() Clock {
+	return realClock{}
+}
+
+// ManualClock — часы для тестов: время меняется только через Advance и Set.
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewManual создает часы, показывающие start.
+func NewManual(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance переводит часы вперед на d.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set переводит часы на t.
+func (c *ManualClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
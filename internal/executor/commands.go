@@ -0,0 +1,567 @@
+package executor
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Argentum88/godb/internal/storage"
+	"github.com/Argentum88/godb/internal/storage/page"
+)
+
+// commandCategory — укрупненная категория команды для клиентов и автодополнения.
+type commandCategory string
+
+const (
+	categoryRead   commandCategory = "read"
+	categoryWrite  commandCategory = "write"
+	categoryAdmin  commandCategory = "admin"
+	categoryDebug  commandCategory = "debug"
+	categoryCustom commandCategory = "custom"
+)
+
+// commandInfo описывает команду: имя, категорию, синтаксис и краткое описание для help.
+type commandInfo struct {
+	name     string
+	category commandCategory
+	usage    string
+	summary  string
+}
+
+// registerBuiltins регистрирует встроенные команды kvExecutor.
+func (e *kvExecutor) registerBuiltins() {
+	builtins := []struct {
+		info    commandInfo
+		args    ArgSpec
+		handler CommandHandler
+	}{
+		{commandInfo{"set", categoryWrite, "set <key> <value>", "store a value"}, ExactArgs(2), e.cmdSet},
+		{commandInfo{"get", categoryRead, "get <key>", "read a value"}, ExactArgs(1), e.cmdGet},
+		{commandInfo{"setb", categoryWrite, "setb <key> <base64>", "store a base64-encoded binary value"}, ExactArgs(2), e.cmdSetB},
+		{commandInfo{"getb", categoryRead, "getb <key>", "read a value encoded as base64"}, ExactArgs(1), e.cmdGetB},
+		{commandInfo{"mset", categoryWrite, "mset <key> <value> [key value ...]", "store several values atomically"}, AtLeastArgs(2), e.cmdMSet},
+		{commandInfo{"mget", categoryRead, "mget <key> [key ...]", "read several values, (nil) for missing keys"}, AtLeastArgs(1), e.cmdMGet},
+		{commandInfo{"incr", categoryWrite, "incr <key>", "increment an integer value by 1"}, ExactArgs(1), e.cmdIncrement(1)},
+		{commandInfo{"decr", categoryWrite, "decr <key>", "decrement an integer value by 1"}, ExactArgs(1), e.cmdIncrement(-1)},
+		{commandInfo{"incrby", categoryWrite, "incrby <key> <n>", "add n to an integer value"}, ExactArgs(2), e.cmdIncrBy(1)},
+		{commandInfo{"decrby", categoryWrite, "decrby <key> <n>", "subtract n from an integer value"}, ExactArgs(2), e.cmdIncrBy(-1)},
+		{commandInfo{"cas", categoryWrite, "cas <key> <expected|(nil)> <new>", "set new if the value equals expected"}, ExactArgs(3), e.cmdCAS},
+		{commandInfo{"getv", categoryRead, "getv <key>", "read a value and its version"}, ExactArgs(1), e.cmdGetV},
+		{commandInfo{"setv", categoryWrite, "setv <key> <value> <version>", "set a value if its version is unchanged, 0 if the key must be absent"}, ExactArgs(3), e.cmdSetV},
+		{commandInfo{"setnx", categoryWrite, "setnx <key> <value>", "store a value only if the key is absent, print 1 if stored"}, ExactArgs(2), e.cmdSetNX},
+		{commandInfo{"getset", categoryWrite, "getset <key> <value>", "store a value and print the previous one, (nil) if absent"}, ExactArgs(2), e.cmdGetSet},
+		{commandInfo{"append", categoryWrite, "append <key> <value>", "append to a value and print its new length"}, ExactArgs(2), e.cmdAppend},
+		{commandInfo{"flushall", categoryWrite, "flushall", "delete all keys"}, ExactArgs(0), e.cmdFlushAll},
+		{commandInfo{"delprefix", categoryWrite, "delprefix <prefix>", "delete keys with a non-empty prefix and print how many were deleted"}, ExactArgs(1), e.cmdDelPrefix},
+		{commandInfo{"ttl", categoryRead, "ttl <key>", "show seconds until a key expires, -1 if it does not, -2 if it is missing"}, ExactArgs(1), e.cmdTTL},
+		{commandInfo{"keys", categoryRead, "keys [prefix]", "list keys in order"}, RangeArgs(0, 1), e.cmdKeys},
+		{commandInfo{"info", categoryAdmin, "info [prefix <prefix>]", "show database size and pool stats, or count keys and value bytes under a prefix"}, RangeArgs(0, 2), e.cmdInfo},
+		{commandInfo{"stats", categoryAdmin, "stats", "show engine metrics"}, ExactArgs(0), e.cmdStats},
+		{commandInfo{"cachemap", categoryDebug, "cachemap <start> <end>", "show which pages are in the buffer pool"}, ExactArgs(2), e.cmdCacheMap},
+		{commandInfo{"dumppage", categoryDebug, "dumppage <page>", "show the header and slots of a page as stored on disk"}, ExactArgs(1), e.cmdDumpPage},
+		{commandInfo{"poolsize", categoryAdmin, "poolsize <frames>", "resize the buffer pool"}, ExactArgs(1), e.cmdPoolSize},
+		{commandInfo{"persisttest", categoryDebug, "persisttest <key> [noflush]", "check that a value is on disk"}, RangeArgs(1, 2), e.cmdPersistTest},
+		{commandInfo{"save", categoryAdmin, "save <file>", "write all data to a file"}, ExactArgs(1), e.cmdSave},
+		{commandInfo{"load", categoryWrite, "load <file>", "replace all data with a saved file"}, ExactArgs(1), e.cmdLoad},
+		{commandInfo{"slowlog", categoryAdmin, "slowlog get|reset", "show or clear slow commands"}, ExactArgs(1), e.cmdSlowLog},
+		{commandInfo{"commands", categoryAdmin, "commands", "list commands with arity and category"}, ExactArgs(0), e.cmdCommands},
+		{commandInfo{"help", categoryAdmin, "help", "show this help"}, ExactArgs(0), e.cmdHelp},
+		{commandInfo{"version", categoryAdmin, "version", "show build information"}, ExactArgs(0), e.cmdVersion},
+		{commandInfo{"fork", categoryAdmin, "fork", "apply commands to a copy of the data"}, ExactArgs(0), e.cmdEngineOp(e.fork)},
+		{commandInfo{"merge", categoryWrite, "merge", "apply the changes made in the fork"}, ExactArgs(0), e.cmdEngineOp(e.merge)},
+		{commandInfo{"discard", categoryAdmin, "discard", "drop the fork"}, ExactArgs(0), e.cmdEngineOp(e.discard)},
+		{commandInfo{"begin", categoryWrite, "begin", "start a transaction"}, ExactArgs(0), e.cmdEngineOp(e.begin)},
+		{commandInfo{"commit", categoryWrite, "commit", "apply the transaction"}, ExactArgs(0), e.cmdEngineOp(e.commit)},
+		{commandInfo{"rollback", categoryWrite, "rollback", "drop the transaction"}, ExactArgs(0), e.cmdEngineOp(e.rollback)},
+	}
+	for _, b := range builtins {
+		e.registry.add(&command{commandInfo: b.info, args: b.args, handler: b.handler})
+	}
+}
+
+func (e *kvExecutor) cmdSet(ctx context.Context, args []string) (Result, error) {
+	if err := e.currentEngine(ctx).Set(ctx, []byte(args[0]), []byte(args[1])); err != nil {
+		return Result{}, err
+	}
+	return okResult(1), nil
+}
+
+func (e *kvExecutor) cmdGet(ctx context.Context, args []string) (Result, error) {
+	value, err := e.currentEngine(ctx).Get(ctx, []byte(args[0]))
+	if err != nil {
+		return Result{}, err
+	}
+	return valueResult(string(value)), nil
+}
+
+// cmdSetB декодирует значение из стандартного base64, чтобы через текстовый протокол
+// можно было записать пробелы, кавычки и нулевые байты.
+func (e *kvExecutor) cmdSetB(ctx context.Context, args []string) (Result, error) {
+	value, err := base64.StdEncoding.DecodeString(args[1])
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: invalid base64 value: %v", ErrInvalidCommandSyntax, err)
+	}
+	if err := e.currentEngine(ctx).Set(ctx, []byte(args[0]), value); err != nil {
+		return Result{}, err
+	}
+	return okResult(1), nil
+}
+
+// cmdGetB выводит значение в стандартном base64, обратном для setb.
+func (e *kvExecutor) cmdGetB(ctx context.Context, args []string) (Result, error) {
+	value, err := e.currentEngine(ctx).Get(ctx, []byte(args[0]))
+	if err != nil {
+		return Result{}, err
+	}
+	return valueResult(base64.StdEncoding.EncodeToString(value)), nil
+}
+
+// cmdMSet — аргументы идут парами ключ-значение, при повторе ключа побеждает последнее значение.
+func (e *kvExecutor) cmdMSet(ctx context.Context, args []string) (Result, error) {
+	if len(args)%2 != 0 {
+		return Result{}, ErrInvalidCommandSyntax
+	}
+	pairs := make(map[string][]byte, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		pairs[args[i]] = []byte(args[i+1])
+	}
+	if err := e.currentEngine(ctx).SetMany(pairs); err != nil {
+		return Result{}, err
+	}
+	return okResult(len(pairs)), nil
+}
+
+// cmdMGet выводит строки ключ-значение в порядке аргументов, вместо отсутствующего значения — (nil).
+func (e *kvExecutor) cmdMGet(ctx context.Context, args []string) (Result, error) {
+	keys := make([][]byte, len(args))
+	for i, arg := range args {
+		keys[i] = []byte(arg)
+	}
+	values, errs := e.currentEngine(ctx).GetMany(keys)
+
+	rows := make([][]string, len(args))
+	for i, key := range args {
+		switch {
+		case errs[i] == nil:
+			rows[i] = []string{key, string(values[i])}
+		case errors.Is(errs[i], storage.ErrKeyNotFound):
+			rows[i] = []string{key, absentValue}
+		default:
+			return Result{}, fmt.Errorf("key %q: %w", key, errs[i])
+		}
+	}
+	return RowsResult(rows), nil
+}
+
+// cmdIncrement возвращает обработчик, прибавляющий к значению ключа фиксированное delta.
+func (e *kvExecutor) cmdIncrement(delta int64) CommandHandler {
+	return func(ctx context.Context, args []string) (Result, error) {
+		return e.increment(ctx, args[0], delta)
+	}
+}
+
+// cmdIncrBy — sign равен 1 для incrby и -1 для decrby.
+func (e *kvExecutor) cmdIncrBy(sign int64) CommandHandler {
+	return func(ctx context.Context, args []string) (Result, error) {
+		delta, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return Result{}, ErrInvalidCommandSyntax
+		}
+		// -math.MinInt64 не представимо в int64
+		if sign < 0 && delta == math.MinInt64 {
+			return Result{}, storage.ErrIntegerOverflow
+		}
+		return e.increment(ctx, args[0], sign*delta)
+	}
+}
+
+func (e *kvExecutor) increment(ctx context.Context, key string, delta int64) (Result, error) {
+	n, err := e.currentEngine(ctx).Increment([]byte(key), delta)
+	if err != nil {
+		return Result{}, err
+	}
+	return valueResult(strconv.FormatInt(n, 10)), nil
+}
+
+// cmdCAS — ожидаемое значение (nil) означает, что ключ должен отсутствовать.
+func (e *kvExecutor) cmdCAS(ctx context.Context, args []string) (Result, error) {
+	var expected []byte
+	if args[1] != absentValue {
+		expected = []byte(args[1])
+	}
+	swapped, err := e.currentEngine(ctx).CompareAndSwap([]byte(args[0]), expected, []byte(args[2]))
+	if err != nil {
+		return Result{}, err
+	}
+	return valueResult(strconv.FormatBool(swapped)), nil
+}
+
+// cmdGetV выводит строки value и version.
+func (e *kvExecutor) cmdGetV(ctx context.Context, args []string) (Result, error) {
+	ve, ok := e.currentEngine(ctx).(versionedEngine)
+	if !ok {
+		return Result{}, ErrNotSupported
+	}
+	value, version, err := ve.GetVersioned([]byte(args[0]))
+	if err != nil {
+		return Result{}, err
+	}
+	return RowsResult([][]string{
+		{"value", string(value)},
+		{"version", strconv.FormatUint(version, 10)},
+	}), nil
+}
+
+// cmdSetV, как и cas, выводит true, если значение записано.
+func (e *kvExecutor) cmdSetV(ctx context.Context, args []string) (Result, error) {
+	expected, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		return Result{}, ErrInvalidCommandSyntax
+	}
+	ve, ok := e.currentEngine(ctx).(versionedEngine)
+	if !ok {
+		return Result{}, ErrNotSupported
+	}
+	set, err := ve.SetIfVersion([]byte(args[0]), []byte(args[1]), expected)
+	if err != nil {
+		return Result{}, err
+	}
+	return valueResult(strconv.FormatBool(set)), nil
+}
+
+// cmdSetNX выводит 1, если значение записано, и 0, если ключ уже существовал.
+func (e *kvExecutor) cmdSetNX(ctx context.Context, args []string) (Result, error) {
+	set, err := e.currentEngine(ctx).SetNX([]byte(args[0]), []byte(args[1]))
+	if err != nil {
+		return Result{}, err
+	}
+	if !set {
+		return valueResult("0"), nil
+	}
+	return valueResult("1"), nil
+}
+
+// cmdGetSet выводит предыдущее значение, а для ключа, которого не было, — (nil).
+func (e *kvExecutor) cmdGetSet(ctx context.Context, args []string) (Result, error) {
+	old, existed, err := e.currentEngine(ctx).GetSet([]byte(args[0]), []byte(args[1]))
+	if err != nil {
+		return Result{}, err
+	}
+	if !existed {
+		return valueResult(absentValue), nil
+	}
+	return valueResult(string(old)), nil
+}
+
+func (e *kvExecutor) cmdAppend(ctx context.Context, args []string) (Result, error) {
+	n, err := e.currentEngine(ctx).Append([]byte(args[0]), []byte(args[1]))
+	if err != nil {
+		return Result{}, err
+	}
+	return valueResult(strconv.Itoa(n)), nil
+}
+
+// cmdTTL выводит оставшиеся секунды с округлением вверх, чтобы ключ с оставшейся долей секунды
+// не выглядел истекшим. Для бессрочного ключа выводится -1, для отсутствующего — -2.
+func (e *kvExecutor) cmdTTL(ctx context.Context, args []string) (Result, error) {
+	ttl, err := e.currentEngine(ctx).TTL([]byte(args[0]))
+	switch {
+	case errors.Is(err, storage.ErrKeyNotFound):
+		return valueResult("-2"), nil
+	case err != nil:
+		return Result{}, err
+	case ttl == storage.NoExpiry:
+		return valueResult("-1"), nil
+	}
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	return valueResult(strconv.FormatInt(seconds, 10)), nil
+}
+
+func (e *kvExecutor) cmdFlushAll(ctx context.Context, args []string) (Result, error) {
+	if err := e.currentEngine(ctx).Clear(); err != nil {
+		return Result{}, err
+	}
+	return okResult(0), nil
+}
+
+// cmdDelPrefix отклоняет пустой префикс: он соответствует всем ключам, и удалить их все
+// опечаткой в кавычках не должно получиться. Для этого есть flushall.
+func (e *kvExecutor) cmdDelPrefix(ctx context.Context, args []string) (Result, error) {
+	if args[0] == "" {
+		return Result{}, fmt.Errorf("%w: empty prefix, use flushall to delete all keys", ErrInvalidCommandSyntax)
+	}
+	deleted, err := e.currentEngine(ctx).DeletePrefix([]byte(args[0]))
+	if err != nil {
+		return Result{}, err
+	}
+	return valueResult(strconv.Itoa(deleted)), nil
+}
+
+// cmdKeys выводит не больше keysLimit ключей с префиксом, а без префикса — все ключи,
+// и сообщает, если вывод обрезан.
+func (e *kvExecutor) cmdKeys(ctx context.Context, args []string) (Result, error) {
+	var prefix []byte
+	if len(args) == 1 {
+		prefix = []byte(args[0])
+	}
+	var (
+		rows      [][]string
+		truncated bool
+	)
+	err := e.currentEngine(ctx).Keys(prefix, func(key []byte) bool {
+		if e.keysLimit > 0 && len(rows) == e.keysLimit {
+			truncated = true
+			return false
+		}
+		rows = append(rows, []string{string(key)})
+		return true
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	if truncated {
+		rows = append(rows, []string{fmt.Sprintf("(truncated after %d keys)", e.keysLimit)})
+	}
+	return RowsResult(rows), nil
+}
+
+// cmdInfo без аргументов сообщает размер базы и счетчики буферного пула.
+func (e *kvExecutor) cmdInfo(ctx context.Context, args []string) (Result, error) {
+	if len(args) == 0 {
+		return e.storageInfo(ctx)
+	}
+	if len(args) != 2 || args[0] != "prefix" {
+		return Result{}, ErrInvalidCommandSyntax
+	}
+	stat, err := e.currentEngine(ctx).PrefixStats([]byte(args[1]))
+	if err != nil {
+		return Result{}, err
+	}
+	return valueResult(fmt.Sprintf("keys=%d bytes=%d", stat.Keys, stat.ValueBytes)), nil
+}
+
+func (e *kvExecutor) storageInfo(ctx context.Context) (Result, error) {
+	si, ok := e.currentEngine(ctx).(storageInspector)
+	if !ok {
+		return Result{}, ErrNotSupported
+	}
+	info, err := si.StorageInfo(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	return valueResult(fmt.Sprintf("pages=%d page_size=%d file_bytes=%d pool_frames=%d pool_hits=%d pool_misses=%d pool_evictions=%d pool_prefetched=%d",
+		info.PageCount, info.PageSize, info.FileSize, info.PoolSize, info.Pool.Hits, info.Pool.Misses, info.Pool.Evictions, info.Pool.Prefetched)), nil
+}
+
+// cmdStats выводит метрики движка построчно в виде имя=значение, упорядоченные по имени.
+func (e *kvExecutor) cmdStats(ctx context.Context, args []string) (Result, error) {
+	ss, ok := e.currentEngine(ctx).(statsSource)
+	if !ok {
+		return Result{}, ErrNotSupported
+	}
+	stats := ss.Stats()
+	rows := make([][]string, 0, len(stats))
+	for _, name := range slices.Sorted(maps.Keys(stats)) {
+		rows = append(rows, []string{name + "=" + stats[name]})
+	}
+	return RowsResult(rows), nil
+}
+
+func (e *kvExecutor) cmdCacheMap(ctx context.Context, args []string) (Result, error) {
+	rs, ok := e.currentEngine(ctx).(residencySource)
+	if !ok {
+		return Result{}, ErrNotSupported
+	}
+	start, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return Result{}, ErrInvalidCommandSyntax
+	}
+	end, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return Result{}, ErrInvalidCommandSyntax
+	}
+	if end < start {
+		return Result{}, fmt.Errorf("%w: end page %d is before start page %d", ErrInvalidCommandSyntax, end, start)
+	}
+	// Страниц за концом файла в пуле быть не может, поэтому диапазон обрезается по размеру файла
+	if si, ok := e.currentEngine(ctx).(storageInspector); ok {
+		info, err := si.StorageInfo(ctx)
+		if err != nil {
+			return Result{}, err
+		}
+		end = max(start, min(end, info.PageCount))
+	}
+	if end-start > cacheMapMaxPages {
+		return Result{}, fmt.Errorf("%w: range of %d pages exceeds %d", ErrInvalidCommandSyntax, end-start, cacheMapMaxPages)
+	}
+	startPage := page.PageID(start)
+	return valueResult(formatResidency(startPage, rs.Residency(startPage, page.PageID(end)))), nil
+}
+
+func (e *kvExecutor) cmdDumpPage(ctx context.Context, args []string) (Result, error) {
+	pd, ok := e.currentEngine(ctx).(pageDumper)
+	if !ok {
+		return Result{}, ErrNotSupported
+	}
+	pageID, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return Result{}, ErrInvalidCommandSyntax
+	}
+	dump, err := pd.DumpPage(ctx, page.PageID(pageID))
+	if err != nil {
+		return Result{}, err
+	}
+	return valueResult(dump), nil
+}
+
+func (e *kvExecutor) cmdPoolSize(ctx context.Context, args []string) (Result, error) {
+	pr, ok := e.currentEngine(ctx).(poolResizer)
+	if !ok {
+		return Result{}, ErrNotSupported
+	}
+	size, err := strconv.Atoi(args[0])
+	if err != nil || size <= 0 {
+		return Result{}, ErrInvalidCommandSyntax
+	}
+	if err := pr.ResizePool(ctx, size); err != nil {
+		return Result{}, err
+	}
+	return okResult(0), nil
+}
+
+// cmdSave пишет снимок во временный файл и переименовывает его, чтобы не испортить прежний снимок при сбое.
+func (e *kvExecutor) cmdSave(ctx context.Context, args []string) (Result, error) {
+	ss, ok := e.currentEngine(ctx).(snapshotter)
+	if !ok {
+		return Result{}, ErrNotSupported
+	}
+	path, err := e.snapshotPath(args[0])
+	if err != nil {
+		return Result{}, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := ss.Dump(tmp); err != nil {
+		tmp.Close()
+		return Result{}, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return Result{}, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return Result{}, fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	return okResult(0), nil
+}
+
+// snapshotPath проверяет путь файла снимка и разрешает его относительно каталога снимков, если он задан.
+func (e *kvExecutor) snapshotPath(path string) (string, error) {
+	if e.snapshotDir == "" {
+		return path, nil
+	}
+	if !filepath.IsLocal(path) {
+		return "", fmt.Errorf("%w: %s", ErrPathNotAllowed, path)
+	}
+	return filepath.Join(e.snapshotDir, path), nil
+}
+
+func (e *kvExecutor) cmdLoad(ctx context.Context, args []string) (Result, error) {
+	ss, ok := e.currentEngine(ctx).(snapshotter)
+	if !ok {
+		return Result{}, ErrNotSupported
+	}
+	path, err := e.snapshotPath(args[0])
+	if err != nil {
+		return Result{}, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer f.Close()
+
+	if err := ss.Load(f); err != nil {
+		return Result{}, err
+	}
+	return okResult(0), nil
+}
+
+// cmdPersistTest — с аргументом noflush проверяется текущее содержимое диска без сброса.
+func (e *kvExecutor) cmdPersistTest(ctx context.Context, args []string) (Result, error) {
+	if len(args) == 2 && args[1] != "noflush" {
+		return Result{}, ErrInvalidCommandSyntax
+	}
+	pt, ok := e.currentEngine(ctx).(persistenceTester)
+	if !ok {
+		return Result{}, ErrNotSupported
+	}
+	match, err := pt.PersistTest(ctx, []byte(args[0]), len(args) == 1)
+	if err != nil {
+		return Result{}, err
+	}
+	if match {
+		return valueResult("match"), nil
+	}
+	return valueResult("mismatch"), nil
+}
+
+func (e *kvExecutor) cmdSlowLog(ctx context.Context, args []string) (Result, error) {
+	switch args[0] {
+	case "get":
+		return RowsResult(slowLogRows(e.slowLog.get())), nil
+	case "reset":
+		e.slowLog.reset()
+		return okResult(0), nil
+	default:
+		return Result{}, ErrInvalidCommandSyntax
+	}
+}
+
+// cmdCommands выводит команды строками: имя, наибольшее количество аргументов, категория.
+func (e *kvExecutor) cmdCommands(ctx context.Context, args []string) (Result, error) {
+	rows := make([][]string, 0, len(e.registry.order))
+	for _, cmd := range e.registry.order {
+		rows = append(rows, []string{cmd.name, strconv.Itoa(cmd.args.Max), string(cmd.category)})
+	}
+	return RowsResult(rows), nil
+}
+
+func (e *kvExecutor) cmdHelp(ctx context.Context, args []string) (Result, error) {
+	rows := make([][]string, 0, len(e.registry.order))
+	for _, cmd := range e.registry.order {
+		rows = append(rows, HelpRow(cmd.usage, cmd.summary))
+	}
+	return RowsResult(rows), nil
+}
+
+func (e *kvExecutor) cmdVersion(ctx context.Context, args []string) (Result, error) {
+	info := e.buildInfo
+	return valueResult(fmt.Sprintf("version=%s page_size=%d engine=%s", info.Version, info.PageSize, info.Engine)), nil
+}
+
+// cmdEngineOp оборачивает операцию переключения движка (форк или транзакция) в обработчик команды.
+func (e *kvExecutor) cmdEngineOp(op func(ctx context.Context) error) CommandHandler {
+	return func(ctx context.Context, args []string) (Result, error) {
+		if err := op(ctx); err != nil {
+			return Result{}, err
+		}
+		return okResult(0), nil
+	}
+}
+
+// HelpRow форматирует строку справки: синтаксис команды и ее описание.
+func HelpRow(usage, summary string) []string {
+	return []string{fmt.Sprintf("%-34s %s", usage, summary)}
+}
@@ -2,16 +2,137 @@ package executor
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 )
 
-type Result struct { 
-	Text string 
+// ResultKind — тип результата команды, определяющий, какие поля Result заполнены.
+type ResultKind int
+
+const (
+	ResultOK    ResultKind = iota // Команда выполнена, Text == "OK"
+	ResultValue                   // Text содержит значение
+	ResultRows                    // Rows содержит строки таблицы, Text — их текстовое представление
+	ResultError                   // Text содержит описание ошибки, для протоколов с типизированными ответами
+)
+
+func (k ResultKind) String() string {
+	switch k {
+	case ResultOK:
+		return "ok"
+	case ResultValue:
+		return "value"
+	case ResultRows:
+		return "rows"
+	case ResultError:
+		return "error"
+	default:
+		return fmt.Sprintf("ResultKind(%d)", int(k))
+	}
+}
+
+type Result struct {
+	Kind          ResultKind
+	Text          string
+	Rows          [][]string
+	AffectedCount int    // Количество измененных ключей для пишущих команд
+	Command       string // Имя команды в нижнем регистре, заполняется исполнителем и при ошибке
+}
+
+// ErrorResult представляет ошибку команды результатом вида ResultError.
+func ErrorResult(command string, err error) Result {
+	return Result{Kind: ResultError, Text: err.Error(), Command: command}
+}
+
+// resultJSON — представление Result в JSON: заполнено только поле, соответствующее виду результата.
+type resultJSON struct {
+	Command  string      `json:"command,omitempty"`
+	Kind     string      `json:"kind"`
+	Value    *string     `json:"value,omitempty"`
+	Rows     *[][]string `json:"rows,omitempty"`
+	Affected int         `json:"affected,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// MarshalJSON кодирует результат объектом с полями command и kind и полем с данными результата:
+// value для ResultValue, rows для ResultRows, affected для ResultOK и error для ResultError.
+func (r Result) MarshalJSON() ([]byte, error) {
+	res := resultJSON{Command: r.Command, Kind: r.Kind.String()}
+	switch r.Kind {
+	case ResultOK:
+		res.Affected = r.AffectedCount
+	case ResultValue:
+		res.Value = &r.Text
+	case ResultRows:
+		// Пустая таблица кодируется как [], а не пропускается
+		rows := r.Rows
+		if rows == nil {
+			rows = [][]string{}
+		}
+		res.Rows = &rows
+	case ResultError:
+		res.Error = r.Text
+	}
+	return json.Marshal(res)
+}
+
+// Render возвращает текстовое представление результата для вывода пользователю.
+// Строки таблицы выводятся построчно, ячейки разделяются пробелом.
+func (r Result) Render() string {
+	if r.Kind != ResultRows {
+		return r.Text
+	}
+	return renderRows(r.Rows)
+}
+
+func renderRows(rows [][]string) string {
+	if len(rows) == 0 {
+		return "(empty)"
+	}
+
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		lines = append(lines, strings.Join(row, " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func okResult(affected int) Result {
+	return Result{Kind: ResultOK, Text: "OK", AffectedCount: affected}
+}
+
+func valueResult(text string) Result {
+	return Result{Kind: ResultValue, Text: text}
+}
+
+// RowsResult возвращает результат вида ResultRows. Text заполняется текстовым представлением строк
+// для потребителей, которые читают только Text.
+func RowsResult(rows [][]string) Result {
+	return Result{Kind: ResultRows, Rows: rows, Text: renderRows(rows)}
 }
 
 var ErrInvalidCommandSyntax = errors.New("invalid command syntax")
 var ErrUnknownCommand = errors.New("unknown command")
+var ErrNotSupported = errors.New("command is not supported by the engine")
+var ErrCommandTimeout = errors.New("command timed out")
+var ErrOutcomeUnknown = errors.New("outcome is unknown, the command may still be applied")
+var ErrPathNotAllowed = errors.New("path is outside the snapshot directory")
 
 type Executor interface {
 	Execute(ctx context.Context, cmd string) (Result, error)
-}
\ No newline at end of file
+}
+
+// Session — исполнитель команд одного клиента со своими транзакцией и форком.
+// Когда клиент завершает работу, сессию нужно закрыть.
+type Session interface {
+	Executor
+	Close()
+}
+
+// SessionExecutor — исполнитель, который может выделить каждому клиенту отдельную сессию.
+type SessionExecutor interface {
+	Executor
+	NewSession() Session
+}
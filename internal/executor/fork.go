@@ -0,0 +1,78 @@
+package executor
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Argentum88/godb/internal/storage"
+)
+
+var ErrAlreadyForked = errors.New("engine is already forked")
+var ErrNotForked = errors.New("engine is not forked")
+
+// forkableEngine реализуется движками, поддерживающими работу с копией для экспериментов.
+type forkableEngine interface {
+	Fork() storage.Engine
+	Merge(fork storage.Engine) error
+}
+
+// currentEngine возвращает движок, к которому сейчас применяются команды сессии ctx:
+// активная транзакция, форк или исходный.
+func (e *kvExecutor) currentEngine(ctx context.Context) storage.Engine {
+	s := e.session(ctx)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.txn != nil {
+		return s.txn
+	}
+	return s.engine
+}
+
+// fork переключает сессию на копию движка.
+func (e *kvExecutor) fork(ctx context.Context) error {
+	s := e.session(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.base != nil {
+		return ErrAlreadyForked
+	}
+	if s.txn != nil {
+		return ErrTxnActive
+	}
+	fe, ok := s.engine.(forkableEngine)
+	if !ok {
+		return ErrNotSupported
+	}
+	s.base = s.engine
+	s.engine = fe.Fork()
+	return nil
+}
+
+// merge применяет изменения форка сессии к исходному движку и возвращает сессию к нему.
+func (e *kvExecutor) merge(ctx context.Context) error {
+	s := e.session(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.base == nil {
+		return ErrNotForked
+	}
+	if err := s.base.(forkableEngine).Merge(s.engine); err != nil {
+		return err
+	}
+	s.engine = s.base
+	s.base = nil
+	return nil
+}
+
+// discard отбрасывает форк сессии и возвращает ее к исходному движку.
+func (e *kvExecutor) discard(ctx context.Context) error {
+	s := e.session(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.base == nil {
+		return ErrNotForked
+	}
+	s.engine = s.base
+	s.base = nil
+	return nil
+}
@@ -2,47 +2,302 @@ package executor
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"strings"
+	"time"
 
+	"github.com/Argentum88/godb/internal/clock"
 	"github.com/Argentum88/godb/internal/storage"
+	"github.com/Argentum88/godb/internal/storage/page"
+	"github.com/Argentum88/godb/internal/txn"
 )
 
+// residencySource реализуется движками, работающими через буферный пул.
+type residencySource interface {
+	Residency(startPage, endPage page.PageID) []bool
+}
+
+// absentValue обозначает отсутствующий ключ: ожидаемое значение в cas и пропущенный ключ в выводе mget.
+const absentValue = "(nil)"
+
+// defaultKeysLimit — сколько ключей по умолчанию выводит команда keys
+const defaultKeysLimit = 1000
+
+// cacheMapMaxPages ограничивает диапазон страниц команды cachemap
+const cacheMapMaxPages = 1 << 16
+
+// poolResizer реализуется движками, размер буферного пула которых можно менять на лету.
+type poolResizer interface {
+	ResizePool(ctx context.Context, newSize int) error
+}
+
+// persistenceTester реализуется движками, умеющими сверить значение ключа с его копией на диске.
+type persistenceTester interface {
+	PersistTest(ctx context.Context, key []byte, flush bool) (bool, error)
+}
+
+// pageDumper реализуется движками, умеющими вывести содержимое страницы с диска для отладки.
+type pageDumper interface {
+	DumpPage(ctx context.Context, pageID page.PageID) (string, error)
+}
+
+// snapshotter реализуется движками, умеющими сохранить все данные в поток и заменить их данными из потока.
+type snapshotter interface {
+	Dump(w io.Writer) error
+	Load(r io.Reader) error
+}
+
+// storageInspector реализуется дисковыми движками, сообщающими размер базы и состояние буферного пула.
+type storageInspector interface {
+	StorageInfo(ctx context.Context) (storage.StorageInfo, error)
+}
+
+// statsSource реализуется движками, сообщающими свои метрики в виде пар имя-значение.
+type statsSource interface {
+	Stats() map[string]string
+}
+
+// versionedEngine реализуется движками, хранящими версию последней записи каждого ключа.
+type versionedEngine interface {
+	GetVersioned(key []byte) ([]byte, uint64, error)
+	SetIfVersion(key, value []byte, expected uint64) (bool, error)
+}
+
+// closer реализуется движками, которые нужно закрыть при завершении работы.
+type closer interface {
+	Close(ctx context.Context) error
+}
+
 type kvExecutor struct {
-	engine storage.Engine
+	engine         storage.Engine
+	txns           *txn.TransactionManager
+	defaultSession *session // Сессия команд, выполняемых напрямую, а не через NewSession
+	slowLog        *slowLog
+	buildInfo      BuildInfo
+	keysLimit      int // Наибольшее количество ключей в выводе keys, 0 — без ограничения
+	registry       *registry
+	clock          clock.Clock   // Часы для замера длительности команд в журнале медленных команд
+	timeout        time.Duration // Наибольшее время выполнения команды, 0 — без ограничения
+	readOnly       bool          // Отклонять команды, изменяющие данные
+	snapshotDir    string        // Каталог, которым ограничены пути save и load, пусто — без ограничения
+}
+
+// BuildInfo — сведения о сборке и конфигурации сервера, которые выводит команда version.
+type BuildInfo struct {
+	Version  string
+	PageSize int
+	Engine   string
+}
+
+// Option настраивает kvExecutor при создании.
+type Option func(e *kvExecutor)
+
+// WithSlowLog задает порог, начиная с которого команда попадает в журнал медленных команд,
+// и максимальное количество хранимых записей.
+func WithSlowLog(threshold time.Duration, capacity int) Option {
+	return func(e *kvExecutor) {
+		e.slowLog = newSlowLog(threshold, capacity)
+	}
 }
 
-func NewKVExecutor(engine storage.Engine) *kvExecutor {
-	return &kvExecutor{engine: engine}
+// WithBuildInfo задает сведения, которые выводит команда version.
+func WithBuildInfo(info BuildInfo) Option {
+	return func(e *kvExecutor) {
+		e.buildInfo = info
+	}
 }
 
-func(e *kvExecutor) Execute(ctx context.Context, cmd string) (Result, error) {
-	fields := strings.Fields(cmd)
+// WithKeysLimit ограничивает вывод команды keys n ключами. Ноль снимает ограничение.
+func WithKeysLimit(n int) Option {
+	return func(e *kvExecutor) {
+		e.keysLimit = n
+	}
+}
+
+// WithClock задает часы, по которым замеряется длительность команд. По умолчанию используются системные часы.
+func WithClock(c clock.Clock) Option {
+	return func(e *kvExecutor) {
+		e.clock = c
+	}
+}
+
+// WithCommandTimeout ограничивает время выполнения одной команды. Ноль снимает ограничение.
+// Команда, не уложившаяся в срок, завершается с ErrCommandTimeout.
+func WithCommandTimeout(d time.Duration) Option {
+	return func(e *kvExecutor) {
+		e.timeout = d
+	}
+}
+
+// WithReadOnly отклоняет команды категории write, включая транзакции, load и merge,
+// с ошибкой storage.ErrReadOnly до обращения к движку.
+func WithReadOnly() Option {
+	return func(e *kvExecutor) {
+		e.readOnly = true
+	}
+}
+
+// WithSnapshotDir ограничивает пути команд save и load каталогом dir: путь должен быть относительным,
+// не выходить за пределы каталога через ".." и отсчитывается от dir. Без этой настройки save и load
+// принимают любой путь, что допустимо для локальной оболочки, но не для сервера.
+func WithSnapshotDir(dir string) Option {
+	return func(e *kvExecutor) {
+		e.snapshotDir = dir
+	}
+}
+
+func NewKVExecutor(engine storage.Engine, opts ...Option) *kvExecutor {
+	e := &kvExecutor{
+		engine:         engine,
+		txns:           txn.NewTransactionManager(engine),
+		defaultSession: newSession(engine),
+		slowLog:        newSlowLog(defaultSlowLogThreshold, defaultSlowLogCapacity),
+		keysLimit:      defaultKeysLimit,
+		buildInfo: BuildInfo{
+			Version:  "dev",
+			PageSize: page.DefaultPageSize,
+			Engine:   "unknown",
+		},
+		registry: newRegistry(),
+		clock:    clock.Real(),
+	}
+	e.registerBuiltins()
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+func (e *kvExecutor) Execute(ctx context.Context, cmd string) (Result, error) {
+	startedAt := e.clock.Now()
+	var (
+		result Result
+		err    error
+	)
+	if e.timeout > 0 {
+		result, err = e.executeWithTimeout(ctx, cmd)
+	} else {
+		result, err = e.execute(ctx, cmd)
+	}
+	e.slowLog.record(cmd, startedAt, e.clock.Now().Sub(startedAt))
+	return result, err
+}
+
+// executeWithTimeout выполняет команду в отдельной горутине и перестает ее ждать по истечении timeout
+// или отмене ctx. Контекст принимают только Set и Get движка, да и те проверяют его лишь до начала
+// операции, поэтому брошенная команда может доработать в фоне, а ее результат будет отброшен.
+// Поэтому ошибка брошенной команды, кроме причины, содержит ErrOutcomeUnknown: запись могла примениться.
+// Пока брошенная команда не завершилась, следующие команды ее сессии ждут, укладываясь в свой timeout:
+// иначе, например, запоздавший begin изменил бы состояние сессии параллельно с ее новой командой.
+// Не дождавшаяся своей очереди команда не выполняется вовсе, и ErrOutcomeUnknown ее ошибка не содержит.
+func (e *kvExecutor) executeWithTimeout(ctx context.Context, cmd string) (Result, error) {
+	ctx, cancel := context.WithTimeoutCause(ctx, e.timeout, fmt.Errorf("%w after %s", ErrCommandTimeout, e.timeout))
+	defer cancel()
+
+	s := e.session(ctx)
+	select {
+	case s.busy <- struct{}{}:
+	case <-ctx.Done():
+		return Result{}, fmt.Errorf("%w: previous command of the session is still running", context.Cause(ctx))
+	}
+
+	type outcome struct {
+		result Result
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() { <-s.busy }()
+		result, err := e.execute(ctx, cmd)
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-ctx.Done():
+		return Result{}, fmt.Errorf("%w: %w", context.Cause(ctx), ErrOutcomeUnknown)
+	}
+}
+
+func (e *kvExecutor) execute(ctx context.Context, cmd string) (Result, error) {
+	fields, err := tokenize(cmd)
+	if err != nil {
+		return Result{}, err
+	}
 	if len(fields) == 0 {
 		return Result{}, ErrInvalidCommandSyntax
 	}
-	op := fields[0]
-	switch op {
-		case "set":
-			if len(fields) != 3 {
-				return Result{}, ErrInvalidCommandSyntax
-			}
-			key := []byte(fields[1])
-			value := []byte(fields[2])
-			if err := e.engine.Set(key, value); err != nil {
-				return Result{}, err
-			}
-			return Result{Text: "OK"}, nil
-		case "get":
-			if len(fields) != 2 {
-				return Result{}, ErrInvalidCommandSyntax
-			}
-			key := []byte(fields[1])
-			value, err := e.engine.Get(key)
-			if err != nil {
-				return Result{}, err
-			}
-			return Result{Text: string(value)}, nil
-		default:
-			return Result{}, ErrUnknownCommand
+	// Регистр важен для ключей и значений, но не для имени команды
+	name := strings.ToLower(fields[0])
+	if e.readOnly && e.registry.mutating(name) {
+		return Result{Command: name}, fmt.Errorf("%w: %s", storage.ErrReadOnly, name)
+	}
+	result, err := e.registry.dispatch(ctx, name, fields[1:])
+	result.Command = name
+	return result, err
+}
+
+// Sync сбрасывает состояние движка на диск, если движок это поддерживает.
+// Форки сессий не сбрасываются, только исходный движок.
+func (e *kvExecutor) Sync(ctx context.Context) error {
+	sc, ok := e.engine.(interface {
+		Sync(ctx context.Context) error
+	})
+	if !ok {
+		return nil
+	}
+	return sc.Sync(ctx)
+}
+
+// Close отбрасывает активные транзакцию и форк исполнителя и закрывает исходный движок,
+// если движок это поддерживает. Сессии, созданные NewSession, нужно закрыть раньше.
+// После Close исполнитель использовать нельзя.
+func (e *kvExecutor) Close(ctx context.Context) error {
+	e.endSession(e.defaultSession)
+
+	c, ok := e.engine.(closer)
+	if !ok {
+		return nil
+	}
+	return c.Close(ctx)
+}
+
+// formatResidency сворачивает флаги присутствия страниц в пуле в серии вида "0-3 resident, 4 absent".
+func formatResidency(startPage page.PageID, resident []bool) string {
+	if len(resident) == 0 {
+		return "empty range"
+	}
+
+	var runs []string
+	runStart := 0
+	for i := 1; i <= len(resident); i++ {
+		if i < len(resident) && resident[i] == resident[runStart] {
+			continue
+		}
+
+		state := "absent"
+		if resident[runStart] {
+			state = "resident"
+		}
+		first := startPage + page.PageID(runStart)
+		last := startPage + page.PageID(i-1)
+		if first == last {
+			runs = append(runs, fmt.Sprintf("%d %s", first, state))
+		} else {
+			runs = append(runs, fmt.Sprintf("%d-%d %s", first, last, state))
+		}
+		runStart = i
+	}
+	return strings.Join(runs, ", ")
+}
+
+// slowLogRows представляет записи журнала медленных команд строками: время, длительность, команда.
+func slowLogRows(entries []SlowLogEntry) [][]string {
+	rows := make([][]string, 0, len(entries))
+	for _, entry := range entries {
+		rows = append(rows, []string{entry.Timestamp.Format(time.RFC3339Nano), entry.Duration.String(), entry.Command})
 	}
+	return rows
 }
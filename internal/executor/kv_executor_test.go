@@ -0,0 +1,1349 @@
+package executor
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Argentum88/godb/internal/clock"
+	"github.com/Argentum88/godb/internal/storage"
+	"github.com/Argentum88/godb/internal/storage/page"
+	"github.com/Argentum88/godb/internal/txn"
+)
+
+// pooledEngine — движок в памяти, сообщающий фиксированную карту присутствия страниц в пуле
+type pooledEngine struct {
+	storage.Engine
+	resident map[page.PageID]bool
+}
+
+func (e *pooledEngine) Residency(startPage, endPage page.PageID) []bool {
+	var res []bool
+	for pageID := startPage; pageID < endPage; pageID++ {
+		res = append(res, e.resident[pageID])
+	}
+	return res
+}
+
+func Test_kvExecutor_cachemap(t *testing.T) {
+	t.Parallel()
+	engine := &pooledEngine{
+		Engine:   storage.NewInMemoryKVEngine(),
+		resident: map[page.PageID]bool{2: true, 3: true, 4: true, 6: true},
+	}
+	exec := NewKVExecutor(engine)
+
+	result, err := exec.Execute(context.Background(), "cachemap 0 8")
+	if err != nil {
+		t.Fatalf("cachemap failed: %v", err)
+	}
+	want := "0-1 absent, 2-4 resident, 5 absent, 6 resident, 7 absent"
+	if result.Text != want {
+		t.Fatalf("expected %q, got %q", want, result.Text)
+	}
+}
+
+// sizedPooledEngine — pooledEngine, сообщающий количество страниц файла
+type sizedPooledEngine struct {
+	pooledEngine
+	pageCount uint64
+}
+
+func (e *sizedPooledEngine) StorageInfo(ctx context.Context) (storage.StorageInfo, error) {
+	return storage.StorageInfo{PageCount: e.pageCount}, nil
+}
+
+func Test_kvExecutor_cachemap_bounds(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	resident := map[page.PageID]bool{1: true}
+	exec := NewKVExecutor(&pooledEngine{Engine: storage.NewInMemoryKVEngine(), resident: resident})
+
+	for _, cmd := range []string{
+		"cachemap 5 4",
+		"cachemap 0 18446744073709551615",
+		fmt.Sprintf("cachemap 10 %d", 10+cacheMapMaxPages+1),
+	} {
+		if _, err := exec.Execute(ctx, cmd); !errors.Is(err, ErrInvalidCommandSyntax) {
+			t.Fatalf("%q: expected %v, got %v", cmd, ErrInvalidCommandSyntax, err)
+		}
+	}
+	result, err := exec.Execute(ctx, "cachemap 3 3")
+	if err != nil || result.Text != "empty range" {
+		t.Fatalf("expected empty range, got %q, %v", result.Text, err)
+	}
+
+	// Конец диапазона обрезается по количеству страниц файла
+	sized := NewKVExecutor(&sizedPooledEngine{
+		pooledEngine: pooledEngine{Engine: storage.NewInMemoryKVEngine(), resident: resident},
+		pageCount:    3,
+	})
+	result, err = sized.Execute(ctx, "cachemap 0 18446744073709551615")
+	if want := "0 absent, 1 resident, 2 absent"; err != nil || result.Text != want {
+		t.Fatalf("expected %q, got %q, %v", want, result.Text, err)
+	}
+	result, err = sized.Execute(ctx, "cachemap 5 18446744073709551615")
+	if err != nil || result.Text != "empty range" {
+		t.Fatalf("expected empty range past the end of file, got %q, %v", result.Text, err)
+	}
+}
+
+func Test_kvExecutor_cachemap_notSupported(t *testing.T) {
+	t.Parallel()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+
+	_, err := exec.Execute(context.Background(), "cachemap 0 8")
+	if !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected %v, got %v", ErrNotSupported, err)
+	}
+}
+
+// slowEngine — движок в памяти, у которого Get выполняется не быстрее delay
+type slowEngine struct {
+	storage.Engine
+	delay time.Duration
+}
+
+func (e *slowEngine) Get(ctx context.Context, key []byte) ([]byte, error) {
+	time.Sleep(e.delay)
+	return e.Engine.Get(ctx, key)
+}
+
+func Test_kvExecutor_slowlog(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := &slowEngine{Engine: storage.NewInMemoryKVEngine(), delay: 20 * time.Millisecond}
+	exec := NewKVExecutor(engine, WithSlowLog(10*time.Millisecond, 4))
+
+	if _, err := exec.Execute(ctx, "set fast 1"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if _, err := exec.Execute(ctx, "get fast"); err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+
+	entries := exec.slowLog.get()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 slowlog entry, got %d: %v", len(entries), entries)
+	}
+	if entries[0].Command != "get fast" || entries[0].Duration < engine.delay {
+		t.Fatalf("unexpected slowlog entry: %+v", entries[0])
+	}
+
+	result, err := exec.Execute(ctx, "slowlog get")
+	if err != nil {
+		t.Fatalf("slowlog get failed: %v", err)
+	}
+	if result.Kind != ResultRows || len(result.Rows) != 1 || result.Rows[0][2] != "get fast" {
+		t.Fatalf("expected single slowlog row for %q, got %+v", "get fast", result)
+	}
+
+	if _, err := exec.Execute(ctx, "slowlog reset"); err != nil {
+		t.Fatalf("slowlog reset failed: %v", err)
+	}
+	result, err = exec.Execute(ctx, "slowlog get")
+	if err != nil {
+		t.Fatalf("slowlog get failed: %v", err)
+	}
+	if len(result.Rows) != 0 || result.Render() != "(empty)" {
+		t.Fatalf("expected empty slowlog after reset, got %+v", result)
+	}
+}
+
+func Test_kvExecutor_slowlogClock(t *testing.T) {
+	t.Parallel()
+	clk := clock.NewManual(time.Unix(1000, 0))
+	engine := &clockedEngine{Engine: storage.NewInMemoryKVEngine(), clock: clk, delay: time.Second}
+	exec := NewKVExecutor(engine, WithSlowLog(time.Second, 4), WithClock(clk))
+
+	exec.Execute(context.Background(), "get k")
+	entries := exec.slowLog.get()
+	if len(entries) != 1 || entries[0].Duration != time.Second || !entries[0].Timestamp.Equal(time.Unix(1000, 0)) {
+		t.Fatalf("expected slowlog entry timed by the manual clock, got %+v", entries)
+	}
+}
+
+// clockedEngine переводит часы вперед при каждом Get вместо реального ожидания
+type clockedEngine struct {
+	storage.Engine
+	clock *clock.ManualClock
+	delay time.Duration
+}
+
+func (e *clockedEngine) Get(ctx context.Context, key []byte) ([]byte, error) {
+	e.clock.Advance(e.delay)
+	return e.Engine.Get(ctx, key)
+}
+
+// blockingEngine не завершает Get, пока не закрыт release
+type blockingEngine struct {
+	storage.Engine
+	release chan struct{}
+}
+
+func (e *blockingEngine) Get(ctx context.Context, key []byte) ([]byte, error) {
+	<-e.release
+	return e.Engine.Get(ctx, key)
+}
+
+func Test_kvExecutor_canceledContext(t *testing.T) {
+	t.Parallel()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, cmd := range []string{"set k v", "get k"} {
+		if _, err := exec.Execute(ctx, cmd); !errors.Is(err, context.Canceled) {
+			t.Fatalf("%q: expected %v, got %v", cmd, context.Canceled, err)
+		}
+	}
+}
+
+func Test_kvExecutor_commandTimeout(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := &blockingEngine{Engine: storage.NewInMemoryKVEngine(), release: make(chan struct{})}
+	defer close(engine.release)
+	exec := NewKVExecutor(engine, WithCommandTimeout(20*time.Millisecond))
+
+	if _, err := exec.Execute(ctx, "set k v"); err != nil {
+		t.Fatalf("expected a fast command to finish within the timeout, got %v", err)
+	}
+	_, err := exec.Execute(ctx, "get k")
+	if !errors.Is(err, ErrCommandTimeout) {
+		t.Fatalf("expected %v for a blocked command, got %v", ErrCommandTimeout, err)
+	}
+	// Брошенная команда может доработать в фоне, поэтому ошибка не утверждает, что она не выполнена
+	if !errors.Is(err, ErrOutcomeUnknown) {
+		t.Fatalf("expected %v for a blocked command, got %v", ErrOutcomeUnknown, err)
+	}
+
+	// Отмена ctx вызывающим — не таймаут команды
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := exec.Execute(canceled, "get k"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v for a canceled context, got %v", context.Canceled, err)
+	}
+}
+
+func Test_kvExecutor_commandTimeoutSerializesSession(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := &blockingEngine{Engine: storage.NewInMemoryKVEngine(), release: make(chan struct{})}
+	exec := NewKVExecutor(engine, WithCommandTimeout(20*time.Millisecond))
+	session := exec.NewSession()
+	defer session.Close()
+
+	if _, err := session.Execute(ctx, "set k v"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if _, err := session.Execute(ctx, "get k"); !errors.Is(err, ErrOutcomeUnknown) {
+		t.Fatalf("expected %v for a blocked command, got %v", ErrOutcomeUnknown, err)
+	}
+
+	// Пока брошенная команда работает, следующая команда сессии не выполняется параллельно с ней
+	_, err := session.Execute(ctx, "set k other")
+	if !errors.Is(err, ErrCommandTimeout) || errors.Is(err, ErrOutcomeUnknown) {
+		t.Fatalf("expected %v without %v while the session is busy, got %v", ErrCommandTimeout, ErrOutcomeUnknown, err)
+	}
+	// Другие сессии брошенная команда не задерживает
+	other := exec.NewSession()
+	defer other.Close()
+	if _, err := other.Execute(ctx, "set x 1"); err != nil {
+		t.Fatalf("expected another session to run, got %v", err)
+	}
+
+	close(engine.release)
+	deadline := time.Now().Add(time.Second)
+	for {
+		result, err := session.Execute(ctx, "get k")
+		if err == nil {
+			if result.Text != "v" {
+				t.Fatalf("expected the command rejected while busy not to run, got %q", result.Text)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the session to accept commands after the abandoned one finished, got %v", err)
+		}
+	}
+}
+
+func Test_metricsExecutor(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	exec := WithMetrics(NewKVExecutor(storage.NewInMemoryKVEngine()))
+
+	for _, cmd := range []string{"set foo bar", "SET baz qux", "get foo", "get missing", "bogus", "  get   foo"} {
+		exec.Execute(ctx, cmd)
+	}
+
+	metrics := exec.Metrics()
+	wantCounts := map[string]int{"set": 2, "get": 3, "bogus": 1}
+	if len(metrics) != len(wantCounts) {
+		t.Fatalf("expected metrics for %d commands, got %v", len(wantCounts), metrics)
+	}
+	for name, want := range wantCounts {
+		m, ok := metrics[name]
+		if !ok {
+			t.Fatalf("expected metrics for %q, got %v", name, metrics)
+		}
+		if m.Count != want {
+			t.Fatalf("%q: expected count %d, got %d", name, want, m.Count)
+		}
+		if m.Total < 0 || m.Max < 0 || m.Max > m.Total {
+			t.Fatalf("%q: expected non-negative latencies with max within total, got total %v max %v", name, m.Total, m.Max)
+		}
+		if len(m.Buckets) != len(LatencyBuckets)+1 {
+			t.Fatalf("%q: expected %d buckets, got %d", name, len(LatencyBuckets)+1, len(m.Buckets))
+		}
+		bucketed := 0
+		for _, n := range m.Buckets {
+			bucketed += n
+		}
+		if bucketed != want {
+			t.Fatalf("%q: expected %d executions across buckets, got %d", name, want, bucketed)
+		}
+	}
+
+	// Снимок не меняется от последующих команд
+	exec.Execute(ctx, "get foo")
+	if metrics["get"].Count != 3 || exec.Metrics()["get"].Count != 4 {
+		t.Fatalf("expected snapshot to stay at 3 and live metrics to reach 4, got %d and %d", metrics["get"].Count, exec.Metrics()["get"].Count)
+	}
+}
+
+// closingExecutor считает вызовы Sync и Close.
+type closingExecutor struct {
+	syncs, closes int
+}
+
+func (e *closingExecutor) Execute(ctx context.Context, cmd string) (Result, error) {
+	return valueResult("OK"), nil
+}
+
+func (e *closingExecutor) Sync(ctx context.Context) error {
+	e.syncs++
+	return nil
+}
+
+func (e *closingExecutor) Close(ctx context.Context) error {
+	e.closes++
+	return nil
+}
+
+func Test_metricsExecutor_forwards(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	// Обертка над исполнителем с сессиями выдает отдельные сессии и замеряет их команды
+	exec := WithMetrics(NewKVExecutor(storage.NewInMemoryKVEngine()))
+	se, ok := exec.(SessionExecutor)
+	if !ok {
+		t.Fatalf("expected metrics over a session executor to be a SessionExecutor")
+	}
+	a, b := se.NewSession(), se.NewSession()
+	defer a.Close()
+	defer b.Close()
+	if _, err := a.Execute(ctx, "begin"); err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+	if _, err := a.Execute(ctx, "set x 1"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if _, err := b.Execute(ctx, "get x"); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected the other session not to see the transaction, got %v", err)
+	}
+	if got := exec.Metrics(); got["begin"].Count != 1 || got["set"].Count != 1 || got["get"].Count != 1 {
+		t.Fatalf("expected session commands in metrics, got %v", got)
+	}
+
+	// Sync и Close доходят до исполнителя, который их поддерживает
+	inner := &closingExecutor{}
+	wrapped := WithMetrics(inner)
+	if _, ok := wrapped.(SessionExecutor); ok {
+		t.Fatalf("expected metrics over a plain executor not to be a SessionExecutor")
+	}
+	closer, ok := wrapped.(interface {
+		Sync(ctx context.Context) error
+		Close(ctx context.Context) error
+	})
+	if !ok {
+		t.Fatalf("expected metrics executor to expose Sync and Close")
+	}
+	if err := closer.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if err := closer.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if inner.syncs != 1 || inner.closes != 1 {
+		t.Fatalf("expected one Sync and one Close forwarded, got %d and %d", inner.syncs, inner.closes)
+	}
+}
+
+func Test_slowLog_ringBuffer(t *testing.T) {
+	t.Parallel()
+	l := newSlowLog(0, 2)
+	now := time.Now()
+	l.record("first", now, time.Second)
+	l.record("second", now, time.Second)
+	l.record("third", now, time.Second)
+
+	entries := l.get()
+	if len(entries) != 2 || entries[0].Command != "third" || entries[1].Command != "second" {
+		t.Fatalf("expected [third second], got %+v", entries)
+	}
+}
+
+func Test_kvExecutor_commands(t *testing.T) {
+	t.Parallel()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+
+	result, err := exec.Execute(context.Background(), "commands")
+	if err != nil {
+		t.Fatalf("commands failed: %v", err)
+	}
+
+	lines := strings.Split(result.Render(), "\n")
+	for _, want := range []string{"get 1 read", "set 2 write"} {
+		if !slices.Contains(lines, want) {
+			t.Fatalf("expected commands listing to contain %q, got:\n%s", want, result.Render())
+		}
+	}
+}
+
+func Test_kvExecutor_version(t *testing.T) {
+	t.Parallel()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine(), WithBuildInfo(BuildInfo{
+		Version:  "v1.2.3",
+		PageSize: 8192,
+		Engine:   "in-memory",
+	}))
+
+	result, err := exec.Execute(context.Background(), "version")
+	if err != nil {
+		t.Fatalf("version failed: %v", err)
+	}
+	for _, want := range []string{"version=v1.2.3", "page_size=8192", "engine=in-memory"} {
+		if !strings.Contains(result.Text, want) {
+			t.Fatalf("expected version output to contain %q, got %q", want, result.Text)
+		}
+	}
+}
+
+func Test_kvExecutor_fork(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		finish   string
+		expected string
+	}{
+		{name: "discard leaves original unchanged", finish: "discard", expected: "original"},
+		{name: "merge applies fork changes", finish: "merge", expected: "forked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+
+			for _, cmd := range []string{"set key original", "fork", "set key forked"} {
+				if _, err := exec.Execute(ctx, cmd); err != nil {
+					t.Fatalf("%q failed: %v", cmd, err)
+				}
+			}
+			result, err := exec.Execute(ctx, "get key")
+			if err != nil || result.Text != "forked" {
+				t.Fatalf("expected fork to see %q, got %q (err %v)", "forked", result.Text, err)
+			}
+
+			if _, err := exec.Execute(ctx, tt.finish); err != nil {
+				t.Fatalf("%q failed: %v", tt.finish, err)
+			}
+			result, err = exec.Execute(ctx, "get key")
+			if err != nil || result.Text != tt.expected {
+				t.Fatalf("expected %q after %s, got %q (err %v)", tt.expected, tt.finish, result.Text, err)
+			}
+
+			if _, err := exec.Execute(ctx, tt.finish); !errors.Is(err, ErrNotForked) {
+				t.Fatalf("expected %v, got %v", ErrNotForked, err)
+			}
+		})
+	}
+}
+
+func Test_kvExecutor_txn(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+
+	steps := []struct {
+		cmd     string
+		want    string
+		wantErr error
+	}{
+		{cmd: "commit", wantErr: ErrNoTxn},
+		{cmd: "begin", want: "OK"},
+		{cmd: "begin", wantErr: ErrTxnActive},
+		{cmd: "fork", wantErr: ErrTxnActive},
+		{cmd: "set rolled back", want: "OK"},
+		{cmd: "get rolled", want: "back"},
+		{cmd: "rollback", want: "OK"},
+		{cmd: "get rolled", wantErr: storage.ErrKeyNotFound},
+		{cmd: "begin", want: "OK"},
+		{cmd: "mset a 1 b 2", want: "OK"},
+		// Проверка атомарных команд прошла бы по состоянию до Commit, поэтому в транзакции они запрещены
+		{cmd: "incr a", wantErr: txn.ErrAtomicInTxn},
+		{cmd: "setnx c 1", wantErr: txn.ErrAtomicInTxn},
+		{cmd: "cas a 1 3", wantErr: txn.ErrAtomicInTxn},
+		{cmd: "getset a 3", wantErr: txn.ErrAtomicInTxn},
+		{cmd: "append a 3", wantErr: txn.ErrAtomicInTxn},
+		{cmd: "set a 2", want: "OK"},
+		{cmd: "commit", want: "OK"},
+		{cmd: "mget a b c", want: "a 2\nb 2\nc (nil)"},
+		{cmd: "rollback", wantErr: ErrNoTxn},
+	}
+	for _, step := range steps {
+		result, err := exec.Execute(ctx, step.cmd)
+		if step.wantErr != nil {
+			if !errors.Is(err, step.wantErr) {
+				t.Fatalf("%q: expected %v, got %v", step.cmd, step.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q failed: %v", step.cmd, err)
+		}
+		if result.Render() != step.want {
+			t.Fatalf("%q: expected %q, got %q", step.cmd, step.want, result.Render())
+		}
+	}
+}
+
+func Test_kvExecutor_sessionClose(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+
+	session := exec.NewSession()
+	for _, cmd := range []string{"begin", "set pending 1"} {
+		if _, err := session.Execute(ctx, cmd); err != nil {
+			t.Fatalf("%q failed: %v", cmd, err)
+		}
+	}
+	// Транзакция сессии не видна исполнителю, а закрытие сессии ее откатывает
+	if _, err := exec.Execute(ctx, "begin"); err != nil {
+		t.Fatalf("expected executor to start its own transaction, got %v", err)
+	}
+	if _, err := exec.Execute(ctx, "rollback"); err != nil {
+		t.Fatalf("rollback failed: %v", err)
+	}
+	session.Close()
+	if _, err := exec.Execute(ctx, "get pending"); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected %v after session close, got %v", storage.ErrKeyNotFound, err)
+	}
+}
+
+func Test_kvExecutor_structuredResults(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+
+	tests := []struct {
+		cmd          string
+		wantKind     ResultKind
+		wantText     string
+		wantAffected int
+		wantRows     bool
+	}{
+		{cmd: "set foo bar", wantKind: ResultOK, wantText: "OK", wantAffected: 1},
+		{cmd: "get foo", wantKind: ResultValue, wantText: "bar"},
+		{cmd: "info prefix f", wantKind: ResultValue, wantText: "keys=1 bytes=3"},
+		{cmd: "version", wantKind: ResultValue, wantText: "version=dev page_size=4096 engine=unknown"},
+		{cmd: "slowlog reset", wantKind: ResultOK, wantText: "OK"},
+		{cmd: "commands", wantKind: ResultRows, wantRows: true},
+	}
+	for _, tt := range tests {
+		result, err := exec.Execute(ctx, tt.cmd)
+		if err != nil {
+			t.Fatalf("%q failed: %v", tt.cmd, err)
+		}
+		wantText := tt.wantText
+		if tt.wantRows {
+			// Для совместимости Text строк содержит их текстовое представление
+			wantText = result.Render()
+		}
+		if result.Kind != tt.wantKind || result.Text != wantText || result.AffectedCount != tt.wantAffected {
+			t.Fatalf("%q: expected kind=%d text=%q affected=%d, got %+v", tt.cmd, tt.wantKind, wantText, tt.wantAffected, result)
+		}
+		if (len(result.Rows) > 0) != tt.wantRows {
+			t.Fatalf("%q: expected rows=%v, got %v", tt.cmd, tt.wantRows, result.Rows)
+		}
+	}
+}
+
+func Test_kvExecutor_keys(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+	for _, cmd := range []string{"set user:1 a", "set user:2 b", "set order:1 c"} {
+		if _, err := exec.Execute(ctx, cmd); err != nil {
+			t.Fatalf("%q failed: %v", cmd, err)
+		}
+	}
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{cmd: "keys user:", want: "user:1\nuser:2"},
+		{cmd: "keys", want: "order:1\nuser:1\nuser:2"},
+		{cmd: "keys missing:", want: "(empty)"},
+	}
+	for _, tt := range tests {
+		result, err := exec.Execute(ctx, tt.cmd)
+		if err != nil {
+			t.Fatalf("%q failed: %v", tt.cmd, err)
+		}
+		if result.Render() != tt.want {
+			t.Fatalf("%q: expected %q, got %q", tt.cmd, tt.want, result.Render())
+		}
+	}
+
+	limited := NewKVExecutor(storage.NewInMemoryKVEngine(), WithKeysLimit(2))
+	for _, cmd := range []string{"set x:a 1", "set x:b 2", "set y:c 3", "set y:d 4"} {
+		if _, err := limited.Execute(ctx, cmd); err != nil {
+			t.Fatalf("%q failed: %v", cmd, err)
+		}
+	}
+	result, err := limited.Execute(ctx, "keys")
+	if err != nil {
+		t.Fatalf("keys failed: %v", err)
+	}
+	if want := "x:a\nx:b\n(truncated after 2 keys)"; result.Render() != want {
+		t.Fatalf("expected %q, got %q", want, result.Render())
+	}
+	// Text заполнен для потребителей, которые не знают о Rows
+	if result.Text != result.Render() {
+		t.Fatalf("expected Text %q to match rendered rows, got %q", result.Render(), result.Text)
+	}
+	// Ровно limit ключей выводятся без пометки
+	result, err = limited.Execute(ctx, "keys y:")
+	if err != nil {
+		t.Fatalf("keys failed: %v", err)
+	}
+	if want := "y:c\ny:d"; result.Render() != want {
+		t.Fatalf("expected %q, got %q", want, result.Render())
+	}
+}
+
+func Test_kvExecutor_incr(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{cmd: "incr hits", want: "1"},
+		{cmd: "incr hits", want: "2"},
+		{cmd: "incrby hits 10", want: "12"},
+		{cmd: "decr hits", want: "11"},
+		{cmd: "decrby hits 5", want: "6"},
+		{cmd: "decrby hits -4", want: "10"},
+		{cmd: "get hits", want: "10"},
+	}
+	for _, tt := range tests {
+		result, err := exec.Execute(ctx, tt.cmd)
+		if err != nil {
+			t.Fatalf("%q failed: %v", tt.cmd, err)
+		}
+		if result.Text != tt.want {
+			t.Fatalf("%q: expected %q, got %q", tt.cmd, tt.want, result.Text)
+		}
+	}
+
+	for _, cmd := range []string{"incr", "incrby hits", "incrby hits ten", "decr hits 1", "decrby hits", "decrby hits x"} {
+		if _, err := exec.Execute(ctx, cmd); !errors.Is(err, ErrInvalidCommandSyntax) {
+			t.Fatalf("%q: expected %v, got %v", cmd, ErrInvalidCommandSyntax, err)
+		}
+	}
+
+	if _, err := exec.Execute(ctx, "decrby hits -9223372036854775808"); !errors.Is(err, storage.ErrIntegerOverflow) {
+		t.Fatalf("expected %v, got %v", storage.ErrIntegerOverflow, err)
+	}
+}
+
+func Test_kvExecutor_caseInsensitiveVerbs(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{cmd: "SET Key Value", want: "OK"},
+		{cmd: "GET Key", want: "Value"},
+		{cmd: "Get Key", want: "Value"},
+		{cmd: "get Key", want: "Value"},
+	}
+	for _, tt := range tests {
+		result, err := exec.Execute(ctx, tt.cmd)
+		if err != nil {
+			t.Fatalf("%q failed: %v", tt.cmd, err)
+		}
+		if result.Text != tt.want {
+			t.Fatalf("%q: expected %q, got %q", tt.cmd, tt.want, result.Text)
+		}
+	}
+
+	// Ключи остаются чувствительными к регистру
+	if _, err := exec.Execute(ctx, "GET key"); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected %v for differently cased key, got %v", storage.ErrKeyNotFound, err)
+	}
+}
+
+func Test_kvExecutor_mset(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+
+	result, err := exec.Execute(ctx, "mset a 1 b 2 a 3")
+	if err != nil {
+		t.Fatalf("mset failed: %v", err)
+	}
+	if result.Kind != ResultOK || result.AffectedCount != 2 {
+		t.Fatalf("expected OK affecting 2 keys, got %+v", result)
+	}
+
+	result, err = exec.Execute(ctx, "mget a missing b")
+	if err != nil {
+		t.Fatalf("mget failed: %v", err)
+	}
+	if want := "a 3\nmissing (nil)\nb 2"; result.Render() != want {
+		t.Fatalf("expected %q, got %q", want, result.Render())
+	}
+
+	for _, cmd := range []string{"mset", "mset a", "mset a 1 b", "mget"} {
+		if _, err := exec.Execute(ctx, cmd); !errors.Is(err, ErrInvalidCommandSyntax) {
+			t.Fatalf("%q: expected %v, got %v", cmd, ErrInvalidCommandSyntax, err)
+		}
+	}
+	// Неудачная команда не записывает ни одной пары
+	if result, _ := exec.Execute(ctx, "mget b"); result.Render() != "b 2" {
+		t.Fatalf("expected b to stay unchanged, got %q", result.Render())
+	}
+}
+
+func Test_kvExecutor_flushall(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+
+	if _, err := exec.Execute(ctx, "mset a 1 b 2 c 3"); err != nil {
+		t.Fatalf("mset failed: %v", err)
+	}
+	result, err := exec.Execute(ctx, "flushall")
+	if err != nil {
+		t.Fatalf("flushall failed: %v", err)
+	}
+	if result.Kind != ResultOK || result.Text != "OK" {
+		t.Fatalf("expected OK, got %+v", result)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := exec.Execute(ctx, "get "+key); !errors.Is(err, storage.ErrKeyNotFound) {
+			t.Fatalf("expected %v for %s after flushall, got %v", storage.ErrKeyNotFound, key, err)
+		}
+	}
+	if _, err := exec.Execute(ctx, "set a 4"); err != nil {
+		t.Fatalf("set after flushall failed: %v", err)
+	}
+
+	// Транзакция не умеет удалять ключи
+	if _, err := exec.Execute(ctx, "begin"); err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+	if _, err := exec.Execute(ctx, "flushall"); !errors.Is(err, txn.ErrClearInTxn) {
+		t.Fatalf("expected %v inside a transaction, got %v", txn.ErrClearInTxn, err)
+	}
+}
+
+func Test_kvExecutor_delprefix(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{cmd: "mset user:1 a user:2 b user:3 c order:1 d", want: "OK"},
+		{cmd: "delprefix user:", want: "3"},
+		{cmd: "delprefix none:", want: "0"},
+		{cmd: "keys", want: "order:1"},
+	}
+	for _, tt := range tests {
+		result, err := exec.Execute(ctx, tt.cmd)
+		if err != nil {
+			t.Fatalf("%q failed: %v", tt.cmd, err)
+		}
+		if result.Render() != tt.want {
+			t.Fatalf("%q: expected %q, got %q", tt.cmd, tt.want, result.Render())
+		}
+	}
+
+	// Пустой префикс удалил бы все ключи, для этого есть flushall
+	if _, err := exec.Execute(ctx, `delprefix ""`); !errors.Is(err, ErrInvalidCommandSyntax) {
+		t.Fatalf("expected %v for an empty prefix, got %v", ErrInvalidCommandSyntax, err)
+	}
+	if _, err := exec.Execute(ctx, "get order:1"); err != nil {
+		t.Fatalf("expected rejected delprefix to keep keys, got %v", err)
+	}
+
+	if _, err := exec.Execute(ctx, "begin"); err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+	if _, err := exec.Execute(ctx, "delprefix order:"); !errors.Is(err, txn.ErrDeleteInTxn) {
+		t.Fatalf("expected %v inside a transaction, got %v", txn.ErrDeleteInTxn, err)
+	}
+}
+
+func Test_kvExecutor_sizeLimits(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine(storage.WithMaxKeySize(3), storage.WithMaxValueSize(5)))
+
+	if _, err := exec.Execute(ctx, "set abc hello"); err != nil {
+		t.Fatalf("set at the limits failed: %v", err)
+	}
+	_, err := exec.Execute(ctx, "set abcd hello")
+	if !errors.Is(err, storage.ErrKeyTooLarge) || !strings.Contains(err.Error(), "limit is 3") {
+		t.Fatalf("expected %v mentioning the limit, got %v", storage.ErrKeyTooLarge, err)
+	}
+	_, err = exec.Execute(ctx, "set abc hello!")
+	if !errors.Is(err, storage.ErrValueTooLarge) || !strings.Contains(err.Error(), "limit is 5") {
+		t.Fatalf("expected %v mentioning the limit, got %v", storage.ErrValueTooLarge, err)
+	}
+}
+
+func Test_kvExecutor_cas(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{cmd: "cas lock (nil) owner1", want: "true"},
+		{cmd: "cas lock (nil) owner2", want: "false"},
+		{cmd: "cas lock owner2 owner3", want: "false"},
+		{cmd: "cas lock owner1 owner2", want: "true"},
+		{cmd: "get lock", want: "owner2"},
+	}
+	for _, tt := range tests {
+		result, err := exec.Execute(ctx, tt.cmd)
+		if err != nil {
+			t.Fatalf("%q failed: %v", tt.cmd, err)
+		}
+		if result.Text != tt.want {
+			t.Fatalf("%q: expected %q, got %q", tt.cmd, tt.want, result.Text)
+		}
+	}
+}
+
+func Test_kvExecutor_append(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{cmd: "append log first", want: "5"},
+		{cmd: "append log ,second", want: "12"},
+		{cmd: "get log", want: "first,second"},
+	}
+	for _, tt := range tests {
+		result, err := exec.Execute(ctx, tt.cmd)
+		if err != nil {
+			t.Fatalf("%q failed: %v", tt.cmd, err)
+		}
+		if result.Text != tt.want {
+			t.Fatalf("%q: expected %q, got %q", tt.cmd, tt.want, result.Text)
+		}
+	}
+}
+
+func Test_kvExecutor_binaryValues(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+
+	values := [][]byte{
+		[]byte("hello world"),
+		{0x00, 'a', 0x00, ' ', 0xff, '\n'},
+		{},
+	}
+	for i, value := range values {
+		key := fmt.Sprintf("bin%d", i)
+		encoded := base64.StdEncoding.EncodeToString(value)
+		if _, err := exec.Execute(ctx, fmt.Sprintf("setb %s %q", key, encoded)); err != nil {
+			t.Fatalf("setb %q failed: %v", value, err)
+		}
+
+		result, err := exec.Execute(ctx, "getb "+key)
+		if err != nil {
+			t.Fatalf("getb %s failed: %v", key, err)
+		}
+		if result.Text != encoded {
+			t.Fatalf("getb %s: expected %q, got %q", key, encoded, result.Text)
+		}
+		result, err = exec.Execute(ctx, "get "+key)
+		if err != nil {
+			t.Fatalf("get %s failed: %v", key, err)
+		}
+		if result.Text != string(value) {
+			t.Fatalf("get %s: expected %q, got %q", key, value, result.Text)
+		}
+	}
+
+	for _, cmd := range []string{"setb key not-base64!", "setb key YWJj="} {
+		if _, err := exec.Execute(ctx, cmd); !errors.Is(err, ErrInvalidCommandSyntax) {
+			t.Fatalf("%q: expected %v, got %v", cmd, ErrInvalidCommandSyntax, err)
+		}
+	}
+	if _, err := exec.Execute(ctx, "getb missing"); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected %v, got %v", storage.ErrKeyNotFound, err)
+	}
+}
+
+func Test_kvExecutor_readOnly(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := storage.NewInMemoryKVEngine()
+	engine.Set(ctx, []byte("foo"), []byte("bar"))
+	exec := NewKVExecutor(engine, WithReadOnly())
+
+	for _, cmd := range []string{"set foo baz", "SET new v", "incr n", "append foo x", "flushall", "begin", "merge", "load dump.db"} {
+		if _, err := exec.Execute(ctx, cmd); !errors.Is(err, storage.ErrReadOnly) {
+			t.Fatalf("%q: expected %v, got %v", cmd, storage.ErrReadOnly, err)
+		}
+	}
+
+	for cmd, want := range map[string]string{"get foo": "bar", "mget foo": "foo bar", "keys": "foo"} {
+		result, err := exec.Execute(ctx, cmd)
+		if err != nil {
+			t.Fatalf("%q failed: %v", cmd, err)
+		}
+		if result.Render() != want {
+			t.Fatalf("%q: expected %q, got %q", cmd, want, result.Render())
+		}
+	}
+	if _, err := engine.Get(ctx, []byte("new")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected rejected commands to leave the engine unchanged, got %v", err)
+	}
+}
+
+func Test_kvExecutor_versions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{cmd: "setv foo bar 0", want: "true"},
+		{cmd: "getv foo", want: "value bar\nversion 1"},
+		{cmd: "setv foo baz 0", want: "false"},
+		{cmd: "setv foo baz 1", want: "true"},
+		{cmd: "set foo qux", want: "OK"},
+		{cmd: "setv foo stale 2", want: "false"},
+		{cmd: "getv foo", want: "value qux\nversion 3"},
+	}
+	for _, tt := range tests {
+		result, err := exec.Execute(ctx, tt.cmd)
+		if err != nil {
+			t.Fatalf("%q failed: %v", tt.cmd, err)
+		}
+		if result.Render() != tt.want {
+			t.Fatalf("%q: expected %q, got %q", tt.cmd, tt.want, result.Render())
+		}
+	}
+
+	if _, err := exec.Execute(ctx, "setv foo bar -1"); !errors.Is(err, ErrInvalidCommandSyntax) {
+		t.Fatalf("expected %v, got %v", ErrInvalidCommandSyntax, err)
+	}
+	mvcc := NewKVExecutor(storage.NewMVCCKVEngine())
+	if _, err := mvcc.Execute(ctx, "getv foo"); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected %v, got %v", ErrNotSupported, err)
+	}
+}
+
+func Test_kvExecutor_getset(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{cmd: "getset owner alice", want: "(nil)"},
+		{cmd: "getset owner bob", want: "alice"},
+		{cmd: "get owner", want: "bob"},
+	}
+	for _, tt := range tests {
+		result, err := exec.Execute(ctx, tt.cmd)
+		if err != nil {
+			t.Fatalf("%q failed: %v", tt.cmd, err)
+		}
+		if result.Text != tt.want {
+			t.Fatalf("%q: expected %q, got %q", tt.cmd, tt.want, result.Text)
+		}
+	}
+}
+
+func Test_kvExecutor_setnx(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{cmd: "setnx lock owner1", want: "1"},
+		{cmd: "setnx lock owner2", want: "0"},
+		{cmd: "get lock", want: "owner1"},
+	}
+	for _, tt := range tests {
+		result, err := exec.Execute(ctx, tt.cmd)
+		if err != nil {
+			t.Fatalf("%q failed: %v", tt.cmd, err)
+		}
+		if result.Text != tt.want {
+			t.Fatalf("%q: expected %q, got %q", tt.cmd, tt.want, result.Text)
+		}
+	}
+}
+
+func Test_kvExecutor_ttl(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clk := clock.NewManual(time.Unix(1000, 0))
+	engine := storage.NewInMemoryKVEngine(storage.WithClock(clk))
+	exec := NewKVExecutor(engine)
+
+	engine.Set(ctx, []byte("persistent"), []byte("v"))
+	engine.Set(ctx, []byte("session"), []byte("v"))
+	engine.Expire([]byte("session"), 10*time.Second)
+	clk.Advance(2500 * time.Millisecond)
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{cmd: "ttl session", want: "8"},
+		{cmd: "ttl persistent", want: "-1"},
+		{cmd: "ttl missing", want: "-2"},
+	}
+	for _, tt := range tests {
+		result, err := exec.Execute(ctx, tt.cmd)
+		if err != nil {
+			t.Fatalf("%q failed: %v", tt.cmd, err)
+		}
+		if result.Text != tt.want {
+			t.Fatalf("%q: expected %q, got %q", tt.cmd, tt.want, result.Text)
+		}
+	}
+}
+
+func Test_kvExecutor_info(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	engine, err := storage.NewDiskKVEngine(ctx, filepath.Join(t.TempDir(), "kv.db"))
+	if err != nil {
+		t.Fatalf("NewDiskKVEngine failed: %v", err)
+	}
+	t.Cleanup(func() {
+		engine.Close(ctx)
+	})
+	exec := NewKVExecutor(engine)
+	if _, err := exec.Execute(ctx, "set foo bar"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+
+	result, err := exec.Execute(ctx, "info")
+	if err != nil {
+		t.Fatalf("info failed: %v", err)
+	}
+	// Одна страница heap-файла, файл из нее и страницы заголовка
+	for _, want := range []string{"pages=1 ", "page_size=4096 ", "file_bytes=8192 ", "pool_frames=64 ", "pool_misses=0"} {
+		if !strings.Contains(result.Text, want) {
+			t.Fatalf("expected %q in info output, got %q", want, result.Text)
+		}
+	}
+
+	if _, err := exec.Execute(ctx, "info foo"); !errors.Is(err, ErrInvalidCommandSyntax) {
+		t.Fatalf("expected %v, got %v", ErrInvalidCommandSyntax, err)
+	}
+	memory := NewKVExecutor(storage.NewInMemoryKVEngine())
+	if _, err := memory.Execute(ctx, "info"); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected %v for in-memory engine, got %v", ErrNotSupported, err)
+	}
+}
+
+func Test_kvExecutor_stats(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+	for _, cmd := range []string{"set a 1", "set b 22"} {
+		if _, err := exec.Execute(ctx, cmd); err != nil {
+			t.Fatalf("%q failed: %v", cmd, err)
+		}
+	}
+
+	result, err := exec.Execute(ctx, "stats")
+	if err != nil {
+		t.Fatalf("stats failed: %v", err)
+	}
+	if want := "keys=2\nvalue_bytes=3"; result.Render() != want {
+		t.Fatalf("expected %q, got %q", want, result.Render())
+	}
+
+	engine, err := storage.NewDiskKVEngine(ctx, filepath.Join(t.TempDir(), "kv.db"))
+	if err != nil {
+		t.Fatalf("NewDiskKVEngine failed: %v", err)
+	}
+	t.Cleanup(func() {
+		engine.Close(ctx)
+	})
+	result, err = NewKVExecutor(engine).Execute(ctx, "stats")
+	if err != nil {
+		t.Fatalf("stats failed: %v", err)
+	}
+	for _, want := range []string{"keys=0", "pool_hits=", "pool_misses=", "pool_evictions="} {
+		if !strings.Contains(result.Render(), want) {
+			t.Fatalf("expected %q in stats output, got %q", want, result.Render())
+		}
+	}
+}
+
+func Test_kvExecutor_persisttest(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	engine, err := storage.NewDiskKVEngine(ctx, filepath.Join(t.TempDir(), "kv.db"))
+	if err != nil {
+		t.Fatalf("NewDiskKVEngine failed: %v", err)
+	}
+	t.Cleanup(func() {
+		engine.Close(ctx)
+	})
+	exec := NewKVExecutor(engine)
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{cmd: "set foo bar", want: "OK"},
+		// Значение есть только в пуле, на диск оно еще не сброшено
+		{cmd: "persisttest foo noflush", want: "mismatch"},
+		{cmd: "persisttest foo", want: "match"},
+		{cmd: "persisttest foo noflush", want: "match"},
+		{cmd: "get foo", want: "bar"},
+	}
+	for _, tt := range tests {
+		result, err := exec.Execute(ctx, tt.cmd)
+		if err != nil {
+			t.Fatalf("%q failed: %v", tt.cmd, err)
+		}
+		if result.Text != tt.want {
+			t.Fatalf("%q: expected %q, got %q", tt.cmd, tt.want, result.Text)
+		}
+	}
+
+	if _, err := exec.Execute(ctx, "persisttest missing"); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected %v, got %v", storage.ErrKeyNotFound, err)
+	}
+}
+
+func Test_kvExecutor_dumppage(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	engine, err := storage.NewDiskKVEngine(ctx, filepath.Join(t.TempDir(), "kv.db"))
+	if err != nil {
+		t.Fatalf("NewDiskKVEngine failed: %v", err)
+	}
+	t.Cleanup(func() {
+		engine.Close(ctx)
+	})
+	exec := NewKVExecutor(engine)
+
+	for _, cmd := range []string{"set foo bar", "persisttest foo"} {
+		if _, err := exec.Execute(ctx, cmd); err != nil {
+			t.Fatalf("%q failed: %v", cmd, err)
+		}
+	}
+	result, err := exec.Execute(ctx, "dumppage 0")
+	if err != nil {
+		t.Fatalf("dumppage failed: %v", err)
+	}
+	for _, want := range []string{"page type: heap", "slot count: 1", "validate: ok", "slot  offset  length  flag"} {
+		if !strings.Contains(result.Text, want) {
+			t.Fatalf("expected dump to contain %q, got:\n%s", want, result.Text)
+		}
+	}
+
+	if _, err := exec.Execute(ctx, "dumppage 1000"); !errors.Is(err, page.ErrPageOutOfBounds) {
+		t.Fatalf("expected %v, got %v", page.ErrPageOutOfBounds, err)
+	}
+	if _, err := exec.Execute(ctx, "dumppage x"); !errors.Is(err, ErrInvalidCommandSyntax) {
+		t.Fatalf("expected %v, got %v", ErrInvalidCommandSyntax, err)
+	}
+	mem := NewKVExecutor(storage.NewInMemoryKVEngine())
+	if _, err := mem.Execute(ctx, "dumppage 0"); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected %v, got %v", ErrNotSupported, err)
+	}
+}
+
+func Test_kvExecutor_saveLoad(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "snapshot.bin")
+
+	src := NewKVExecutor(storage.NewInMemoryKVEngine())
+	for _, cmd := range []string{`set greeting "hello world"`, "set empty \"\"", "save " + path} {
+		if _, err := src.Execute(ctx, cmd); err != nil {
+			t.Fatalf("%q failed: %v", cmd, err)
+		}
+	}
+
+	dst := NewKVExecutor(storage.NewInMemoryKVEngine())
+	if _, err := dst.Execute(ctx, "load "+path); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	result, err := dst.Execute(ctx, "mget greeting empty")
+	if err != nil {
+		t.Fatalf("mget failed: %v", err)
+	}
+	if want := "greeting hello world\nempty "; result.Render() != want {
+		t.Fatalf("expected %q, got %q", want, result.Render())
+	}
+
+	if _, err := dst.Execute(ctx, "load "+filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatalf("expected error loading missing file")
+	}
+}
+
+func Test_kvExecutor_snapshotDir(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dir := t.TempDir()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine(), WithSnapshotDir(dir))
+
+	outside := filepath.Join(t.TempDir(), "snapshot.bin")
+	for _, path := range []string{outside, "../snapshot.bin", "sub/../../snapshot.bin"} {
+		if _, err := exec.Execute(ctx, "save "+path); !errors.Is(err, ErrPathNotAllowed) {
+			t.Fatalf("save %q: expected %v, got %v", path, ErrPathNotAllowed, err)
+		}
+	}
+	if _, err := os.Stat(outside); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected no file outside the snapshot directory, got %v", err)
+	}
+
+	if _, err := exec.Execute(ctx, "save snapshot.bin"); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "snapshot.bin")); err != nil {
+		t.Fatalf("expected snapshot in the snapshot directory: %v", err)
+	}
+
+	// Файлы вне каталога не читаются, даже если существуют
+	src := NewKVExecutor(storage.NewInMemoryKVEngine())
+	if _, err := src.Execute(ctx, "save "+outside); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	for _, path := range []string{outside, "../" + filepath.Base(dir) + "/snapshot.bin", "/etc/passwd"} {
+		if _, err := exec.Execute(ctx, "load "+path); !errors.Is(err, ErrPathNotAllowed) {
+			t.Fatalf("load %q: expected %v, got %v", path, ErrPathNotAllowed, err)
+		}
+	}
+	if _, err := exec.Execute(ctx, "load snapshot.bin"); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+}
+
+func Test_kvExecutor_help(t *testing.T) {
+	t.Parallel()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+
+	result, err := exec.Execute(context.Background(), "help")
+	if err != nil {
+		t.Fatalf("help failed: %v", err)
+	}
+	if len(result.Rows) != len(exec.registry.order) {
+		t.Fatalf("expected %d help rows, got %d", len(exec.registry.order), len(result.Rows))
+	}
+	for _, want := range []string{"set <key> <value>", "get <key>", "help"} {
+		if !strings.Contains(result.Render(), want) {
+			t.Fatalf("expected help to mention %q, got:\n%s", want, result.Render())
+		}
+	}
+}
+
+func Test_kvExecutor_Register(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	exec := NewKVExecutor(storage.NewInMemoryKVEngine())
+
+	exec.Register("echo", RangeArgs(1, 2), func(ctx context.Context, args []string) (Result, error) {
+		return valueResult(strings.Join(args, " ")), nil
+	})
+
+	result, err := exec.Execute(ctx, `echo hello "big world"`)
+	if err != nil {
+		t.Fatalf("echo failed: %v", err)
+	}
+	if result.Text != "hello big world" {
+		t.Fatalf("expected %q, got %q", "hello big world", result.Text)
+	}
+	for _, cmd := range []string{"echo", "echo a b c"} {
+		if _, err := exec.Execute(ctx, cmd); !errors.Is(err, ErrInvalidCommandSyntax) {
+			t.Fatalf("%q: expected %v, got %v", cmd, ErrInvalidCommandSyntax, err)
+		}
+	}
+
+	for cmd, want := range map[string]string{"commands": "echo 2 custom", "help": "echo <arg1> [arg2]"} {
+		result, err := exec.Execute(ctx, cmd)
+		if err != nil {
+			t.Fatalf("%q failed: %v", cmd, err)
+		}
+		if !strings.Contains(result.Render(), want) {
+			t.Fatalf("expected %q output to contain %q, got:\n%s", cmd, want, result.Render())
+		}
+	}
+
+	// Повторная регистрация заменяет встроенную команду
+	exec.Register("get", ExactArgs(1), func(ctx context.Context, args []string) (Result, error) {
+		return valueResult("overridden"), nil
+	})
+	if result, _ := exec.Execute(ctx, "get anything"); result.Text != "overridden" {
+		t.Fatalf("expected overridden get, got %q", result.Text)
+	}
+}
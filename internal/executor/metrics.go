@@ -0,0 +1,155 @@
+package executor
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets — верхние границы корзин гистограммы длительности команд.
+// Команды дольше последней границы попадают в дополнительную последнюю корзину.
+var LatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+// CommandMetrics — количество выполнений команды и распределение их длительности.
+// Выполнения, завершившиеся ошибкой, тоже учитываются.
+type CommandMetrics struct {
+	Count int
+	Total time.Duration
+	Max   time.Duration
+	// Buckets[i] — сколько выполнений длилось не дольше LatencyBuckets[i],
+	// но дольше предыдущей границы; последний элемент — дольше всех границ.
+	Buckets []int
+}
+
+// MetricsExecutor — исполнитель, который копит метрики длительности выполненных команд.
+type MetricsExecutor interface {
+	Executor
+	Metrics() map[string]CommandMetrics
+}
+
+// metricsExecutor замеряет длительность каждой команды и копит метрики по ее имени.
+type metricsExecutor struct {
+	inner   Executor
+	mu      sync.Mutex
+	metrics map[string]*CommandMetrics
+}
+
+// metricsSessionExecutor — metricsExecutor над исполнителем с сессиями:
+// команды сессий замеряются в общие метрики.
+type metricsSessionExecutor struct {
+	*metricsExecutor
+}
+
+// WithMetrics оборачивает inner исполнителем, который замеряет Execute и копит метрики
+// по первому слову команды в нижнем регистре. Снимок метрик возвращает Metrics.
+// Sync и Close передаются inner, если он их поддерживает, а если inner — SessionExecutor,
+// то и обертка остается SessionExecutor, чтобы клиенты сервера не делили одну сессию.
+func WithMetrics(inner Executor) MetricsExecutor {
+	m := &metricsExecutor{inner: inner, metrics: make(map[string]*CommandMetrics)}
+	if _, ok := inner.(SessionExecutor); ok {
+		return metricsSessionExecutor{m}
+	}
+	return m
+}
+
+func (m *metricsExecutor) Execute(ctx context.Context, cmd string) (Result, error) {
+	return m.measure(ctx, m.inner, cmd)
+}
+
+// measure выполняет cmd исполнителем exec и учитывает длительность выполнения.
+func (m *metricsExecutor) measure(ctx context.Context, exec Executor, cmd string) (Result, error) {
+	startedAt := time.Now()
+	result, err := exec.Execute(ctx, cmd)
+	m.record(commandName(cmd), time.Since(startedAt))
+	return result, err
+}
+
+// Sync сбрасывает состояние inner на диск, если inner это поддерживает.
+func (m *metricsExecutor) Sync(ctx context.Context) error {
+	sc, ok := m.inner.(interface {
+		Sync(ctx context.Context) error
+	})
+	if !ok {
+		return nil
+	}
+	return sc.Sync(ctx)
+}
+
+// Close закрывает inner, если inner это поддерживает.
+func (m *metricsExecutor) Close(ctx context.Context) error {
+	c, ok := m.inner.(closer)
+	if !ok {
+		return nil
+	}
+	return c.Close(ctx)
+}
+
+// NewSession создает сессию inner, команды которой замеряются в метрики обертки.
+func (m metricsSessionExecutor) NewSession() Session {
+	return &metricsSession{m: m.metricsExecutor, inner: m.inner.(SessionExecutor).NewSession()}
+}
+
+// metricsSession замеряет команды сессии inner в метрики m.
+type metricsSession struct {
+	m     *metricsExecutor
+	inner Session
+}
+
+func (s *metricsSession) Execute(ctx context.Context, cmd string) (Result, error) {
+	return s.m.measure(ctx, s.inner, cmd)
+}
+
+func (s *metricsSession) Close() {
+	s.inner.Close()
+}
+
+// record учитывает выполнение команды name длительностью d.
+func (m *metricsExecutor) record(name string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cm, ok := m.metrics[name]
+	if !ok {
+		cm = &CommandMetrics{Buckets: make([]int, len(LatencyBuckets)+1)}
+		m.metrics[name] = cm
+	}
+	cm.Count++
+	cm.Total += d
+	cm.Max = max(cm.Max, d)
+	bucket := len(LatencyBuckets)
+	for i, bound := range LatencyBuckets {
+		if d <= bound {
+			bucket = i
+			break
+		}
+	}
+	cm.Buckets[bucket]++
+}
+
+// Metrics возвращает копию накопленных метрик по именам команд.
+func (m *metricsExecutor) Metrics() map[string]CommandMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make(map[string]CommandMetrics, len(m.metrics))
+	for name, cm := range m.metrics {
+		snapshot := *cm
+		snapshot.Buckets = append([]int(nil), cm.Buckets...)
+		res[name] = snapshot
+	}
+	return res
+}
+
+// commandName возвращает первое слово команды в нижнем регистре или пустую строку для пустой команды.
+func commandName(cmd string) string {
+	fields := strings.Fields(cmd)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(fields[0])
+}
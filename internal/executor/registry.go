@@ -0,0 +1,111 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// CommandHandler выполняет команду. args — аргументы команды без ее имени,
+// их количество уже проверено по ArgSpec, с которым команда зарегистрирована.
+type CommandHandler func(ctx context.Context, args []string) (Result, error)
+
+// ArgSpec — допустимое количество аргументов команды: от Min до Max включительно.
+// Отрицательный Max снимает ограничение сверху.
+type ArgSpec struct {
+	Min int
+	Max int
+}
+
+// ExactArgs требует ровно n аргументов.
+func ExactArgs(n int) ArgSpec {
+	return ArgSpec{Min: n, Max: n}
+}
+
+// RangeArgs допускает от min до max аргументов.
+func RangeArgs(min, max int) ArgSpec {
+	return ArgSpec{Min: min, Max: max}
+}
+
+// AtLeastArgs требует не меньше n аргументов.
+func AtLeastArgs(n int) ArgSpec {
+	return ArgSpec{Min: n, Max: -1}
+}
+
+func (s ArgSpec) accepts(n int) bool {
+	return n >= s.Min && (s.Max < 0 || n <= s.Max)
+}
+
+// command — зарегистрированная команда: описание для commands и help и обработчик.
+type command struct {
+	commandInfo
+	args    ArgSpec
+	handler CommandHandler
+}
+
+// registry — команды исполнителя по имени и в порядке регистрации.
+type registry struct {
+	commands map[string]*command
+	order    []*command
+}
+
+func newRegistry() *registry {
+	return &registry{commands: make(map[string]*command)}
+}
+
+// add регистрирует команду, заменяя ранее зарегистрированную с тем же именем.
+func (r *registry) add(cmd *command) {
+	if prev, ok := r.commands[cmd.name]; ok {
+		for i, c := range r.order {
+			if c == prev {
+				r.order[i] = cmd
+			}
+		}
+	} else {
+		r.order = append(r.order, cmd)
+	}
+	r.commands[cmd.name] = cmd
+}
+
+// mutating сообщает, изменяет ли встроенная команда name данные. Команды, зарегистрированные
+// через Register, к изменяющим не относятся: за них отвечает их обработчик.
+func (r *registry) mutating(name string) bool {
+	cmd, ok := r.commands[name]
+	return ok && cmd.category == categoryWrite
+}
+
+// dispatch находит команду по имени, проверяет количество аргументов и вызывает обработчик.
+func (r *registry) dispatch(ctx context.Context, name string, args []string) (Result, error) {
+	cmd, ok := r.commands[name]
+	if !ok {
+		return Result{}, ErrUnknownCommand
+	}
+	if !cmd.args.accepts(len(args)) {
+		return Result{}, ErrInvalidCommandSyntax
+	}
+	return cmd.handler(ctx, args)
+}
+
+// Register добавляет команду name с обработчиком handler или заменяет существующую.
+// Количество аргументов проверяется по args до вызова обработчика.
+// Имя команды, как и при вызове, не зависит от регистра.
+// Регистрировать команды следует до начала выполнения команд.
+func (e *kvExecutor) Register(name string, args ArgSpec, handler CommandHandler) {
+	name = strings.ToLower(name)
+	usage := name
+	for i := range max(args.Max, args.Min) {
+		if i < args.Min {
+			usage += fmt.Sprintf(" <arg%d>", i+1)
+		} else {
+			usage += fmt.Sprintf(" [arg%d]", i+1)
+		}
+	}
+	if args.Max < 0 {
+		usage += " [arg...]"
+	}
+	e.registry.add(&command{
+		commandInfo: commandInfo{name: name, category: categoryCustom, usage: usage},
+		args:        args,
+		handler:     handler,
+	})
+}
@@ -0,0 +1,72 @@
+package executor
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Argentum88/godb/internal/storage"
+	"github.com/Argentum88/godb/internal/txn"
+)
+
+// session — состояние одного клиента исполнителя: активные транзакция и форк.
+type session struct {
+	mu     sync.RWMutex
+	engine storage.Engine   // Движок, к которому применяются команды: исходный или форк
+	base   storage.Engine   // Исходный движок, пока команды применяются к форку
+	txn    *txn.Transaction // Активная транзакция или nil
+	// busy занят, пока выполняется команда сессии с таймаутом, в том числе брошенная по таймауту:
+	// следующая команда сессии ждет ее завершения, а не выполняется параллельно с ней
+	busy chan struct{}
+}
+
+func newSession(engine storage.Engine) *session {
+	return &session{engine: engine, busy: make(chan struct{}, 1)}
+}
+
+// sessionKey — ключ контекста, под которым Execute сессии передает ее состояние командам.
+type sessionKey struct{}
+
+// session возвращает сессию, от имени которой выполняется команда с контекстом ctx.
+// Команды, выполняемые напрямую через исполнитель, относятся к его собственной сессии.
+func (e *kvExecutor) session(ctx context.Context) *session {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		return s
+	}
+	return e.defaultSession
+}
+
+// endSession откатывает активную транзакцию и отбрасывает форк сессии.
+func (e *kvExecutor) endSession(s *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.txn != nil {
+		e.txns.Rollback(s.txn)
+		s.txn = nil
+	}
+	if s.base != nil {
+		s.engine = s.base
+		s.base = nil
+	}
+}
+
+// sessionExecutor выполняет команды исполнителя e в отдельной сессии.
+type sessionExecutor struct {
+	e *kvExecutor
+	s *session
+}
+
+// NewSession создает сессию для отдельного клиента, например соединения сервера.
+// Сессия разделяет с исполнителем движок, журнал медленных команд и зарегистрированные команды,
+// но транзакция и форк у нее свои: begin и fork одного клиента не затрагивают команды других.
+func (e *kvExecutor) NewSession() Session {
+	return &sessionExecutor{e: e, s: newSession(e.engine)}
+}
+
+func (se *sessionExecutor) Execute(ctx context.Context, cmd string) (Result, error) {
+	return se.e.Execute(context.WithValue(ctx, sessionKey{}, se.s), cmd)
+}
+
+// Close откатывает активную транзакцию и отбрасывает форк сессии. Движок остается открытым.
+func (se *sessionExecutor) Close() {
+	se.e.endSession(se.s)
+}
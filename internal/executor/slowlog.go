@@ -0,0 +1,75 @@
+package executor
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultSlowLogThreshold = 10 * time.Millisecond
+	defaultSlowLogCapacity  = 128
+)
+
+// SlowLogEntry — запись о команде, выполнявшейся дольше порога.
+type SlowLogEntry struct {
+	Command   string
+	Duration  time.Duration
+	Timestamp time.Time
+}
+
+// slowLog — кольцевой буфер медленных команд фиксированной емкости.
+type slowLog struct {
+	threshold time.Duration
+	entries   []SlowLogEntry
+	next      int
+	full      bool
+	mu        sync.Mutex
+}
+
+func newSlowLog(threshold time.Duration, capacity int) *slowLog {
+	return &slowLog{
+		threshold: threshold,
+		entries:   make([]SlowLogEntry, capacity),
+	}
+}
+
+// record сохраняет команду, если она выполнялась дольше порога.
+// При заполнении буфера затирается самая старая запись.
+func (l *slowLog) record(cmd string, startedAt time.Time, duration time.Duration) {
+	if duration < l.threshold || len(l.entries) == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[l.next] = SlowLogEntry{Command: cmd, Duration: duration, Timestamp: startedAt}
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// get возвращает записи от самой новой к самой старой.
+func (l *slowLog) get() []SlowLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := l.next
+	if l.full {
+		n = len(l.entries)
+	}
+	res := make([]SlowLogEntry, 0, n)
+	for i := range n {
+		idx := (l.next - 1 - i + len(l.entries)) % len(l.entries)
+		res = append(res, l.entries[idx])
+	}
+	return res
+}
+
+func (l *slowLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	clear(l.entries)
+	l.next = 0
+	l.full = false
+}
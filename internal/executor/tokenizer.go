@@ -0,0 +1,52 @@
+package executor
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+var ErrUnterminatedQuote = errors.New("unterminated quoted string")
+
+// tokenize разбивает команду на поля по пробельным символам.
+// Строки в двойных кавычках образуют одно поле, даже если содержат пробелы или пусты.
+// Внутри кавычек поддерживаются экранирования \" и \\.
+func tokenize(cmd string) ([]string, error) {
+	var (
+		fields  []string
+		field   strings.Builder
+		inField bool
+		inQuote bool
+		escaped bool
+	)
+
+	for _, r := range cmd {
+		switch {
+		case escaped:
+			field.WriteRune(r)
+			escaped = false
+		case inQuote && r == '\\':
+			escaped = true
+		case r == '"':
+			inQuote = !inQuote
+			inField = true
+		case !inQuote && unicode.IsSpace(r):
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+
+	if inQuote {
+		return nil, ErrUnterminatedQuote
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
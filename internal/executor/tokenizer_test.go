@@ -0,0 +1,65 @@
+package executor
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func Test_tokenize(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		cmd     string
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "plain fields",
+			cmd:  "set foo  bar",
+			want: []string{"set", "foo", "bar"},
+		},
+		{
+			name: "quoted value with spaces",
+			cmd:  `set greeting "hello world"`,
+			want: []string{"set", "greeting", "hello world"},
+		},
+		{
+			name: "quoted key",
+			cmd:  `get "my key"`,
+			want: []string{"get", "my key"},
+		},
+		{
+			name: "escaped quote and backslash",
+			cmd:  `set q "say \"hi\" \\ bye"`,
+			want: []string{"set", "q", `say "hi" \ bye`},
+		},
+		{
+			name: "empty quoted value",
+			cmd:  `set empty ""`,
+			want: []string{"set", "empty", ""},
+		},
+		{
+			name:    "unterminated quote",
+			cmd:     `set foo "bar`,
+			wantErr: ErrUnterminatedQuote,
+		},
+		{
+			name: "empty input",
+			cmd:  "   ",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := tokenize(tt.cmd)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("tokenize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("tokenize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
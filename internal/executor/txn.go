@@ -0,0 +1,55 @@
+package executor
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrTxnActive = errors.New("transaction is already active")
+var ErrNoTxn = errors.New("no active transaction")
+
+// begin начинает транзакцию сессии: до commit или rollback изменения копятся в ней, а не в движке.
+// Транзакция и форк взаимоисключающие.
+func (e *kvExecutor) begin(ctx context.Context) error {
+	s := e.session(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.txn != nil {
+		return ErrTxnActive
+	}
+	if s.base != nil {
+		return ErrAlreadyForked
+	}
+	s.txn = e.txns.Begin()
+	return nil
+}
+
+// commit применяет изменения транзакции сессии к движку.
+func (e *kvExecutor) commit(ctx context.Context) error {
+	s := e.session(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.txn == nil {
+		return ErrNoTxn
+	}
+	if err := e.txns.Commit(s.txn); err != nil {
+		return err
+	}
+	s.txn = nil
+	return nil
+}
+
+// rollback отбрасывает изменения транзакции сессии.
+func (e *kvExecutor) rollback(ctx context.Context) error {
+	s := e.session(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.txn == nil {
+		return ErrNoTxn
+	}
+	if err := e.txns.Rollback(s.txn); err != nil {
+		return err
+	}
+	s.txn = nil
+	return nil
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Argentum88/godb/internal/executor"
+)
+
+var ErrServerClosed = errors.New("server closed")
+var ErrShutdownForbidden = errors.New("shutdown is allowed only from loopback connections")
+
+const shutdownCommand = "shutdown"
+
+// shutdownTimeout ограничивает ожидание выполняемых команд при остановке ListenAndServe.
+const shutdownTimeout = 10 * time.Second
+
+// syncer реализуется исполнителями, умеющими сбросить состояние движка на диск.
+type syncer interface {
+	Sync(ctx context.Context) error
+}
+
+type Server struct {
+	executor     executor.Executor
+	mu           sync.Mutex
+	listeners    map[net.Listener]struct{}
+	conns        map[net.Conn]struct{}
+	handlers     sync.WaitGroup
+	shuttingDown atomic.Bool
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+func NewServer(executor executor.Executor) *Server {
+	return &Server{
+		executor:  executor,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe слушает TCP-адрес addr и обслуживает соединения, пока не отменен ctx
+// или не получена команда shutdown, после чего корректно останавливает сервер.
+func ListenAndServe(ctx context.Context, addr string, exec executor.Executor) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	srv := NewServer(exec)
+	// Выполняемые команды не прерываются отменой ctx: их дожидается Shutdown.
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(context.WithoutCancel(ctx), ln)
+	}()
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, ErrServerClosed) {
+			return err
+		}
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// Serve принимает соединения на ln и обслуживает каждое в отдельной горутине.
+// Возвращает ErrServerClosed после вызова Shutdown.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	if !s.trackListener(ln) {
+		ln.Close()
+		return ErrServerClosed
+	}
+	defer s.untrackListener(ln)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.shuttingDown.Load() {
+				return ErrServerClosed
+			}
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+
+		if !s.trackConn(conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		go s.handleConn(ctx, conn)
+	}
+}
+
+// Shutdown перестает принимать новые соединения, дожидается завершения выполняемых команд
+// (но не дольше дедлайна ctx), сбрасывает движок на диск и закрывает соединения.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		s.shutdownErr = s.shutdown(ctx)
+	})
+	return s.shutdownErr
+}
+
+func (s *Server) shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shuttingDown.Store(true)
+	for ln := range s.listeners {
+		ln.Close()
+	}
+	// Прерываем ожидание чтения у простаивающих соединений.
+	// Соединения, выполняющие команду, допишут ответ и завершатся на следующем чтении.
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+
+	if sc, ok := s.executor.(syncer); ok {
+		if err := sc.Sync(ctx); err != nil {
+			return fmt.Errorf("failed to sync engine: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) handleConn(ctx context.Context, conn net.Conn) {
+	defer s.handlers.Done()
+	defer s.untrackConn(conn)
+	defer conn.Close()
+
+	// Транзакция или форк, начатые клиентом, не должны перехватывать команды других соединений
+	exec := s.executor
+	if se, ok := s.executor.(executor.SessionExecutor); ok {
+		session := se.NewSession()
+		defer session.Close()
+		exec = session
+	}
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		if s.shuttingDown.Load() {
+			return
+		}
+
+		cmd := strings.TrimSpace(scanner.Text())
+		if cmd == "" {
+			continue
+		}
+
+		// Имя команды сравнивается без учета регистра, как в исполнителе
+		if fields := strings.Fields(cmd); strings.ToLower(fields[0]) == shutdownCommand {
+			if !isLoopback(conn.RemoteAddr()) {
+				fmt.Fprintf(conn, "Error: %v\n", ErrShutdownForbidden)
+				continue
+			}
+			fmt.Fprint(conn, "OK\n")
+			// Shutdown ждет завершения всех обработчиков, включая текущий,
+			// поэтому запускаем его асинхронно.
+			go s.Shutdown(context.WithoutCancel(ctx))
+			return
+		}
+
+		result, err := exec.Execute(ctx, cmd)
+		if err != nil {
+			fmt.Fprintf(conn, "Error: %v\n", err)
+		} else {
+			fmt.Fprintf(conn, "%s\n", result.Render())
+		}
+	}
+}
+
+func (s *Server) trackListener(ln net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shuttingDown.Load() {
+		return false
+	}
+	s.listeners[ln] = struct{}{}
+	return true
+}
+
+func (s *Server) untrackListener(ln net.Listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.listeners, ln)
+}
+
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shuttingDown.Load() {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.handlers.Add(1)
+	return true
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+func isLoopback(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	return tcpAddr.IP.IsLoopback()
+}
@@ -0,0 +1,295 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Argentum88/godb/internal/executor"
+	"github.com/Argentum88/godb/internal/server"
+	"github.com/Argentum88/godb/internal/storage"
+)
+
+// blockingExecutor сигнализирует о начале выполнения команды и ждет разрешения завершить ее.
+type blockingExecutor struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (e *blockingExecutor) Execute(ctx context.Context, cmd string) (executor.Result, error) {
+	e.started <- struct{}{}
+	<-e.release
+	return executor.Result{Text: "done"}, nil
+}
+
+func TestServer_ShutdownDrainsInFlightCommand(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	exec := &blockingExecutor{started: make(chan struct{}), release: make(chan struct{})}
+	srv := server.NewServer(exec)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ctx, ln)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	if _, err := conn.Write([]byte("get foo\n")); err != nil {
+		t.Fatalf("failed to write command: %v", err)
+	}
+	<-exec.started
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- srv.Shutdown(ctx)
+	}()
+
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Shutdown returned before in-flight command completed: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(exec.release)
+
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read reply: %v", err)
+	}
+	if reply != "done\n" {
+		t.Fatalf("expected reply %q, got %q", "done\n", reply)
+	}
+
+	if err := <-shutdownErr; err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if err := <-serveErr; !errors.Is(err, server.ErrServerClosed) {
+		t.Fatalf("expected Serve to return %v, got %v", server.ErrServerClosed, err)
+	}
+	if _, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+		t.Fatalf("expected listener to be closed after Shutdown")
+	}
+}
+
+func TestServer_ShutdownDeadline(t *testing.T) {
+	t.Parallel()
+
+	exec := &blockingExecutor{started: make(chan struct{}), release: make(chan struct{})}
+	t.Cleanup(func() {
+		close(exec.release)
+	})
+	srv := server.NewServer(exec)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go srv.Serve(context.Background(), ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	if _, err := conn.Write([]byte("get foo\n")); err != nil {
+		t.Fatalf("failed to write command: %v", err)
+	}
+	<-exec.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestListenAndServe(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Занимаем и сразу освобождаем свободный порт, чтобы узнать адрес заранее
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	exec := executor.NewKVExecutor(storage.NewInMemoryKVEngine())
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe(ctx, addr, exec)
+	}()
+
+	var conn net.Conn
+	deadline := time.Now().Add(time.Second)
+	for {
+		conn, err = net.Dial("tcp", addr)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	reader := bufio.NewReader(conn)
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{cmd: "set foo bar", want: "OK\n"},
+		{cmd: "get foo", want: "bar\n"},
+		{cmd: "get missing", want: "Error: key not found\n"},
+	}
+	for _, tt := range tests {
+		if _, err := conn.Write([]byte(tt.cmd + "\r\n")); err != nil {
+			t.Fatalf("failed to write %q: %v", tt.cmd, err)
+		}
+		reply, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read reply to %q: %v", tt.cmd, err)
+		}
+		if reply != tt.want {
+			t.Fatalf("%q: expected reply %q, got %q", tt.cmd, tt.want, reply)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			t.Fatalf("ListenAndServe failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("ListenAndServe did not return after context cancellation")
+	}
+}
+
+func TestServer_SessionsAreIsolated(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	srv := server.NewServer(executor.NewKVExecutor(storage.NewInMemoryKVEngine()))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go srv.Serve(ctx, ln)
+	t.Cleanup(func() {
+		srv.Shutdown(ctx)
+	})
+
+	dial := func() func(cmd string) string {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		t.Cleanup(func() {
+			conn.Close()
+		})
+		reader := bufio.NewReader(conn)
+		return func(cmd string) string {
+			if _, err := conn.Write([]byte(cmd + "\n")); err != nil {
+				t.Fatalf("failed to write %q: %v", cmd, err)
+			}
+			reply, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("failed to read reply to %q: %v", cmd, err)
+			}
+			return reply
+		}
+	}
+	a, b := dial(), dial()
+
+	steps := []struct {
+		conn func(cmd string) string
+		cmd  string
+		want string
+	}{
+		// Транзакция первого соединения не перехватывает записи второго
+		{a, "begin", "OK\n"},
+		{a, "set x 1", "OK\n"},
+		{b, "set y 2", "OK\n"},
+		{b, "get x", "Error: key not found\n"},
+		{b, "commit", "Error: no active transaction\n"},
+		{a, "rollback", "OK\n"},
+		{a, "get x", "Error: key not found\n"},
+		{a, "get y", "2\n"},
+		// Форк первого соединения не виден второму
+		{a, "fork", "OK\n"},
+		{a, "set z 3", "OK\n"},
+		{b, "get z", "Error: key not found\n"},
+		{b, "set w 4", "OK\n"},
+		{b, "discard", "Error: engine is not forked\n"},
+		{a, "get w", "Error: key not found\n"},
+		{a, "discard", "OK\n"},
+		{a, "get w", "4\n"},
+	}
+	for i, step := range steps {
+		if reply := step.conn(step.cmd); reply != step.want {
+			t.Fatalf("step %d %q: expected reply %q, got %q", i, step.cmd, step.want, reply)
+		}
+	}
+}
+
+func TestServer_ShutdownCommandIgnoresCase(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	srv := server.NewServer(executor.NewKVExecutor(storage.NewInMemoryKVEngine()))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ctx, ln)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("  SHUTDOWN now\n")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read reply: %v", err)
+	}
+	if reply != "OK\n" {
+		t.Fatalf("expected reply %q, got %q", "OK\n", reply)
+	}
+
+	select {
+	case <-serveErr:
+	case <-time.After(time.Second):
+		t.Fatalf("Serve did not return after the shutdown command")
+	}
+}
@@ -0,0 +1,42 @@
+package shell
+
+import (
+	"bufio"
+	"io"
+)
+
+// LineReader — источник строк для Shell. ReadLine возвращает строку без перевода строки
+// и io.EOF, когда строки закончились.
+type LineReader interface {
+	ReadLine() (string, error)
+}
+
+// historyRecorder реализуется источниками строк, позволяющими перебирать ранее введенные команды.
+type historyRecorder interface {
+	AddHistory(line string)
+}
+
+// interrupter реализуется источниками строк, которым нужно вернуть устройство ввода
+// в исходное состояние, если ожидание строки прервано.
+type interrupter interface {
+	Interrupt()
+}
+
+// scannerLineReader читает строки из произвольного io.Reader.
+type scannerLineReader struct {
+	scanner *bufio.Scanner
+}
+
+func newScannerLineReader(r io.Reader) *scannerLineReader {
+	return &scannerLineReader{scanner: bufio.NewScanner(r)}
+}
+
+func (r *scannerLineReader) ReadLine() (string, error) {
+	if r.scanner.Scan() {
+		return r.scanner.Text(), nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", io.EOF
+}
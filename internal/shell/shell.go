@@ -3,51 +3,285 @@ package shell
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/Argentum88/godb/internal/executor"
 )
 
+const (
+	prompt             = "godb> "
+	continuationPrompt = "  ... "
+)
+
+// shellHelpRows дополняют справку исполнителя командами самой оболочки.
+var shellHelpRows = [][]string{
+	executor.HelpRow("history", "list commands run in this session"),
+	executor.HelpRow("exit | quit", "leave the shell"),
+}
+
+var ErrScriptFailed = errors.New("script failed")
+
 type Shell struct {
-	executor executor.Executor
+	executor        executor.Executor
+	history         []string
+	continueOnError bool
+	jsonOutput      bool
 }
 
-func NewShell(executor executor.Executor) *Shell {
-	return &Shell{executor: executor}
+// Option настраивает Shell при создании.
+type Option func(s *Shell)
+
+// WithContinueOnError отключает остановку RunScript на первой ошибочной команде.
+func WithContinueOnError() Option {
+	return func(s *Shell) {
+		s.continueOnError = true
+	}
+}
+
+// WithJSONOutput печатает результат каждой команды, включая ошибки, отдельной строкой JSON
+// вместо текста для человека. Формат строки описан в executor.Result.MarshalJSON.
+func WithJSONOutput() Option {
+	return func(s *Shell) {
+		s.jsonOutput = true
+	}
 }
 
+func NewShell(executor executor.Executor, opts ...Option) *Shell {
+	s := &Shell{executor: executor}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// runMode определяет поведение цикла чтения команд.
+type runMode struct {
+	interactive bool // Печатать приглашение
+	stopOnError bool // Прерывать выполнение на первой ошибочной команде
+}
+
+// Run читает команды из in и выполняет их, печатая результаты в out.
+// Строки, начинающиеся с #, считаются комментариями. Обратный слеш в конце строки
+// переносит команду на следующую строку, а точка с запятой разделяет несколько команд
+// в одной строке. Приглашение печатается, только если in — терминал;
+// в этом случае доступны редактирование строки и перебор истории стрелками.
+// При отмене ctx Run перестает ждать ввод и возвращает ошибку контекста.
 func (s *Shell) Run(ctx context.Context, in io.Reader, out io.Writer) error {
-	scanner := bufio.NewScanner(in)
+	if f, ok := in.(*os.File); ok && isTerminal(f) {
+		return s.run(ctx, newTerminalLineReader(f, out), out, runMode{interactive: true})
+	}
+	return s.run(ctx, newScannerLineReader(in), out, runMode{})
+}
+
+// RunLines выполняет команды, читая строки из lr, без печати приглашения.
+func (s *Shell) RunLines(ctx context.Context, lr LineReader, out io.Writer) error {
+	return s.run(ctx, lr, out, runMode{})
+}
 
+// RunScript выполняет команды из r без приглашения. На первой ошибочной команде
+// выполнение прерывается с ErrScriptFailed, если не задан WithContinueOnError.
+// Команда exit или quit, как и конец ввода, завершает сценарий без ошибки.
+func (s *Shell) RunScript(ctx context.Context, r io.Reader, out io.Writer) error {
+	return s.run(ctx, newScannerLineReader(r), out, runMode{stopOnError: !s.continueOnError})
+}
+
+// run выполняет команды, буферизуя вывод: в интерактивном режиме буфер сбрасывается
+// перед каждым ожиданием ввода, чтобы приглашение и результат появлялись сразу,
+// а при выполнении сценария — по заполнении и при завершении, что экономит системные вызовы.
+// Ошибка сброса буфера возвращается, если выполнение не завершилось другой ошибкой.
+func (s *Shell) run(ctx context.Context, lr LineReader, out io.Writer, mode runMode) error {
+	bw := bufio.NewWriter(out)
+	err := s.runBuffered(ctx, lr, bw, mode)
+	if flushErr := bw.Flush(); flushErr != nil && err == nil {
+		err = fmt.Errorf("failed to write output: %w", flushErr)
+	}
+	return err
+}
+
+func (s *Shell) runBuffered(ctx context.Context, lr LineReader, out *bufio.Writer, mode runMode) error {
+	var (
+		pending strings.Builder
+		lineNo  int
+	)
 	for {
-		fmt.Fprint(out, "godb> ")
+		if mode.interactive {
+			if pending.Len() == 0 {
+				fmt.Fprint(out, prompt)
+			} else {
+				fmt.Fprint(out, continuationPrompt)
+			}
+			if err := out.Flush(); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+		}
 
-		if !scanner.Scan() {
-			break // EOF или ошибка
+		line, err := readLine(ctx, lr)
+		if errors.Is(err, io.EOF) {
+			break
 		}
+		if err != nil {
+			return err
+		}
+		lineNo++
 
-		cmd := strings.TrimSpace(scanner.Text())
-		if cmd == "" {
+		if pending.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), "#") {
 			continue
 		}
-
-		if cmd == "exit" || cmd == "quit" {
-			break
+		if trimmed := strings.TrimRight(line, " \t"); strings.HasSuffix(trimmed, `\`) {
+			pending.WriteString(strings.TrimSuffix(trimmed, `\`))
+			continue
 		}
+		pending.WriteString(line)
 
-		result, err := s.executor.Execute(ctx, cmd)
+		line = pending.String()
+		pending.Reset()
+		exit, err := s.executeLine(ctx, lr, line, out, mode)
 		if err != nil {
-			fmt.Fprintf(out, "Error: %v\n", err)
-		} else {
-			fmt.Fprintf(out, "%s\n", result.Text)
+			return fmt.Errorf("%w: line %d: %w", ErrScriptFailed, lineNo, err)
+		}
+		if exit {
+			return nil
+		}
+	}
+
+	// Выполняем команду, оборванную переносом в последней строке
+	if _, err := s.executeLine(ctx, lr, pending.String(), out, mode); err != nil {
+		return fmt.Errorf("%w: line %d: %w", ErrScriptFailed, lineNo, err)
+	}
+	return nil
+}
+
+// readLine читает строку из lr, прерывая ожидание при отмене ctx.
+// Прерванное чтение продолжается в фоне, пока не придет строка или конец ввода,
+// а его результат отбрасывается.
+func readLine(ctx context.Context, lr LineReader) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	type readResult struct {
+		line string
+		err  error
+	}
+	done := make(chan readResult, 1)
+	go func() {
+		line, err := lr.ReadLine()
+		done <- readResult{line: line, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.line, res.err
+	case <-ctx.Done():
+		if ir, ok := lr.(interrupter); ok {
+			ir.Interrupt()
+		}
+		return "", ctx.Err()
+	}
+}
+
+// executeLine выполняет по порядку команды строки, разделенные точкой с запятой.
+// Возвращает exit == true, если встретилась команда exit или quit в любом регистре,
+// и ошибку команды, если в режиме mode.stopOnError выполнение нужно прервать.
+func (s *Shell) executeLine(ctx context.Context, lr LineReader, line string, out io.Writer, mode runMode) (exit bool, err error) {
+	for _, cmd := range splitStatements(line) {
+		if isExitCommand(cmd) {
+			return true, nil
+		}
+		s.addHistory(lr, cmd)
+		if err := s.execute(ctx, cmd, out); err != nil && mode.stopOnError {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// History возвращает команды, выполненные в текущем сеансе, в порядке выполнения.
+func (s *Shell) History() []string {
+	return append([]string(nil), s.history...)
+}
+
+// addHistory запоминает команду в истории сеанса и передает ее источнику строк,
+// если тот поддерживает перебор истории.
+func (s *Shell) addHistory(lr LineReader, cmd string) {
+	s.history = append(s.history, cmd)
+	if hr, ok := lr.(historyRecorder); ok {
+		hr.AddHistory(cmd)
+	}
+}
+
+// execute выполняет команду и печатает результат или ошибку. Ошибку команды также возвращает.
+func (s *Shell) execute(ctx context.Context, cmd string, out io.Writer) error {
+	if strings.EqualFold(cmd, "history") {
+		if s.jsonOutput {
+			return s.printJSON(out, s.historyResult())
+		}
+		for i, entry := range s.history {
+			fmt.Fprintf(out, "%d %s\n", i+1, entry)
 		}
+		return nil
 	}
 
-	if err := scanner.Err(); err != nil {
+	result, err := s.executor.Execute(ctx, cmd)
+	if err != nil {
+		if s.jsonOutput {
+			if printErr := s.printJSON(out, executor.ErrorResult(result.Command, err)); printErr != nil {
+				return printErr
+			}
+		} else {
+			fmt.Fprintf(out, "Error: %v\n", err)
+		}
 		return err
 	}
+	if strings.EqualFold(cmd, "help") && result.Kind == executor.ResultRows {
+		command := result.Command
+		result = executor.RowsResult(append(result.Rows, shellHelpRows...))
+		result.Command = command
+	}
+	if s.jsonOutput {
+		return s.printJSON(out, result)
+	}
+	fmt.Fprintf(out, "%s\n", result.Render())
+	return nil
+}
 
+// historyResult представляет историю сеанса таблицей из номера и текста команды.
+func (s *Shell) historyResult() executor.Result {
+	rows := make([][]string, len(s.history))
+	for i, entry := range s.history {
+		rows[i] = []string{strconv.Itoa(i + 1), entry}
+	}
+	result := executor.RowsResult(rows)
+	result.Command = "history"
+	return result
+}
+
+// printJSON печатает результат строкой JSON.
+func (s *Shell) printJSON(out io.Writer, result executor.Result) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+	fmt.Fprintf(out, "%s\n", data)
 	return nil
 }
+
+// isExitCommand сообщает, завершает ли cmd работу оболочки
+func isExitCommand(cmd string) bool {
+	return strings.EqualFold(cmd, "exit") || strings.EqualFold(cmd, "quit")
+}
+
+// isTerminal сообщает, подключен ли f к терминалу
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
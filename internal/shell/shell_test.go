@@ -3,8 +3,13 @@ package shell_test
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Argentum88/godb/internal/executor"
 	"github.com/Argentum88/godb/internal/shell"
@@ -33,6 +38,21 @@ func TestShell_Commands(t *testing.T) {
 			commands: []string{"delete foo", "exit"},
 			expected: []string{"Error:", "unknown command"},
 		},
+		{
+			name:     "quoted value with spaces",
+			commands: []string{`set greeting "hello world"`, "get greeting", "exit"},
+			expected: []string{"OK", "hello world"},
+		},
+		{
+			name:     "help",
+			commands: []string{"help", "exit"},
+			expected: []string{"set <key> <value>", "get <key>", "exit"},
+		},
+		{
+			name:     "info prefix",
+			commands: []string{"set user:1 alice", "set user:2 bob", "info prefix user:", "info prefix none:", "exit"},
+			expected: []string{"keys=2 bytes=8", "keys=0 bytes=0"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -59,3 +79,291 @@ func TestShell_Commands(t *testing.T) {
 		})
 	}
 }
+
+func TestShell_Script(t *testing.T) {
+	t.Parallel()
+	engine := storage.NewInMemoryKVEngine()
+	exec := executor.NewKVExecutor(engine)
+	sh := shell.NewShell(exec)
+
+	script := `# заполняем данные
+set foo bar
+
+  # комментарий с отступом
+set greeting \
+  "hello world"
+get foo
+get \
+greeting
+exit
+get foo
+`
+	output := &bytes.Buffer{}
+	if err := sh.Run(context.Background(), strings.NewReader(script), output); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "OK\nOK\nbar\nhello world\n"
+	if output.String() != expected {
+		t.Fatalf("expected output %q, got %q", expected, output.String())
+	}
+}
+
+// fakeLineReader отдает заранее заданные строки и запоминает переданную ему историю
+type fakeLineReader struct {
+	lines   []string
+	history []string
+}
+
+func (r *fakeLineReader) ReadLine() (string, error) {
+	if len(r.lines) == 0 {
+		return "", io.EOF
+	}
+	line := r.lines[0]
+	r.lines = r.lines[1:]
+	return line, nil
+}
+
+func (r *fakeLineReader) AddHistory(line string) {
+	r.history = append(r.history, line)
+}
+
+func TestShell_History(t *testing.T) {
+	t.Parallel()
+	exec := executor.NewKVExecutor(storage.NewInMemoryKVEngine())
+	sh := shell.NewShell(exec)
+
+	lr := &fakeLineReader{lines: []string{
+		"set foo bar",
+		"# комментарий не попадает в историю",
+		"",
+		`get \`,
+		"foo",
+		"history",
+	}}
+	output := &bytes.Buffer{}
+	if err := sh.RunLines(context.Background(), lr, output); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"set foo bar", "get foo", "history"}
+	if !slices.Equal(sh.History(), want) {
+		t.Fatalf("expected history %q, got %q", want, sh.History())
+	}
+	if !slices.Equal(lr.history, want) {
+		t.Fatalf("expected line reader to receive history %q, got %q", want, lr.history)
+	}
+
+	expected := "OK\nbar\n1 set foo bar\n2 get foo\n3 history\n"
+	if output.String() != expected {
+		t.Fatalf("expected output %q, got %q", expected, output.String())
+	}
+}
+
+func TestShell_JSONOutput(t *testing.T) {
+	t.Parallel()
+	exec := executor.NewKVExecutor(storage.NewInMemoryKVEngine())
+	sh := shell.NewShell(exec, shell.WithJSONOutput())
+
+	input := strings.NewReader("SET foo \"hello world\"\nget foo\nget missing\nhistory\n")
+	output := &bytes.Buffer{}
+	if err := sh.Run(context.Background(), input, output); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		`{"command":"set","kind":"ok","affected":1}`,
+		`{"command":"get","kind":"value","value":"hello world"}`,
+		`{"command":"get","kind":"error","error":"key not found"}`,
+		`{"command":"history","kind":"rows","rows":[["1","SET foo \"hello world\""],["2","get foo"],["3","get missing"],["4","history"]]}`,
+	}
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if !slices.Equal(lines, expected) {
+		t.Fatalf("expected JSON lines\n%s\ngot\n%s", strings.Join(expected, "\n"), output.String())
+	}
+}
+
+func TestShell_MultiStatement(t *testing.T) {
+	t.Parallel()
+	exec := executor.NewKVExecutor(storage.NewInMemoryKVEngine())
+	sh := shell.NewShell(exec)
+
+	script := `# несколько команд в одной строке
+set a 1; set b "x;y" ;; get a;get b
+  # закомментированная команда не выполняется: get a
+get missing; get a; exit; get b
+get a
+`
+	output := &bytes.Buffer{}
+	if err := sh.Run(context.Background(), strings.NewReader(script), output); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "OK\nOK\n1\nx;y\nError: key not found\n1\n"
+	if output.String() != expected {
+		t.Fatalf("expected output %q, got %q", expected, output.String())
+	}
+}
+
+func TestShell_ExitAnyCase(t *testing.T) {
+	t.Parallel()
+	for _, exitCmd := range []string{"EXIT", "Quit", "exit  "} {
+		sh := shell.NewShell(executor.NewKVExecutor(storage.NewInMemoryKVEngine()))
+		script := "SET foo bar\nGet foo\n" + exitCmd + "\nget foo\n"
+		output := &bytes.Buffer{}
+		if err := sh.Run(context.Background(), strings.NewReader(script), output); err != nil {
+			t.Fatalf("%q: unexpected error: %v", exitCmd, err)
+		}
+		if expected := "OK\nbar\n"; output.String() != expected {
+			t.Fatalf("%q: expected output %q, got %q", exitCmd, expected, output.String())
+		}
+	}
+}
+
+func TestShell_RunCanceled(t *testing.T) {
+	t.Parallel()
+	sh := shell.NewShell(executor.NewKVExecutor(storage.NewInMemoryKVEngine()))
+
+	// Ввод никогда не заканчивается: Run может завершиться только отменой контекста
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- sh.Run(ctx, pr, io.Discard)
+	}()
+
+	if _, err := io.WriteString(pw, "set foo bar\n"); err != nil {
+		t.Fatalf("failed to write command: %v", err)
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected %v, got %v", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Run did not return after context cancellation")
+	}
+}
+
+func TestShell_RunScript(t *testing.T) {
+	t.Parallel()
+	script := `set foo bar
+get foo
+get missing
+set after error
+exit
+get foo
+`
+	tests := []struct {
+		name     string
+		opts     []shell.Option
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "abort on first error",
+			expected: "OK\nbar\nError: key not found\n",
+			wantErr:  true,
+		},
+		{
+			name:     "continue on error",
+			opts:     []shell.Option{shell.WithContinueOnError()},
+			expected: "OK\nbar\nError: key not found\nOK\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			exec := executor.NewKVExecutor(storage.NewInMemoryKVEngine())
+			sh := shell.NewShell(exec, tt.opts...)
+
+			output := &bytes.Buffer{}
+			err := sh.RunScript(context.Background(), strings.NewReader(script), output)
+			if tt.wantErr {
+				if !errors.Is(err, shell.ErrScriptFailed) || !errors.Is(err, storage.ErrKeyNotFound) {
+					t.Fatalf("expected script failure caused by ErrKeyNotFound, got %v", err)
+				}
+				if !strings.Contains(err.Error(), "line 3") {
+					t.Fatalf("expected error to point at line 3, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if output.String() != tt.expected {
+				t.Fatalf("expected output %q, got %q", tt.expected, output.String())
+			}
+		})
+	}
+}
+
+// countingWriter считает вызовы Write и после failAfter успешных вызовов возвращает ошибку
+type countingWriter struct {
+	bytes.Buffer
+	writes    int
+	failAfter int
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	if w.failAfter > 0 && w.writes >= w.failAfter {
+		return 0, errWriteFailed
+	}
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestShell_BufferedOutput(t *testing.T) {
+	t.Parallel()
+	const commands = 1000
+
+	var script, expected strings.Builder
+	for i := range commands {
+		fmt.Fprintf(&script, "set key%d value%d\nget key%d\n", i, i, i)
+		fmt.Fprintf(&expected, "OK\nvalue%d\n", i)
+	}
+
+	sh := shell.NewShell(executor.NewKVExecutor(storage.NewInMemoryKVEngine()))
+	out := &countingWriter{}
+	if err := sh.RunScript(context.Background(), strings.NewReader(script.String()), out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != expected.String() {
+		t.Fatalf("unexpected output of %d commands", 2*commands)
+	}
+	// Без приглашения вывод сбрасывается блоками, а не по записи на результат
+	if out.writes >= commands {
+		t.Fatalf("expected output to be batched, got %d writes for %d results", out.writes, 2*commands)
+	}
+}
+
+func TestShell_OutputError(t *testing.T) {
+	t.Parallel()
+	sh := shell.NewShell(executor.NewKVExecutor(storage.NewInMemoryKVEngine()))
+
+	out := &countingWriter{failAfter: 1}
+	err := sh.Run(context.Background(), strings.NewReader(strings.Repeat("set foo bar\n", 10000)), out)
+	if !errors.Is(err, errWriteFailed) {
+		t.Fatalf("expected Run to report the write error, got %v", err)
+	}
+}
+
+func BenchmarkShell_RunScript(b *testing.B) {
+	var script strings.Builder
+	for i := range 1000 {
+		fmt.Fprintf(&script, "set key%d value%d\nget key%d\n", i, i, i)
+	}
+	sh := shell.NewShell(executor.NewKVExecutor(storage.NewInMemoryKVEngine()))
+
+	b.ResetTimer()
+	for range b.N {
+		if err := sh.RunScript(context.Background(), strings.NewReader(script.String()), io.Discard); err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package shell
+
+import "strings"
+
+// splitStatements разбивает строку на команды по точке с запятой.
+// Точка с запятой внутри двойных кавычек (с учетом экранирования \") разделителем не считается.
+// Пустые команды пропускаются.
+func splitStatements(line string) []string {
+	var (
+		stmts   []string
+		start   int
+		inQuote bool
+		escaped bool
+	)
+	appendStmt := func(stmt string) {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case inQuote && r == '\\':
+			escaped = true
+		case r == '"':
+			inQuote = !inQuote
+		case !inQuote && r == ';':
+			appendStmt(line[start:i])
+			start = i + 1
+		}
+	}
+	appendStmt(line[start:])
+	return stmts
+}
@@ -0,0 +1,198 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	keyCtrlA     = 0x01
+	keyCtrlC     = 0x03
+	keyCtrlD     = 0x04
+	keyCtrlE     = 0x05
+	keyBackspace = 0x08
+	keyEnter     = '\r'
+	keyNewline   = '\n'
+	keyEscape    = 0x1b
+	keyDelete    = 0x7f
+)
+
+// terminalLineReader читает строки с терминала в неканоническом режиме,
+// поддерживая перемещение курсора, удаление символов и перебор истории стрелками.
+// Если перевести терминал в неканонический режим не удалось, строки читаются как есть.
+type terminalLineReader struct {
+	file    *os.File
+	in      *bufio.Reader
+	out     io.Writer
+	history []string
+
+	mu      sync.Mutex
+	restore func() // Восстановление режима терминала во время ReadLine в неканоническом режиме
+}
+
+func newTerminalLineReader(f *os.File, out io.Writer) *terminalLineReader {
+	return &terminalLineReader{file: f, in: bufio.NewReader(f), out: out}
+}
+
+func (r *terminalLineReader) AddHistory(line string) {
+	r.history = append(r.history, line)
+}
+
+// Interrupt возвращает терминал в исходный режим, не дожидаясь завершения ReadLine.
+func (r *terminalLineReader) Interrupt() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.restore != nil {
+		r.restore()
+	}
+}
+
+func (r *terminalLineReader) ReadLine() (string, error) {
+	restore, err := makeRaw(r.file)
+	if err != nil {
+		return r.readCooked()
+	}
+	r.setRestore(restore)
+	defer func() {
+		r.setRestore(nil)
+		restore()
+	}()
+
+	var (
+		buf     []rune
+		cursor  int
+		histPos = len(r.history)
+		draft   []rune // Набранная строка, пока просматривается история
+	)
+	for {
+		ch, _, err := r.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		prevCursor := cursor
+		switch ch {
+		case keyEnter, keyNewline:
+			fmt.Fprint(r.out, "\r\n")
+			return string(buf), nil
+		case keyCtrlC:
+			// Отменяем набранную строку
+			fmt.Fprint(r.out, "^C\r\n")
+			return "", nil
+		case keyCtrlD:
+			if len(buf) == 0 {
+				fmt.Fprint(r.out, "\r\n")
+				return "", io.EOF
+			}
+			continue
+		case keyCtrlA:
+			cursor = 0
+		case keyCtrlE:
+			cursor = len(buf)
+		case keyBackspace, keyDelete:
+			if cursor == 0 {
+				continue
+			}
+			buf = append(buf[:cursor-1], buf[cursor:]...)
+			cursor--
+		case keyEscape:
+			seq, err := r.readEscape()
+			if err != nil {
+				return "", err
+			}
+			switch seq {
+			case 'A': // Вверх — предыдущая команда
+				if histPos == 0 {
+					continue
+				}
+				if histPos == len(r.history) {
+					draft = buf
+				}
+				histPos--
+				buf = []rune(r.history[histPos])
+				cursor = len(buf)
+			case 'B': // Вниз — следующая команда или набранная строка
+				if histPos == len(r.history) {
+					continue
+				}
+				histPos++
+				if histPos == len(r.history) {
+					buf = draft
+				} else {
+					buf = []rune(r.history[histPos])
+				}
+				cursor = len(buf)
+			case 'C':
+				if cursor < len(buf) {
+					cursor++
+				}
+			case 'D':
+				if cursor > 0 {
+					cursor--
+				}
+			case 'H':
+				cursor = 0
+			case 'F':
+				cursor = len(buf)
+			default:
+				continue
+			}
+		default:
+			if ch < ' ' {
+				continue
+			}
+			buf = append(buf[:cursor], append([]rune{ch}, buf[cursor:]...)...)
+			cursor++
+		}
+		r.redraw(prevCursor, buf, cursor)
+	}
+}
+
+func (r *terminalLineReader) setRestore(restore func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.restore = restore
+}
+
+// readEscape читает управляющую последовательность вида ESC [ X и возвращает X.
+// Последовательности с числовым параметром (ESC [ 3 ~ и подобные) пропускаются целиком.
+func (r *terminalLineReader) readEscape() (rune, error) {
+	ch, _, err := r.in.ReadRune()
+	if err != nil || ch != '[' {
+		return 0, err
+	}
+	ch, _, err = r.in.ReadRune()
+	for err == nil && ch >= '0' && ch <= '9' {
+		if ch, _, err = r.in.ReadRune(); err == nil && ch == '~' {
+			return 0, nil
+		}
+	}
+	return ch, err
+}
+
+// redraw перерисовывает строку после приглашения: возвращает курсор к началу строки,
+// печатает buf, стирает остаток экранной строки и ставит курсор в позицию cursor.
+func (r *terminalLineReader) redraw(prevCursor int, buf []rune, cursor int) {
+	if prevCursor > 0 {
+		fmt.Fprintf(r.out, "\x1b[%dD", prevCursor)
+	}
+	fmt.Fprintf(r.out, "%s\x1b[K", string(buf))
+	if back := len(buf) - cursor; back > 0 {
+		fmt.Fprintf(r.out, "\x1b[%dD", back)
+	}
+}
+
+// readCooked читает строку целиком, полагаясь на редактирование средствами терминала.
+func (r *terminalLineReader) readCooked() (string, error) {
+	line, err := r.in.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line != "" {
+			return line, nil
+		}
+		return "", err
+	}
+	return line[:len(line)-1], nil
+}
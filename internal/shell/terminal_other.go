@@ -0,0 +1,13 @@
+//go:build !linux
+
+package shell
+
+import (
+	"errors"
+	"os"
+)
+
+// makeRaw не поддерживается вне Linux: строки читаются в каноническом режиме терминала.
+func makeRaw(f *os.File) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
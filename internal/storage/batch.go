@@ -0,0 +1,47 @@
+package storage
+
+import "bytes"
+
+// Batch накапливает записи и удаления, которые движок применяет атомарно через ApplyBatch.
+// Операции применяются в порядке добавления: для повторяющегося ключа побеждает последняя.
+// Нулевое значение Batch готово к использованию. Batch не безопасен для конкурентного использования.
+type Batch struct {
+	ops []batchOp
+}
+
+// batchOp — одна операция пакета. value == nil при deleted == true.
+type batchOp struct {
+	key     []byte
+	value   []byte
+	deleted bool
+}
+
+// Set добавляет в пакет запись value в ключ key. Ключ и значение копируются.
+func (b *Batch) Set(key, value []byte) {
+	b.ops = append(b.ops, batchOp{key: bytes.Clone(key), value: bytes.Clone(value)})
+}
+
+// Delete добавляет в пакет удаление ключа. Удаление отсутствующего ключа ничего не делает.
+func (b *Batch) Delete(key []byte) {
+	b.ops = append(b.ops, batchOp{key: bytes.Clone(key), deleted: true})
+}
+
+// Len возвращает количество операций в пакете.
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Reset очищает пакет для повторного использования.
+func (b *Batch) Reset() {
+	b.ops = b.ops[:0]
+}
+
+// checkBatch проверяет размеры всех ключей и записываемых значений пакета.
+func (o engineOptions) checkBatch(b *Batch) error {
+	for _, op := range b.ops {
+		if err := o.checkSize(op.key, op.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,16 +1,32 @@
 package buffer
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/Argentum88/godb/internal/storage/page"
 )
 
 var ErrBufferPoolFull = errors.New("buffer pool is full, all pages are pinned")
+var ErrResizePinned = errors.New("cannot shrink buffer pool: excess frame is pinned")
+var ErrPagePinned = errors.New("page is pinned")
+var ErrPageDirty = errors.New("page has unflushed changes")
+var ErrPageNotResident = errors.New("page is not resident in buffer pool")
+var ErrPinLimit = errors.New("buffer pool pin limit reached")
+
+// defaultCheckpointPages — сколько грязных страниц по умолчанию сбрасывает чекпоинтер за один тик
+const defaultCheckpointPages = 64
+
+// batchFlushThreshold — сколько смежных грязных страниц должно набраться,
+// чтобы FlushAllPages записал их одним пакетом WritePages
+const batchFlushThreshold = 4
 
 type frameID int
 
@@ -27,6 +43,9 @@ type replacer interface {
 	// Unpin сообщает Replacer, что страница с frameID больше не закреплена
 	// и может быть рассмотрена как кандидат на вытеснение.
 	Unpin(frameID frameID)
+
+	// Size возвращает количество кандидатов на вытеснение.
+	Size() int
 }
 
 type LatchMode int
@@ -36,11 +55,28 @@ const (
 	LatchExclusive
 )
 
+// frame — ячейка буферного пула.
+//
+// Дисциплина блокировок:
+//   - id и срез data (но не его содержимое) задаются при создании фрейма и больше не меняются,
+//     поэтому читаются без блокировок. Фреймы хранятся по указателю, поэтому Resize
+//     не перемещает их в памяти, и pagePin обращается к своему фрейму напрямую;
+//   - pageID и pinCount читаются и изменяются только под Pool.mu;
+//   - dirty устанавливается под Pool.mu вместе с добавлением фрейма в dirtyFrames
+//     и сбрасывается под Pool.mu только при pinCount == 0 либо в FlushPage, который держит
+//     разделяемую защелку. Поэтому владелец эксклюзивной защелки может читать dirty
+//     без Pool.mu: пока он держит защелку, флаг не сбросится;
+//   - содержимое data читается и изменяется только под latch, который держит pagePin.
+//     Пул обращается к содержимому под Pool.mu только у фреймов с pinCount == 0:
+//     пока pinCount > 0, фрейм не вытесняется и не сбрасывается на диск.
+//     Unpin отпускает latch раньше, чем уменьшает pinCount, поэтому pinCount == 0
+//     гарантирует, что latch никем не удерживается;
+//   - несколько latch одновременно захватываются по возрастанию pageID, см. FetchPagesOrdered.
 type frame struct {
 	id       frameID
 	pageID   page.PageID
 	data     []byte
-	dirty    bool
+	dirty    atomic.Bool
 	pinCount int
 	latch    sync.RWMutex
 }
@@ -48,9 +84,16 @@ type frame struct {
 type pagePin struct {
 	pageID     page.PageID
 	frameID    frameID
+	frame      *frame
 	mode       LatchMode
 	pool       *Pool
 	isUnpinned atomic.Bool
+	internal   bool // Закрепление самого пула, не учитывается в лимите закреплений
+}
+
+// PageID возвращает идентификатор закрепленной страницы.
+func (p *pagePin) PageID() page.PageID {
+	return p.pageID
 }
 
 // Bytes возвращает срез байтов, представляющий содержимое страницы.
@@ -59,39 +102,55 @@ func (p *pagePin) Bytes() []byte {
 		panic("attempt to access bytes of an unpinned page")
 	}
 
-	return p.pool.frames[p.frameID].data
+	return p.frame.data
 }
 
 // MarkDirty помечает страницу как измененную (грязную).
 // Это означает, что перед выгрузкой страницы на диск ее содержимое должно быть записано.
+// Повторные вызовы для уже грязной страницы не захватывают мьютекс пула.
 func (p *pagePin) MarkDirty() {
 	if p.isUnpinned.Load() {
 		panic("attempt to mark an unpinned page as dirty")
 	}
 
+	f := p.frame
+	if f.dirty.Load() {
+		return
+	}
+
 	p.pool.mu.Lock()
 	defer p.pool.mu.Unlock()
 
-	p.pool.frames[p.frameID].dirty = true
+	f.dirty.Store(true)
+	p.pool.dirtyFrames[p.frameID] = struct{}{}
 }
 
 // Unpin снимает закрепление страницы в буферном пуле.
 // Делает страницу доступной для вытеснения, если ее pinCount достигает нуля.
 // Если страница была закреплена в эксклюзивном режиме, она будет разблокирована для других операций.
+// Повторный вызов — ошибка вызывающего кода: вместо порчи pinCount и защелки он паникует.
 func (p *pagePin) Unpin() {
 	if !p.isUnpinned.CompareAndSwap(false, true) {
-		return
+		panic(fmt.Sprintf("double unpin of page %d", p.pageID))
 	}
 
+	f := p.frame
 	if p.mode == LatchExclusive {
-		p.pool.frames[p.frameID].latch.Unlock()
+		f.latch.Unlock()
 	} else {
-		p.pool.frames[p.frameID].latch.RUnlock()
+		f.latch.RUnlock()
 	}
 
+	// pinCount уменьшаем только после освобождения latch, см. дисциплину блокировок frame
 	p.pool.mu.Lock()
-	p.pool.frames[p.frameID].pinCount--
-	if p.pool.frames[p.frameID].pinCount == 0 {
+	f.pinCount--
+	if !p.internal {
+		p.pool.pins--
+	}
+	if f.pinCount == 0 {
+		if p.pool.writeThrough && f.dirty.Load() {
+			p.pool.flushFrame(f)
+		}
 		p.pool.replacer.Unpin(p.frameID)
 	}
 	p.pool.mu.Unlock()
@@ -99,49 +158,164 @@ func (p *pagePin) Unpin() {
 
 type Pool struct {
 	pageToFrameMap map[page.PageID]frameID
-	frames         []frame
+	frames         []*frame
 	freeFrameIDs   []frameID
+	dirtyFrames    map[frameID]struct{} // Фреймы с dirty == true, чтобы сброс не обходил весь пул
 	replacer       replacer
 	pm             page.Manager
 	mu             sync.Mutex
+
+	stats      PoolStats
+	prefetchWG sync.WaitGroup // Фоновые чтения, запущенные Prefetch
+
+	writeThrough    bool // Сбрасывать грязную страницу сразу при снятии последнего закрепления
+	prefetch        int  // Сколько следующих страниц подгружать при промахе FetchPage
+	checkpointPages int  // Сколько грязных страниц сбрасывать за один тик чекпоинтера
+	maxPins         int  // Наибольшее количество одновременных закреплений, 0 — без ограничения
+	pins            int  // Закреплений, выданных вызывающему коду и еще не снятых
+
+	flusherMu     sync.Mutex
+	flusherCancel context.CancelFunc
+	flusherDone   chan struct{}
+}
+
+// PoolStats — счетчики обращений к пулу.
+type PoolStats struct {
+	Hits       uint64 // FetchPage нашел страницу в пуле
+	Misses     uint64 // FetchPage прочитал страницу с диска
+	Prefetched uint64 // Страниц подгружено упреждающим чтением
+	Evictions  uint64 // Страниц вытеснено, чтобы освободить фрейм
+}
+
+// PoolCapacity — распределение фреймов пула. Фреймы, которые не свободны и не могут быть вытеснены,
+// закреплены: если Free и Evictable равны нулю, новая страница не поместится в пул.
+type PoolCapacity struct {
+	Frames    int // Всего фреймов
+	Free      int // Фреймов без страницы
+	Evictable int // Фреймов с незакрепленной страницей
+}
+
+// PoolOption настраивает Pool при создании.
+type PoolOption func(p *Pool)
+
+// WithReplacer задает политику вытеснения. По умолчанию используется LRU.
+func WithReplacer(r replacer) PoolOption {
+	return func(p *Pool) {
+		p.replacer = r
+	}
+}
+
+// WithWriteThrough включает сквозную запись: грязная страница записывается на диск
+// при снятии последнего закрепления, а не при вытеснении или сбросе.
+func WithWriteThrough() PoolOption {
+	return func(p *Pool) {
+		p.writeThrough = true
+	}
+}
+
+// WithPrefetch включает упреждающее чтение: при промахе FetchPage в свободные фреймы
+// подгружаются до n следующих по номеру страниц.
+func WithPrefetch(n int) PoolOption {
+	return func(p *Pool) {
+		p.prefetch = n
+	}
+}
+
+// WithCheckpointPages задает, сколько грязных страниц чекпоинтер сбрасывает за один тик.
+func WithCheckpointPages(n int) PoolOption {
+	return func(p *Pool) {
+		p.checkpointPages = n
+	}
 }
 
-func NewPool(replacer replacer, pm page.Manager, size int) *Pool {
+// WithMaxPins ограничивает количество одновременно удерживаемых закреплений страниц.
+// Закрепление сверх лимита завершается ErrPinLimit, что позволяет обнаружить код,
+// который не снимает закрепления, раньше, чем он исчерпает пул. Ноль снимает ограничение.
+func WithMaxPins(n int) PoolOption {
+	return func(p *Pool) {
+		p.maxPins = n
+	}
+}
+
+func NewPool(pm page.Manager, size int, opts ...PoolOption) *Pool {
 	// Инициализация фреймов и свободных frameID
-	frames := make([]frame, size)
+	frames := newFrames(0, size, pm.PageSize())
 	freeFrameIDs := make([]frameID, size)
-	blockOfBytes := make([]byte, size*page.PageSize)
 	for i := range size {
-		left := i * page.PageSize
-		right := left + page.PageSize
-		frames[i].id = frameID(i)
-		frames[i].data = blockOfBytes[left:right]
 		freeFrameIDs[i] = frameID(i)
 	}
 
-	return &Pool{
-		frames:         frames,
-		freeFrameIDs:   freeFrameIDs,
-		pageToFrameMap: make(map[page.PageID]frameID, size),
-		replacer:       replacer,
-		pm:             pm,
+	p := &Pool{
+		frames:          frames,
+		freeFrameIDs:    freeFrameIDs,
+		pageToFrameMap:  make(map[page.PageID]frameID, size),
+		dirtyFrames:     make(map[frameID]struct{}),
+		replacer:        NewLRUReplacer(),
+		pm:              pm,
+		checkpointPages: defaultCheckpointPages,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// newFrames создает count фреймов с идентификаторами начиная с firstID над общим блоком памяти
+func newFrames(firstID frameID, count int, pageSize int) []*frame {
+	frames := make([]*frame, count)
+	blockOfBytes := make([]byte, count*pageSize)
+	for i := range count {
+		left := i * pageSize
+		right := left + pageSize
+		frames[i] = &frame{
+			id:   firstID + frameID(i),
+			data: blockOfBytes[left:right],
+		}
 	}
+	return frames
 }
 
 // NewPage создает новую страницу, выделяя для нее место на диске и в пуле.
+// Если менеджер выдал заново освобожденную страницу, которую еще держит закрепившая ее
+// после освобождения операция, страница возвращается менеджеру, а NewPage — ErrPagePinned.
 func (p *Pool) NewPage(ctx context.Context) (*pagePin, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	p.mu.Lock()
+	if err := p.reservePin(); err != nil {
+		p.mu.Unlock()
+		return nil, err
+	}
 	freeFrame, err := p.findFreeFrame(ctx)
 	if err != nil {
+		p.pins--
 		p.mu.Unlock()
 		return nil, err
 	}
 
 	pageID, err := p.pm.AllocatePage(ctx)
 	if err != nil {
+		p.pins--
 		p.mu.Unlock()
 		return nil, fmt.Errorf("failed to allocate new page: %w", err)
 	}
+	// Освобожденную страницу могло подгрузить упреждающее чтение до ее повторной выдачи.
+	// Пока ее старый фрейм закреплен, страницу выдавать нельзя: у одного PageID оказалось бы два фрейма
+	if staleID, ok := p.pageToFrameMap[pageID]; ok {
+		if p.frames[staleID].pinCount > 0 {
+			p.freeFrameIDs = append(p.freeFrameIDs, freeFrame.id)
+			p.pins--
+			err := p.pm.DeallocatePage(ctx, pageID)
+			p.mu.Unlock()
+			if err != nil {
+				return nil, fmt.Errorf("failed to release page %d: %w", pageID, err)
+			}
+			return nil, fmt.Errorf("%w: freed page %d is still in use", ErrPagePinned, pageID)
+		}
+		p.dropFrame(staleID)
+	}
 	clear(freeFrame.data)
 
 	p.pageToFrameMap[pageID] = freeFrame.id
@@ -154,6 +328,7 @@ func (p *Pool) NewPage(ctx context.Context) (*pagePin, error) {
 	return &pagePin{
 		pageID:  pageID,
 		frameID: freeFrame.id,
+		frame:   freeFrame,
 		mode:    LatchExclusive,
 		pool:    p,
 	}, nil
@@ -162,40 +337,42 @@ func (p *Pool) NewPage(ctx context.Context) (*pagePin, error) {
 // FetchPage извлекает страницу из буферного пула.
 // Если страницы нет в пуле, он загружает ее с диска.
 func (p *Pool) FetchPage(ctx context.Context, pageID page.PageID, mode LatchMode) (*pagePin, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	p.mu.Lock()
+	if err := p.reservePin(); err != nil {
+		p.mu.Unlock()
+		return nil, err
+	}
 	if frameID, ok := p.pageToFrameMap[pageID]; ok {
-		p.frames[frameID].pinCount++
+		p.stats.Hits++
+		f := p.frames[frameID]
+		f.pinCount++
 		p.replacer.Pin(frameID)
 		p.mu.Unlock()
 
 		if mode == LatchExclusive {
-			p.frames[frameID].latch.Lock()
+			f.latch.Lock()
 		} else {
-			p.frames[frameID].latch.RLock()
+			f.latch.RLock()
 		}
 		return &pagePin{
 			pageID:  pageID,
 			frameID: frameID,
+			frame:   f,
 			mode:    mode,
 			pool:    p,
 		}, nil
 	}
 
-	freeFrame, err := p.findFreeFrame(ctx)
+	freeFrame, err := p.loadPage(ctx, pageID)
 	if err != nil {
+		p.pins--
 		p.mu.Unlock()
 		return nil, err
 	}
-	err = p.pm.ReadPage(ctx, pageID, freeFrame.data)
-	if err != nil {
-		p.mu.Unlock()
-		return nil, fmt.Errorf("failed to read page %d from disk: %w", pageID, err)
-	}
-
-	p.pageToFrameMap[pageID] = freeFrame.id
-	p.replacer.Pin(freeFrame.id)
-	freeFrame.pageID = pageID
-	freeFrame.pinCount++
 	p.mu.Unlock()
 
 	if mode == LatchExclusive {
@@ -206,28 +383,588 @@ func (p *Pool) FetchPage(ctx context.Context, pageID page.PageID, mode LatchMode
 	return &pagePin{
 		pageID:  pageID,
 		frameID: freeFrame.id,
+		frame:   freeFrame,
 		mode:    mode,
 		pool:    p,
 	}, nil
 }
 
+// PagePins — закрепления нескольких страниц, полученные FetchPagesOrdered, по возрастанию PageID.
+type PagePins []*pagePin
+
+// FetchPagesOrdered закрепляет страницы pageIDs, захватывая защелки в режиме mode
+// по возрастанию PageID независимо от порядка в pageIDs. Повторы PageID закрепляются один раз.
+//
+// Правило порядка защелок: код, удерживающий несколько защелок страниц одновременно,
+// захватывает их по возрастанию PageID — через FetchPagesOrdered или вручную.
+// Тогда две операции не могут ждать защелки друг друга по кругу.
+// Если порядок соблюсти нельзя, следует использовать TryFetchPage.
+//
+// При ошибке уже полученные закрепления снимаются.
+func (p *Pool) FetchPagesOrdered(ctx context.Context, pageIDs []page.PageID, mode LatchMode) (PagePins, error) {
+	sorted := slices.Clone(pageIDs)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+
+	pins := make(PagePins, 0, len(sorted))
+	for _, pageID := range sorted {
+		pin, err := p.FetchPage(ctx, pageID, mode)
+		if err != nil {
+			pins.UnpinAll()
+			return nil, err
+		}
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
+
+// UnpinAll снимает все закрепления в порядке, обратном захвату.
+func (pins PagePins) UnpinAll() {
+	for _, pin := range slices.Backward(pins) {
+		pin.Unpin()
+	}
+}
+
+// TryFetchPage извлекает страницу из пула, как FetchPage, но не ждет защелку:
+// если ее нельзя захватить сразу, возвращает (nil, false, nil), не закрепляя страницу.
+// Позволяет захватывать защелки в произвольном порядке без риска взаимной блокировки.
+func (p *Pool) TryFetchPage(ctx context.Context, pageID page.PageID, mode LatchMode) (*pagePin, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if frameID, ok := p.pageToFrameMap[pageID]; ok {
+		f := p.frames[frameID]
+		// Защелку пробуем захватить до закрепления, поэтому при неудаче откатывать нечего.
+		// Под p.mu это безопасно: TryLock не ждет.
+		if !tryLatch(f, mode) {
+			return nil, false, nil
+		}
+		if err := p.reservePin(); err != nil {
+			unlatch(f, mode)
+			return nil, false, err
+		}
+		p.stats.Hits++
+		f.pinCount++
+		p.replacer.Pin(frameID)
+		return &pagePin{
+			pageID:  pageID,
+			frameID: frameID,
+			frame:   f,
+			mode:    mode,
+			pool:    p,
+		}, true, nil
+	}
+
+	if err := p.reservePin(); err != nil {
+		return nil, false, err
+	}
+	freeFrame, err := p.loadPage(ctx, pageID)
+	if err != nil {
+		p.pins--
+		return nil, false, err
+	}
+	// Только что загруженный фрейм никто, кроме нас, не закрепил, и защелка свободна.
+	// Но страницу могли загрузить параллельно, пока loadPage отпускал p.mu
+	if !tryLatch(freeFrame, mode) {
+		p.pins--
+		freeFrame.pinCount--
+		if freeFrame.pinCount == 0 {
+			p.replacer.Unpin(freeFrame.id)
+		}
+		return nil, false, nil
+	}
+	return &pagePin{
+		pageID:  pageID,
+		frameID: freeFrame.id,
+		frame:   freeFrame,
+		mode:    mode,
+		pool:    p,
+	}, true, nil
+}
+
+// loadPage читает страницу с диска в свободный фрейм и закрепляет ее. Вызывается под p.mu.
+// Если страницу загрузили в пул, пока findFreeFrame отпускал p.mu, закрепляет уже загруженную.
+func (p *Pool) loadPage(ctx context.Context, pageID page.PageID) (*frame, error) {
+	p.stats.Misses++
+	freeFrame, err := p.findFreeFrame(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if frameID, ok := p.pageToFrameMap[pageID]; ok {
+		p.freeFrameIDs = append(p.freeFrameIDs, freeFrame.id)
+		f := p.frames[frameID]
+		f.pinCount++
+		p.replacer.Pin(frameID)
+		return f, nil
+	}
+	err = p.pm.ReadPage(ctx, pageID, freeFrame.data)
+	if err != nil {
+		// Фрейм уже не принадлежит ни одной странице
+		p.freeFrameIDs = append(p.freeFrameIDs, freeFrame.id)
+		if errors.Is(err, page.ErrPageOutOfBounds) {
+			return nil, fmt.Errorf("page %d was never allocated: %w", pageID, err)
+		}
+		return nil, fmt.Errorf("failed to read page %d from disk: %w", pageID, err)
+	}
+
+	p.pageToFrameMap[pageID] = freeFrame.id
+	p.replacer.Pin(freeFrame.id)
+	freeFrame.pageID = pageID
+	freeFrame.pinCount++
+	p.prefetchAfter(ctx, pageID)
+	return freeFrame, nil
+}
+
+func tryLatch(f *frame, mode LatchMode) bool {
+	if mode == LatchExclusive {
+		return f.latch.TryLock()
+	}
+	return f.latch.TryRLock()
+}
+
+func unlatch(f *frame, mode LatchMode) {
+	if mode == LatchExclusive {
+		f.latch.Unlock()
+	} else {
+		f.latch.RUnlock()
+	}
+}
+
+// reservePin учитывает новое закрепление в лимите WithMaxPins. Вызывается под p.mu.
+// Если закрепление затем не выдается вызывающему коду, резерв снимается уменьшением p.pins.
+func (p *Pool) reservePin() error {
+	if p.maxPins > 0 && p.pins >= p.maxPins {
+		return fmt.Errorf("%w: %d pins held, limit is %d", ErrPinLimit, p.pins, p.maxPins)
+	}
+	p.pins++
+	return nil
+}
+
+// FlushAllPages записывает на диск все грязные незакрепленные страницы.
+// Закрепленные страницы пропускаются, а не записываются под одним p.mu: владелец защелки
+// может менять их прямо во время записи, и на диск попала бы наполовину измененная страница.
+// Они будут записаны следующим сбросом или FlushPage, который дожидается защелки.
+// Отмена ctx проверяется между записями страниц: при отмене сброс прерывается,
+// а оставшиеся страницы остаются грязными. Это ускоряет остановку ценой долговечности,
+// поэтому отменять сброс стоит только когда потеря несброшенных данных допустима.
+// Если среди грязных страниц набирается batchFlushThreshold смежных, все они записываются
+// одним пакетом, и смежные страницы объединяются в одну запись.
 func (p *Pool) FlushAllPages(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	for i := range p.frames {
-		if p.frames[i].dirty && p.frames[i].pinCount == 0 {
-			if err := p.pm.WritePage(ctx, p.frames[i].pageID, p.frames[i].data); err != nil {
-				return fmt.Errorf("failed to write dirty page %d to disk: %w", p.frames[i].pageID, err)
+	var flushable []frameID
+	for i := range p.dirtyFrames {
+		if p.frames[i].pinCount == 0 {
+			flushable = append(flushable, i)
+		}
+	}
+	if contiguousPages(p.frames, flushable) >= batchFlushThreshold {
+		return p.flushBatch(ctx, flushable)
+	}
+
+	for _, i := range flushable {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := p.pm.WritePage(ctx, p.frames[i].pageID, p.frames[i].data); err != nil {
+			return fmt.Errorf("failed to write dirty page %d to disk: %w", p.frames[i].pageID, err)
+		}
+		p.frames[i].dirty.Store(false)
+		delete(p.dirtyFrames, i)
+	}
+
+	return nil
+}
+
+// flushBatch записывает фреймы одним пакетом WritePages. Вызывается под p.mu.
+// При ошибке все фреймы пакета остаются грязными и будут записаны повторно.
+func (p *Pool) flushBatch(ctx context.Context, frameIDs []frameID) error {
+	writes := make([]page.PageWrite, len(frameIDs))
+	for i, id := range frameIDs {
+		writes[i] = page.PageWrite{PageID: p.frames[id].pageID, Data: p.frames[id].data}
+	}
+	if err := p.pm.WritePages(ctx, writes); err != nil {
+		return fmt.Errorf("failed to write dirty pages to disk: %w", err)
+	}
+	for _, id := range frameIDs {
+		p.frames[id].dirty.Store(false)
+		delete(p.dirtyFrames, id)
+	}
+	return nil
+}
+
+// contiguousPages возвращает, сколько страниц фреймов frameIDs идут сразу за другой страницей из того же набора.
+func contiguousPages(frames []*frame, frameIDs []frameID) int {
+	pageIDs := make([]page.PageID, len(frameIDs))
+	for i, id := range frameIDs {
+		pageIDs[i] = frames[id].pageID
+	}
+	slices.Sort(pageIDs)
+
+	n := 0
+	for i := 1; i < len(pageIDs); i++ {
+		if pageIDs[i] == pageIDs[i-1]+1 {
+			n++
+		}
+	}
+	return n
+}
+
+// FlushPage записывает страницу на диск, если она грязная, и снимает с нее признак грязности.
+// Страница на время записи закрепляется с разделяемой защелкой, поэтому FlushPage ждет,
+// пока владелец эксклюзивной защелки закончит изменение, и не записывает страницу наполовину.
+// Возвращает ErrPageNotResident, если страницы нет в пуле.
+func (p *Pool) FlushPage(ctx context.Context, pageID page.PageID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	frameID, ok := p.pageToFrameMap[pageID]
+	if !ok {
+		p.mu.Unlock()
+		return fmt.Errorf("%w: page %d", ErrPageNotResident, pageID)
+	}
+	f := p.frames[frameID]
+	f.pinCount++
+	p.replacer.Pin(frameID)
+	p.mu.Unlock()
+
+	// Защелку ждем без p.mu: владельцу эксклюзивной защелки p.mu нужен для Unpin
+	f.latch.RLock()
+	pin := &pagePin{pageID: pageID, frameID: frameID, frame: f, mode: LatchShared, pool: p, internal: true}
+	defer pin.Unpin()
+
+	if !f.dirty.Load() {
+		return nil
+	}
+	if err := p.pm.WritePage(ctx, pageID, f.data); err != nil {
+		return fmt.Errorf("failed to write dirty page %d to disk: %w", pageID, err)
+	}
+
+	p.mu.Lock()
+	f.dirty.Store(false)
+	delete(p.dirtyFrames, frameID)
+	p.mu.Unlock()
+	return nil
+}
+
+// EvictPage убирает чистую незакрепленную страницу из пула, освобождая ее фрейм.
+// Грязную страницу не вытесняет, чтобы не потерять изменения: ее нужно сначала сбросить через FlushPage.
+func (p *Pool) EvictPage(pageID page.PageID) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	frameID, ok := p.pageToFrameMap[pageID]
+	if !ok {
+		return nil
+	}
+	f := p.frames[frameID]
+	if f.pinCount > 0 {
+		return fmt.Errorf("%w: page %d", ErrPagePinned, pageID)
+	}
+	if f.dirty.Load() {
+		return fmt.Errorf("%w: page %d", ErrPageDirty, pageID)
+	}
+
+	p.dropFrame(frameID)
+	return nil
+}
+
+// DeletePage убирает страницу из пула, отбрасывая несброшенные изменения, и освобождает ее
+// в менеджере страниц для повторного выделения. Закрепленную страницу не удаляет.
+// Страницы нужно освобождать через пул, а не напрямую в менеджере: иначе пул продолжит отдавать
+// старое содержимое, а вытеснение грязного фрейма перезапишет уже выданную заново страницу.
+func (p *Pool) DeletePage(ctx context.Context, pageID page.PageID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	frameID, resident := p.pageToFrameMap[pageID]
+	if resident && p.frames[frameID].pinCount > 0 {
+		return fmt.Errorf("%w: page %d", ErrPagePinned, pageID)
+	}
+	if err := p.pm.DeallocatePage(ctx, pageID); err != nil {
+		return fmt.Errorf("failed to deallocate page %d: %w", pageID, err)
+	}
+	if resident {
+		p.dropFrame(frameID)
+	}
+	return nil
+}
+
+// dropFrame отвязывает незакрепленный фрейм от страницы и возвращает его в свободные.
+// Изменения грязного фрейма теряются. Вызывается под p.mu.
+func (p *Pool) dropFrame(id frameID) {
+	f := p.frames[id]
+	delete(p.pageToFrameMap, f.pageID)
+	delete(p.dirtyFrames, id)
+	f.dirty.Store(false)
+	p.replacer.Pin(id) // Убираем фрейм из кандидатов на вытеснение
+	p.freeFrameIDs = append(p.freeFrameIDs, id)
+}
+
+// Prefetch в фоне подгружает в свободные фреймы страницы pageIDs, которых еще нет в пуле,
+// чтобы последующий FetchPage нашел их в кеше. Страницы не закрепляются и ничего не вытесняют:
+// если свободных фреймов нет, оставшиеся страницы пропускаются. Ошибки чтения игнорируются.
+func (p *Pool) Prefetch(ctx context.Context, pageIDs []page.PageID) {
+	pageIDs = slices.Clone(pageIDs)
+	p.prefetchWG.Add(1)
+	go func() {
+		defer p.prefetchWG.Done()
+		for _, pageID := range pageIDs {
+			if ctx.Err() != nil {
+				return
+			}
+			p.mu.Lock()
+			ok, _ := p.loadUnpinned(ctx, pageID)
+			p.mu.Unlock()
+			if !ok {
+				return
 			}
-			p.frames[i].dirty = false
 		}
+	}()
+}
+
+// Stats возвращает счетчики обращений к пулу.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+// Resize изменяет количество фреймов в пуле.
+// При увеличении добавляет свободные фреймы. При уменьшении сбрасывает на диск
+// и освобождает фреймы с номерами от newSize и выше; если какой-либо из них закреплен,
+// возвращает ErrResizePinned и не меняет пул.
+func (p *Pool) Resize(ctx context.Context, newSize int) error {
+	if newSize <= 0 {
+		return fmt.Errorf("invalid pool size %d", newSize)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	oldSize := len(p.frames)
+	if newSize >= oldSize {
+		added := newFrames(frameID(oldSize), newSize-oldSize, p.pm.PageSize())
+		p.frames = append(p.frames, added...)
+		for _, f := range added {
+			p.freeFrameIDs = append(p.freeFrameIDs, f.id)
+		}
+		return nil
 	}
 
+	excess := p.frames[newSize:]
+	for _, f := range excess {
+		if f.pinCount > 0 {
+			return fmt.Errorf("%w: frame %d holds pinned page %d", ErrResizePinned, f.id, f.pageID)
+		}
+	}
+
+	for _, f := range excess {
+		if f.dirty.Load() {
+			if err := p.pm.WritePage(ctx, f.pageID, f.data); err != nil {
+				return fmt.Errorf("failed to write dirty page %d to disk: %w", f.pageID, err)
+			}
+			f.dirty.Store(false)
+			delete(p.dirtyFrames, f.id)
+		}
+	}
+
+	for _, f := range excess {
+		if mapped, ok := p.pageToFrameMap[f.pageID]; ok && mapped == f.id {
+			delete(p.pageToFrameMap, f.pageID)
+		}
+		p.replacer.Pin(f.id) // Убираем фрейм из кандидатов на вытеснение
+	}
+	p.freeFrameIDs = slices.DeleteFunc(p.freeFrameIDs, func(id frameID) bool {
+		return int(id) >= newSize
+	})
+	clear(excess)
+	p.frames = p.frames[:newSize]
 	return nil
 }
 
+// Size возвращает текущее количество фреймов в пуле.
+func (p *Pool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.frames)
+}
+
+// Capacity возвращает, сколько фреймов пула свободно, а сколько можно освободить вытеснением.
+func (p *Pool) Capacity() PoolCapacity {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PoolCapacity{
+		Frames:    len(p.frames),
+		Free:      len(p.freeFrameIDs),
+		Evictable: p.replacer.Size(),
+	}
+}
+
+// PinnedPage — закрепленная страница и количество ее закреплений.
+type PinnedPage struct {
+	PageID   page.PageID
+	PinCount int
+}
+
+// PinnedPages возвращает закрепленные страницы по возрастанию PageID.
+// Помогает найти код, который не снимает закрепления: такие страницы остаются в списке.
+func (p *Pool) PinnedPages() []PinnedPage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var pinned []PinnedPage
+	for _, f := range p.frames {
+		if f.pinCount > 0 {
+			pinned = append(pinned, PinnedPage{PageID: f.pageID, PinCount: f.pinCount})
+		}
+	}
+	slices.SortFunc(pinned, func(a, b PinnedPage) int {
+		return cmp.Compare(a.PageID, b.PageID)
+	})
+	return pinned
+}
+
+// pinnedFrames возвращает количество закрепленных фреймов. Вызывается под p.mu.
+func (p *Pool) pinnedFrames() int {
+	n := 0
+	for _, f := range p.frames {
+		if f.pinCount > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// PageSize возвращает размер страницы в байтах.
+func (p *Pool) PageSize() int {
+	return p.pm.PageSize()
+}
+
+// Residency сообщает для каждой страницы из полуинтервала [startPage, endPage), находится ли она в пуле.
+func (p *Pool) Residency(startPage, endPage page.PageID) []bool {
+	if endPage <= startPage {
+		return nil
+	}
+
+	resident := make([]bool, endPage-startPage)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := range resident {
+		_, resident[i] = p.pageToFrameMap[startPage+page.PageID(i)]
+	}
+	return resident
+}
+
+// StartBackgroundFlusher запускает горутину, которая раз в interval сбрасывает грязные страницы на диск,
+// пока не будет отменен ctx или вызван StopBackgroundFlusher.
+// Повторный запуск при уже работающем сбросе ничего не делает.
+func (p *Pool) StartBackgroundFlusher(ctx context.Context, interval time.Duration) {
+	p.startBackground(ctx, interval, func(ctx context.Context) {
+		// Ошибку игнорируем: не сброшенные страницы останутся грязными
+		// и будут записаны на следующем тике или при Close.
+		_ = p.FlushAllPages(ctx)
+	})
+}
+
+// StartCheckpointer запускает фоновый сброс, который раз в interval записывает на диск
+// не больше WithCheckpointPages грязных незакрепленных страниц. В отличие от StartBackgroundFlusher,
+// p.mu не удерживается на время записи: каждая страница сбрасывается через FlushPage,
+// поэтому чекпоинтер не останавливает работу с пулом даже при большом количестве грязных страниц.
+// Останавливается так же, как фоновый сброс; одновременно работает только один из них.
+func (p *Pool) StartCheckpointer(ctx context.Context, interval time.Duration) {
+	p.startBackground(ctx, interval, p.checkpoint)
+}
+
+// checkpoint сбрасывает на диск не больше checkpointPages грязных незакрепленных страниц.
+func (p *Pool) checkpoint(ctx context.Context) {
+	p.mu.Lock()
+	pageIDs := make([]page.PageID, 0, p.checkpointPages)
+	for id := range p.dirtyFrames {
+		if len(pageIDs) == p.checkpointPages {
+			break
+		}
+		if f := p.frames[id]; f.pinCount == 0 {
+			pageIDs = append(pageIDs, f.pageID)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, pageID := range pageIDs {
+		// Страница могла быть вытеснена с записью на диск, пока p.mu был отпущен
+		err := p.FlushPage(ctx, pageID)
+		if err != nil && !errors.Is(err, ErrPageNotResident) {
+			// Остальные страницы останутся грязными до следующего тика
+			return
+		}
+	}
+}
+
+// startBackground запускает горутину фонового сброса, вызывающую tick раз в interval.
+func (p *Pool) startBackground(ctx context.Context, interval time.Duration, tick func(ctx context.Context)) {
+	p.flusherMu.Lock()
+	defer p.flusherMu.Unlock()
+	if p.flusherDone != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	p.flusherCancel = cancel
+	p.flusherDone = done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				tick(ctx)
+			}
+		}
+	}()
+}
+
+// StopBackgroundFlusher останавливает фоновый сброс и дожидается завершения его горутины.
+func (p *Pool) StopBackgroundFlusher() {
+	p.flusherMu.Lock()
+	defer p.flusherMu.Unlock()
+	if p.flusherDone == nil {
+		return
+	}
+
+	p.flusherCancel()
+	<-p.flusherDone
+	p.flusherCancel = nil
+	p.flusherDone = nil
+}
+
 func (p *Pool) Close(ctx context.Context) error {
+	p.StopBackgroundFlusher()
+	p.prefetchWG.Wait()
+
 	err := p.FlushAllPages(ctx)
 	if err != nil {
 		return err
@@ -246,29 +983,118 @@ func (p *Pool) Close(ctx context.Context) error {
 	return nil
 }
 
-func (p *Pool) findFreeFrame(ctx context.Context) (*frame, error) {
-	lenFreeFrameIDs := len(p.freeFrameIDs)
-	if lenFreeFrameIDs > 0 {
-		freeFrameID := p.freeFrameIDs[lenFreeFrameIDs-1]
-		p.freeFrameIDs = p.freeFrameIDs[:lenFreeFrameIDs-1]
+// flushFrame записывает грязный незакрепленный фрейм на диск при сквозной записи.
+// Вызывается под p.mu. При ошибке фрейм остается грязным и будет записан при вытеснении или сбросе.
+func (p *Pool) flushFrame(f *frame) {
+	if err := p.pm.WritePage(context.Background(), f.pageID, f.data); err != nil {
+		slog.Warn("write-through failed", "page", f.pageID, "error", err)
+		return
+	}
+	f.dirty.Store(false)
+	delete(p.dirtyFrames, f.id)
+}
 
-		return &p.frames[freeFrameID], nil
+// prefetchAfter подгружает в свободные фреймы страницы, следующие за pageID.
+// Вызывается под p.mu. Чтение прекращается, когда свободные фреймы закончились
+// или страницу не удалось прочитать, например за концом файла.
+func (p *Pool) prefetchAfter(ctx context.Context, pageID page.PageID) {
+	for next := pageID + 1; next <= pageID+page.PageID(p.prefetch); next++ {
+		if ok, err := p.loadUnpinned(ctx, next); !ok || err != nil {
+			return
+		}
 	}
+}
 
-	evictedFrameID, ok := p.replacer.Evict()
-	if !ok {
-		return nil, ErrBufferPoolFull
+// loadUnpinned читает страницу в свободный фрейм, не закрепляя ее. Страницы ради этого не вытесняются.
+// Возвращает false, если свободных фреймов нет. Вызывается под p.mu.
+func (p *Pool) loadUnpinned(ctx context.Context, pageID page.PageID) (bool, error) {
+	if _, ok := p.pageToFrameMap[pageID]; ok {
+		return true, nil
+	}
+	n := len(p.freeFrameIDs)
+	if n == 0 {
+		return false, nil
+	}
+	f := p.frames[p.freeFrameIDs[n-1]]
+	if err := p.pm.ReadPage(ctx, pageID, f.data); err != nil {
+		return true, err
 	}
+	p.freeFrameIDs = p.freeFrameIDs[:n-1]
+	p.pageToFrameMap[pageID] = f.id
+	f.pageID = pageID
+	p.replacer.Unpin(f.id)
+	p.stats.Prefetched++
+	return true, nil
+}
 
-	evictedFrame := &p.frames[evictedFrameID]
-	if evictedFrame.dirty {
-		if err := p.pm.WritePage(ctx, evictedFrame.pageID, evictedFrame.data); err != nil {
-			return nil, fmt.Errorf("failed to write dirty page %d to disk: %w", evictedFrame.pageID, err)
+// findFreeFrame возвращает свободный фрейм, при необходимости вытесняя страницу.
+// Вызывается под p.mu. Грязная жертва записывается на диск с отпущенным p.mu,
+// поэтому к возврату состояние пула могло измениться, см. writeVictim.
+func (p *Pool) findFreeFrame(ctx context.Context) (*frame, error) {
+	for {
+		lenFreeFrameIDs := len(p.freeFrameIDs)
+		if lenFreeFrameIDs > 0 {
+			freeFrameID := p.freeFrameIDs[lenFreeFrameIDs-1]
+			p.freeFrameIDs = p.freeFrameIDs[:lenFreeFrameIDs-1]
+
+			return p.frames[freeFrameID], nil
+		}
+
+		evictedFrameID, ok := p.replacer.Evict()
+		if !ok {
+			return nil, fmt.Errorf("%w: %d of %d frames pinned, %d pins held", ErrBufferPoolFull, p.pinnedFrames(), len(p.frames), p.pins)
+		}
+
+		evictedFrame := p.frames[evictedFrameID]
+		if evictedFrame.dirty.Load() {
+			evicted, err := p.writeVictim(ctx, evictedFrame)
+			if err != nil {
+				return nil, err
+			}
+			if !evicted {
+				continue
+			}
 		}
+
+		delete(p.pageToFrameMap, evictedFrame.pageID)
+		delete(p.dirtyFrames, evictedFrameID)
+		evictedFrame.dirty.Store(false)
+		p.stats.Evictions++
+
+		return evictedFrame, nil
 	}
+}
 
-	delete(p.pageToFrameMap, evictedFrame.pageID)
-	evictedFrame.dirty = false
+// writeVictim записывает на диск грязный фрейм, выбранный для вытеснения. Вызывается под p.mu,
+// но на время записи отпускает его, чтобы запись не останавливала остальные операции пула.
+// Пока p.mu отпущен, фрейм закреплен, как в FlushPage: его не выберет другая жертва,
+// не сбросит и не освободит Resize, а разделяемая защелка не дает изменить страницу во время записи.
+// Страница остается в pageToFrameMap, поэтому FetchPage находит ее в пуле, а не читает устаревшую копию с диска.
+// Возвращает false, если за время записи страницу снова закрепили или изменили:
+// тогда фрейм возвращается в кандидаты на вытеснение, и жертву нужно выбрать заново.
+func (p *Pool) writeVictim(ctx context.Context, f *frame) (bool, error) {
+	f.pinCount++
+	p.mu.Unlock()
+
+	f.latch.RLock()
+	err := p.pm.WritePage(ctx, f.pageID, f.data)
+
+	p.mu.Lock()
+	if err == nil {
+		f.dirty.Store(false)
+		delete(p.dirtyFrames, f.id)
+	}
+	f.latch.RUnlock()
+	f.pinCount--
 
-	return evictedFrame, nil
+	if err == nil && f.pinCount == 0 && !f.dirty.Load() {
+		return true, nil
+	}
+	if f.pinCount == 0 {
+		p.replacer.Unpin(f.id)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to write dirty page %d to disk: %w", f.pageID, err)
+	}
+	return false, nil
 }
@@ -0,0 +1,123 @@
+//go:build pooldebug
+
+package buffer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/Argentum88/godb/internal/storage/page"
+)
+
+// Отладочный снимок состояния пула. Собирается только с тегом сборки pooldebug.
+//
+// Формат: [ Magic (4 байта) ] [ PageSize (4 байта) ] [ FrameCount (4 байта) ],
+// затем для каждого фрейма по порядку:
+// [ Used (1 байт) ] [ PageID (8 байт) ] [ Dirty (1 байт) ] [ PinCount (4 байта) ] [ Data ]
+const dumpMagic = 0x42504F4C // "BPOL"
+
+var ErrInvalidDump = errors.New("invalid buffer pool dump")
+
+// DumpState записывает в w состояние всех фреймов пула: страницу, флаг грязности,
+// количество закреплений и содержимое. Содержимое читается без защелок,
+// поэтому снимать состояние стоит только с пула, в котором никто не работает.
+func (p *Pool) DumpState(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	header := make([]byte, 0, 12)
+	header = binary.LittleEndian.AppendUint32(header, dumpMagic)
+	header = binary.LittleEndian.AppendUint32(header, uint32(p.pm.PageSize()))
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(p.frames)))
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	meta := make([]byte, 0, 14)
+	for _, f := range p.frames {
+		used := p.frameInUse(f)
+		meta = meta[:0]
+		meta = append(meta, boolToByte(used))
+		meta = binary.LittleEndian.AppendUint64(meta, uint64(f.pageID))
+		meta = append(meta, boolToByte(f.dirty.Load()))
+		meta = binary.LittleEndian.AppendUint32(meta, uint32(f.pinCount))
+		if _, err := bw.Write(meta); err != nil {
+			return err
+		}
+		if _, err := bw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// LoadState восстанавливает в пустой пул снимок, записанный DumpState.
+// Размер страницы и количество фреймов должны совпадать с пулом, из которого снят снимок.
+// Закрепления не восстанавливаются: они сохраняются в снимке только для диагностики.
+func (p *Pool) LoadState(r io.Reader) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.pageToFrameMap) != 0 {
+		return fmt.Errorf("%w: target pool is not empty", ErrInvalidDump)
+	}
+
+	br := bufio.NewReader(r)
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidDump, err)
+	}
+	if binary.LittleEndian.Uint32(header[0:4]) != dumpMagic {
+		return fmt.Errorf("%w: bad magic", ErrInvalidDump)
+	}
+	if pageSize := int(binary.LittleEndian.Uint32(header[4:8])); pageSize != p.pm.PageSize() {
+		return fmt.Errorf("%w: page size %d, pool uses %d", ErrInvalidDump, pageSize, p.pm.PageSize())
+	}
+	if count := int(binary.LittleEndian.Uint32(header[8:12])); count != len(p.frames) {
+		return fmt.Errorf("%w: %d frames, pool has %d", ErrInvalidDump, count, len(p.frames))
+	}
+
+	meta := make([]byte, 14)
+	for _, f := range p.frames {
+		if _, err := io.ReadFull(br, meta); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidDump, err)
+		}
+		if _, err := io.ReadFull(br, f.data); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidDump, err)
+		}
+		if meta[0] == 0 {
+			continue
+		}
+
+		f.pageID = page.PageID(binary.LittleEndian.Uint64(meta[1:9]))
+		f.pinCount = 0
+		p.pageToFrameMap[f.pageID] = f.id
+		if meta[9] != 0 {
+			f.dirty.Store(true)
+			p.dirtyFrames[f.id] = struct{}{}
+		}
+		p.replacer.Unpin(f.id)
+		p.freeFrameIDs = slices.DeleteFunc(p.freeFrameIDs, func(id frameID) bool {
+			return id == f.id
+		})
+	}
+	return nil
+}
+
+// frameInUse сообщает, занят ли фрейм страницей. Вызывается под p.mu.
+func (p *Pool) frameInUse(f *frame) bool {
+	id, ok := p.pageToFrameMap[f.pageID]
+	return ok && id == f.id
+}
+
+func boolToByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+//go:build pooldebug
+
+package buffer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPool_DumpAndLoadState(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const poolSize = 4
+
+	pool := NewPool(&countingManager{}, poolSize)
+	for i := range 3 {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page: %v", err)
+		}
+		copy(pin.Bytes(), bytes.Repeat([]byte{byte('a' + i)}, 16))
+		if i != 1 {
+			pin.MarkDirty()
+		}
+		pin.Unpin()
+	}
+
+	var dump bytes.Buffer
+	if err := pool.DumpState(&dump); err != nil {
+		t.Fatalf("DumpState failed: %v", err)
+	}
+
+	restored := NewPool(&countingManager{}, poolSize)
+	if err := restored.LoadState(bytes.NewReader(dump.Bytes())); err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+
+	for i, f := range pool.frames {
+		g := restored.frames[i]
+		if pool.frameInUse(f) != restored.frameInUse(g) {
+			t.Fatalf("frame %d: usage mismatch", i)
+		}
+		if !bytes.Equal(f.data, g.data) {
+			t.Fatalf("frame %d: contents differ after restore", i)
+		}
+		if !pool.frameInUse(f) {
+			continue
+		}
+		if f.pageID != g.pageID || f.dirty.Load() != g.dirty.Load() {
+			t.Fatalf("frame %d: expected page %d dirty=%v, got page %d dirty=%v",
+				i, f.pageID, f.dirty.Load(), g.pageID, g.dirty.Load())
+		}
+	}
+	if len(restored.dirtyFrames) != 2 {
+		t.Fatalf("expected 2 dirty frames after restore, got %d", len(restored.dirtyFrames))
+	}
+
+	// Восстановленные страницы доступны без чтения с диска
+	pin, err := restored.FetchPage(ctx, 2, LatchShared)
+	if err != nil {
+		t.Fatalf("failed to fetch restored page: %v", err)
+	}
+	if pin.Bytes()[0] != 'c' {
+		t.Fatalf("expected restored page 2 to start with 'c', got %q", pin.Bytes()[0])
+	}
+	pin.Unpin()
+
+	if err := restored.LoadState(bytes.NewReader(dump.Bytes())); !errors.Is(err, ErrInvalidDump) {
+		t.Fatalf("expected ErrInvalidDump when loading into non-empty pool, got %v", err)
+	}
+}
@@ -4,11 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"math/rand"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -28,7 +33,7 @@ func TestPool_Eviction(t *testing.T) {
 	}
 
 	// Инициализация Pool с размером 2, чтобы вытеснение произошло при третьей странице
-	pool := NewPool(NewLRUReplacer(), pm, 2)
+	pool := NewPool(pm, 2)
 	t.Cleanup(func() {
 		pool.Close(ctx)
 	})
@@ -38,7 +43,7 @@ func TestPool_Eviction(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to create page A: %v", err)
 	}
-	dataA := bytes.Repeat([]byte{'A'}, page.PageSize)
+	dataA := bytes.Repeat([]byte{'A'}, page.DefaultPageSize)
 	copy(pageA.Bytes(), dataA)
 
 	pageA.MarkDirty()
@@ -49,7 +54,7 @@ func TestPool_Eviction(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to create page B: %v", err)
 	}
-	dataB := bytes.Repeat([]byte{'B'}, page.PageSize)
+	dataB := bytes.Repeat([]byte{'B'}, page.DefaultPageSize)
 	copy(pageB.Bytes(), dataB)
 
 	pageB.MarkDirty()
@@ -61,7 +66,7 @@ func TestPool_Eviction(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to create page C: %v", err)
 	}
-	dataC := bytes.Repeat([]byte{'C'}, page.PageSize)
+	dataC := bytes.Repeat([]byte{'C'}, page.DefaultPageSize)
 	copy(pageC.Bytes(), dataC)
 
 	pageC.MarkDirty()
@@ -100,7 +105,7 @@ func TestPool_Concurrency(t *testing.T) {
 	}
 
 	// Инициализация Pool
-	pool := NewPool(NewLRUReplacer(), pm, 10)
+	pool := NewPool(pm, 10)
 	t.Cleanup(func() {
 		pool.Close(ctx)
 	})
@@ -179,17 +184,1532 @@ func TestPool_Concurrency(t *testing.T) {
 	wgChaos.Wait()
 }
 
+func TestPool_CustomPageSize(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const pageSize = 8 * 1024
+
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	pm, err := page.NewDiskManager(ctx, dbPath, page.WithPageSize(pageSize))
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+
+	pool := NewPool(pm, 1)
+	t.Cleanup(func() {
+		pool.Close(ctx)
+	})
+
+	pin, err := pool.NewPage(ctx)
+	if err != nil {
+		t.Fatalf("failed to create new page: %v", err)
+	}
+	if len(pin.Bytes()) != pageSize {
+		t.Fatalf("expected frame of %d bytes, got %d", pageSize, len(pin.Bytes()))
+	}
+	data := bytes.Repeat([]byte{'P'}, pageSize)
+	copy(pin.Bytes(), data)
+	pin.MarkDirty()
+	pin.Unpin()
+
+	if err := pool.FlushAllPages(ctx); err != nil {
+		t.Fatalf("failed to flush pages: %v", err)
+	}
+	onDisk := make([]byte, pageSize)
+	if err := pm.ReadPage(ctx, pin.pageID, onDisk); err != nil {
+		t.Fatalf("failed to read page from disk: %v", err)
+	}
+	if !bytes.Equal(onDisk, data) {
+		t.Fatalf("read data does not match written data")
+	}
+}
+
+func TestPool_CanceledContext(t *testing.T) {
+	t.Parallel()
+
+	pool := NewPool(&failingManager{t: t}, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := pool.NewPage(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v from NewPage, got %v", context.Canceled, err)
+	}
+	if _, err := pool.FetchPage(ctx, 0, LatchShared); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v from FetchPage, got %v", context.Canceled, err)
+	}
+	if err := pool.FlushAllPages(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v from FlushAllPages, got %v", context.Canceled, err)
+	}
+}
+
+func TestPool_FlushAllPages_CanceledMidFlush(t *testing.T) {
+	t.Parallel()
+	const numPages = 5
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pm := &countingManager{}
+	pool := NewPool(pm, numPages)
+	for range numPages {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page: %v", err)
+		}
+		pin.MarkDirty()
+		pin.Unpin()
+	}
+
+	// Отменяем контекст сразу после записи первой страницы
+	pm.onWrite = cancel
+	if err := pool.FlushAllPages(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if pm.writes != 1 {
+		t.Fatalf("expected 1 page to be written before cancellation, got %d", pm.writes)
+	}
+}
+
+func TestPool_FlushAllPages_OnlyDirtyFrames(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const poolSize = 1000
+
+	pm := &countingManager{}
+	pool := NewPool(pm, poolSize)
+
+	for i := range poolSize {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page: %v", err)
+		}
+		if i%250 == 0 {
+			pin.MarkDirty()
+		}
+		pin.Unpin()
+	}
+
+	if err := pool.FlushAllPages(ctx); err != nil {
+		t.Fatalf("failed to flush pages: %v", err)
+	}
+	if pm.writes != 4 {
+		t.Fatalf("expected 4 dirty pages to be written, got %d", pm.writes)
+	}
+	if pm.batches != 0 {
+		t.Fatalf("expected scattered dirty pages to be written one by one, got %d batches", pm.batches)
+	}
+	if len(pool.dirtyFrames) != 0 {
+		t.Fatalf("expected dirty frame set to be empty after flush, got %d frames", len(pool.dirtyFrames))
+	}
+
+	// Повторный сброс ничего не пишет
+	if err := pool.FlushAllPages(ctx); err != nil {
+		t.Fatalf("failed to flush pages: %v", err)
+	}
+	if pm.writes != 4 {
+		t.Fatalf("expected no additional writes, got %d total", pm.writes)
+	}
+}
+
+func TestPool_FlushAllPages_Batched(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const numPages = 16
+
+	pm, err := page.NewDiskManager(ctx, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create disk manager: %v", err)
+	}
+	pool := NewPool(pm, numPages)
+	t.Cleanup(func() {
+		pool.Close(ctx)
+	})
+
+	// Грязные страницы 0-5 и 9-11 смежные, 14 отдельная
+	expected := make(map[page.PageID][]byte)
+	for i := range numPages {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page: %v", err)
+		}
+		if i <= 5 || (i >= 9 && i <= 11) || i == 14 {
+			data := bytes.Repeat([]byte{byte('a' + i)}, page.DefaultPageSize)
+			copy(pin.Bytes(), data)
+			pin.MarkDirty()
+			expected[pin.pageID] = data
+		}
+		pin.Unpin()
+	}
+
+	if err := pool.FlushAllPages(ctx); err != nil {
+		t.Fatalf("failed to flush pages: %v", err)
+	}
+	if len(pool.dirtyFrames) != 0 {
+		t.Fatalf("expected dirty frame set to be empty after flush, got %d frames", len(pool.dirtyFrames))
+	}
+
+	onDisk := make([]byte, page.DefaultPageSize)
+	for pageID, data := range expected {
+		if err := pm.ReadPage(ctx, pageID, onDisk); err != nil {
+			t.Fatalf("failed to read page %d: %v", pageID, err)
+		}
+		if !bytes.Equal(onDisk, data) {
+			t.Fatalf("page %d: data on disk does not match flushed data", pageID)
+		}
+	}
+
+	counting := &countingManager{}
+	countingPool := NewPool(counting, numPages)
+	for range numPages {
+		pin, err := countingPool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page: %v", err)
+		}
+		pin.MarkDirty()
+		pin.Unpin()
+	}
+	if err := countingPool.FlushAllPages(ctx); err != nil {
+		t.Fatalf("failed to flush pages: %v", err)
+	}
+	if counting.batches != 1 || counting.writes != numPages {
+		t.Fatalf("expected %d pages in 1 batch, got %d pages in %d batches", numPages, counting.writes, counting.batches)
+	}
+}
+
+func TestPool_EvictionWritesWithoutPoolMutex(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	pm := &countingManager{}
+	pool := NewPool(pm, 2)
+	dirty, err := pool.NewPage(ctx)
+	if err != nil {
+		t.Fatalf("failed to create new page: %v", err)
+	}
+	dirtyID := dirty.PageID()
+	dirty.MarkDirty()
+	dirty.Unpin()
+	clean, err := pool.NewPage(ctx)
+	if err != nil {
+		t.Fatalf("failed to create new page: %v", err)
+	}
+	cleanID := clean.PageID()
+	clean.Unpin()
+
+	// Запись вытесняемой грязной страницы зависает, пока ее не отпустят
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	pm.onWrite = func() {
+		once.Do(func() {
+			close(started)
+			<-release
+		})
+	}
+	newPageDone := make(chan error)
+	go func() {
+		pin, err := pool.NewPage(ctx)
+		if err == nil {
+			pin.Unpin()
+		}
+		newPageDone <- err
+	}()
+	<-started
+
+	// Пока идет запись, остальные операции пула не ждут p.mu
+	fetched := make(chan *pagePin)
+	go func() {
+		pin, err := pool.FetchPage(ctx, cleanID, LatchShared)
+		if err != nil {
+			t.Errorf("failed to fetch page during eviction: %v", err)
+		} else {
+			pin.Unpin()
+		}
+		// Вытесняемая страница по-прежнему в пуле: закрепление отменяет ее вытеснение
+		pin, err = pool.FetchPage(ctx, dirtyID, LatchShared)
+		if err != nil {
+			t.Errorf("failed to fetch page being evicted: %v", err)
+		}
+		fetched <- pin
+	}()
+	var victim *pagePin
+	select {
+	case victim = <-fetched:
+	case <-time.After(time.Second):
+		close(release)
+		t.Fatalf("FetchPage blocked while an evicted page was being written")
+	}
+	if hits := pool.Stats().Hits; hits != 2 {
+		t.Fatalf("expected 2 hits during eviction, got %d", hits)
+	}
+
+	close(release)
+	if err := <-newPageDone; err != nil {
+		t.Fatalf("NewPage failed: %v", err)
+	}
+	if victim == nil {
+		t.FailNow()
+	}
+	victim.Unpin()
+
+	// Вместо закрепленной страницы вытеснена чистая
+	if got := pool.Residency(dirtyID, dirtyID+1); !got[0] {
+		t.Fatalf("expected page %d fetched during its eviction to stay in the pool", dirtyID)
+	}
+	if got := pool.Residency(cleanID, cleanID+1); got[0] {
+		t.Fatalf("expected clean page %d to be evicted instead", cleanID)
+	}
+	if pm.writes != 1 {
+		t.Fatalf("expected 1 write, got %d", pm.writes)
+	}
+	if got := pool.Capacity(); got.Evictable != 2 {
+		t.Fatalf("expected both frames to be evictable again, got %+v", got)
+	}
+}
+
+func TestPool_EvictionClearsDirtyFrame(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	pm := &countingManager{}
+	pool := NewPool(pm, 1)
+
+	pin, err := pool.NewPage(ctx)
+	if err != nil {
+		t.Fatalf("failed to create new page: %v", err)
+	}
+	pin.MarkDirty()
+	pin.Unpin()
+
+	// Вытесняет грязную страницу, записывая ее на диск
+	pin, err = pool.NewPage(ctx)
+	if err != nil {
+		t.Fatalf("failed to create new page: %v", err)
+	}
+	pin.Unpin()
+
+	if len(pool.dirtyFrames) != 0 {
+		t.Fatalf("expected dirty frame set to be empty after eviction, got %d frames", len(pool.dirtyFrames))
+	}
+	if err := pool.FlushAllPages(ctx); err != nil {
+		t.Fatalf("failed to flush pages: %v", err)
+	}
+	if pm.writes != 1 {
+		t.Fatalf("expected only the eviction write, got %d writes", pm.writes)
+	}
+	if evictions := pool.Stats().Evictions; evictions != 1 {
+		t.Fatalf("expected 1 eviction, got %d", evictions)
+	}
+}
+
+func TestPool_Residency(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	pool := NewPool(&countingManager{}, 3)
+
+	// Выделяем 5 страниц, в пуле остаются только последние три
+	for range 5 {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page: %v", err)
+		}
+		pin.Unpin()
+	}
+
+	// Возвращаем в пул страницу 0, вытесняя самую старую из оставшихся (2)
+	pin, err := pool.FetchPage(ctx, 0, LatchShared)
+	if err != nil {
+		t.Fatalf("failed to fetch page: %v", err)
+	}
+	pin.Unpin()
+
+	got := pool.Residency(0, 6)
+	want := []bool{true, false, false, true, true, false}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected residency %v, got %v", want, got)
+	}
+}
+
+func TestPool_FetchPage_NotAllocated(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	pm, err := page.NewMemoryManager(page.DefaultPageSize)
+	if err != nil {
+		t.Fatalf("failed to create MemoryManager: %v", err)
+	}
+	pool := NewPool(pm, 2)
+	t.Cleanup(func() {
+		pool.Close(ctx)
+	})
+
+	if _, err := pool.FetchPage(ctx, 7, LatchShared); !errors.Is(err, page.ErrPageOutOfBounds) {
+		t.Fatalf("expected %v, got %v", page.ErrPageOutOfBounds, err)
+	}
+	// Фрейм, в который не удалось прочитать страницу, возвращается в пул
+	if free := pool.Capacity().Free; free != 2 {
+		t.Fatalf("expected 2 free frames after failed fetch, got %d", free)
+	}
+}
+
+func TestPool_Capacity(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const size = 3
+
+	pool := NewPool(&countingManager{}, size)
+	if got, want := pool.Capacity(), (PoolCapacity{Frames: size, Free: size}); got != want {
+		t.Fatalf("expected %+v for an empty pool, got %+v", want, got)
+	}
+
+	var pins []*pagePin
+	for range size {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page: %v", err)
+		}
+		pins = append(pins, pin)
+	}
+	// Все фреймы закреплены: вытеснять нечего, и новая страница не помещается
+	if got, want := pool.Capacity(), (PoolCapacity{Frames: size}); got != want {
+		t.Fatalf("expected %+v with every frame pinned, got %+v", want, got)
+	}
+	if _, err := pool.NewPage(ctx); !errors.Is(err, ErrBufferPoolFull) {
+		t.Fatalf("expected ErrBufferPoolFull, got %v", err)
+	}
+
+	pins[0].Unpin()
+	if got, want := pool.Capacity(), (PoolCapacity{Frames: size, Evictable: 1}); got != want {
+		t.Fatalf("expected %+v after unpinning one page, got %+v", want, got)
+	}
+	for _, pin := range pins[1:] {
+		pin.Unpin()
+	}
+}
+
+func TestPool_PinnedPages(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	pool := NewPool(&countingManager{}, 2)
+	var pageIDs []page.PageID
+	for range 2 {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page: %v", err)
+		}
+		pageIDs = append(pageIDs, pin.PageID())
+		pin.Unpin()
+	}
+
+	// Вызывающий код забывает снимать закрепления: первая страница закреплена дважды
+	leaked := []*pagePin{}
+	for _, pageID := range []page.PageID{pageIDs[1], pageIDs[0], pageIDs[0]} {
+		pin, err := pool.FetchPage(ctx, pageID, LatchShared)
+		if err != nil {
+			t.Fatalf("failed to fetch page %d: %v", pageID, err)
+		}
+		leaked = append(leaked, pin)
+	}
+
+	_, err := pool.NewPage(ctx)
+	if !errors.Is(err, ErrBufferPoolFull) {
+		t.Fatalf("expected ErrBufferPoolFull, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "2 of 2 frames pinned") {
+		t.Fatalf("expected the error to report pinned frames, got %q", err)
+	}
+	want := []PinnedPage{{PageID: pageIDs[0], PinCount: 2}, {PageID: pageIDs[1], PinCount: 1}}
+	if got := pool.PinnedPages(); !slices.Equal(got, want) {
+		t.Fatalf("expected pinned pages %+v, got %+v", want, got)
+	}
+
+	PagePins(leaked).UnpinAll()
+	if got := pool.PinnedPages(); len(got) != 0 {
+		t.Fatalf("expected no pinned pages after unpinning, got %+v", got)
+	}
+}
+
+func TestPool_MaxPins(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	pool := NewPool(&countingManager{}, 4, WithMaxPins(2))
+	var pageIDs []page.PageID
+	for range 3 {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page: %v", err)
+		}
+		pin.MarkDirty()
+		pageIDs = append(pageIDs, pin.PageID())
+		pin.Unpin()
+	}
+
+	first, err := pool.FetchPage(ctx, pageIDs[0], LatchShared)
+	if err != nil {
+		t.Fatalf("failed to fetch page: %v", err)
+	}
+	second, err := pool.FetchPage(ctx, pageIDs[0], LatchShared)
+	if err != nil {
+		t.Fatalf("failed to fetch page: %v", err)
+	}
+	if _, err := pool.FetchPage(ctx, pageIDs[1], LatchShared); !errors.Is(err, ErrPinLimit) {
+		t.Fatalf("expected %v over the pin limit, got %v", ErrPinLimit, err)
+	}
+	if _, _, err := pool.TryFetchPage(ctx, pageIDs[1], LatchShared); !errors.Is(err, ErrPinLimit) {
+		t.Fatalf("expected %v from TryFetchPage over the pin limit, got %v", ErrPinLimit, err)
+	}
+	if _, err := pool.NewPage(ctx); !errors.Is(err, ErrPinLimit) {
+		t.Fatalf("expected %v from NewPage over the pin limit, got %v", ErrPinLimit, err)
+	}
+	// Собственные закрепления пула в лимите не учитываются
+	if err := pool.FlushPage(ctx, pageIDs[0]); err != nil {
+		t.Fatalf("expected FlushPage to work at the pin limit, got %v", err)
+	}
+
+	second.Unpin()
+	third, err := pool.FetchPage(ctx, pageIDs[1], LatchShared)
+	if err != nil {
+		t.Fatalf("expected fetch to succeed after an unpin, got %v", err)
+	}
+	first.Unpin()
+	third.Unpin()
+}
+
+func TestPool_Resize_Grow(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	pool := NewPool(&countingManager{}, 2)
+
+	var pins []*pagePin
+	for range 2 {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page: %v", err)
+		}
+		pins = append(pins, pin)
+	}
+	if _, err := pool.NewPage(ctx); !errors.Is(err, ErrBufferPoolFull) {
+		t.Fatalf("expected ErrBufferPoolFull, got %v", err)
+	}
+
+	if err := pool.Resize(ctx, 4); err != nil {
+		t.Fatalf("failed to grow pool: %v", err)
+	}
+	if pool.Size() != 4 {
+		t.Fatalf("expected pool size 4, got %d", pool.Size())
+	}
+
+	// Новые фреймы доступны, пока старые страницы остаются закрепленными
+	for range 2 {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page after grow: %v", err)
+		}
+		copy(pin.Bytes(), "grown")
+		pins = append(pins, pin)
+	}
+	for _, pin := range pins {
+		pin.Unpin()
+	}
+}
+
+func TestPool_Resize_Shrink(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	pm := &countingManager{}
+	pool := NewPool(pm, 4)
+
+	var pins []*pagePin
+	for range 4 {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page: %v", err)
+		}
+		pin.MarkDirty()
+		pins = append(pins, pin)
+	}
+
+	// Закрепленная страница в лишнем фрейме не дает уменьшить пул
+	if err := pool.Resize(ctx, 2); !errors.Is(err, ErrResizePinned) {
+		t.Fatalf("expected ErrResizePinned, got %v", err)
+	}
+	if pool.Size() != 4 {
+		t.Fatalf("expected pool size to stay 4, got %d", pool.Size())
+	}
+
+	for _, pin := range pins {
+		pin.Unpin()
+	}
+	if err := pool.Resize(ctx, 2); err != nil {
+		t.Fatalf("failed to shrink pool: %v", err)
+	}
+	if pool.Size() != 2 {
+		t.Fatalf("expected pool size 2, got %d", pool.Size())
+	}
+	if pm.writes != 2 {
+		t.Fatalf("expected 2 excess dirty pages to be flushed, got %d writes", pm.writes)
+	}
+
+	resident := 0
+	for _, ok := range pool.Residency(0, 4) {
+		if ok {
+			resident++
+		}
+	}
+	if resident != 2 {
+		t.Fatalf("expected 2 resident pages after shrink, got %d", resident)
+	}
+	if len(pool.dirtyFrames) != 2 {
+		t.Fatalf("expected only remaining frames to be dirty, got %d", len(pool.dirtyFrames))
+	}
+
+	// Вытесненные страницы снова читаются, используя оставшиеся фреймы
+	for pageID := range page.PageID(4) {
+		pin, err := pool.FetchPage(ctx, pageID, LatchShared)
+		if err != nil {
+			t.Fatalf("failed to fetch page %d after shrink: %v", pageID, err)
+		}
+		pin.Unpin()
+	}
+}
+
+func TestPool_WriteThrough(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		opts       []PoolOption
+		wantWrites int
+	}{
+		{name: "write-back by default", wantWrites: 0},
+		{name: "write-through", opts: []PoolOption{WithWriteThrough()}, wantWrites: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			pm := &countingManager{}
+			pool := NewPool(pm, 2, tt.opts...)
+
+			pin, err := pool.NewPage(ctx)
+			if err != nil {
+				t.Fatalf("failed to create new page: %v", err)
+			}
+			pin.MarkDirty()
+			pin.Unpin()
+
+			if pm.writes != tt.wantWrites {
+				t.Fatalf("expected %d writes after Unpin, got %d", tt.wantWrites, pm.writes)
+			}
+			if len(pool.dirtyFrames) != 1-tt.wantWrites {
+				t.Fatalf("expected %d dirty frames, got %d", 1-tt.wantWrites, len(pool.dirtyFrames))
+			}
+		})
+	}
+}
+
+func TestPool_Prefetch(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	pm, err := page.NewDiskManager(ctx, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+	t.Cleanup(func() {
+		pm.Close(ctx)
+	})
+	for range 5 {
+		if _, err := pm.AllocatePage(ctx); err != nil {
+			t.Fatalf("failed to allocate page: %v", err)
+		}
+	}
+
+	pool := NewPool(pm, 4, WithPrefetch(2))
+	pin, err := pool.FetchPage(ctx, 0, LatchShared)
+	if err != nil {
+		t.Fatalf("failed to fetch page: %v", err)
+	}
+	pin.Unpin()
+
+	got := pool.Residency(0, 5)
+	want := []bool{true, true, true, false, false}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected residency %v, got %v", want, got)
+	}
+
+	// Упреждающее чтение не выходит за конец файла
+	pin, err = pool.FetchPage(ctx, 4, LatchShared)
+	if err != nil {
+		t.Fatalf("failed to fetch last page: %v", err)
+	}
+	pin.Unpin()
+}
+
+func TestPool_PrefetchPages(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	pm, err := page.NewDiskManager(ctx, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+	t.Cleanup(func() {
+		pm.Close(ctx)
+	})
+	for range 6 {
+		if _, err := pm.AllocatePage(ctx); err != nil {
+			t.Fatalf("failed to allocate page: %v", err)
+		}
+	}
+
+	pool := NewPool(pm, 3)
+	// Страница 0 закреплена и занимает один из фреймов
+	pinned, err := pool.FetchPage(ctx, 0, LatchShared)
+	if err != nil {
+		t.Fatalf("failed to fetch page: %v", err)
+	}
+	defer pinned.Unpin()
+
+	// Свободных фреймов хватает только на две страницы, остальные пропускаются
+	pool.Prefetch(ctx, []page.PageID{1, 3, 5})
+	pool.prefetchWG.Wait()
+
+	got := pool.Residency(0, 6)
+	want := []bool{true, true, false, true, false, false}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected residency %v, got %v", want, got)
+	}
+
+	before := pool.Stats()
+	for _, pageID := range []page.PageID{1, 3} {
+		pin, err := pool.FetchPage(ctx, pageID, LatchShared)
+		if err != nil {
+			t.Fatalf("failed to fetch page %d: %v", pageID, err)
+		}
+		pin.Unpin()
+	}
+	after := pool.Stats()
+	if after.Hits-before.Hits != 2 || after.Misses != before.Misses {
+		t.Fatalf("expected 2 cache hits and no misses, got %+v -> %+v", before, after)
+	}
+	if after.Prefetched != 2 {
+		t.Fatalf("expected 2 prefetched pages, got %d", after.Prefetched)
+	}
+}
+
+func TestPool_TryFetchPage(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	pool := NewPool(&countingManager{}, 2)
+	holder, err := pool.NewPage(ctx) // Держит эксклюзивную защелку
+	if err != nil {
+		t.Fatalf("failed to create new page: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, mode := range []LatchMode{LatchShared, LatchExclusive} {
+			pin, ok, err := pool.TryFetchPage(ctx, holder.PageID(), mode)
+			if err != nil || ok || pin != nil {
+				t.Errorf("expected TryFetchPage to fail without error, got ok=%v err=%v", ok, err)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("TryFetchPage blocked on a held latch")
+	}
+
+	pool.mu.Lock()
+	pinCount := pool.frames[holder.frameID].pinCount
+	pool.mu.Unlock()
+	if pinCount != 1 {
+		t.Fatalf("expected pin count to stay 1, got %d", pinCount)
+	}
+
+	holder.Unpin()
+	pin, ok, err := pool.TryFetchPage(ctx, holder.PageID(), LatchExclusive)
+	if err != nil || !ok {
+		t.Fatalf("expected TryFetchPage to succeed after Unpin, got ok=%v err=%v", ok, err)
+	}
+	pin.Unpin()
+
+	// Единственный закрепленный фрейм освободился: страницу можно вытеснить
+	for range 2 {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page: %v", err)
+		}
+		defer pin.Unpin()
+	}
+}
+
+func TestPool_FetchPagesOrdered(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const rounds = 1000
+
+	pool := NewPool(&countingManager{}, 2)
+	var pageIDs []page.PageID
+	for range 2 {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page: %v", err)
+		}
+		pageIDs = append(pageIDs, pin.PageID())
+		pin.Unpin()
+	}
+	a, b := pageIDs[0], pageIDs[1]
+
+	// Без упорядочивания две горутины, захватывающие одни и те же страницы
+	// в противоположном порядке, рано или поздно ждут друг друга
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, order := range [][]page.PageID{{a, b}, {b, a}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range rounds {
+				pins, err := pool.FetchPagesOrdered(ctx, order, LatchExclusive)
+				if err != nil {
+					t.Errorf("FetchPagesOrdered failed: %v", err)
+					return
+				}
+				for _, pin := range pins {
+					data := pin.Bytes()
+					binary.LittleEndian.PutUint32(data, binary.LittleEndian.Uint32(data)+1)
+				}
+				pins.UnpinAll()
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("FetchPagesOrdered deadlocked on pages requested in opposite orders")
+	}
+
+	// Каждая горутина изменила обе страницы rounds раз под эксклюзивной защелкой
+	pins, err := pool.FetchPagesOrdered(ctx, []page.PageID{b, a, b}, LatchShared)
+	if err != nil {
+		t.Fatalf("FetchPagesOrdered failed: %v", err)
+	}
+	if len(pins) != 2 || pins[0].PageID() != a || pins[1].PageID() != b {
+		t.Fatalf("expected pins for pages %d and %d in order, got %d pins", a, b, len(pins))
+	}
+	for _, pin := range pins {
+		if got := binary.LittleEndian.Uint32(pin.Bytes()); got != 2*rounds {
+			t.Fatalf("page %d: expected counter %d, got %d", pin.PageID(), 2*rounds, got)
+		}
+	}
+	pins.UnpinAll()
+
+	// При ошибке уже полученные закрепления снимаются
+	small := NewPool(&countingManager{}, 1)
+	if _, err := small.FetchPagesOrdered(ctx, []page.PageID{a, b}, LatchExclusive); !errors.Is(err, ErrBufferPoolFull) {
+		t.Fatalf("expected %v, got %v", ErrBufferPoolFull, err)
+	}
+	for _, f := range small.frames {
+		if f.pinCount != 0 {
+			t.Fatalf("expected no pinned frames after failed fetch, frame %d has pin count %d", f.id, f.pinCount)
+		}
+	}
+}
+
+func TestPool_FlushPage(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	pm, err := page.NewDiskManager(ctx, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+	t.Cleanup(func() {
+		pm.Close(ctx)
+	})
+	pool := NewPool(pm, 2)
+
+	var pageIDs []page.PageID
+	for i := range 2 {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page: %v", err)
+		}
+		copy(pin.Bytes(), bytes.Repeat([]byte{byte('a' + i)}, page.DefaultPageSize))
+		pin.MarkDirty()
+		pageIDs = append(pageIDs, pin.PageID())
+		pin.Unpin()
+	}
+
+	if err := pool.FlushPage(ctx, pageIDs[0]); err != nil {
+		t.Fatalf("FlushPage failed: %v", err)
+	}
+
+	onDisk := make([]byte, page.DefaultPageSize)
+	if err := pm.ReadPage(ctx, pageIDs[0], onDisk); err != nil {
+		t.Fatalf("failed to read page: %v", err)
+	}
+	if !bytes.Equal(onDisk, bytes.Repeat([]byte{'a'}, page.DefaultPageSize)) {
+		t.Fatalf("flushed page was not persisted")
+	}
+	if err := pm.ReadPage(ctx, pageIDs[1], onDisk); err != nil {
+		t.Fatalf("failed to read page: %v", err)
+	}
+	if !bytes.Equal(onDisk, make([]byte, page.DefaultPageSize)) {
+		t.Fatalf("page that was not flushed reached the disk")
+	}
+	if len(pool.dirtyFrames) != 1 {
+		t.Fatalf("expected 1 dirty frame left, got %d", len(pool.dirtyFrames))
+	}
+
+	if err := pool.FlushPage(ctx, 100); !errors.Is(err, ErrPageNotResident) {
+		t.Fatalf("expected ErrPageNotResident, got %v", err)
+	}
+}
+
+func TestPagePin_DoubleUnpin(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	pool := NewPool(&countingManager{}, 1)
+	pin, err := pool.NewPage(ctx)
+	if err != nil {
+		t.Fatalf("failed to create new page: %v", err)
+	}
+	pin.Unpin()
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatalf("expected second Unpin to panic")
+			}
+		}()
+		pin.Unpin()
+	}()
+
+	pool.mu.Lock()
+	pinCount := pool.frames[pin.frameID].pinCount
+	pool.mu.Unlock()
+	if pinCount != 0 {
+		t.Fatalf("expected pin count to stay 0 after double unpin, got %d", pinCount)
+	}
+}
+
+func TestPool_FlushAndEvictPage(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	pm := &countingManager{}
+	pool := NewPool(pm, 2)
+
+	pin, err := pool.NewPage(ctx)
+	if err != nil {
+		t.Fatalf("failed to create new page: %v", err)
+	}
+	pin.MarkDirty()
+	if err := pool.EvictPage(pin.PageID()); !errors.Is(err, ErrPagePinned) {
+		t.Fatalf("expected ErrPagePinned, got %v", err)
+	}
+	pin.Unpin()
+
+	if err := pool.EvictPage(pin.PageID()); !errors.Is(err, ErrPageDirty) {
+		t.Fatalf("expected ErrPageDirty, got %v", err)
+	}
+	if err := pool.FlushPage(ctx, pin.PageID()); err != nil {
+		t.Fatalf("FlushPage failed: %v", err)
+	}
+	if pm.writes != 1 {
+		t.Fatalf("expected 1 write, got %d", pm.writes)
+	}
+	if err := pool.EvictPage(pin.PageID()); err != nil {
+		t.Fatalf("EvictPage failed: %v", err)
+	}
+	if got := pool.Residency(0, 1); got[0] {
+		t.Fatalf("expected page to be evicted")
+	}
+
+	// Освободившийся фрейм снова используется
+	for range 2 {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page after eviction: %v", err)
+		}
+		defer pin.Unpin()
+	}
+}
+
+func TestPool_DeletePage(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	pm, err := page.NewMemoryManager(page.DefaultPageSize)
+	if err != nil {
+		t.Fatalf("failed to create MemoryManager: %v", err)
+	}
+	pool := NewPool(pm, 2)
+	t.Cleanup(func() {
+		pool.Close(ctx)
+	})
+
+	pin, err := pool.NewPage(ctx)
+	if err != nil {
+		t.Fatalf("failed to create new page: %v", err)
+	}
+	pageID := pin.PageID()
+	copy(pin.Bytes(), bytes.Repeat([]byte{'x'}, page.DefaultPageSize))
+	pin.MarkDirty()
+	if err := pool.DeletePage(ctx, pageID); !errors.Is(err, ErrPagePinned) {
+		t.Fatalf("expected ErrPagePinned, got %v", err)
+	}
+	pin.Unpin()
+
+	// Грязная страница удаляется без записи, и ее фрейм освобождается
+	if err := pool.DeletePage(ctx, pageID); err != nil {
+		t.Fatalf("DeletePage failed: %v", err)
+	}
+	if got := pool.Residency(pageID, pageID+1); got[0] {
+		t.Fatalf("expected deleted page not to be resident")
+	}
+	if capacity := pool.Capacity(); capacity.Free != 2 {
+		t.Fatalf("expected 2 free frames, got %+v", capacity)
+	}
+	if err := pool.DeletePage(ctx, pageID); !errors.Is(err, page.ErrPageNotAllocated) {
+		t.Fatalf("expected %v on repeated delete, got %v", page.ErrPageNotAllocated, err)
+	}
+
+	// Освобожденная страница выдается снова, и пул не отдает ее старое содержимое
+	pin, err = pool.NewPage(ctx)
+	if err != nil {
+		t.Fatalf("failed to create new page: %v", err)
+	}
+	defer pin.Unpin()
+	if pin.PageID() != pageID {
+		t.Fatalf("expected deleted page %d to be reused, got %d", pageID, pin.PageID())
+	}
+	if !bytes.Equal(pin.Bytes(), make([]byte, page.DefaultPageSize)) {
+		t.Fatalf("expected reused page to be zeroed")
+	}
+}
+
+func TestPool_NewPage_StaleFramePinned(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	pm, err := page.NewDiskManager(ctx, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+	pool := NewPool(pm, 4)
+	t.Cleanup(func() {
+		pool.Close(ctx)
+	})
+
+	pin, err := pool.NewPage(ctx)
+	if err != nil {
+		t.Fatalf("failed to create new page: %v", err)
+	}
+	pageID := pin.PageID()
+	pin.Unpin()
+	if err := pool.DeletePage(ctx, pageID); err != nil {
+		t.Fatalf("DeletePage failed: %v", err)
+	}
+
+	// Освобожденную страницу закрепляет запоздавший читатель
+	stale, err := pool.FetchPage(ctx, pageID, LatchShared)
+	if err != nil {
+		t.Fatalf("failed to fetch freed page: %v", err)
+	}
+	if _, err := pool.NewPage(ctx); !errors.Is(err, ErrPagePinned) {
+		t.Fatalf("expected %v while the freed page is pinned, got %v", ErrPagePinned, err)
+	}
+	if capacity := pool.Capacity(); capacity.Free != 3 {
+		t.Fatalf("expected the frame of the failed NewPage to be free, got %+v", capacity)
+	}
+	stale.Unpin()
+
+	// После снятия закрепления страница выдается снова, и пул знает только ее новый фрейм
+	pin, err = pool.NewPage(ctx)
+	if err != nil {
+		t.Fatalf("failed to create new page: %v", err)
+	}
+	if pin.PageID() != pageID {
+		t.Fatalf("expected freed page %d to be reused, got %d", pageID, pin.PageID())
+	}
+	pin.Bytes()[0] = 'n'
+	pin.MarkDirty()
+	pin.Unpin()
+	fetched, err := pool.FetchPage(ctx, pageID, LatchShared)
+	if err != nil {
+		t.Fatalf("failed to fetch page: %v", err)
+	}
+	defer fetched.Unpin()
+	if fetched.Bytes()[0] != 'n' {
+		t.Fatalf("expected the reissued page contents, got %q", fetched.Bytes()[0])
+	}
+}
+
+func TestPool_BackgroundFlusher(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	tempDir := t.TempDir()
+	dbPath := filepath.Join(tempDir, "test.db")
+	pm, err := page.NewDiskManager(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+
+	pool := NewPool(pm, 2)
+	t.Cleanup(func() {
+		pool.Close(ctx)
+	})
+
+	pool.StartBackgroundFlusher(ctx, 5*time.Millisecond)
+	pool.StartBackgroundFlusher(ctx, 5*time.Millisecond) // повторный запуск ничего не делает
+	defer pool.StopBackgroundFlusher()
+
+	pin, err := pool.NewPage(ctx)
+	if err != nil {
+		t.Fatalf("failed to create new page: %v", err)
+	}
+	data := bytes.Repeat([]byte{'F'}, page.DefaultPageSize)
+	copy(pin.Bytes(), data)
+	pin.MarkDirty()
+	pin.Unpin()
+
+	onDisk := make([]byte, page.DefaultPageSize)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if err := pm.ReadPage(ctx, pin.pageID, onDisk); err != nil {
+			t.Fatalf("failed to read page from disk: %v", err)
+		}
+		if bytes.Equal(onDisk, data) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("dirty page was not flushed by background flusher")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPool_Checkpointer(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const numPages, perTick = 100, 10
+
+	pm := &countingManager{}
+	pool := NewPool(pm, numPages, WithCheckpointPages(perTick))
+	for range numPages {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page: %v", err)
+		}
+		pin.MarkDirty()
+		pin.Unpin()
+	}
+	// Закрепленная грязная страница пропускается
+	pinned, err := pool.FetchPage(ctx, 0, LatchShared)
+	if err != nil {
+		t.Fatalf("failed to fetch page: %v", err)
+	}
+
+	dirtyCount := func() int {
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+		return len(pool.dirtyFrames)
+	}
+
+	// Один тик сбрасывает не больше perTick страниц
+	pool.checkpoint(ctx)
+	if got := dirtyCount(); got != numPages-perTick {
+		t.Fatalf("expected %d dirty pages after one tick, got %d", numPages-perTick, got)
+	}
+
+	pool.StartCheckpointer(ctx, time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for dirtyCount() > 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("checkpointer did not flush dirty pages, %d left", dirtyCount())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	pool.StopBackgroundFlusher()
+
+	if pm.writes != numPages-1 {
+		t.Fatalf("expected %d pages to be written, got %d", numPages-1, pm.writes)
+	}
+	pinned.Unpin()
+	if got := dirtyCount(); got != 1 {
+		t.Fatalf("expected only the pinned page to stay dirty, got %d", got)
+	}
+}
+
+// countingManager — менеджер страниц без диска, считающий количество записей
+type countingManager struct {
+	nextPage page.PageID
+	writes   int
+	batches  int
+	onWrite  func()
+}
+
+func (m *countingManager) AllocatePage(ctx context.Context) (page.PageID, error) {
+	pageID := m.nextPage
+	m.nextPage++
+	return pageID, nil
+}
+
+func (m *countingManager) AllocatePages(ctx context.Context, n int) ([]page.PageID, error) {
+	pageIDs := make([]page.PageID, n)
+	for i := range pageIDs {
+		pageIDs[i], _ = m.AllocatePage(ctx)
+	}
+	return pageIDs, nil
+}
+
+func (m *countingManager) DeallocatePage(ctx context.Context, pageID page.PageID) error {
+	return nil
+}
+
+func (m *countingManager) ReadPage(ctx context.Context, pageID page.PageID, p []byte) error {
+	return nil
+}
+
+func (m *countingManager) WritePage(ctx context.Context, pageID page.PageID, p []byte) error {
+	m.writes++
+	if m.onWrite != nil {
+		m.onWrite()
+	}
+	return nil
+}
+
+func (m *countingManager) WritePages(ctx context.Context, pages []page.PageWrite) error {
+	m.batches++
+	for _, pw := range pages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := m.WritePage(ctx, pw.PageID, pw.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *countingManager) ForEachPage(ctx context.Context, fn func(pageID page.PageID, data []byte) error) error {
+	return nil
+}
+
+func (m *countingManager) Sync(ctx context.Context) error {
+	return nil
+}
+
+func (m *countingManager) PageSize() int {
+	return page.DefaultPageSize
+}
+
+func (m *countingManager) PageCount(ctx context.Context) (uint64, error) {
+	return uint64(m.nextPage), nil
+}
+
+func (m *countingManager) FileSize(ctx context.Context) (int64, error) {
+	return int64(m.nextPage+1) * page.DefaultPageSize, nil
+}
+
+func (m *countingManager) Close(ctx context.Context) error {
+	return nil
+}
+
+// failingManager проваливает тест при любом обращении к диску
+type failingManager struct {
+	t *testing.T
+}
+
+func (m *failingManager) AllocatePage(ctx context.Context) (page.PageID, error) {
+	m.t.Errorf("unexpected AllocatePage call")
+	return 0, nil
+}
+
+func (m *failingManager) AllocatePages(ctx context.Context, n int) ([]page.PageID, error) {
+	m.t.Errorf("unexpected AllocatePages call")
+	return nil, nil
+}
+
+func (m *failingManager) DeallocatePage(ctx context.Context, pageID page.PageID) error {
+	m.t.Errorf("unexpected DeallocatePage call")
+	return nil
+}
+
+func (m *failingManager) ReadPage(ctx context.Context, pageID page.PageID, p []byte) error {
+	m.t.Errorf("unexpected ReadPage call")
+	return nil
+}
+
+func (m *failingManager) WritePage(ctx context.Context, pageID page.PageID, p []byte) error {
+	m.t.Errorf("unexpected WritePage call")
+	return nil
+}
+
+func (m *failingManager) WritePages(ctx context.Context, pages []page.PageWrite) error {
+	m.t.Errorf("unexpected WritePages call")
+	return nil
+}
+
+func (m *failingManager) ForEachPage(ctx context.Context, fn func(pageID page.PageID, data []byte) error) error {
+	m.t.Errorf("unexpected ForEachPage call")
+	return nil
+}
+
+func (m *failingManager) Sync(ctx context.Context) error {
+	m.t.Errorf("unexpected Sync call")
+	return nil
+}
+
+func (m *failingManager) PageSize() int {
+	return page.DefaultPageSize
+}
+
+func (m *failingManager) PageCount(ctx context.Context) (uint64, error) {
+	m.t.Errorf("unexpected PageCount call")
+	return 0, nil
+}
+
+func (m *failingManager) FileSize(ctx context.Context) (int64, error) {
+	m.t.Errorf("unexpected FileSize call")
+	return 0, nil
+}
+
+func (m *failingManager) Close(ctx context.Context) error {
+	m.t.Errorf("unexpected Close call")
+	return nil
+}
+
+func TestPool_EvictionWithMarkDirtyStress(t *testing.T) {
+	const (
+		numPages = 8
+		workers  = 16
+		rounds   = 200
+	)
+
+	t.Parallel()
+	ctx := context.Background()
+
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	pm, err := page.NewDiskManager(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+
+	// Пул меньше количества страниц, чтобы вытеснение шло постоянно
+	pool := NewPool(pm, 3)
+	t.Cleanup(func() {
+		pool.Close(ctx)
+	})
+
+	pageIDs := make([]page.PageID, numPages)
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := range numPages {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page: %v", err)
+		}
+		pageIDs[i] = pin.pageID
+		writeTestData(pin.Bytes(), rnd)
+		pin.MarkDirty()
+		pin.Unpin()
+	}
+
+	wg := new(sync.WaitGroup)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+			for range rounds {
+				targetPageID := pageIDs[rnd.Intn(numPages)]
+				mode := LatchShared
+				if rnd.Intn(2) == 0 {
+					mode = LatchExclusive
+				}
+				pin, err := pool.FetchPage(ctx, targetPageID, mode)
+				if errors.Is(err, ErrBufferPoolFull) {
+					continue
+				}
+				if err != nil {
+					t.Errorf("failed to fetch page %d: %v", targetPageID, err)
+					return
+				}
+				if mode == LatchExclusive {
+					writeTestData(pin.Bytes(), rnd)
+					pin.MarkDirty()
+				} else if err := checkTestData(pin.Bytes()); err != nil {
+					t.Errorf("data integrity check failed for page %d: %v", targetPageID, err)
+				}
+				pin.Unpin()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// checksumManager проверяет контрольную сумму каждой записываемой страницы
+type checksumManager struct {
+	page.Manager
+	torn atomic.Int32
+}
+
+func (m *checksumManager) WritePage(ctx context.Context, pageID page.PageID, p []byte) error {
+	if checkTestData(p) != nil {
+		m.torn.Add(1)
+	}
+	return m.Manager.WritePage(ctx, pageID, p)
+}
+
+func (m *checksumManager) WritePages(ctx context.Context, pages []page.PageWrite) error {
+	for _, pw := range pages {
+		if err := m.WritePage(ctx, pw.PageID, pw.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestPool_FlushNeverWritesHalfModifiedPage(t *testing.T) {
+	const (
+		numPages = 8
+		rounds   = 300
+	)
+
+	t.Parallel()
+	ctx := context.Background()
+
+	mm, err := page.NewMemoryManager(page.DefaultPageSize)
+	if err != nil {
+		t.Fatalf("failed to create memory manager: %v", err)
+	}
+	pm := &checksumManager{Manager: mm}
+	// Пул вмещает все страницы, поэтому записывают на диск только сбросы
+	pool := NewPool(pm, numPages)
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	pageIDs := make([]page.PageID, numPages)
+	for i := range numPages {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page: %v", err)
+		}
+		pageIDs[i] = pin.PageID()
+		writeTestData(pin.Bytes(), rnd)
+		pin.MarkDirty()
+		pin.Unpin()
+	}
+
+	stop := make(chan struct{})
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := pool.FlushAllPages(ctx); err != nil {
+				t.Errorf("FlushAllPages failed: %v", err)
+				return
+			}
+			if err := pool.FlushPage(ctx, pageIDs[rnd.Intn(numPages)]); err != nil {
+				t.Errorf("FlushPage failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	// Страница меняется по частям: до пересчета контрольной суммы ее содержимое несогласованно
+	writer := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for range rounds {
+		pin, err := pool.FetchPage(ctx, pageIDs[writer.Intn(numPages)], LatchExclusive)
+		if err != nil {
+			t.Fatalf("failed to fetch page: %v", err)
+		}
+		data := pin.Bytes()
+		pin.MarkDirty()
+		for range 16 {
+			offset := writer.Intn(page.DefaultPageSize - 4 - 64)
+			writer.Read(data[offset : offset+64])
+			runtime.Gosched()
+		}
+		binary.BigEndian.PutUint32(data[page.DefaultPageSize-4:], crc32.ChecksumIEEE(data[:page.DefaultPageSize-4]))
+		pin.Unpin()
+	}
+	close(stop)
+	<-flushed
+
+	if n := pm.torn.Load(); n != 0 {
+		t.Fatalf("expected every written page to be consistent, got %d torn writes", n)
+	}
+}
+
+func BenchmarkPagePin_MarkDirty(b *testing.B) {
+	ctx := context.Background()
+	pool := NewPool(&countingManager{}, 1)
+
+	pin, err := pool.NewPage(ctx)
+	if err != nil {
+		b.Fatalf("failed to create new page: %v", err)
+	}
+	defer pin.Unpin()
+
+	// Конкурент за мьютекс пула: постоянно опрашивает резидентность страниц
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				pool.Residency(0, 1)
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	for range b.N {
+		pin.MarkDirty()
+	}
+	b.StopTimer()
+
+	close(stop)
+	<-done
+}
+
 // writeTestData формирует контент: [RandomBytes..., Checksum] и пишет в p
 func writeTestData(p []byte, rng *rand.Rand) {
-	rng.Read(p[:page.PageSize-4])
-	sum := crc32.ChecksumIEEE(p[:page.PageSize-4])
-	binary.BigEndian.PutUint32(p[page.PageSize-4:], sum)
+	rng.Read(p[:page.DefaultPageSize-4])
+	sum := crc32.ChecksumIEEE(p[:page.DefaultPageSize-4])
+	binary.BigEndian.PutUint32(p[page.DefaultPageSize-4:], sum)
 }
 
 // checkTestData проверяет контрольную сумму в p
 func checkTestData(p []byte) error {
-	storedSum := binary.BigEndian.Uint32(p[page.PageSize-4:])
-	sum := crc32.ChecksumIEEE(p[:page.PageSize-4])
+	storedSum := binary.BigEndian.Uint32(p[page.DefaultPageSize-4:])
+	sum := crc32.ChecksumIEEE(p[:page.DefaultPageSize-4])
 	if storedSum != sum {
 		return fmt.Errorf("checksum mismatch: stored %d, computed %d", storedSum, sum)
 	}
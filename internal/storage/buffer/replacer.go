@@ -47,3 +47,156 @@ func (r *lruReplacer) Evict() (frameID, bool) {
 
 	return frameID, true
 }
+
+func (r *lruReplacer) Size() int {
+	return r.list.Len()
+}
+
+// lruKReplacer вытесняет фрейм с наибольшим обратным K-расстоянием: чье K-е с конца обращение
+// было раньше всех. Фреймы, к которым обращались меньше K раз, вытесняются в первую очередь,
+// между собой — по LRU. Поэтому страницы, прочитанные один раз при последовательном сканировании,
+// не вытесняют страницы, к которым обращаются регулярно.
+//
+// Обращением считается Unpin. История фрейма сбрасывается при его вытеснении через Evict.
+// Evict просматривает все кандидаты, поэтому работает за O(n) от их количества.
+type lruKReplacer struct {
+	k         int
+	clock     uint64               // Логическое время последнего обращения
+	history   map[frameID][]uint64 // Время последних не более k обращений к фрейму, от старых к новым
+	evictable map[frameID]struct{} // Незакрепленные фреймы — кандидаты на вытеснение
+}
+
+func NewLRUKReplacer(k int) *lruKReplacer {
+	return &lruKReplacer{
+		k:         max(k, 1),
+		history:   make(map[frameID][]uint64),
+		evictable: make(map[frameID]struct{}),
+	}
+}
+
+func (r *lruKReplacer) Pin(frameID frameID) {
+	delete(r.evictable, frameID)
+}
+
+func (r *lruKReplacer) Unpin(frameID frameID) {
+	r.clock++
+	h := append(r.history[frameID], r.clock)
+	if len(h) > r.k {
+		h = h[len(h)-r.k:]
+	}
+	r.history[frameID] = h
+	r.evictable[frameID] = struct{}{}
+}
+
+func (r *lruKReplacer) Evict() (frameID, bool) {
+	var (
+		victim   frameID
+		found    bool
+		complete bool   // У жертвы набралось k обращений
+		victimTS uint64 // Время, по которому сравниваются кандидаты
+	)
+	for id := range r.evictable {
+		h := r.history[id]
+		// Неполная история означает бесконечное K-расстояние: такие фреймы сравниваются
+		// по последнему обращению, а полные — по K-му с конца
+		isComplete := len(h) == r.k
+		ts := h[len(h)-1]
+		if isComplete {
+			ts = h[0]
+		}
+		if !found || (complete && !isComplete) || (complete == isComplete && ts < victimTS) {
+			victim, found, complete, victimTS = id, true, isComplete, ts
+		}
+	}
+	if !found {
+		return 0, false
+	}
+
+	delete(r.evictable, victim)
+	delete(r.history, victim)
+	return victim, true
+}
+
+func (r *lruKReplacer) Size() int {
+	return len(r.evictable)
+}
+
+// twoQueueReplacer реализует упрощенный алгоритм 2Q. Фрейм, к которому обратились впервые,
+// попадает в FIFO-очередь A1in, а при повторном обращении переходит в LRU-очередь Am.
+// Evict берет жертву из A1in, пока та занимает больше доли kinRatio от всех кандидатов,
+// иначе — из Am. Поэтому страницы, прочитанные один раз при сканировании, вытесняют друг друга,
+// а не страницы, к которым обращаются повторно.
+//
+// Обращением считается Unpin. Очереди хранят только кандидатов на вытеснение, а очередь,
+// к которой относится закрепленный фрейм, запоминается до его вытеснения через Evict.
+// В отличие от полного 2Q, очереди вытесненных страниц A1out нет: replacer знает фреймы,
+// а не страницы, и не может узнать страницу, вернувшуюся в пул в другом фрейме.
+type twoQueueReplacer struct {
+	kinRatio float64
+	a1in     *list.List                // FIFO фреймов с одним обращением. Голова — самые новые
+	am       *list.List                // LRU фреймов с повторными обращениями. Голова — самые "свежие"
+	hot      map[frameID]bool          // Очередь фрейма, известного replacer: true — Am, false — A1in
+	nodes    map[frameID]*list.Element // Узлы незакрепленных фреймов в их очереди
+}
+
+// NewTwoQueueReplacer создает 2Q replacer. kinRatio — доля кандидатов, которую может занимать
+// очередь A1in, прежде чем Evict начнет брать жертв из нее. Значение ограничивается отрезком [0, 1].
+func NewTwoQueueReplacer(kinRatio float64) *twoQueueReplacer {
+	return &twoQueueReplacer{
+		kinRatio: min(max(kinRatio, 0), 1),
+		a1in:     list.New(),
+		am:       list.New(),
+		hot:      make(map[frameID]bool),
+		nodes:    make(map[frameID]*list.Element),
+	}
+}
+
+func (r *twoQueueReplacer) Pin(frameID frameID) {
+	el, ok := r.nodes[frameID]
+	if !ok {
+		return
+	}
+	delete(r.nodes, frameID)
+	r.queue(frameID).Remove(el)
+}
+
+func (r *twoQueueReplacer) Unpin(frameID frameID) {
+	r.Pin(frameID)
+	// Повторное обращение переводит фрейм в Am, первое — ставит в A1in
+	_, seen := r.hot[frameID]
+	r.hot[frameID] = seen
+	r.nodes[frameID] = r.queue(frameID).PushFront(frameID)
+}
+
+func (r *twoQueueReplacer) Evict() (frameID, bool) {
+	q := r.am
+	if r.am.Len() == 0 || float64(r.a1in.Len()) > r.kinRatio*float64(r.Size()) {
+		q = r.a1in
+	}
+	el := q.Back()
+	if el == nil {
+		return 0, false
+	}
+
+	frameID, ok := el.Value.(frameID)
+	if !ok {
+		panic("failed to assert frameID type")
+	}
+
+	q.Remove(el)
+	delete(r.nodes, frameID)
+	delete(r.hot, frameID)
+	return frameID, true
+}
+
+func (r *twoQueueReplacer) Size() int {
+	return r.a1in.Len() + r.am.Len()
+}
+
+// queue возвращает очередь, к которой относится фрейм.
+func (r *twoQueueReplacer) queue(frameID frameID) *list.List {
+	if r.hot[frameID] {
+		return r.am
+	}
+	return r.a1in
+}
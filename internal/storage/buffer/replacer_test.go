@@ -0,0 +1,172 @@
+package buffer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Argentum88/godb/internal/storage/page"
+)
+
+// touch имитирует закрепление и открепление фреймов пулом
+func touch(r replacer, frameIDs ...frameID) {
+	for _, id := range frameIDs {
+		r.Pin(id)
+		r.Unpin(id)
+	}
+}
+
+func TestLRUKReplacer_ScanResistance(t *testing.T) {
+	t.Parallel()
+
+	// Фреймы 0 и 1 горячие, затем сканирование однократно читает фреймы 2-4
+	access := func(r replacer) {
+		touch(r, 0, 1, 0, 1)
+		touch(r, 2, 3, 4)
+	}
+
+	lru := NewLRUReplacer()
+	access(lru)
+	if victim, _ := lru.Evict(); victim != 0 {
+		t.Fatalf("expected plain LRU to evict hot frame 0, got %d", victim)
+	}
+
+	lruK := NewLRUKReplacer(2)
+	access(lruK)
+	// Сначала вытесняются фреймы сканирования по LRU, и только потом горячие
+	for _, want := range []frameID{2, 3, 4, 0, 1} {
+		victim, ok := lruK.Evict()
+		if !ok || victim != want {
+			t.Fatalf("expected frame %d to be evicted, got %d (ok=%v)", want, victim, ok)
+		}
+	}
+	if _, ok := lruK.Evict(); ok {
+		t.Fatalf("expected no frames left to evict")
+	}
+}
+
+func TestLRUKReplacer_BackwardKDistance(t *testing.T) {
+	t.Parallel()
+	r := NewLRUKReplacer(2)
+
+	// K-е с конца обращение: у фрейма 0 — время 1, у фрейма 1 — время 2, у фрейма 2 — время 5
+	touch(r, 0, 1, 1, 0, 2, 2)
+	// Закрепленный фрейм не вытесняется
+	r.Pin(0)
+
+	if victim, _ := r.Evict(); victim != 1 {
+		t.Fatalf("expected frame 1 with the oldest 2nd-to-last access, got %d", victim)
+	}
+	if victim, _ := r.Evict(); victim != 2 {
+		t.Fatalf("expected frame 2, got %d", victim)
+	}
+	if _, ok := r.Evict(); ok {
+		t.Fatalf("expected pinned frame 0 not to be evicted")
+	}
+
+	// Вытеснение сбрасывает историю: фрейм 2 снова считается прочитанным один раз
+	r.Unpin(0)
+	touch(r, 2)
+	if victim, _ := r.Evict(); victim != 2 {
+		t.Fatalf("expected frame 2 with reset history to be evicted first, got %d", victim)
+	}
+}
+
+func TestTwoQueueReplacer_ScanResistance(t *testing.T) {
+	t.Parallel()
+	r := NewTwoQueueReplacer(0.25)
+
+	// Фреймы 0 и 1 горячие, затем сканирование однократно читает фреймы 2-9
+	touch(r, 0, 1, 0, 1)
+	touch(r, 2, 3, 4, 5, 6, 7, 8, 9)
+	if r.Size() != 10 {
+		t.Fatalf("expected 10 candidates, got %d", r.Size())
+	}
+	// Фреймы сканирования вытесняются в порядке FIFO, горячие — последними и по LRU
+	for _, want := range []frameID{2, 3, 4, 5, 6, 7, 8, 9, 0, 1} {
+		victim, ok := r.Evict()
+		if !ok || victim != want {
+			t.Fatalf("expected frame %d to be evicted, got %d (ok=%v)", want, victim, ok)
+		}
+	}
+	if _, ok := r.Evict(); ok {
+		t.Fatalf("expected no frames left to evict")
+	}
+}
+
+func TestTwoQueueReplacer_Queues(t *testing.T) {
+	t.Parallel()
+	r := NewTwoQueueReplacer(1)
+
+	// При kinRatio = 1 очередь A1in никогда не превышает свою долю, и жертвы берутся из Am, пока она не пуста
+	touch(r, 0, 1, 2, 0, 1)
+	r.Pin(0)
+	if victim, _ := r.Evict(); victim != 1 {
+		t.Fatalf("expected unpinned hot frame 1, got %d", victim)
+	}
+	if victim, _ := r.Evict(); victim != 2 {
+		t.Fatalf("expected cold frame 2 once Am has no candidates, got %d", victim)
+	}
+	if _, ok := r.Evict(); ok {
+		t.Fatalf("expected pinned frame 0 not to be evicted")
+	}
+
+	// Закрепленный фрейм остается в Am, а вытеснение забывает очередь фрейма
+	touch(r, 1)
+	r.Unpin(0)
+	if victim, _ := r.Evict(); victim != 0 {
+		t.Fatalf("expected frame 0 to stay hot while pinned, got %d", victim)
+	}
+	if victim, _ := r.Evict(); victim != 1 {
+		t.Fatalf("expected frame 1 to be cold after its eviction, got %d", victim)
+	}
+}
+
+func TestPool_LRUKReplacer_KeepsHotPagesDuringScan(t *testing.T) {
+	t.Parallel()
+	testKeepsHotPagesDuringScan(t, NewLRUKReplacer(2))
+}
+
+func TestPool_TwoQueueReplacer_KeepsHotPagesDuringScan(t *testing.T) {
+	t.Parallel()
+	testKeepsHotPagesDuringScan(t, NewTwoQueueReplacer(0.25))
+}
+
+// testKeepsHotPagesDuringScan проверяет, что страницы, прочитанные дважды, остаются в пуле
+// после сканирования, которое читает больше страниц, чем помещается в пул, по одному разу
+func testKeepsHotPagesDuringScan(t *testing.T, r replacer) {
+	ctx := context.Background()
+	const poolSize, scanPages = 4, 16
+
+	pool := NewPool(&countingManager{}, poolSize, WithReplacer(r))
+	var hot []page.PageID
+	for range 2 {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page: %v", err)
+		}
+		hot = append(hot, pin.PageID())
+		pin.Unpin()
+	}
+	for _, pageID := range hot {
+		pin, err := pool.FetchPage(ctx, pageID, LatchShared)
+		if err != nil {
+			t.Fatalf("failed to fetch page %d: %v", pageID, err)
+		}
+		pin.Unpin()
+	}
+
+	// Последовательное сканирование страниц, к которым обращаются один раз
+	for range scanPages {
+		pin, err := pool.NewPage(ctx)
+		if err != nil {
+			t.Fatalf("failed to create new page: %v", err)
+		}
+		pin.Unpin()
+	}
+
+	for _, pageID := range hot {
+		if resident := pool.Residency(pageID, pageID+1); !resident[0] {
+			t.Fatalf("expected hot page %d to survive the scan", pageID)
+		}
+	}
+}
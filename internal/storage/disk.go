@@ -0,0 +1,739 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Argentum88/godb/internal/storage/buffer"
+	"github.com/Argentum88/godb/internal/storage/heap"
+	"github.com/Argentum88/godb/internal/storage/page"
+	"github.com/Argentum88/godb/internal/storage/wal"
+)
+
+const (
+	defaultDiskPoolSize = 64
+	recordKeyLenSize    = 4
+	walSuffix           = ".wal"
+	clearLogMarker      = math.MaxUint32     // Count записи журнала, удаляющей все ключи
+	deletePrefixMarker  = math.MaxUint32 - 1 // Count записи журнала, удаляющей ключи с префиксом
+)
+
+var ErrCorruptRecord = errors.New("corrupt key-value record")
+
+// diskIndexEntry — положение записи с актуальным значением ключа в heap-файле.
+type diskIndexEntry struct {
+	rid      heap.RecordID
+	valueLen int
+}
+
+// diskKVEngine хранит пары ключ-значение записями heap-файла
+// и держит в памяти индекс ключ -> RecordID, восстанавливаемый при открытии.
+// Каждое изменение сначала записывается в журнал упреждающей записи и сбрасывается на диск,
+// а затем применяется к страницам пула. При открытии журнал проигрывается поверх
+// сохраненных страниц, после чего страницы сбрасываются, а журнал очищается.
+//
+// Формат записи heap-файла: [ KeyLen (4 байта) ] [ Key ] [ Value ]
+// Формат записи журнала: [ Count (4 байта) ], затем Count раз [ RecordLen (4 байта) ] [ запись heap-файла ].
+// Запись журнала из одного Count, равного clearLogMarker, удаляет все ключи, а запись из Count,
+// равного deletePrefixMarker, и следующего за ним префикса — ключи с этим префиксом.
+type diskKVEngine struct {
+	pm    page.Manager
+	pool  *buffer.Pool
+	heap  *heap.HeapFile
+	wal   *wal.Log
+	index map[string]diskIndexEntry
+	mtx   sync.RWMutex
+	opts  engineOptions
+	scrub diskScrubber
+}
+
+// NewDiskKVEngine открывает файл базы по пути path, создавая его при отсутствии,
+// и восстанавливает индекс по сохраненным записям и журналу упреждающей записи path + ".wal".
+// С WithScrubber запускает фоновую проверку страниц и индекса, которую останавливает Close.
+func NewDiskKVEngine(ctx context.Context, path string, opts ...Option) (*diskKVEngine, error) {
+	pm, err := page.NewDiskManager(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open disk manager: %w", err)
+	}
+
+	// Файл целиком принадлежит одному heap-файлу, поэтому его страницы — все heap-страницы файла.
+	// Непроинициализированные страницы тоже принадлежат ему: они выделены до сбоя, но не записаны
+	var pages []page.PageID
+	err = pm.ForEachPage(ctx, func(pageID page.PageID, data []byte) error {
+		sp := page.NewSlottedPage(data)
+		if !sp.Initialized() || sp.PageType() == page.PageTypeHeap {
+			pages = append(pages, pageID)
+		}
+		return nil
+	})
+	if err != nil {
+		pm.Close(ctx)
+		return nil, fmt.Errorf("failed to list pages: %w", err)
+	}
+
+	pool := buffer.NewPool(pm, defaultDiskPoolSize)
+	kv := &diskKVEngine{
+		pm:    pm,
+		pool:  pool,
+		heap:  heap.OpenHeapFile(pool, pages),
+		index: make(map[string]diskIndexEntry),
+		opts:  newEngineOptions(opts),
+	}
+	if err := kv.recover(ctx); err != nil {
+		pool.Close(ctx)
+		return nil, err
+	}
+
+	kv.wal, err = wal.Open(path + walSuffix)
+	if err != nil {
+		pool.Close(ctx)
+		return nil, err
+	}
+	if err := kv.replay(ctx); err != nil {
+		kv.wal.Close()
+		pool.Close(ctx)
+		return nil, err
+	}
+
+	if kv.opts.scrubInterval > 0 && kv.opts.scrubBatch > 0 {
+		kv.startScrubber(kv.opts.scrubInterval, kv.opts.scrubBatch)
+	}
+	return kv, nil
+}
+
+// recover восстанавливает индекс по живым записям heap-файла.
+// Вставка в heap-файл идет только в последнюю страницу, поэтому RecordID растут монотонно.
+// Если сбой случился между вставкой нового значения и удалением старого,
+// у ключа окажется две живые записи: актуальна более поздняя, а старая удаляется.
+func (kv *diskKVEngine) recover(ctx context.Context) error {
+	var stale []heap.RecordID
+	err := kv.heap.Scan(ctx, func(rid heap.RecordID, data []byte) error {
+		key, value, err := decodeRecord(data)
+		if err != nil {
+			return fmt.Errorf("record %v: %w", rid, err)
+		}
+		if prev, ok := kv.index[string(key)]; ok {
+			stale = append(stale, prev.rid)
+		}
+		kv.index[string(key)] = diskIndexEntry{rid: rid, valueLen: len(value)}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rebuild index: %w", err)
+	}
+
+	for _, rid := range stale {
+		if err := kv.heap.DeleteRecord(ctx, rid); err != nil {
+			return fmt.Errorf("failed to delete stale record %v: %w", rid, err)
+		}
+	}
+	return nil
+}
+
+// replay применяет изменения из журнала упреждающей записи, которые могли не попасть
+// в сохраненные страницы, и делает контрольную точку.
+// Запись, не поместившаяся в страницу, пропускается: ее изменение и до сбоя завершилось ошибкой.
+func (kv *diskKVEngine) replay(ctx context.Context) error {
+	it := kv.wal.Iterator()
+	for it.Next() {
+		lsn, data := it.Record()
+		if isClearLogRecord(data) {
+			if err := kv.clear(ctx); err != nil {
+				return fmt.Errorf("failed to replay log record %d: %w", lsn, err)
+			}
+			continue
+		}
+		if prefix, ok := deletePrefixLogRecord(data); ok {
+			if _, err := kv.deletePrefix(ctx, prefix); err != nil {
+				return fmt.Errorf("failed to replay log record %d: %w", lsn, err)
+			}
+			continue
+		}
+		pairs, err := decodeLogRecord(data)
+		if err != nil {
+			return fmt.Errorf("log record %d: %w", lsn, err)
+		}
+		for _, pair := range pairs {
+			err := kv.set(ctx, pair.key, pair.value)
+			if errors.Is(err, heap.ErrRecordTooLarge) {
+				slog.Warn("skipping log record that does not fit into a page", "lsn", lsn, "key", string(pair.key))
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to replay log record %d: %w", lsn, err)
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return fmt.Errorf("failed to replay write-ahead log: %w", err)
+	}
+	return kv.checkpoint(ctx)
+}
+
+// checkpoint сбрасывает страницы на диск и очищает журнал, чьи изменения теперь в страницах.
+// Вызывается под kv.mtx или до начала работы с движком.
+func (kv *diskKVEngine) checkpoint(ctx context.Context) error {
+	if err := kv.pool.FlushAllPages(ctx); err != nil {
+		return err
+	}
+	if err := kv.pm.Sync(ctx); err != nil {
+		return err
+	}
+	return kv.wal.Truncate()
+}
+
+// checkSize проверяет ограничения размера из опций, а также то, что запись ключа и значения
+// помещается в пустую страницу. Иначе изменение попало бы в журнал, но не в heap-файл.
+func (kv *diskKVEngine) checkSize(key, value []byte) error {
+	if err := kv.opts.checkSize(key, value); err != nil {
+		return err
+	}
+	limit := heap.MaxRecordSize(kv.pm.PageSize()) - recordKeyLenSize
+	if len(key) > limit {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrKeyTooLarge, len(key), limit)
+	}
+	if len(key)+len(value) > limit {
+		return fmt.Errorf("%w: %d bytes, limit is %d for this key", ErrValueTooLarge, len(value), limit-len(key))
+	}
+	return nil
+}
+
+// logWrite записывает пары в журнал одной записью и дожидается ее сброса на диск.
+// Вызывается под kv.mtx до применения пар к страницам.
+func (kv *diskKVEngine) logWrite(pairs ...kvPair) error {
+	return kv.logAppend(encodeLogRecord(pairs))
+}
+
+// logAppend записывает запись в журнал и дожидается ее сброса на диск. Вызывается под kv.mtx.
+func (kv *diskKVEngine) logAppend(record []byte) error {
+	if _, err := kv.wal.Append(record); err != nil {
+		return err
+	}
+	return kv.wal.Sync()
+}
+
+// Set проверяет ctx и после захвата блокировки: запись, дождавшаяся ее после отмены,
+// не попадает ни в журнал, ни в heap-файл.
+func (kv *diskKVEngine) Set(ctx context.Context, key []byte, value []byte) error {
+	if err := kv.checkSize(key, value); err != nil {
+		return err
+	}
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := kv.logWrite(kvPair{key: key, value: value}); err != nil {
+		return err
+	}
+	return kv.set(ctx, key, value)
+}
+
+func (kv *diskKVEngine) Get(ctx context.Context, key []byte) ([]byte, error) {
+	kv.mtx.RLock()
+	defer kv.mtx.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return kv.get(ctx, key)
+}
+
+// SetMany записывает пары под одной блокировкой. Ошибка записи не откатывает уже записанные пары.
+func (kv *diskKVEngine) SetMany(pairs map[string][]byte) error {
+	for k, v := range pairs {
+		if err := kv.checkSize([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	ctx := context.Background()
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+
+	batch := make([]kvPair, 0, len(pairs))
+	for k, v := range pairs {
+		batch = append(batch, kvPair{key: []byte(k), value: v})
+	}
+	if err := kv.logWrite(batch...); err != nil {
+		return err
+	}
+	for _, pair := range batch {
+		if err := kv.set(ctx, pair.key, pair.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (kv *diskKVEngine) GetMany(keys [][]byte) ([][]byte, []error) {
+	ctx := context.Background()
+	kv.mtx.RLock()
+	defer kv.mtx.RUnlock()
+	values := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		values[i], errs[i] = kv.get(ctx, key)
+	}
+	return values, errs
+}
+
+func (kv *diskKVEngine) Increment(key []byte, delta int64) (int64, error) {
+	if err := kv.checkSize(key, nil); err != nil {
+		return 0, err
+	}
+	ctx := context.Background()
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+
+	value, err := kv.get(ctx, key)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return 0, err
+	}
+	n, err := AddToValue(value, delta)
+	if err != nil {
+		return 0, err
+	}
+	// В журнал пишется результат, а не приращение, чтобы повторное применение было безопасным
+	newValue := strconv.AppendInt(nil, n, 10)
+	if err := kv.logWrite(kvPair{key: key, value: newValue}); err != nil {
+		return 0, err
+	}
+	if err := kv.set(ctx, key, newValue); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (kv *diskKVEngine) CompareAndSwap(key, expected, new []byte) (bool, error) {
+	if err := kv.checkSize(key, new); err != nil {
+		return false, err
+	}
+	ctx := context.Background()
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+
+	current, err := kv.get(ctx, key)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return false, err
+	}
+	if !ValueMatches(current, err == nil, expected) {
+		return false, nil
+	}
+	if err := kv.logWrite(kvPair{key: key, value: new}); err != nil {
+		return false, err
+	}
+	if err := kv.set(ctx, key, new); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (kv *diskKVEngine) SetNX(key, value []byte) (bool, error) {
+	return kv.CompareAndSwap(key, nil, value)
+}
+
+func (kv *diskKVEngine) GetSet(key, value []byte) ([]byte, bool, error) {
+	if err := kv.checkSize(key, value); err != nil {
+		return nil, false, err
+	}
+	ctx := context.Background()
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+
+	old, err := kv.get(ctx, key)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return nil, false, err
+	}
+	existed := err == nil
+	if err := kv.logWrite(kvPair{key: key, value: value}); err != nil {
+		return nil, false, err
+	}
+	if err := kv.set(ctx, key, value); err != nil {
+		return nil, false, err
+	}
+	return old, existed, nil
+}
+
+// TTL — срок жизни ключей движком не поддерживается, поэтому существующий ключ бессрочен.
+func (kv *diskKVEngine) TTL(key []byte) (time.Duration, error) {
+	kv.mtx.RLock()
+	defer kv.mtx.RUnlock()
+	if _, ok := kv.index[string(key)]; !ok {
+		return 0, ErrKeyNotFound
+	}
+	return NoExpiry, nil
+}
+
+// Append в журнал пишет получившееся значение целиком, как и Increment.
+func (kv *diskKVEngine) Append(key, suffix []byte) (int, error) {
+	ctx := context.Background()
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+
+	current, err := kv.get(ctx, key)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return 0, err
+	}
+	value := AppendValue(current, suffix)
+	if err := kv.checkSize(key, value); err != nil {
+		return 0, err
+	}
+	if err := kv.logWrite(kvPair{key: key, value: value}); err != nil {
+		return 0, err
+	}
+	if err := kv.set(ctx, key, value); err != nil {
+		return 0, err
+	}
+	return len(value), nil
+}
+
+// Clear удаляет записи всех ключей. Удаление сначала попадает в журнал одной записью,
+// поэтому после сбоя ключи либо все удалены, либо все на месте.
+// Страницы heap-файла освобождаются, и новые записи займут их, а не расширят файл.
+// Список освобожденных страниц хранится только в памяти: после переоткрытия
+// повторно используется лишь последняя из них, как и при обычной вставке.
+func (kv *diskKVEngine) Clear() error {
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	if err := kv.logAppend(binary.LittleEndian.AppendUint32(nil, clearLogMarker)); err != nil {
+		return err
+	}
+	return kv.clear(context.Background())
+}
+
+// clear освобождает все страницы heap-файла и очищает индекс. Вызывается под kv.mtx.
+func (kv *diskKVEngine) clear(ctx context.Context) error {
+	if err := kv.heap.Truncate(ctx); err != nil {
+		return fmt.Errorf("failed to truncate heap file: %w", err)
+	}
+	clear(kv.index)
+	return nil
+}
+
+// DeletePrefix, как и Clear, записывает удаление в журнал одной записью.
+// Если ключей с префиксом нет, журнал не меняется.
+func (kv *diskKVEngine) DeletePrefix(prefix []byte) (int, error) {
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	if !kv.hasPrefix(prefix) {
+		return 0, nil
+	}
+	record := binary.LittleEndian.AppendUint32(nil, deletePrefixMarker)
+	if err := kv.logAppend(append(record, prefix...)); err != nil {
+		return 0, err
+	}
+	return kv.deletePrefix(context.Background(), prefix)
+}
+
+// hasPrefix сообщает, есть ли в индексе ключ с префиксом prefix. Вызывается под kv.mtx.
+func (kv *diskKVEngine) hasPrefix(prefix []byte) bool {
+	for k := range kv.index {
+		if strings.HasPrefix(k, string(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// deletePrefix удаляет записи ключей с префиксом prefix из heap-файла и индекса
+// и возвращает их количество. Пустой префикс соответствует всем ключам, и тогда heap-файл
+// очищается целиком, как в clear. Вызывается под kv.mtx.
+func (kv *diskKVEngine) deletePrefix(ctx context.Context, prefix []byte) (int, error) {
+	if len(prefix) == 0 {
+		deleted := len(kv.index)
+		if err := kv.clear(ctx); err != nil {
+			return 0, err
+		}
+		return deleted, nil
+	}
+	deleted := 0
+	for k, entry := range kv.index {
+		if !strings.HasPrefix(k, string(prefix)) {
+			continue
+		}
+		if err := kv.heap.DeleteRecord(ctx, entry.rid); err != nil {
+			return deleted, fmt.Errorf("failed to delete record %v: %w", entry.rid, err)
+		}
+		delete(kv.index, k)
+		deleted++
+	}
+	return deleted, nil
+}
+
+// set записывает новое значение ключа и удаляет предыдущее. Вызывается под kv.mtx.
+func (kv *diskKVEngine) set(ctx context.Context, key []byte, value []byte) error {
+	rid, err := kv.heap.InsertRecord(ctx, encodeRecord(key, value))
+	if err != nil {
+		return fmt.Errorf("failed to store value: %w", err)
+	}
+
+	prev, ok := kv.index[string(key)]
+	kv.index[string(key)] = diskIndexEntry{rid: rid, valueLen: len(value)}
+	if ok {
+		if err := kv.heap.DeleteRecord(ctx, prev.rid); err != nil {
+			return fmt.Errorf("failed to delete previous value: %w", err)
+		}
+	}
+	return nil
+}
+
+// get читает актуальное значение ключа. Вызывается под kv.mtx.
+func (kv *diskKVEngine) get(ctx context.Context, key []byte) ([]byte, error) {
+	entry, ok := kv.index[string(key)]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	data, err := kv.heap.GetRecord(ctx, entry.rid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read value: %w", err)
+	}
+	_, value, err := decodeRecord(data)
+	if err != nil {
+		return nil, fmt.Errorf("record %v: %w", entry.rid, err)
+	}
+	return value, nil
+}
+
+func (kv *diskKVEngine) PrefixStats(prefix []byte) (PrefixStat, error) {
+	kv.mtx.RLock()
+	defer kv.mtx.RUnlock()
+	var stat PrefixStat
+	for k, entry := range kv.index {
+		if strings.HasPrefix(k, string(prefix)) {
+			stat.Keys++
+			stat.ValueBytes += entry.valueLen
+		}
+	}
+	return stat, nil
+}
+
+func (kv *diskKVEngine) Keys(prefix []byte, fn func(key []byte) bool) error {
+	kv.mtx.RLock()
+	var keys []string
+	for k := range kv.index {
+		if strings.HasPrefix(k, string(prefix)) {
+			keys = append(keys, k)
+		}
+	}
+	kv.mtx.RUnlock()
+
+	return visitKeys(keys, fn)
+}
+
+// PersistTest проверяет, что актуальное значение ключа сохранено на диске.
+// При flush страница записи сбрасывается, вытесняется из пула и читается заново через пул.
+// Без flush на диске проверяется текущее содержимое страницы, а пул не меняется.
+// Возвращает true, если значение на диске совпадает со значением в пуле.
+func (kv *diskKVEngine) PersistTest(ctx context.Context, key []byte, flush bool) (bool, error) {
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+
+	cached, err := kv.get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	rid := kv.index[string(key)].rid
+
+	var onDisk []byte
+	if flush {
+		// Страницы нет в пуле, только если ее вытеснили, а при вытеснении она уже записана
+		if err := kv.pool.FlushPage(ctx, rid.PageID); err != nil && !errors.Is(err, buffer.ErrPageNotResident) {
+			return false, err
+		}
+		if err := kv.pool.EvictPage(rid.PageID); err != nil {
+			return false, err
+		}
+		if onDisk, err = kv.get(ctx, key); err != nil {
+			return false, err
+		}
+	} else {
+		buf := make([]byte, kv.pm.PageSize())
+		if err := kv.pm.ReadPage(ctx, rid.PageID, buf); err != nil {
+			return false, err
+		}
+		// Запись могла еще не попасть на диск: тогда слота нет или он не занят
+		data, err := page.NewSlottedPage(buf).GetTuple(rid.SlotID)
+		if err != nil {
+			return false, nil
+		}
+		_, value, err := decodeRecord(data)
+		if err != nil {
+			return false, nil
+		}
+		onDisk = value
+	}
+	return bytes.Equal(cached, onDisk), nil
+}
+
+// DumpPage читает страницу pageID прямо с диска, минуя буферный пул, и выводит ее заголовок
+// и слоты через Dump. Изменения, еще не сброшенные из пула, в вывод не попадают.
+func (kv *diskKVEngine) DumpPage(ctx context.Context, pageID page.PageID) (string, error) {
+	buf := make([]byte, kv.pm.PageSize())
+	if err := kv.pm.ReadPage(ctx, pageID, buf); err != nil {
+		return "", err
+	}
+	return page.NewSlottedPage(buf).Dump(), nil
+}
+
+// ResizePool изменяет количество фреймов буферного пула.
+func (kv *diskKVEngine) ResizePool(ctx context.Context, newSize int) error {
+	return kv.pool.Resize(ctx, newSize)
+}
+
+// Residency сообщает, какие страницы из полуинтервала [startPage, endPage) находятся в буферном пуле.
+func (kv *diskKVEngine) Residency(startPage, endPage page.PageID) []bool {
+	return kv.pool.Residency(startPage, endPage)
+}
+
+// StorageInfo — размер файла базы и состояние буферного пула.
+type StorageInfo struct {
+	PageCount uint64 // Выделено страниц
+	PageSize  int
+	FileSize  int64 // Размер файла базы в байтах
+	PoolSize  int   // Фреймов в буферном пуле
+	Pool      buffer.PoolStats
+}
+
+// StorageInfo возвращает размер файла базы и счетчики буферного пула.
+func (kv *diskKVEngine) StorageInfo(ctx context.Context) (StorageInfo, error) {
+	pageCount, err := kv.pm.PageCount(ctx)
+	if err != nil {
+		return StorageInfo{}, err
+	}
+	fileSize, err := kv.pm.FileSize(ctx)
+	if err != nil {
+		return StorageInfo{}, err
+	}
+	return StorageInfo{
+		PageCount: pageCount,
+		PageSize:  kv.pm.PageSize(),
+		FileSize:  fileSize,
+		PoolSize:  kv.pool.Size(),
+		Pool:      kv.pool.Stats(),
+	}, nil
+}
+
+// Stats возвращает количество ключей и счетчики буферного пула.
+func (kv *diskKVEngine) Stats() map[string]string {
+	kv.mtx.RLock()
+	keys := len(kv.index)
+	kv.mtx.RUnlock()
+	stats := kv.pool.Stats()
+	return map[string]string{
+		"keys":            strconv.Itoa(keys),
+		"pool_frames":     strconv.Itoa(kv.pool.Size()),
+		"pool_hits":       strconv.FormatUint(stats.Hits, 10),
+		"pool_misses":     strconv.FormatUint(stats.Misses, 10),
+		"pool_evictions":  strconv.FormatUint(stats.Evictions, 10),
+		"pool_prefetched": strconv.FormatUint(stats.Prefetched, 10),
+	}
+}
+
+// PageSize возвращает размер страницы файла базы.
+func (kv *diskKVEngine) PageSize() int {
+	return kv.pm.PageSize()
+}
+
+// Sync сбрасывает грязные страницы пула и буферы файла на диск и очищает журнал упреждающей записи.
+// Изменения на время сброса блокируются, чтобы журнал не потерял еще не сброшенные изменения.
+func (kv *diskKVEngine) Sync(ctx context.Context) error {
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	return kv.checkpoint(ctx)
+}
+
+// Close останавливает фоновую проверку, сбрасывает данные на диск и закрывает файлы базы и журнала.
+func (kv *diskKVEngine) Close(ctx context.Context) error {
+	kv.stopScrubber()
+	if err := kv.Sync(ctx); err != nil {
+		kv.wal.Close()
+		kv.pool.Close(ctx)
+		return err
+	}
+	if err := kv.wal.Close(); err != nil {
+		kv.pool.Close(ctx)
+		return err
+	}
+	return kv.pool.Close(ctx)
+}
+
+func encodeRecord(key, value []byte) []byte {
+	buf := make([]byte, 0, recordKeyLenSize+len(key)+len(value))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(key)))
+	buf = append(buf, key...)
+	return append(buf, value...)
+}
+
+// kvPair — пара ключ-значение записи журнала.
+type kvPair struct {
+	key   []byte
+	value []byte
+}
+
+func encodeLogRecord(pairs []kvPair) []byte {
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(len(pairs)))
+	for _, pair := range pairs {
+		record := encodeRecord(pair.key, pair.value)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(record)))
+		buf = append(buf, record...)
+	}
+	return buf
+}
+
+func isClearLogRecord(data []byte) bool {
+	return len(data) == 4 && binary.LittleEndian.Uint32(data) == clearLogMarker
+}
+
+// deletePrefixLogRecord возвращает префикс, если data — запись удаления ключей с префиксом.
+func deletePrefixLogRecord(data []byte) ([]byte, bool) {
+	if len(data) < 4 || binary.LittleEndian.Uint32(data) != deletePrefixMarker {
+		return nil, false
+	}
+	return data[4:], true
+}
+
+func decodeLogRecord(data []byte) ([]kvPair, error) {
+	if len(data) < 4 {
+		return nil, ErrCorruptRecord
+	}
+	count := int(binary.LittleEndian.Uint32(data))
+	data = data[4:]
+
+	var pairs []kvPair
+	for range count {
+		if len(data) < 4 {
+			return nil, ErrCorruptRecord
+		}
+		n := int(binary.LittleEndian.Uint32(data))
+		if 4+n > len(data) {
+			return nil, ErrCorruptRecord
+		}
+		key, value, err := decodeRecord(data[4 : 4+n])
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, kvPair{key: key, value: value})
+		data = data[4+n:]
+	}
+	return pairs, nil
+}
+
+func decodeRecord(data []byte) (key, value []byte, err error) {
+	if len(data) < recordKeyLenSize {
+		return nil, nil, ErrCorruptRecord
+	}
+	keyLen := int(binary.LittleEndian.Uint32(data))
+	if recordKeyLenSize+keyLen > len(data) {
+		return nil, nil, ErrCorruptRecord
+	}
+	return data[recordKeyLenSize : recordKeyLenSize+keyLen], data[recordKeyLenSize+keyLen:], nil
+}
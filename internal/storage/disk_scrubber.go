@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Argentum88/godb/internal/storage/heap"
+)
+
+var ErrIndexMismatch = errors.New("index entry does not match heap record")
+
+// IndexIssue — запись индекса дискового движка, которая не сходится с записью heap-файла.
+type IndexIssue struct {
+	Key string
+	RID heap.RecordID
+	Err error
+}
+
+// ScrubReport — накопленный результат фоновой проверки дискового движка:
+// проверка структуры страниц heap-файла и проверка записей индекса по heap-файлу.
+type ScrubReport struct {
+	Pages          heap.ScrubReport
+	EntriesChecked int
+	IndexIssues    []IndexIssue
+}
+
+type diskScrubber struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	// keys и cursor трогает только горутина проверки: снимок ключей индекса
+	// текущего прохода и индекс следующего проверяемого ключа в нем
+	keys   []string
+	cursor int
+
+	mu             sync.Mutex
+	entriesChecked int
+	issues         map[string]IndexIssue // Последняя найденная проблема по каждому ключу
+}
+
+// startScrubber запускает горутину, которая раз в interval проверяет следующие batch страниц
+// heap-файла и следующие batch записей индекса, циклически проходя по всему файлу и индексу.
+// Проверка идет под kv.mtx на чтение, поэтому видит согласованные индекс и heap-файл.
+func (kv *diskKVEngine) startScrubber(interval time.Duration, batch int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	kv.scrub.cancel = cancel
+	kv.scrub.done = done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				kv.mtx.RLock()
+				kv.heap.ScrubPages(ctx, batch)
+				kv.scrubIndex(ctx, batch)
+				kv.mtx.RUnlock()
+			}
+		}
+	}()
+}
+
+// stopScrubber останавливает фоновую проверку, если она запущена, и дожидается ее горутины.
+func (kv *diskKVEngine) stopScrubber() {
+	if kv.scrub.done == nil {
+		return
+	}
+	kv.scrub.cancel()
+	<-kv.scrub.done
+	kv.scrub.cancel, kv.scrub.done = nil, nil
+}
+
+// ScrubReport возвращает результат фоновой проверки: проблемы страниц heap-файла
+// и записи индекса, не сходящиеся с heap-файлом, упорядоченные по ключу.
+func (kv *diskKVEngine) ScrubReport() ScrubReport {
+	report := ScrubReport{Pages: kv.heap.ScrubReport()}
+
+	kv.scrub.mu.Lock()
+	defer kv.scrub.mu.Unlock()
+	report.EntriesChecked = kv.scrub.entriesChecked
+	report.IndexIssues = slices.Collect(maps.Values(kv.scrub.issues))
+	slices.SortFunc(report.IndexIssues, func(a, b IndexIssue) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return report
+}
+
+// scrubIndex сверяет с heap-файлом следующие n записей индекса. Вызывается под kv.mtx.
+// Ключи, удаленные после снимка, пропускаются, а их проблемы забываются при следующем снимке.
+func (kv *diskKVEngine) scrubIndex(ctx context.Context, n int) {
+	s := &kv.scrub
+	for range n {
+		if s.cursor >= len(s.keys) {
+			s.keys = slices.Sorted(maps.Keys(kv.index))
+			s.cursor = 0
+			s.mu.Lock()
+			maps.DeleteFunc(s.issues, func(key string, _ IndexIssue) bool {
+				_, ok := kv.index[key]
+				return !ok
+			})
+			s.mu.Unlock()
+			if len(s.keys) == 0 {
+				return
+			}
+		}
+		key := s.keys[s.cursor]
+		s.cursor++
+
+		entry, ok := kv.index[key]
+		if !ok {
+			continue
+		}
+		err := kv.verifyEntry(ctx, key, entry)
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.entriesChecked++
+		if err != nil {
+			if s.issues == nil {
+				s.issues = make(map[string]IndexIssue)
+			}
+			s.issues[key] = IndexIssue{Key: key, RID: entry.rid, Err: err}
+		} else {
+			delete(s.issues, key)
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			slog.Warn("disk scrubber found a broken index entry", "key", key, "record", entry.rid, "error", err)
+		}
+	}
+}
+
+// verifyEntry проверяет, что запись индекса указывает на живую запись heap-файла
+// с тем же ключом и значением той длины, которую помнит индекс.
+func (kv *diskKVEngine) verifyEntry(ctx context.Context, key string, entry diskIndexEntry) error {
+	data, err := kv.heap.GetRecord(ctx, entry.rid)
+	if err != nil {
+		return err
+	}
+	recordKey, value, err := decodeRecord(data)
+	if err != nil {
+		return fmt.Errorf("record %v: %w", entry.rid, err)
+	}
+	if string(recordKey) != key {
+		return fmt.Errorf("%w: record %v holds key %q", ErrIndexMismatch, entry.rid, recordKey)
+	}
+	if len(value) != entry.valueLen {
+		return fmt.Errorf("%w: record %v holds %d value bytes, index expects %d", ErrIndexMismatch, entry.rid, len(value), entry.valueLen)
+	}
+	return nil
+}
@@ -0,0 +1,478 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Argentum88/godb/internal/storage"
+	"github.com/Argentum88/godb/internal/storage/heap"
+	"github.com/Argentum88/godb/internal/storage/page"
+)
+
+func TestDiskKV_ReplaysLogAfterCrash(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "kv.db")
+	const n = 200
+
+	// Движок «падает»: его не закрывают, и грязные страницы пула не попадают на диск
+	crashed, err := storage.NewDiskKVEngine(ctx, path)
+	if err != nil {
+		t.Fatalf("NewDiskKVEngine failed: %v", err)
+	}
+	for i := range n {
+		if err := crashed.Set(ctx, []byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i))); err != nil {
+			t.Fatalf("Set %d failed: %v", i, err)
+		}
+	}
+	crashed.SetMany(map[string][]byte{"batch_a": []byte("a"), "batch_b": []byte("b")})
+	crashed.Increment([]byte("counter"), 41)
+	crashed.Increment([]byte("counter"), 1)
+	crashed.CompareAndSwap([]byte("key_0"), []byte("value_0"), []byte("swapped"))
+
+	// Недописанная запись в конце журнала, как при сбое во время записи
+	f, err := os.OpenFile(path+".wal", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	f.Write([]byte{0xFF, 0x00, 0x00})
+	f.Close()
+
+	kv, err := storage.NewDiskKVEngine(ctx, path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer kv.Close(ctx)
+
+	want := map[string]string{"key_0": "swapped", "batch_a": "a", "batch_b": "b", "counter": "42"}
+	for i := 1; i < n; i++ {
+		want[fmt.Sprintf("key_%d", i)] = fmt.Sprintf("value_%d", i)
+	}
+	for key, expected := range want {
+		value, err := kv.Get(ctx, []byte(key))
+		if err != nil || string(value) != expected {
+			t.Fatalf("key %s: expected %q after replay, got %q, %v", key, expected, value, err)
+		}
+	}
+	if stat, _ := kv.PrefixStats(nil); stat.Keys != len(want) {
+		t.Fatalf("expected %d keys after replay, got %d", len(want), stat.Keys)
+	}
+}
+
+func TestDiskKV_ClearReplaysAfterCrash(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "kv.db")
+
+	kv, err := storage.NewDiskKVEngine(ctx, path)
+	if err != nil {
+		t.Fatalf("NewDiskKVEngine failed: %v", err)
+	}
+	for i := range 100 {
+		kv.Set(ctx, []byte(fmt.Sprintf("key_%d", i)), []byte("value"))
+	}
+	// Записи ключей уже на диске, а удаление — только в журнале
+	if err := kv.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if err := kv.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if err := kv.Set(ctx, []byte("after"), []byte("clear")); err != nil {
+		t.Fatalf("Set after Clear failed: %v", err)
+	}
+
+	kv, err = storage.NewDiskKVEngine(ctx, path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer kv.Close(ctx)
+
+	if _, err := kv.Get(ctx, []byte("key_0")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected cleared key to stay deleted after replay, got %v", err)
+	}
+	if value, err := kv.Get(ctx, []byte("after")); err != nil || string(value) != "clear" {
+		t.Fatalf("expected key written after Clear to survive, got %q, %v", value, err)
+	}
+	if stat, _ := kv.PrefixStats(nil); stat.Keys != 1 {
+		t.Fatalf("expected 1 key after replay, got %d", stat.Keys)
+	}
+}
+
+func TestDiskKV_ClearReusesFileSpace(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	kv, err := storage.NewDiskKVEngine(ctx, filepath.Join(t.TempDir(), "kv.db"))
+	if err != nil {
+		t.Fatalf("NewDiskKVEngine failed: %v", err)
+	}
+	defer kv.Close(ctx)
+
+	value := bytes.Repeat([]byte{'v'}, 500)
+	fill := func() {
+		for i := range 200 {
+			if err := kv.Set(ctx, []byte(fmt.Sprintf("key_%d", i)), value); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+		}
+	}
+	fill()
+	before, err := kv.StorageInfo(ctx)
+	if err != nil {
+		t.Fatalf("StorageInfo failed: %v", err)
+	}
+
+	if err := kv.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if stat, _ := kv.PrefixStats(nil); stat.Keys != 0 {
+		t.Fatalf("expected no keys after Clear, got %d", stat.Keys)
+	}
+	// Освобожденные страницы занимаются заново, и файл не растет
+	fill()
+	after, err := kv.StorageInfo(ctx)
+	if err != nil {
+		t.Fatalf("StorageInfo failed: %v", err)
+	}
+	if after.FileSize != before.FileSize {
+		t.Fatalf("expected file size to stay %d after Clear and refill, got %d", before.FileSize, after.FileSize)
+	}
+	if got, err := kv.Get(ctx, []byte("key_199")); err != nil || !bytes.Equal(got, value) {
+		t.Fatalf("expected value after refill, got %d bytes, %v", len(got), err)
+	}
+}
+
+func TestDiskKV_ScrubberFindsCorruptPage(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "kv.db")
+
+	kv, err := storage.NewDiskKVEngine(ctx, path, storage.WithScrubber(time.Millisecond, 8))
+	if err != nil {
+		t.Fatalf("NewDiskKVEngine failed: %v", err)
+	}
+	defer kv.Close(ctx)
+
+	// Страниц больше, чем кадров пула, поэтому проверка перечитывает их с диска
+	value := bytes.Repeat([]byte{'v'}, 2000)
+	for i := range 300 {
+		if err := kv.Set(ctx, []byte(fmt.Sprintf("key_%03d", i)), value); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	if err := kv.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	// Портим страницу с записью key_000 в обход движка: неизвестный тип страницы
+	// ломает ее структуру, а измененный ключ записи расходится с индексом
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	pos := bytes.Index(data, []byte("key_000"))
+	if pos < 0 {
+		t.Fatal("record key_000 not found in the database file")
+	}
+	pageSize := kv.PageSize()
+	pageID := page.PageID(pos/pageSize - 1)
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	const pageTypeOffset = 7
+	_, err = f.WriteAt([]byte{0xFF}, int64(pos/pageSize*pageSize+pageTypeOffset))
+	if err == nil {
+		_, err = f.WriteAt([]byte("X"), int64(pos+len("key")))
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		t.Fatalf("failed to corrupt page: %v", err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		report := kv.ScrubReport()
+		pageFound := slices.ContainsFunc(report.Pages.Issues, func(issue heap.ScrubIssue) bool {
+			return issue.PageID == pageID && errors.Is(issue.Err, page.ErrCorruptPage)
+		})
+		entryFound := slices.ContainsFunc(report.IndexIssues, func(issue storage.IndexIssue) bool {
+			return issue.Key == "key_000" && errors.Is(issue.Err, storage.ErrIndexMismatch)
+		})
+		if pageFound && entryFound {
+			if len(report.IndexIssues) != 1 {
+				t.Fatalf("expected only key_000 to be reported, got %v", report.IndexIssues)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("scrubber did not report page %d and key_000: %+v", pageID, report)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Close останавливает проверку
+	if err := kv.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	checked := kv.ScrubReport().EntriesChecked
+	time.Sleep(20 * time.Millisecond)
+	if got := kv.ScrubReport().EntriesChecked; got != checked {
+		t.Fatalf("expected scrubber to stop on Close, checked %d entries after it", got-checked)
+	}
+}
+
+func TestDiskKV_DeletePrefixReplaysAfterCrash(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "kv.db")
+
+	kv, err := storage.NewDiskKVEngine(ctx, path)
+	if err != nil {
+		t.Fatalf("NewDiskKVEngine failed: %v", err)
+	}
+	for i := range 50 {
+		kv.Set(ctx, []byte(fmt.Sprintf("tmp:%d", i)), []byte("value"))
+		kv.Set(ctx, []byte(fmt.Sprintf("key_%d", i)), []byte("value"))
+	}
+	// Записи ключей уже на диске, а удаление — только в журнале
+	if err := kv.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	deleted, err := kv.DeletePrefix([]byte("tmp:"))
+	if err != nil || deleted != 50 {
+		t.Fatalf("expected 50 keys deleted, got %d, %v", deleted, err)
+	}
+	if deleted, _ := kv.DeletePrefix([]byte("none:")); deleted != 0 {
+		t.Fatalf("expected no keys deleted for an unmatched prefix, got %d", deleted)
+	}
+	if err := kv.Set(ctx, []byte("tmp:after"), []byte("delete")); err != nil {
+		t.Fatalf("Set after DeletePrefix failed: %v", err)
+	}
+
+	kv, err = storage.NewDiskKVEngine(ctx, path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer kv.Close(ctx)
+
+	if _, err := kv.Get(ctx, []byte("tmp:0")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected deleted key to stay deleted after replay, got %v", err)
+	}
+	if value, err := kv.Get(ctx, []byte("tmp:after")); err != nil || string(value) != "delete" {
+		t.Fatalf("expected key written after DeletePrefix to survive, got %q, %v", value, err)
+	}
+	if stat, _ := kv.PrefixStats(nil); stat.Keys != 51 {
+		t.Fatalf("expected 51 keys after replay, got %d", stat.Keys)
+	}
+}
+
+func TestDiskKV_SurvivesReopen(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "kv.db")
+	const n = 500
+
+	kv, err := storage.NewDiskKVEngine(ctx, path)
+	if err != nil {
+		t.Fatalf("NewDiskKVEngine failed: %v", err)
+	}
+	for i := range n {
+		key := fmt.Sprintf("key_%d", i)
+		value := fmt.Sprintf("value_%d", i)
+		if err := kv.Set(ctx, []byte(key), []byte(value)); err != nil {
+			t.Fatalf("Set %s failed: %v", key, err)
+		}
+	}
+	// Обновление должно пережить переоткрытие, а старое значение — нет
+	if err := kv.Set(ctx, []byte("key_0"), []byte("updated")); err != nil {
+		t.Fatalf("Update (Set) failed: %v", err)
+	}
+	if err := kv.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	kv, err = storage.NewDiskKVEngine(ctx, path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	t.Cleanup(func() {
+		kv.Close(ctx)
+	})
+
+	for i := range n {
+		key := fmt.Sprintf("key_%d", i)
+		expectedValue := fmt.Sprintf("value_%d", i)
+		if i == 0 {
+			expectedValue = "updated"
+		}
+		value, err := kv.Get(ctx, []byte(key))
+		if err != nil {
+			t.Fatalf("Get %s after reopen failed: %v", key, err)
+		}
+		if string(value) != expectedValue {
+			t.Fatalf("For key %s, expected %s, but got %s", key, expectedValue, value)
+		}
+	}
+
+	stat, err := kv.PrefixStats([]byte("key_"))
+	if err != nil {
+		t.Fatalf("PrefixStats failed: %v", err)
+	}
+	if stat.Keys != n {
+		t.Fatalf("Expected %d keys after reopen, got %d", n, stat.Keys)
+	}
+}
+
+// Запись ключа и значения должна помещаться в страницу даже без ограничений в опциях
+func TestDiskKV_SizeLimits(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "kv.db")
+
+	kv, err := storage.NewDiskKVEngine(ctx, path)
+	if err != nil {
+		t.Fatalf("NewDiskKVEngine failed: %v", err)
+	}
+
+	key := []byte("big")
+	// Страница по умолчанию 4096 байт: заголовок 8, слот 4, длина ключа 4
+	atValue := bytes.Repeat([]byte{'v'}, 4096-8-4-4-len(key))
+	overValue := append(bytes.Clone(atValue), 'v')
+
+	if err := kv.Set(ctx, key, atValue); err != nil {
+		t.Fatalf("Set at the page limit failed: %v", err)
+	}
+	if err := kv.Set(ctx, key, overValue); !errors.Is(err, storage.ErrValueTooLarge) {
+		t.Fatalf("expected ErrValueTooLarge, got %v", err)
+	}
+	if err := kv.SetMany(map[string][]byte{"small": []byte("v"), "big": overValue}); !errors.Is(err, storage.ErrValueTooLarge) {
+		t.Fatalf("expected ErrValueTooLarge from SetMany, got %v", err)
+	}
+	if err := kv.Set(ctx, bytes.Repeat([]byte{'k'}, 4096), nil); !errors.Is(err, storage.ErrKeyTooLarge) {
+		t.Fatalf("expected ErrKeyTooLarge, got %v", err)
+	}
+	if err := kv.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	kv, err = storage.NewDiskKVEngine(ctx, path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	t.Cleanup(func() {
+		kv.Close(ctx)
+	})
+	if value, err := kv.Get(ctx, key); err != nil || !bytes.Equal(value, atValue) {
+		t.Fatalf("expected value at the page limit to survive reopen, got %d bytes, %v", len(value), err)
+	}
+	if _, err := kv.Get(ctx, []byte("small")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected rejected SetMany to store nothing, got %v", err)
+	}
+}
+
+func TestDiskKV_CanceledContext(t *testing.T) {
+	t.Parallel()
+	kv, err := storage.NewDiskKVEngine(context.Background(), filepath.Join(t.TempDir(), "kv.db"))
+	if err != nil {
+		t.Fatalf("NewDiskKVEngine failed: %v", err)
+	}
+	defer kv.Close(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := kv.Set(ctx, []byte("key"), []byte("value")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected Set to return %v, got %v", context.Canceled, err)
+	}
+	if _, err := kv.Get(ctx, []byte("key")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected Get to return %v, got %v", context.Canceled, err)
+	}
+	if _, err := kv.Get(context.Background(), []byte("key")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected canceled Set to store nothing, got %v", err)
+	}
+}
+
+func TestDiskKV_Get_NonExistentKey(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	kv, err := storage.NewDiskKVEngine(ctx, filepath.Join(t.TempDir(), "kv.db"))
+	if err != nil {
+		t.Fatalf("NewDiskKVEngine failed: %v", err)
+	}
+	t.Cleanup(func() {
+		kv.Close(ctx)
+	})
+
+	if _, err := kv.Get(ctx, []byte("nonexistent")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("Expected error '%v', got '%v'", storage.ErrKeyNotFound, err)
+	}
+}
+
+func TestDiskKV_Increment_Concurrency(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "kv.db")
+	const goroutines, increments = 20, 50
+
+	kv, err := storage.NewDiskKVEngine(ctx, path)
+	if err != nil {
+		t.Fatalf("NewDiskKVEngine failed: %v", err)
+	}
+
+	wg := new(sync.WaitGroup)
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range increments {
+				if _, err := kv.Increment([]byte("counter"), 1); err != nil {
+					t.Errorf("Increment failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := kv.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Счетчик переживает переоткрытие
+	kv, err = storage.NewDiskKVEngine(ctx, path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer kv.Close(ctx)
+	n, err := kv.Increment([]byte("counter"), 0)
+	if err != nil {
+		t.Fatalf("Increment failed: %v", err)
+	}
+	if n != goroutines*increments {
+		t.Fatalf("expected %d after concurrent increments, got %d", goroutines*increments, n)
+	}
+}
+
+func TestDiskKV_CompareAndSwap_Concurrency(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	kv, err := storage.NewDiskKVEngine(ctx, filepath.Join(t.TempDir(), "kv.db"))
+	if err != nil {
+		t.Fatalf("NewDiskKVEngine failed: %v", err)
+	}
+	defer kv.Close(ctx)
+
+	testCompareAndSwapGenerations(t, kv)
+}
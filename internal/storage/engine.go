@@ -1,12 +1,170 @@
 package storage
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/Argentum88/godb/internal/clock"
 )
 
 type Engine interface {
-	Set(key []byte, value []byte) error
-	Get(key []byte) ([]byte, error)
+	// Set записывает значение ключа. Если ctx уже отменен, возвращает ctx.Err() без записи.
+	Set(ctx context.Context, key []byte, value []byte) error
+	// Get читает значение ключа. Если ctx уже отменен, возвращает ctx.Err().
+	Get(ctx context.Context, key []byte) ([]byte, error)
+	PrefixStats(prefix []byte) (PrefixStat, error)
+	// Keys вызывает fn для каждого ключа с префиксом prefix в лексикографическом порядке,
+	// пока fn возвращает true. Пустой префикс соответствует всем ключам.
+	// fn вызывается без удержания блокировок движка.
+	Keys(prefix []byte, fn func(key []byte) bool) error
+	// Increment атомарно прибавляет delta к целому десятичному значению ключа
+	// и возвращает результат. Отсутствующий ключ считается равным 0.
+	Increment(key []byte, delta int64) (int64, error)
+	// CompareAndSwap атомарно записывает new, только если текущее значение ключа равно expected,
+	// и сообщает, произошла ли запись. expected == nil означает, что ключ должен отсутствовать.
+	CompareAndSwap(key, expected, new []byte) (bool, error)
+	// SetNX атомарно записывает value, только если ключ отсутствует, и сообщает, произошла ли запись.
+	SetNX(key, value []byte) (bool, error)
+	// GetSet атомарно записывает value и возвращает предыдущее значение ключа.
+	// existed == false, если ключа не было.
+	GetSet(key, value []byte) (old []byte, existed bool, err error)
+	// TTL возвращает оставшийся срок жизни ключа или NoExpiry, если срок не задан.
+	// Для отсутствующего ключа возвращает ErrKeyNotFound.
+	TTL(key []byte) (time.Duration, error)
+	// Append атомарно дописывает suffix к значению ключа, создавая ключ при его отсутствии,
+	// и возвращает длину получившегося значения.
+	Append(key, suffix []byte) (int, error)
+	// SetMany атомарно записывает все пары ключ-значение.
+	SetMany(pairs map[string][]byte) error
+	// GetMany читает значения ключей из одного согласованного состояния.
+	// Для отсутствующего ключа значение равно nil, а ошибка — ErrKeyNotFound.
+	GetMany(keys [][]byte) ([][]byte, []error)
+	// Clear атомарно удаляет все ключи.
+	Clear() error
+	// DeletePrefix атомарно удаляет все ключи с префиксом prefix и возвращает их количество.
+	// Пустой префикс, как и в Keys, соответствует всем ключам.
+	DeletePrefix(prefix []byte) (int, error)
+}
+
+// PrefixStat — количество ключей с заданным префиксом и суммарный размер их значений.
+type PrefixStat struct {
+	Keys       int
+	ValueBytes int
+}
+
+// NoExpiry — значение TTL для ключа без срока жизни.
+const NoExpiry time.Duration = -1
+
+var ErrKeyNotFound = errors.New("key not found")
+var ErrNotInteger = errors.New("value is not an integer")
+var ErrIntegerOverflow = errors.New("increment would overflow")
+var ErrKeyTooLarge = errors.New("key is too large")
+var ErrValueTooLarge = errors.New("value is too large")
+
+// Option настраивает движок при создании.
+type Option func(o *engineOptions)
+
+// engineOptions — общие настройки движков.
+type engineOptions struct {
+	maxKeySize    int // Наибольший размер ключа в байтах, 0 — без ограничения
+	maxValueSize  int // Наибольший размер значения в байтах, 0 — без ограничения
+	clock         clock.Clock
+	scrubInterval time.Duration // Период фоновой проверки дискового движка, 0 — проверка выключена
+	scrubBatch    int           // Количество страниц и записей индекса, проверяемых за один раз
+}
+
+// WithMaxKeySize ограничивает размер ключа n байтами. Ноль снимает ограничение.
+func WithMaxKeySize(n int) Option {
+	return func(o *engineOptions) {
+		o.maxKeySize = n
+	}
+}
+
+// WithMaxValueSize ограничивает размер значения n байтами. Ноль снимает ограничение.
+func WithMaxValueSize(n int) Option {
+	return func(o *engineOptions) {
+		o.maxValueSize = n
+	}
+}
+
+// WithClock задает источник времени для истечения ключей. По умолчанию используются системные часы.
+func WithClock(c clock.Clock) Option {
+	return func(o *engineOptions) {
+		o.clock = c
+	}
 }
 
-var ErrKeyNotFound = errors.New("key not found")
\ No newline at end of file
+// WithScrubber включает фоновую проверку дискового движка: раз в interval проверяются
+// структура следующих batch страниц heap-файла и следующие batch записей индекса.
+// Остальные движки эту настройку игнорируют.
+func WithScrubber(interval time.Duration, batch int) Option {
+	return func(o *engineOptions) {
+		o.scrubInterval = interval
+		o.scrubBatch = batch
+	}
+}
+
+func newEngineOptions(opts []Option) engineOptions {
+	o := engineOptions{clock: clock.Real()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// checkSize проверяет ключ и записываемое значение на соответствие ограничениям размера.
+func (o engineOptions) checkSize(key, value []byte) error {
+	if o.maxKeySize > 0 && len(key) > o.maxKeySize {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrKeyTooLarge, len(key), o.maxKeySize)
+	}
+	if o.maxValueSize > 0 && len(value) > o.maxValueSize {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrValueTooLarge, len(value), o.maxValueSize)
+	}
+	return nil
+}
+
+// checkPairs проверяет размеры всех пар для SetMany.
+func (o engineOptions) checkPairs(pairs map[string][]byte) error {
+	for k, v := range pairs {
+		if err := o.checkSize([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddToValue разбирает текущее значение ключа как int64 (nil — отсутствующий ключ, равный 0)
+// и прибавляет к нему delta.
+func AddToValue(value []byte, delta int64) (int64, error) {
+	var current int64
+	if value != nil {
+		n, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrNotInteger, value)
+		}
+		current = n
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, ErrIntegerOverflow
+	}
+	return current + delta, nil
+}
+
+// AppendValue возвращает новый срез из value и suffix, не разделяющий память ни с одним из них.
+func AppendValue(value, suffix []byte) []byte {
+	res := make([]byte, 0, len(value)+len(suffix))
+	return append(append(res, value...), suffix...)
+}
+
+// ValueMatches сравнивает текущее значение ключа с ожидаемым для CompareAndSwap.
+func ValueMatches(current []byte, found bool, expected []byte) bool {
+	if expected == nil {
+		return !found
+	}
+	return found && bytes.Equal(current, expected)
+}
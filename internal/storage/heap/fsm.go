@@ -0,0 +1,111 @@
+package heap
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Argentum88/godb/internal/storage/buffer"
+	"github.com/Argentum88/godb/internal/storage/page"
+)
+
+// freeSpaceBuckets — количество градаций свободного места, помещающихся в байт.
+const freeSpaceBuckets = 256
+
+// freeSpaceMap хранит приблизительный объем свободного места heap-страниц,
+// по байту на страницу, в отдельных страницах буферного пула.
+// Байт страницы p лежит в странице карты p/entriesPerPage по смещению p%entriesPerPage.
+// Значение b означает, что на странице свободно не меньше b*pageSize/freeSpaceBuckets байт,
+// поэтому карта может занижать свободное место, но не завышает его.
+type freeSpaceMap struct {
+	pool     *buffer.Pool
+	mu       sync.Mutex    // Защищает pages и pageSize
+	pages    []page.PageID // Страницы карты по порядку
+	pageSize int
+}
+
+func newFreeSpaceMap(pool *buffer.Pool) *freeSpaceMap {
+	return &freeSpaceMap{pool: pool}
+}
+
+// update запоминает, что на странице pageID свободно free байт, при необходимости выделяя страницы карты.
+func (m *freeSpaceMap) update(ctx context.Context, pageID page.PageID, pageSize, free int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.pageSize == 0 {
+		m.pageSize = pageSize
+	}
+	index := int(pageID) / m.pageSize
+	for len(m.pages) <= index {
+		pin, err := m.pool.NewPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to allocate free space map page: %w", err)
+		}
+		pin.MarkDirty()
+		m.pages = append(m.pages, pin.PageID())
+		pin.Unpin()
+	}
+
+	pin, err := m.pool.FetchPage(ctx, m.pages[index], buffer.LatchExclusive)
+	if err != nil {
+		return fmt.Errorf("failed to fetch free space map page %d: %w", m.pages[index], err)
+	}
+	defer pin.Unpin()
+
+	bucket := byte(min(free*freeSpaceBuckets/m.pageSize, freeSpaceBuckets-1))
+	entry := &pin.Bytes()[int(pageID)%m.pageSize]
+	if *entry != bucket {
+		*entry = bucket
+		pin.MarkDirty()
+	}
+	return nil
+}
+
+// reset освобождает страницы карты, после чего карта пуста, как у нового heap-файла.
+func (m *freeSpaceMap) reset(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for len(m.pages) > 0 {
+		if err := m.pool.DeletePage(ctx, m.pages[0]); err != nil {
+			return fmt.Errorf("failed to deallocate free space map page %d: %w", m.pages[0], err)
+		}
+		m.pages = m.pages[1:]
+	}
+	m.pages = nil
+	return nil
+}
+
+// find возвращает страницу, на которой по данным карты свободно не меньше need байт.
+// Читаются только страницы карты, сами heap-страницы не загружаются.
+func (m *freeSpaceMap) find(ctx context.Context, need int) (page.PageID, bool, error) {
+	m.mu.Lock()
+	pages := m.pages
+	pageSize := m.pageSize
+	m.mu.Unlock()
+
+	if pageSize == 0 {
+		return 0, false, nil
+	}
+	// Наименьшая градация, гарантирующая need байт
+	minBucket := (need*freeSpaceBuckets + pageSize - 1) / pageSize
+	if minBucket >= freeSpaceBuckets {
+		return 0, false, nil
+	}
+
+	for index, mapPageID := range pages {
+		pin, err := m.pool.FetchPage(ctx, mapPageID, buffer.LatchShared)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to fetch free space map page %d: %w", mapPageID, err)
+		}
+		for offset, bucket := range pin.Bytes() {
+			if int(bucket) >= minBucket {
+				pin.Unpin()
+				return page.PageID(index*pageSize + offset), true, nil
+			}
+		}
+		pin.Unpin()
+	}
+	return 0, false, nil
+}
@@ -0,0 +1,327 @@
+package heap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/Argentum88/godb/internal/storage/buffer"
+	"github.com/Argentum88/godb/internal/storage/page"
+)
+
+var ErrRecordNotFound = errors.New("record not found")
+var ErrRecordTooLarge = errors.New("record does not fit into an empty page")
+
+// RecordID — адрес записи в heap-файле: страница и слот на ней.
+type RecordID struct {
+	PageID page.PageID
+	SlotID uint16
+}
+
+func (rid RecordID) String() string {
+	return fmt.Sprintf("(%d,%d)", rid.PageID, rid.SlotID)
+}
+
+// HeapFile — неупорядоченное хранилище записей поверх буферного пула и слотовых страниц.
+type HeapFile struct {
+	pool  *buffer.Pool
+	pages []page.PageID // Страницы heap-файла в порядке выделения
+	mu    sync.Mutex    // Защищает pages и сериализует вставки
+	fsm   *freeSpaceMap // Карта свободного места, nil если не включена
+	scrub scrubber
+}
+
+// Option настраивает HeapFile при создании.
+type Option func(h *HeapFile)
+
+// WithFreeSpaceMap включает карту свободного места: вставка идет в любую страницу,
+// где по карте хватает места, а не только в последнюю. Поэтому RecordID
+// перестают расти монотонно. Карта хранится в отдельных страницах пула
+// и обновляется при вставке, удалении и CompactPage.
+func WithFreeSpaceMap() Option {
+	return func(h *HeapFile) {
+		h.fsm = newFreeSpaceMap(h.pool)
+	}
+}
+
+func NewHeapFile(pool *buffer.Pool, opts ...Option) *HeapFile {
+	h := &HeapFile{pool: pool}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// OpenHeapFile открывает существующий heap-файл, состоящий из страниц pages в порядке их выделения.
+// Карта свободного места открытого файла пуста, пока не вызван RebuildFreeSpaceMap.
+func OpenHeapFile(pool *buffer.Pool, pages []page.PageID, opts ...Option) *HeapFile {
+	h := NewHeapFile(pool, opts...)
+	h.pages = slices.Clone(pages)
+	return h
+}
+
+// MaxRecordSize возвращает длину наибольшей записи, которую heap-файл сохранит при размере страницы pageSize.
+func MaxRecordSize(pageSize int) int {
+	return page.MaxTupleSize(pageSize, page.SlotFormatFor(pageSize))
+}
+
+// InsertRecord сохраняет запись и возвращает ее адрес.
+// С картой свободного места запись вставляется в первую страницу, где по карте хватает места.
+// Иначе — в последнюю страницу, а если там нет места — в новую.
+func (h *HeapFile) InsertRecord(ctx context.Context, data []byte) (RecordID, error) {
+	if len(data) > MaxRecordSize(h.pool.PageSize()) {
+		return RecordID{}, ErrRecordTooLarge
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.fsm != nil {
+		pageID, ok, err := h.fsm.find(ctx, len(data))
+		if err != nil {
+			return RecordID{}, err
+		}
+		if ok {
+			slotID, err := h.insertIntoPage(ctx, pageID, data)
+			if err == nil {
+				return RecordID{PageID: pageID, SlotID: slotID}, nil
+			}
+			if !errors.Is(err, page.ErrPageFull) {
+				return RecordID{}, err
+			}
+		}
+	}
+
+	if len(h.pages) > 0 {
+		lastPageID := h.pages[len(h.pages)-1]
+		slotID, err := h.insertIntoPage(ctx, lastPageID, data)
+		if err == nil {
+			return RecordID{PageID: lastPageID, SlotID: slotID}, nil
+		}
+		if !errors.Is(err, page.ErrPageFull) {
+			return RecordID{}, err
+		}
+	}
+
+	pin, err := h.pool.NewPage(ctx)
+	if err != nil {
+		return RecordID{}, fmt.Errorf("failed to allocate heap page: %w", err)
+	}
+	defer pin.Unpin()
+
+	pageID := pin.PageID()
+	sp := page.NewSlottedPage(pin.Bytes())
+	if err := sp.Init(page.SlotFormatFor(h.pool.PageSize())); err != nil {
+		return RecordID{}, fmt.Errorf("failed to init heap page %d: %w", pageID, err)
+	}
+	pin.MarkDirty()
+	h.pages = append(h.pages, pageID)
+
+	slotID, err := sp.InsertTuple(data)
+	if errors.Is(err, page.ErrPageFull) {
+		return RecordID{}, ErrRecordTooLarge
+	}
+	if err != nil {
+		return RecordID{}, fmt.Errorf("failed to insert record into page %d: %w", pageID, err)
+	}
+	if err := h.updateFreeSpace(ctx, pageID, pin.Bytes()); err != nil {
+		return RecordID{}, err
+	}
+	return RecordID{PageID: pageID, SlotID: slotID}, nil
+}
+
+// insertIntoPage вставляет запись в существующую страницу.
+// Если места не хватает, возвращает page.ErrPageFull и поправляет карту свободного места.
+func (h *HeapFile) insertIntoPage(ctx context.Context, pageID page.PageID, data []byte) (uint16, error) {
+	pin, err := h.pool.FetchPage(ctx, pageID, buffer.LatchExclusive)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch page %d: %w", pageID, err)
+	}
+	defer pin.Unpin()
+
+	sp := page.NewSlottedPage(pin.Bytes())
+	if !sp.Initialized() {
+		// Страница выделена до сбоя, но так и не попала на диск
+		if err := sp.Init(page.SlotFormatFor(h.pool.PageSize())); err != nil {
+			return 0, fmt.Errorf("failed to init heap page %d: %w", pageID, err)
+		}
+		pin.MarkDirty()
+	}
+	slotID, err := sp.InsertTuple(data)
+	if err != nil && !errors.Is(err, page.ErrPageFull) {
+		return 0, fmt.Errorf("failed to insert record into page %d: %w", pageID, err)
+	}
+	if err == nil {
+		pin.MarkDirty()
+	}
+	if err := h.updateFreeSpace(ctx, pageID, pin.Bytes()); err != nil {
+		return 0, err
+	}
+	return slotID, err
+}
+
+// updateFreeSpace записывает в карту свободное место страницы pageID с содержимым data.
+// Вызывается под latch страницы.
+func (h *HeapFile) updateFreeSpace(ctx context.Context, pageID page.PageID, data []byte) error {
+	if h.fsm == nil {
+		return nil
+	}
+	return h.fsm.update(ctx, pageID, len(data), page.NewSlottedPage(data).FreeSpace())
+}
+
+// GetRecord возвращает копию записи по ее адресу.
+func (h *HeapFile) GetRecord(ctx context.Context, rid RecordID) ([]byte, error) {
+	pin, err := h.pool.FetchPage(ctx, rid.PageID, buffer.LatchShared)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch page %d: %w", rid.PageID, err)
+	}
+	defer pin.Unpin()
+
+	tuple, err := page.NewSlottedPage(pin.Bytes()).GetTuple(rid.SlotID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v: %v", ErrRecordNotFound, rid, err)
+	}
+	return append([]byte(nil), tuple...), nil
+}
+
+// DeleteRecord помечает запись как удаленную.
+func (h *HeapFile) DeleteRecord(ctx context.Context, rid RecordID) error {
+	pin, err := h.pool.FetchPage(ctx, rid.PageID, buffer.LatchExclusive)
+	if err != nil {
+		return fmt.Errorf("failed to fetch page %d: %w", rid.PageID, err)
+	}
+	defer pin.Unpin()
+
+	sp := page.NewSlottedPage(pin.Bytes())
+	if _, err := sp.GetTuple(rid.SlotID); err != nil {
+		return fmt.Errorf("%w: %v: %v", ErrRecordNotFound, rid, err)
+	}
+	if err := sp.DeleteTuple(rid.SlotID); err != nil {
+		return fmt.Errorf("failed to delete record %v: %w", rid, err)
+	}
+	pin.MarkDirty()
+	return h.updateFreeSpace(ctx, rid.PageID, pin.Bytes())
+}
+
+// CompactPage освобождает место удаленных записей страницы pageID, чтобы его заняли новые вставки.
+// RecordID удаленных записей после этого могут быть выданы новым записям.
+func (h *HeapFile) CompactPage(ctx context.Context, pageID page.PageID) error {
+	pin, err := h.pool.FetchPage(ctx, pageID, buffer.LatchExclusive)
+	if err != nil {
+		return fmt.Errorf("failed to fetch page %d: %w", pageID, err)
+	}
+	defer pin.Unpin()
+
+	sp := page.NewSlottedPage(pin.Bytes())
+	for slotID := range sp.SlotCount() {
+		if _, err := sp.GetTuple(slotID); !errors.Is(err, page.ErrTupleDeleted) {
+			continue
+		}
+		if err := sp.SetTupleAsUnused(slotID); err != nil {
+			return fmt.Errorf("failed to reclaim slot %d of page %d: %w", slotID, pageID, err)
+		}
+		pin.MarkDirty()
+	}
+	return h.updateFreeSpace(ctx, pageID, pin.Bytes())
+}
+
+// RebuildFreeSpaceMap заново заполняет карту свободного места, обходя все страницы heap-файла.
+// Без карты свободного места ничего не делает.
+func (h *HeapFile) RebuildFreeSpaceMap(ctx context.Context) error {
+	if h.fsm == nil {
+		return nil
+	}
+	h.mu.Lock()
+	pages := slices.Clone(h.pages)
+	h.mu.Unlock()
+
+	for _, pageID := range pages {
+		pin, err := h.pool.FetchPage(ctx, pageID, buffer.LatchShared)
+		if err != nil {
+			return fmt.Errorf("failed to fetch page %d: %w", pageID, err)
+		}
+		err = h.updateFreeSpace(ctx, pageID, pin.Bytes())
+		pin.Unpin()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Truncate освобождает все страницы heap-файла и его карты свободного места, оставляя пустой файл,
+// готовый к новым вставкам. Страницы убираются из буферного пула и освобождаются в менеджере страниц,
+// поэтому следующие вставки займут их, а не расширят файл. RecordID прежних записей становятся
+// недействительными. Truncate нельзя вызывать одновременно с другими операциями над записями:
+// закрепленную страницу освободить не удастся, и Truncate вернет ошибку, освободив только часть страниц.
+func (h *HeapFile) Truncate(ctx context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for len(h.pages) > 0 {
+		pageID := h.pages[0]
+		if err := h.pool.DeletePage(ctx, pageID); err != nil {
+			return fmt.Errorf("failed to deallocate heap page %d: %w", pageID, err)
+		}
+		h.pages = h.pages[1:]
+	}
+	h.pages = nil
+	if h.fsm != nil {
+		return h.fsm.reset(ctx)
+	}
+	return nil
+}
+
+// Scan обходит все живые записи heap-файла в порядке страниц и слотов и вызывает для каждой fn.
+// Живые записи страницы копируются под разделяемым latch, и страница открепляется до вызовов fn,
+// поэтому fn может изменять heap-файл. Ошибка из fn прекращает обход и возвращается вызывающему.
+func (h *HeapFile) Scan(ctx context.Context, fn func(rid RecordID, data []byte) error) error {
+	it := h.Iterator(ctx)
+	for it.Next() {
+		if err := fn(it.Record()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+type record struct {
+	rid  RecordID
+	data []byte
+}
+
+// liveRecords возвращает копии живых записей страницы
+func (h *HeapFile) liveRecords(ctx context.Context, pageID page.PageID) ([]record, error) {
+	pin, err := h.pool.FetchPage(ctx, pageID, buffer.LatchShared)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch page %d: %w", pageID, err)
+	}
+	defer pin.Unpin()
+
+	sp := page.NewSlottedPage(pin.Bytes())
+	if !sp.Initialized() {
+		// Страница выделена до сбоя, но так и не попала на диск
+		return nil, nil
+	}
+	sp, err = page.LoadSlottedPage(pin.Bytes(), page.PageTypeHeap)
+	if err != nil {
+		return nil, fmt.Errorf("page %d: %w", pageID, err)
+	}
+	var records []record
+	for slotID := range sp.SlotCount() {
+		tuple, err := sp.GetTuple(slotID)
+		if errors.Is(err, page.ErrTupleDeleted) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read slot %d of page %d: %w", slotID, pageID, err)
+		}
+		records = append(records, record{
+			rid:  RecordID{PageID: pageID, SlotID: slotID},
+			data: append([]byte(nil), tuple...),
+		})
+	}
+	return records, nil
+}
@@ -0,0 +1,423 @@
+package heap
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Argentum88/godb/internal/storage/buffer"
+	"github.com/Argentum88/godb/internal/storage/page"
+)
+
+func newTestHeapFile(t *testing.T, poolSize int, opts ...Option) *HeapFile {
+	t.Helper()
+	ctx := context.Background()
+
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	pm, err := page.NewDiskManager(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+	pool := buffer.NewPool(pm, poolSize)
+	t.Cleanup(func() {
+		pool.Close(ctx)
+	})
+
+	return NewHeapFile(pool, opts...)
+}
+
+func TestHeapFile_InsertAndGetManyPages(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const numRecords = 1000
+
+	// Пул меньше количества страниц, чтобы страницы вытеснялись на диск
+	h := newTestHeapFile(t, 4)
+
+	rids := make([]RecordID, numRecords)
+	for i := range numRecords {
+		rid, err := h.InsertRecord(ctx, testRecord(i))
+		if err != nil {
+			t.Fatalf("failed to insert record %d: %v", i, err)
+		}
+		rids[i] = rid
+	}
+
+	if len(h.pages) < 2 {
+		t.Fatalf("expected records to span multiple pages, got %d pages", len(h.pages))
+	}
+
+	for i, rid := range rids {
+		got, err := h.GetRecord(ctx, rid)
+		if err != nil {
+			t.Fatalf("failed to get record %d at %v: %v", i, rid, err)
+		}
+		if !bytes.Equal(got, testRecord(i)) {
+			t.Fatalf("record %d at %v: expected %q, got %q", i, rid, testRecord(i), got)
+		}
+	}
+}
+
+func TestHeapFile_DeleteRecord(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	h := newTestHeapFile(t, 4)
+
+	rid, err := h.InsertRecord(ctx, []byte("doomed"))
+	if err != nil {
+		t.Fatalf("failed to insert record: %v", err)
+	}
+	if err := h.DeleteRecord(ctx, rid); err != nil {
+		t.Fatalf("failed to delete record: %v", err)
+	}
+
+	if _, err := h.GetRecord(ctx, rid); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("expected %v after delete, got %v", ErrRecordNotFound, err)
+	}
+	if err := h.DeleteRecord(ctx, rid); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("expected %v on repeated delete, got %v", ErrRecordNotFound, err)
+	}
+}
+
+func TestHeapFile_RecordTooLarge(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	h := newTestHeapFile(t, 4)
+
+	maxSize := MaxRecordSize(page.DefaultPageSize)
+	if _, err := h.InsertRecord(ctx, make([]byte, maxSize+1)); !errors.Is(err, ErrRecordTooLarge) {
+		t.Fatalf("expected %v, got %v", ErrRecordTooLarge, err)
+	}
+	if len(h.pages) != 0 {
+		t.Fatalf("expected rejected record not to allocate pages, got %d", len(h.pages))
+	}
+	if _, err := h.InsertRecord(ctx, make([]byte, maxSize)); err != nil {
+		t.Fatalf("failed to insert record of the largest size: %v", err)
+	}
+}
+
+func TestHeapFile_LargePages(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	// Страницы больше 32KB размечаются широкими слотами, и записи длиннее 16 бит в них помещаются
+	pm, err := page.NewMemoryManager(page.MaxPageSize)
+	if err != nil {
+		t.Fatalf("failed to create MemoryManager: %v", err)
+	}
+	pool := buffer.NewPool(pm, 4)
+	t.Cleanup(func() {
+		pool.Close(ctx)
+	})
+	h := NewHeapFile(pool)
+
+	records := [][]byte{
+		bytes.Repeat([]byte{'a'}, 100_000),
+		bytes.Repeat([]byte{'b'}, 10),
+		bytes.Repeat([]byte{'c'}, MaxRecordSize(page.MaxPageSize)),
+	}
+	rids := make([]RecordID, len(records))
+	for i, record := range records {
+		rid, err := h.InsertRecord(ctx, record)
+		if err != nil {
+			t.Fatalf("failed to insert record %d: %v", i, err)
+		}
+		rids[i] = rid
+	}
+	if rids[0].PageID != rids[1].PageID {
+		t.Fatalf("expected small record to share the page, got %v and %v", rids[0], rids[1])
+	}
+	for i, rid := range rids {
+		got, err := h.GetRecord(ctx, rid)
+		if err != nil {
+			t.Fatalf("failed to get record %v: %v", rid, err)
+		}
+		if !bytes.Equal(got, records[i]) {
+			t.Fatalf("record %v corrupted: expected %d bytes, got %d", rid, len(records[i]), len(got))
+		}
+	}
+}
+
+func TestHeapFile_Scan(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const numRecords = 300
+
+	h := newTestHeapFile(t, 4)
+
+	rids := make([]RecordID, numRecords)
+	for i := range numRecords {
+		rid, err := h.InsertRecord(ctx, testRecord(i))
+		if err != nil {
+			t.Fatalf("failed to insert record %d: %v", i, err)
+		}
+		rids[i] = rid
+	}
+
+	survivors := make(map[RecordID][]byte, numRecords)
+	for i, rid := range rids {
+		if i%7 == 0 {
+			if err := h.DeleteRecord(ctx, rid); err != nil {
+				t.Fatalf("failed to delete record %v: %v", rid, err)
+			}
+			continue
+		}
+		survivors[rid] = testRecord(i)
+	}
+
+	err := h.Scan(ctx, func(rid RecordID, data []byte) error {
+		want, ok := survivors[rid]
+		if !ok {
+			t.Fatalf("scan visited deleted or unknown record %v", rid)
+		}
+		if !bytes.Equal(data, want) {
+			t.Fatalf("record %v: expected %q, got %q", rid, want, data)
+		}
+		delete(survivors, rid)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if len(survivors) != 0 {
+		t.Fatalf("scan missed %d records", len(survivors))
+	}
+
+	errStop := errors.New("stop")
+	calls := 0
+	err = h.Scan(ctx, func(rid RecordID, data []byte) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || calls != 1 {
+		t.Fatalf("expected scan to stop after first callback with %v, got %v after %d calls", errStop, err, calls)
+	}
+}
+
+func TestHeapFile_Iterator(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const numRecords = 500
+
+	h := newTestHeapFile(t, 4)
+	for i := range numRecords {
+		if _, err := h.InsertRecord(ctx, testRecord(i)); err != nil {
+			t.Fatalf("failed to insert record %d: %v", i, err)
+		}
+	}
+	if len(h.pages) < 2 {
+		t.Fatalf("expected records to span multiple pages, got %d pages", len(h.pages))
+	}
+
+	// RecordID растут монотонно, поэтому итератор возвращает записи в порядке вставки
+	it := h.Iterator(ctx)
+	var (
+		n    int
+		prev RecordID
+	)
+	for it.Next() {
+		rid, data := it.Record()
+		if n > 0 && (rid.PageID < prev.PageID || rid.PageID == prev.PageID && rid.SlotID <= prev.SlotID) {
+			t.Fatalf("record %v returned after %v", rid, prev)
+		}
+		if !bytes.Equal(data, testRecord(n)) {
+			t.Fatalf("record %v: expected %q, got %q", rid, testRecord(n), data)
+		}
+		prev = rid
+		n++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("iteration failed: %v", err)
+	}
+	if n != numRecords {
+		t.Fatalf("expected %d records, got %d", numRecords, n)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	it = h.Iterator(canceled)
+	if it.Next() {
+		t.Fatalf("expected iteration with canceled context to stop")
+	}
+	if !errors.Is(it.Err(), context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, it.Err())
+	}
+}
+
+func TestHeapFile_FreeSpaceMap(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	h := newTestHeapFile(t, 8, WithFreeSpaceMap())
+	var rids []RecordID
+	for i := 0; len(h.pages) < 40; i++ {
+		rid, err := h.InsertRecord(ctx, testRecord(i))
+		if err != nil {
+			t.Fatalf("failed to insert record %d: %v", i, err)
+		}
+		rids = append(rids, rid)
+	}
+
+	// Освобождаем одну из первых страниц целиком
+	freedPageID := h.pages[2]
+	for _, rid := range rids {
+		if rid.PageID != freedPageID {
+			continue
+		}
+		if err := h.DeleteRecord(ctx, rid); err != nil {
+			t.Fatalf("failed to delete record %v: %v", rid, err)
+		}
+	}
+	if err := h.CompactPage(ctx, freedPageID); err != nil {
+		t.Fatalf("failed to compact page %d: %v", freedPageID, err)
+	}
+
+	// Вставка читает страницу карты и целевую страницу, а не перебирает заполненные страницы
+	before := h.pool.Stats()
+	big := bytes.Repeat([]byte{'y'}, page.DefaultPageSize/2)
+	rid, err := h.InsertRecord(ctx, big)
+	if err != nil {
+		t.Fatalf("failed to insert record: %v", err)
+	}
+	after := h.pool.Stats()
+	if rid.PageID != freedPageID {
+		t.Fatalf("expected record on freed page %d, got %v", freedPageID, rid)
+	}
+	if fetched := after.Hits + after.Misses - before.Hits - before.Misses; fetched > 3 {
+		t.Fatalf("expected insert to fetch at most 3 pages, fetched %d", fetched)
+	}
+
+	// Карта открытого файла восстанавливается обходом страниц
+	reopened := OpenHeapFile(h.pool, h.pages, WithFreeSpaceMap())
+	if err := reopened.RebuildFreeSpaceMap(ctx); err != nil {
+		t.Fatalf("failed to rebuild free space map: %v", err)
+	}
+	rid, err = reopened.InsertRecord(ctx, []byte("small"))
+	if err != nil {
+		t.Fatalf("failed to insert record: %v", err)
+	}
+	if rid.PageID != freedPageID {
+		t.Fatalf("expected record on freed page %d after rebuild, got %v", freedPageID, rid)
+	}
+	got, err := reopened.GetRecord(ctx, rid)
+	if err != nil || !bytes.Equal(got, []byte("small")) {
+		t.Fatalf("expected %q, got %q, %v", "small", got, err)
+	}
+}
+
+func TestHeapFile_Truncate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	pm, err := page.NewDiskManager(ctx, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+	pool := buffer.NewPool(pm, 4)
+	t.Cleanup(func() {
+		pool.Close(ctx)
+	})
+
+	h := NewHeapFile(pool, WithFreeSpaceMap())
+	for i := 0; len(h.pages) < 10; i++ {
+		if _, err := h.InsertRecord(ctx, testRecord(i)); err != nil {
+			t.Fatalf("failed to insert record %d: %v", i, err)
+		}
+	}
+	freed := slices.Clone(h.pages)
+	pageCount, err := pm.PageCount(ctx)
+	if err != nil {
+		t.Fatalf("failed to get page count: %v", err)
+	}
+
+	if err := h.Truncate(ctx); err != nil {
+		t.Fatalf("failed to truncate heap file: %v", err)
+	}
+	if got := h.pool.Residency(0, page.PageID(pageCount)); slices.Contains(got, true) {
+		t.Fatalf("expected no pages of the truncated file in the pool, got %v", got)
+	}
+	err = h.Scan(ctx, func(rid RecordID, data []byte) error {
+		return fmt.Errorf("unexpected record %v after truncate", rid)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Новые записи занимают освобожденные страницы, а не расширяют файл
+	rid, err := h.InsertRecord(ctx, []byte("reborn"))
+	if err != nil {
+		t.Fatalf("failed to insert record after truncate: %v", err)
+	}
+	if rid.PageID != freed[0] {
+		t.Fatalf("expected record on freed page %d, got %v", freed[0], rid)
+	}
+	got, err := h.GetRecord(ctx, rid)
+	if err != nil || !bytes.Equal(got, []byte("reborn")) {
+		t.Fatalf("expected %q, got %q, %v", "reborn", got, err)
+	}
+	var scanned int
+	if err := h.Scan(ctx, func(RecordID, []byte) error { scanned++; return nil }); err != nil || scanned != 1 {
+		t.Fatalf("expected 1 record after truncate, scanned %d, err %v", scanned, err)
+	}
+	if after, _ := pm.PageCount(ctx); after != pageCount {
+		t.Fatalf("expected file to stay at %d pages, got %d", pageCount, after)
+	}
+}
+
+func TestHeapFile_ScrubberReportsCorruptPage(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	h := newTestHeapFile(t, 4)
+	for i := range 200 {
+		if _, err := h.InsertRecord(ctx, testRecord(i)); err != nil {
+			t.Fatalf("failed to insert record %d: %v", i, err)
+		}
+	}
+	if len(h.pages) < 2 {
+		t.Fatalf("expected records to span multiple pages, got %d pages", len(h.pages))
+	}
+
+	// Портим указатель свободного места на второй странице
+	corruptPageID := h.pages[1]
+	pin, err := h.pool.FetchPage(ctx, corruptPageID, buffer.LatchExclusive)
+	if err != nil {
+		t.Fatalf("failed to fetch page: %v", err)
+	}
+	binary.LittleEndian.PutUint16(pin.Bytes()[2:4], 1)
+	pin.MarkDirty()
+	pin.Unpin()
+
+	h.StartScrubber(ctx, time.Millisecond, 1)
+	defer h.StopScrubber()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		report := h.ScrubReport()
+		if len(report.Issues) > 0 {
+			if len(report.Issues) != 1 || report.Issues[0].PageID != corruptPageID {
+				t.Fatalf("expected single issue on page %d, got %+v", corruptPageID, report.Issues)
+			}
+			if !errors.Is(report.Issues[0].Err, page.ErrCorruptPage) {
+				t.Fatalf("expected %v, got %v", page.ErrCorruptPage, report.Issues[0].Err)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("scrubber did not report corrupt page, report: %+v", report)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func testRecord(i int) []byte {
+	return []byte(fmt.Sprintf("record-%04d-%s", i, bytes.Repeat([]byte{'x'}, i%50)))
+}
@@ -0,0 +1,63 @@
+package heap
+
+import (
+	"context"
+	"slices"
+
+	"github.com/Argentum88/godb/internal/storage/page"
+)
+
+// Iterator последовательно обходит живые записи heap-файла в порядке страниц и слотов.
+// Записи страницы копируются целиком при переходе на нее, и страница сразу открепляется,
+// поэтому во время обхода heap-файл можно изменять. Страницы, выделенные после создания
+// итератора, не обходятся.
+//
+//	it := h.Iterator(ctx)
+//	for it.Next() {
+//		rid, data := it.Record()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator struct {
+	ctx     context.Context
+	heap    *HeapFile
+	pages   []page.PageID
+	records []record
+	current record
+	err     error
+}
+
+// Iterator возвращает итератор по живым записям heap-файла.
+func (h *HeapFile) Iterator(ctx context.Context) *Iterator {
+	h.mu.Lock()
+	pages := slices.Clone(h.pages)
+	h.mu.Unlock()
+	return &Iterator{ctx: ctx, heap: h, pages: pages}
+}
+
+// Next переходит к следующей записи и сообщает, есть ли она.
+// После false причину остановки сообщает Err.
+func (it *Iterator) Next() bool {
+	for len(it.records) == 0 {
+		if it.err != nil || len(it.pages) == 0 {
+			return false
+		}
+		it.records, it.err = it.heap.liveRecords(it.ctx, it.pages[0])
+		it.pages = it.pages[1:]
+	}
+	it.current = it.records[0]
+	it.records = it.records[1:]
+	return true
+}
+
+// Record возвращает адрес и копию данных текущей записи.
+func (it *Iterator) Record() (RecordID, []byte) {
+	return it.current.rid, it.current.data
+}
+
+// Err возвращает ошибку, прервавшую обход, или nil, если записи закончились.
+func (it *Iterator) Err() error {
+	return it.err
+}
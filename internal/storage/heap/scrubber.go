@@ -0,0 +1,145 @@
+package heap
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Argentum88/godb/internal/storage/buffer"
+	"github.com/Argentum88/godb/internal/storage/page"
+)
+
+// ScrubIssue — проблема, найденная фоновой проверкой на конкретной странице.
+type ScrubIssue struct {
+	PageID page.PageID
+	Err    error
+}
+
+// ScrubReport — накопленный результат фоновой проверки heap-файла.
+type ScrubReport struct {
+	PagesScanned int
+	Issues       []ScrubIssue
+}
+
+type scrubber struct {
+	mu           sync.Mutex
+	cancel       context.CancelFunc
+	done         chan struct{}
+	cursor       int // Индекс следующей проверяемой страницы в HeapFile.pages
+	pagesScanned int
+	issues       map[page.PageID]error // Последняя найденная проблема по каждой странице
+}
+
+// StartScrubber запускает горутину, которая раз в interval проверяет структуру
+// следующих pagesPerTick страниц heap-файла, циклически проходя по всем страницам.
+// Ограничение количества страниц за тик сглаживает нагрузку на диск.
+// Найденные проблемы пишутся в лог и попадают в ScrubReport, работа при этом не прерывается.
+// Повторный запуск при уже работающей проверке ничего не делает.
+func (h *HeapFile) StartScrubber(ctx context.Context, interval time.Duration, pagesPerTick int) {
+	h.scrub.mu.Lock()
+	defer h.scrub.mu.Unlock()
+	if h.scrub.done != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	h.scrub.cancel = cancel
+	h.scrub.done = done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				h.ScrubPages(ctx, pagesPerTick)
+			}
+		}
+	}()
+}
+
+// StopScrubber останавливает фоновую проверку и дожидается завершения ее горутины.
+func (h *HeapFile) StopScrubber() {
+	h.scrub.mu.Lock()
+	cancel, done := h.scrub.cancel, h.scrub.done
+	h.scrub.cancel, h.scrub.done = nil, nil
+	h.scrub.mu.Unlock()
+	if done == nil {
+		return
+	}
+
+	cancel()
+	<-done
+}
+
+// ScrubReport возвращает количество проверенных страниц и найденные проблемы, упорядоченные по PageID.
+func (h *HeapFile) ScrubReport() ScrubReport {
+	h.scrub.mu.Lock()
+	defer h.scrub.mu.Unlock()
+
+	report := ScrubReport{PagesScanned: h.scrub.pagesScanned}
+	for pageID, err := range h.scrub.issues {
+		report.Issues = append(report.Issues, ScrubIssue{PageID: pageID, Err: err})
+	}
+	slices.SortFunc(report.Issues, func(a, b ScrubIssue) int {
+		return int(a.PageID) - int(b.PageID)
+	})
+	return report
+}
+
+// ScrubPages проверяет структуру следующих n страниц heap-файла, продолжая с места,
+// где остановилась предыдущая проверка, и учитывает результат в ScrubReport.
+// Нужен владельцам heap-файла, которые проводят проверку сами, как дисковый движок.
+func (h *HeapFile) ScrubPages(ctx context.Context, n int) {
+	h.mu.Lock()
+	pages := slices.Clone(h.pages)
+	h.mu.Unlock()
+	if len(pages) == 0 {
+		return
+	}
+
+	for range min(n, len(pages)) {
+		h.scrub.mu.Lock()
+		pageID := pages[h.scrub.cursor%len(pages)]
+		h.scrub.cursor = (h.scrub.cursor + 1) % len(pages)
+		h.scrub.mu.Unlock()
+
+		err := h.validatePage(ctx, pageID)
+		if ctx.Err() != nil {
+			return
+		}
+
+		h.scrub.mu.Lock()
+		h.scrub.pagesScanned++
+		if err != nil {
+			if h.scrub.issues == nil {
+				h.scrub.issues = make(map[page.PageID]error)
+			}
+			h.scrub.issues[pageID] = err
+		} else {
+			delete(h.scrub.issues, pageID)
+		}
+		h.scrub.mu.Unlock()
+
+		if err != nil {
+			slog.Warn("heap scrubber found a problem", "page", pageID, "error", err)
+		}
+	}
+}
+
+func (h *HeapFile) validatePage(ctx context.Context, pageID page.PageID) error {
+	pin, err := h.pool.FetchPage(ctx, pageID, buffer.LatchShared)
+	if err != nil {
+		return fmt.Errorf("failed to fetch page %d: %w", pageID, err)
+	}
+	defer pin.Unpin()
+
+	return page.NewSlottedPage(pin.Bytes()).Validate()
+}
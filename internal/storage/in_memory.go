@@ -1,34 +1,473 @@
 package storage
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
+var ErrIncompatibleFork = errors.New("fork was not created by this engine type")
+
+// inMemoryKVEngine хранит собственные копии значений: запись копирует значение вызывающего,
+// а чтение возвращает копию, поэтому изменение этих срезов не затрагивает хранилище.
+//
+// Ключу можно задать срок жизни через Expire. Истекший ключ считается отсутствующим
+// сразу по часам движка, а удаляется из памяти при следующей записи в него или в ReapExpired.
+//
+// Каждая запись ключа присваивает ему версию из общего для движка возрастающего счетчика,
+// поэтому версия не повторяется, даже если ключ удалить и создать заново.
+// Версию читает GetVersioned, а проверяет перед записью SetIfVersion.
+//
+// Форк, созданный Fork, запоминает ключи, которые в нем записали, удалили или которым задали
+// срок жизни, чтобы Merge перенес в исходное хранилище только эти изменения.
 type inMemoryKVEngine struct {
-	data map[string][]byte
-	mtx  sync.RWMutex
+	data     map[string][]byte
+	expires  map[string]time.Time // Момент истечения ключей, которым задан срок жизни
+	versions map[string]uint64    // Версия последней записи каждого ключа из data
+	version  uint64               // Последняя выданная версия
+	touched  map[string]struct{}  // Ключи, измененные в форке после Fork; nil, если это не форк
+	cleared  bool                 // В форке после Fork вызывался Clear
+	mtx      sync.RWMutex
+	opts     engineOptions
 }
 
-func NewInMemoryKVEngine() *inMemoryKVEngine {
+func NewInMemoryKVEngine(opts ...Option) *inMemoryKVEngine {
 	return &inMemoryKVEngine{
-		data: make(map[string][]byte),
-		mtx:  sync.RWMutex{},
+		data:     make(map[string][]byte),
+		expires:  make(map[string]time.Time),
+		versions: make(map[string]uint64),
+		mtx:      sync.RWMutex{},
+		opts:     newEngineOptions(opts),
 	}
 }
 
-func (kv *inMemoryKVEngine) Set(key []byte, value []byte) error {
+// lookup возвращает значение ключа, если он существует и не истек. Вызывается под kv.mtx.
+func (kv *inMemoryKVEngine) lookup(key string, now time.Time) ([]byte, bool) {
+	v, ok := kv.data[key]
+	if !ok || kv.expired(key, now) {
+		return nil, false
+	}
+	return v, true
+}
+
+// expired сообщает, истек ли срок жизни ключа к моменту now. Вызывается под kv.mtx.
+func (kv *inMemoryKVEngine) expired(key string, now time.Time) bool {
+	deadline, ok := kv.expires[key]
+	return ok && !now.Before(deadline)
+}
+
+// put записывает значение, присваивает ключу новую версию и снимает срок жизни.
+// Вызывается под kv.mtx на запись.
+func (kv *inMemoryKVEngine) put(key string, value []byte) {
+	kv.data[key] = value
+	kv.version++
+	kv.versions[key] = kv.version
+	delete(kv.expires, key)
+	kv.touch(key)
+}
+
+// remove удаляет ключ вместе с его версией и сроком жизни. Вызывается под kv.mtx на запись.
+func (kv *inMemoryKVEngine) remove(key string) {
+	kv.drop(key)
+	kv.touch(key)
+}
+
+// drop удаляет истекший ключ из памяти. Для читателей он отсутствовал и раньше,
+// поэтому в изменения форка удаление не попадает. Вызывается под kv.mtx на запись.
+func (kv *inMemoryKVEngine) drop(key string) {
+	delete(kv.data, key)
+	delete(kv.versions, key)
+	delete(kv.expires, key)
+}
+
+// touch запоминает изменение ключа в форке. Вызывается под kv.mtx на запись.
+func (kv *inMemoryKVEngine) touch(key string) {
+	if kv.touched != nil {
+		kv.touched[key] = struct{}{}
+	}
+}
+
+// reset заменяет все содержимое движка и присваивает каждому ключу новую версию,
+// чтобы версии, прочитанные до замены, не совпали ни с одной после нее.
+// Вызывается под kv.mtx на запись.
+func (kv *inMemoryKVEngine) reset(data map[string][]byte, expires map[string]time.Time) {
+	kv.data = data
+	kv.expires = expires
+	kv.versions = make(map[string]uint64, len(data))
+	for k := range data {
+		kv.version++
+		kv.versions[k] = kv.version
+	}
+}
+
+// Expire задает ключу срок жизни ttl, отсчитываемый от текущего времени часов движка.
+// Возвращает false, если ключ отсутствует. Любая последующая запись ключа снимает срок жизни.
+func (kv *inMemoryKVEngine) Expire(key []byte, ttl time.Duration) (bool, error) {
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	now := kv.opts.clock.Now()
+	if _, ok := kv.lookup(string(key), now); !ok {
+		return false, nil
+	}
+	kv.expires[string(key)] = now.Add(ttl)
+	kv.touch(string(key))
+	return true, nil
+}
+
+// TTL отсчитывает оставшееся время по тем же часам, по которым ключи истекают.
+func (kv *inMemoryKVEngine) TTL(key []byte) (time.Duration, error) {
+	kv.mtx.RLock()
+	defer kv.mtx.RUnlock()
+	now := kv.opts.clock.Now()
+	if _, ok := kv.lookup(string(key), now); !ok {
+		return 0, ErrKeyNotFound
+	}
+	deadline, ok := kv.expires[string(key)]
+	if !ok {
+		return NoExpiry, nil
+	}
+	return deadline.Sub(now), nil
+}
+
+// ReapExpired удаляет из памяти истекшие ключи и возвращает их количество.
+func (kv *inMemoryKVEngine) ReapExpired() int {
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	now := kv.opts.clock.Now()
+	reaped := 0
+	for k := range kv.expires {
+		if kv.expired(k, now) {
+			kv.drop(k)
+			reaped++
+		}
+	}
+	return reaped
+}
+
+func (kv *inMemoryKVEngine) Set(ctx context.Context, key []byte, value []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := kv.opts.checkSize(key, value); err != nil {
+		return err
+	}
+	value = bytes.Clone(value)
 	kv.mtx.Lock()
 	defer kv.mtx.Unlock()
-	kv.data[string(key)] = value
+	kv.put(string(key), value)
 	return nil
 }
 
-func (kv *inMemoryKVEngine) Get(key []byte) ([]byte, error) {
+func (kv *inMemoryKVEngine) Get(ctx context.Context, key []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	kv.mtx.RLock()
 	defer kv.mtx.RUnlock()
-	v, ok := kv.data[string(key)]
+	v, ok := kv.lookup(string(key), kv.opts.clock.Now())
 	if !ok {
 		return nil, ErrKeyNotFound
 	}
-	return v, nil
+	return bytes.Clone(v), nil
+}
+
+func (kv *inMemoryKVEngine) SetMany(pairs map[string][]byte) error {
+	if err := kv.opts.checkPairs(pairs); err != nil {
+		return err
+	}
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	for k, v := range pairs {
+		kv.put(k, bytes.Clone(v))
+	}
+	return nil
+}
+
+func (kv *inMemoryKVEngine) GetMany(keys [][]byte) ([][]byte, []error) {
+	kv.mtx.RLock()
+	defer kv.mtx.RUnlock()
+	now := kv.opts.clock.Now()
+	values := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		v, ok := kv.lookup(string(key), now)
+		if !ok {
+			errs[i] = ErrKeyNotFound
+			continue
+		}
+		values[i] = bytes.Clone(v)
+	}
+	return values, errs
+}
+
+// GetVersioned возвращает значение ключа вместе с версией его последней записи.
+func (kv *inMemoryKVEngine) GetVersioned(key []byte) ([]byte, uint64, error) {
+	kv.mtx.RLock()
+	defer kv.mtx.RUnlock()
+	v, ok := kv.lookup(string(key), kv.opts.clock.Now())
+	if !ok {
+		return nil, 0, ErrKeyNotFound
+	}
+	return bytes.Clone(v), kv.versions[string(key)], nil
+}
+
+// SetIfVersion атомарно записывает value, только если версия ключа все еще равна expected,
+// и сообщает, произошла ли запись. expected == 0 означает, что ключ должен отсутствовать:
+// выданные версии начинаются с 1.
+func (kv *inMemoryKVEngine) SetIfVersion(key, value []byte, expected uint64) (bool, error) {
+	if err := kv.opts.checkSize(key, value); err != nil {
+		return false, err
+	}
+	value = bytes.Clone(value)
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	var current uint64
+	if _, ok := kv.lookup(string(key), kv.opts.clock.Now()); ok {
+		current = kv.versions[string(key)]
+	}
+	if current != expected {
+		return false, nil
+	}
+	kv.put(string(key), value)
+	return true, nil
+}
+
+func (kv *inMemoryKVEngine) Increment(key []byte, delta int64) (int64, error) {
+	if err := kv.opts.checkSize(key, nil); err != nil {
+		return 0, err
+	}
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	current, _ := kv.lookup(string(key), kv.opts.clock.Now())
+	n, err := AddToValue(current, delta)
+	if err != nil {
+		return 0, err
+	}
+	kv.put(string(key), strconv.AppendInt(nil, n, 10))
+	return n, nil
+}
+
+func (kv *inMemoryKVEngine) CompareAndSwap(key, expected, new []byte) (bool, error) {
+	if err := kv.opts.checkSize(key, new); err != nil {
+		return false, err
+	}
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	current, ok := kv.lookup(string(key), kv.opts.clock.Now())
+	if !ValueMatches(current, ok, expected) {
+		return false, nil
+	}
+	kv.put(string(key), bytes.Clone(new))
+	return true, nil
+}
+
+func (kv *inMemoryKVEngine) SetNX(key, value []byte) (bool, error) {
+	if err := kv.opts.checkSize(key, value); err != nil {
+		return false, err
+	}
+	value = bytes.Clone(value)
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	if _, ok := kv.lookup(string(key), kv.opts.clock.Now()); ok {
+		return false, nil
+	}
+	kv.put(string(key), value)
+	return true, nil
+}
+
+func (kv *inMemoryKVEngine) GetSet(key, value []byte) ([]byte, bool, error) {
+	if err := kv.opts.checkSize(key, value); err != nil {
+		return nil, false, err
+	}
+	value = bytes.Clone(value)
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	old, ok := kv.lookup(string(key), kv.opts.clock.Now())
+	kv.put(string(key), value)
+	// Старое значение больше не хранится, поэтому копировать его не нужно
+	return old, ok, nil
+}
+
+func (kv *inMemoryKVEngine) Append(key, suffix []byte) (int, error) {
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	current, _ := kv.lookup(string(key), kv.opts.clock.Now())
+	value := AppendValue(current, suffix)
+	if err := kv.opts.checkSize(key, value); err != nil {
+		return 0, err
+	}
+	kv.put(string(key), value)
+	return len(value), nil
+}
+
+// ApplyBatch применяет все операции пакета под одним захватом блокировки на запись,
+// поэтому читатели видят либо весь пакет, либо ни одной его операции.
+// Если хотя бы одна операция нарушает ограничения размера, пакет отклоняется целиком.
+func (kv *inMemoryKVEngine) ApplyBatch(b *Batch) error {
+	if err := kv.opts.checkBatch(b); err != nil {
+		return err
+	}
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	for _, op := range b.ops {
+		if op.deleted {
+			kv.remove(string(op.key))
+			continue
+		}
+		// Пакет хранит собственные копии и никогда не изменяет их, поэтому значение можно не копировать
+		kv.put(string(op.key), op.value)
+	}
+	return nil
+}
+
+func (kv *inMemoryKVEngine) Clear() error {
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	kv.reset(make(map[string][]byte), make(map[string]time.Time))
+	if kv.touched != nil {
+		kv.cleared = true
+		clear(kv.touched)
+	}
+	return nil
+}
+
+// DeletePrefix удаляет из памяти и истекшие ключи с префиксом, но в количестве их не учитывает.
+func (kv *inMemoryKVEngine) DeletePrefix(prefix []byte) (int, error) {
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	now := kv.opts.clock.Now()
+	deleted := 0
+	for k := range kv.data {
+		if !strings.HasPrefix(k, string(prefix)) {
+			continue
+		}
+		if kv.expired(k, now) {
+			kv.drop(k)
+			continue
+		}
+		deleted++
+		kv.remove(k)
+	}
+	return deleted, nil
+}
+
+func (kv *inMemoryKVEngine) PrefixStats(prefix []byte) (PrefixStat, error) {
+	kv.mtx.RLock()
+	defer kv.mtx.RUnlock()
+	now := kv.opts.clock.Now()
+	var stat PrefixStat
+	for k, v := range kv.data {
+		if strings.HasPrefix(k, string(prefix)) && !kv.expired(k, now) {
+			stat.Keys++
+			stat.ValueBytes += len(v)
+		}
+	}
+	return stat, nil
+}
+
+// Stats возвращает количество ключей и суммарный размер значений.
+func (kv *inMemoryKVEngine) Stats() map[string]string {
+	stat, _ := kv.PrefixStats(nil)
+	return map[string]string{
+		"keys":        strconv.Itoa(stat.Keys),
+		"value_bytes": strconv.Itoa(stat.ValueBytes),
+	}
+}
+
+// Fork возвращает независимую глубокую копию хранилища.
+// Изменения в копии не затрагивают исходное хранилище и наоборот.
+func (kv *inMemoryKVEngine) Fork() Engine {
+	kv.mtx.RLock()
+	defer kv.mtx.RUnlock()
+	return &inMemoryKVEngine{
+		data:     cloneData(kv.data),
+		expires:  maps.Clone(kv.expires),
+		versions: maps.Clone(kv.versions),
+		version:  kv.version,
+		touched:  make(map[string]struct{}),
+		opts:     kv.opts,
+	}
+}
+
+// Merge применяет к хранилищу изменения форка, полученного через Fork: ключи, записанные
+// или удаленные в форке, и заданные в нем сроки жизни. Остальные ключи, в том числе
+// записанные в хранилище после Fork, не меняются. Clear в форке очищает хранилище целиком,
+// после чего применяются изменения, сделанные в форке позже.
+func (kv *inMemoryKVEngine) Merge(fork Engine) error {
+	other, ok := fork.(*inMemoryKVEngine)
+	if !ok {
+		return ErrIncompatibleFork
+	}
+
+	type change struct {
+		value    []byte
+		present  bool
+		deadline time.Time
+		expires  bool
+	}
+	other.mtx.RLock()
+	cleared := other.cleared
+	changes := make(map[string]change, len(other.touched))
+	for k := range other.touched {
+		v, present := other.data[k]
+		deadline, expires := other.expires[k]
+		changes[k] = change{value: bytes.Clone(v), present: present, deadline: deadline, expires: expires}
+	}
+	other.mtx.RUnlock()
+
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	if cleared {
+		kv.reset(make(map[string][]byte), make(map[string]time.Time))
+	}
+	for k, c := range changes {
+		if !c.present {
+			kv.remove(k)
+			continue
+		}
+		kv.put(k, c.value)
+		if c.expires {
+			kv.expires[k] = c.deadline
+		}
+	}
+	return nil
+}
+
+func cloneData(data map[string][]byte) map[string][]byte {
+	res := make(map[string][]byte, len(data))
+	for k, v := range data {
+		res[k] = append([]byte(nil), v...)
+	}
+	return res
+}
+
+func (kv *inMemoryKVEngine) Keys(prefix []byte, fn func(key []byte) bool) error {
+	kv.mtx.RLock()
+	now := kv.opts.clock.Now()
+	var keys []string
+	for k := range kv.data {
+		if strings.HasPrefix(k, string(prefix)) && !kv.expired(k, now) {
+			keys = append(keys, k)
+		}
+	}
+	kv.mtx.RUnlock()
+
+	return visitKeys(keys, fn)
+}
+
+// visitKeys сортирует ключи и передает их в fn, пока fn возвращает true
+func visitKeys(keys []string, fn func(key []byte) bool) error {
+	slices.Sort(keys)
+	for _, k := range keys {
+		if !fn([]byte(k)) {
+			break
+		}
+	}
+	return nil
 }
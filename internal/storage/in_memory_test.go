@@ -1,23 +1,30 @@
 package storage_test
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/Argentum88/godb/internal/clock"
 	"github.com/Argentum88/godb/internal/storage"
 )
 
 func TestInMemoryKV_SetAndGet(t *testing.T) {
 	t.Parallel()
+	ctx := context.Background()
 	kv := storage.NewInMemoryKVEngine()
-	err := kv.Set([]byte("key"), []byte("value"))
+	err := kv.Set(ctx, []byte("key"), []byte("value"))
 	if err != nil {
 		t.Fatalf("Set failed: %v", err)
 	}
 
-	value, err := kv.Get([]byte("key"))
+	value, err := kv.Get(ctx, []byte("key"))
 	if err != nil {
 		t.Fatalf("Get failed: %v", err)
 	}
@@ -28,13 +35,14 @@ func TestInMemoryKV_SetAndGet(t *testing.T) {
 
 func TestInMemoryKV_Update(t *testing.T) {
 	t.Parallel()
+	ctx := context.Background()
 	kv := storage.NewInMemoryKVEngine()
-	err := kv.Set([]byte("key"), []byte("value"))
+	err := kv.Set(ctx, []byte("key"), []byte("value"))
 	if err != nil {
 		t.Fatalf("Set failed: %v", err)
 	}
 	// Check that the initial value is set correctly
-	value, err := kv.Get([]byte("key"))
+	value, err := kv.Get(ctx, []byte("key"))
 	if err != nil {
 		t.Fatalf("Get after initial Set failed: %v", err)
 	}
@@ -43,12 +51,12 @@ func TestInMemoryKV_Update(t *testing.T) {
 	}
 
 	// Update the value
-	err = kv.Set([]byte("key"), []byte("newvalue"))
+	err = kv.Set(ctx, []byte("key"), []byte("newvalue"))
 	if err != nil {
 		t.Fatalf("Update (Set) failed: %v", err)
 	}
 
-	value, err = kv.Get([]byte("key"))
+	value, err = kv.Get(ctx, []byte("key"))
 	if err != nil {
 		t.Fatalf("Get after update failed: %v", err)
 	}
@@ -57,17 +65,100 @@ func TestInMemoryKV_Update(t *testing.T) {
 	}
 }
 
+func TestInMemoryKV_ValuesAreCopied(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewInMemoryKVEngine()
+
+	// Изменение буфера после Set не затрагивает хранилище
+	buf := []byte("value")
+	if err := kv.Set(ctx, []byte("key"), buf); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	copy(buf, "XXXXX")
+
+	// Изменение результата Get тоже
+	got, err := kv.Get(ctx, []byte("key"))
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if string(got) != "value" {
+		t.Fatalf("expected stored value to ignore changes to the Set buffer, got %q", got)
+	}
+	copy(got, "YYYYY")
+	if got, _ := kv.Get(ctx, []byte("key")); string(got) != "value" {
+		t.Fatalf("expected stored value to ignore changes to the Get result, got %q", got)
+	}
+
+	// То же для пакетных операций и CompareAndSwap
+	pairs := map[string][]byte{"a": []byte("one")}
+	if err := kv.SetMany(pairs); err != nil {
+		t.Fatalf("SetMany failed: %v", err)
+	}
+	copy(pairs["a"], "XXX")
+	values, _ := kv.GetMany([][]byte{[]byte("a")})
+	if string(values[0]) != "one" {
+		t.Fatalf("expected stored value to ignore changes to the SetMany map, got %q", values[0])
+	}
+	copy(values[0], "YYY")
+	newValue := []byte("two")
+	if ok, err := kv.CompareAndSwap([]byte("a"), []byte("one"), newValue); !ok || err != nil {
+		t.Fatalf("expected CompareAndSwap to succeed, got %v, %v", ok, err)
+	}
+	copy(newValue, "XXX")
+	if got, _ := kv.Get(ctx, []byte("a")); string(got) != "two" {
+		t.Fatalf("expected stored value to ignore changes to the CompareAndSwap buffer, got %q", got)
+	}
+
+	// И для SetNX и GetSet: предыдущее значение, возвращенное GetSet, тоже можно менять
+	nxValue := []byte("nx")
+	if ok, err := kv.SetNX([]byte("b"), nxValue); !ok || err != nil {
+		t.Fatalf("expected SetNX to succeed, got %v, %v", ok, err)
+	}
+	copy(nxValue, "XX")
+	swapValue := []byte("new")
+	old, _, err := kv.GetSet([]byte("b"), swapValue)
+	if err != nil || string(old) != "nx" {
+		t.Fatalf("expected stored value to ignore changes to the SetNX buffer, got %q, %v", old, err)
+	}
+	copy(swapValue, "XXX")
+	copy(old, "YY")
+	if got, _ := kv.Get(ctx, []byte("b")); string(got) != "new" {
+		t.Fatalf("expected stored value to ignore changes to the GetSet buffer, got %q", got)
+	}
+}
+
 func TestInMemoryKV_Get_NonExistentKey(t *testing.T) {
 	t.Parallel()
+	ctx := context.Background()
 	kv := storage.NewInMemoryKVEngine()
-	_, err := kv.Get([]byte("nonexistent"))
+	_, err := kv.Get(ctx, []byte("nonexistent"))
 	if !errors.Is(err, storage.ErrKeyNotFound) {
 		t.Fatalf("Expected error '%v', got '%v'", storage.ErrKeyNotFound, err)
 	}
 }
 
+func TestInMemoryKV_CanceledContext(t *testing.T) {
+	t.Parallel()
+	kv := storage.NewInMemoryKVEngine()
+	kv.Set(context.Background(), []byte("key"), []byte("value"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := kv.Set(ctx, []byte("key"), []byte("changed")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected Set to return %v, got %v", context.Canceled, err)
+	}
+	if _, err := kv.Get(ctx, []byte("key")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected Get to return %v, got %v", context.Canceled, err)
+	}
+	if value, _ := kv.Get(context.Background(), []byte("key")); string(value) != "value" {
+		t.Fatalf("expected canceled Set to leave the value unchanged, got %q", value)
+	}
+}
+
 func TestInMemoryKV_Concurrency(t *testing.T) {
 	t.Parallel()
+	ctx := context.Background()
 	kv := storage.NewInMemoryKVEngine()
 	wg := new(sync.WaitGroup)
 	n := 100
@@ -77,11 +168,11 @@ func TestInMemoryKV_Concurrency(t *testing.T) {
 			defer wg.Done()
 			key := fmt.Sprintf("key_%d", i)
 			value := fmt.Sprintf("value_%d", i)
-			kv.Set([]byte(key), []byte(value))
+			kv.Set(ctx, []byte(key), []byte(value))
 
 			j := (i + 1) % n
 			readKey := fmt.Sprintf("key_%d", j)
-			kv.Get([]byte(readKey))
+			kv.Get(ctx, []byte(readKey))
 		}(i)
 	}
 	wg.Wait()
@@ -90,7 +181,7 @@ func TestInMemoryKV_Concurrency(t *testing.T) {
 		key := fmt.Sprintf("key_%d", i)
 		expectedValue := fmt.Sprintf("value_%d", i)
 
-		actualValue, err := kv.Get([]byte(key))
+		actualValue, err := kv.Get(ctx, []byte(key))
 		if err != nil {
 			t.Fatalf("Key %s should exist, but Get failed: %v", key, err)
 		}
@@ -100,3 +191,858 @@ func TestInMemoryKV_Concurrency(t *testing.T) {
 		}
 	}
 }
+
+func TestInMemoryKV_PrefixStats(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewInMemoryKVEngine()
+	kv.Set(ctx, []byte("user:1"), []byte("alice"))
+	kv.Set(ctx, []byte("user:2"), []byte("bob"))
+	kv.Set(ctx, []byte("order:1"), []byte("book"))
+
+	stat, err := kv.PrefixStats([]byte("user:"))
+	if err != nil {
+		t.Fatalf("PrefixStats failed: %v", err)
+	}
+	if stat.Keys != 2 || stat.ValueBytes != 8 {
+		t.Fatalf("Expected 2 keys and 8 bytes, got %d keys and %d bytes", stat.Keys, stat.ValueBytes)
+	}
+}
+
+func TestInMemoryKV_PrefixStats_Empty(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewInMemoryKVEngine()
+	kv.Set(ctx, []byte("user:1"), []byte("alice"))
+
+	stat, err := kv.PrefixStats([]byte("missing:"))
+	if err != nil {
+		t.Fatalf("PrefixStats failed: %v", err)
+	}
+	if stat.Keys != 0 || stat.ValueBytes != 0 {
+		t.Fatalf("Expected zero stats, got %d keys and %d bytes", stat.Keys, stat.ValueBytes)
+	}
+}
+
+func TestInMemoryKV_ForkIsolation(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewInMemoryKVEngine()
+	kv.Set(ctx, []byte("key"), []byte("value"))
+
+	fork := kv.Fork()
+	if err := fork.Set(ctx, []byte("key"), []byte("forked")); err != nil {
+		t.Fatalf("Set on fork failed: %v", err)
+	}
+	if err := fork.Set(ctx, []byte("new"), []byte("only in fork")); err != nil {
+		t.Fatalf("Set on fork failed: %v", err)
+	}
+	if err := kv.Set(ctx, []byte("other"), []byte("only in original")); err != nil {
+		t.Fatalf("Set on original failed: %v", err)
+	}
+
+	value, err := kv.Get(ctx, []byte("key"))
+	if err != nil || string(value) != "value" {
+		t.Fatalf("Expected original value 'value', got '%s' (err %v)", value, err)
+	}
+	if _, err := kv.Get(ctx, []byte("new")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("Expected key created in fork to be absent in original, got %v", err)
+	}
+	if _, err := fork.Get(ctx, []byte("other")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("Expected key created in original to be absent in fork, got %v", err)
+	}
+}
+
+func TestInMemoryKV_Merge(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewInMemoryKVEngine()
+	kv.Set(ctx, []byte("key"), []byte("value"))
+
+	fork := kv.Fork()
+	fork.Set(ctx, []byte("key"), []byte("forked"))
+	if err := kv.Merge(fork); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	value, err := kv.Get(ctx, []byte("key"))
+	if err != nil || string(value) != "forked" {
+		t.Fatalf("Expected merged value 'forked', got '%s' (err %v)", value, err)
+	}
+}
+
+func TestInMemoryKV_MergeKeepsBaseChangesAfterFork(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewInMemoryKVEngine()
+	kv.Set(ctx, []byte("shared"), []byte("base"))
+	kv.Set(ctx, []byte("gone"), []byte("base"))
+
+	fork := kv.Fork()
+	fork.Set(ctx, []byte("shared"), []byte("forked"))
+	fork.Set(ctx, []byte("fork-only"), []byte("forked"))
+	fork.DeletePrefix([]byte("gone"))
+
+	// Запись в исходное хранилище после Fork, например другим клиентом
+	kv.Set(ctx, []byte("base-only"), []byte("base"))
+
+	if err := kv.Merge(fork); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	want := map[string]string{"shared": "forked", "fork-only": "forked", "base-only": "base"}
+	for key, expected := range want {
+		value, err := kv.Get(ctx, []byte(key))
+		if err != nil || string(value) != expected {
+			t.Fatalf("%s: expected %q after merge, got %q (err %v)", key, expected, value, err)
+		}
+	}
+	if _, err := kv.Get(ctx, []byte("gone")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected key deleted in fork to be deleted after merge, got %v", err)
+	}
+}
+
+func TestInMemoryKV_Keys(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewInMemoryKVEngine()
+	for _, k := range []string{"user:2", "order:1", "user:1", "user:10"} {
+		kv.Set(ctx, []byte(k), []byte("v"))
+	}
+
+	collect := func(prefix string, limit int) []string {
+		var keys []string
+		err := kv.Keys([]byte(prefix), func(key []byte) bool {
+			keys = append(keys, string(key))
+			return len(keys) < limit
+		})
+		if err != nil {
+			t.Fatalf("Keys failed: %v", err)
+		}
+		return keys
+	}
+
+	if got, want := collect("user:", 10), []string{"user:1", "user:10", "user:2"}; !slices.Equal(got, want) {
+		t.Fatalf("Expected keys %v, got %v", want, got)
+	}
+	if got, want := collect("", 10), []string{"order:1", "user:1", "user:10", "user:2"}; !slices.Equal(got, want) {
+		t.Fatalf("Expected all keys %v for empty prefix, got %v", want, got)
+	}
+	if got := collect("missing:", 10); len(got) != 0 {
+		t.Fatalf("Expected no keys, got %v", got)
+	}
+	if got, want := collect("user:", 1), []string{"user:1"}; !slices.Equal(got, want) {
+		t.Fatalf("Expected iteration to stop after %v, got %v", want, got)
+	}
+}
+
+func TestInMemoryKV_SizeLimits(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const maxKey, maxValue = 8, 16
+	kv := storage.NewInMemoryKVEngine(storage.WithMaxKeySize(maxKey), storage.WithMaxValueSize(maxValue))
+
+	atKey, overKey := bytes.Repeat([]byte{'k'}, maxKey), bytes.Repeat([]byte{'k'}, maxKey+1)
+	atValue, overValue := bytes.Repeat([]byte{'v'}, maxValue), bytes.Repeat([]byte{'v'}, maxValue+1)
+
+	if err := kv.Set(ctx, atKey, atValue); err != nil {
+		t.Fatalf("Set at the limits failed: %v", err)
+	}
+	if err := kv.Set(ctx, overKey, atValue); !errors.Is(err, storage.ErrKeyTooLarge) {
+		t.Fatalf("expected ErrKeyTooLarge, got %v", err)
+	}
+	if err := kv.Set(ctx, atKey, overValue); !errors.Is(err, storage.ErrValueTooLarge) {
+		t.Fatalf("expected ErrValueTooLarge, got %v", err)
+	}
+	if err := kv.SetMany(map[string][]byte{"ok": atValue, "big": overValue}); !errors.Is(err, storage.ErrValueTooLarge) {
+		t.Fatalf("expected ErrValueTooLarge from SetMany, got %v", err)
+	}
+	if _, err := kv.Get(ctx, []byte("ok")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected rejected SetMany to store nothing, got %v", err)
+	}
+	if _, err := kv.CompareAndSwap(atKey, atValue, overValue); !errors.Is(err, storage.ErrValueTooLarge) {
+		t.Fatalf("expected ErrValueTooLarge from CompareAndSwap, got %v", err)
+	}
+	if value, _ := kv.Get(ctx, atKey); !bytes.Equal(value, atValue) {
+		t.Fatalf("expected value at the limit to stay stored, got %q", value)
+	}
+
+	// Нулевые ограничения снимают проверку
+	unlimited := storage.NewInMemoryKVEngine(storage.WithMaxKeySize(0), storage.WithMaxValueSize(0))
+	if err := unlimited.Set(ctx, bytes.Repeat([]byte{'k'}, 1<<16), bytes.Repeat([]byte{'v'}, 1<<20)); err != nil {
+		t.Fatalf("Set without limits failed: %v", err)
+	}
+}
+
+func TestInMemoryKV_Increment(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewInMemoryKVEngine()
+
+	n, err := kv.Increment([]byte("counter"), 5)
+	if err != nil {
+		t.Fatalf("Increment failed: %v", err)
+	}
+	if n != 5 {
+		t.Fatalf("expected 5 for missing key, got %d", n)
+	}
+	if n, _ = kv.Increment([]byte("counter"), -7); n != -2 {
+		t.Fatalf("expected -2, got %d", n)
+	}
+	value, _ := kv.Get(ctx, []byte("counter"))
+	if string(value) != "-2" {
+		t.Fatalf("expected stored value %q, got %q", "-2", value)
+	}
+
+	kv.Set(ctx, []byte("name"), []byte("alice"))
+	if _, err := kv.Increment([]byte("name"), 1); !errors.Is(err, storage.ErrNotInteger) {
+		t.Fatalf("expected ErrNotInteger, got %v", err)
+	}
+	kv.Set(ctx, []byte("max"), []byte("9223372036854775807"))
+	if _, err := kv.Increment([]byte("max"), 1); !errors.Is(err, storage.ErrIntegerOverflow) {
+		t.Fatalf("expected ErrIntegerOverflow, got %v", err)
+	}
+}
+
+func TestInMemoryKV_SetManyGetMany(t *testing.T) {
+	t.Parallel()
+	kv := storage.NewInMemoryKVEngine()
+
+	if err := kv.SetMany(map[string][]byte{"a": []byte("1"), "b": []byte("2")}); err != nil {
+		t.Fatalf("SetMany failed: %v", err)
+	}
+
+	values, errs := kv.GetMany([][]byte{[]byte("b"), []byte("missing"), []byte("a")})
+	if string(values[0]) != "2" || errs[0] != nil {
+		t.Fatalf("expected %q for b, got %q, %v", "2", values[0], errs[0])
+	}
+	if values[1] != nil || !errors.Is(errs[1], storage.ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound for missing key, got %q, %v", values[1], errs[1])
+	}
+	if string(values[2]) != "1" || errs[2] != nil {
+		t.Fatalf("expected %q for a, got %q, %v", "1", values[2], errs[2])
+	}
+}
+
+func TestInMemoryKV_Increment_Concurrency(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewInMemoryKVEngine()
+	const goroutines, increments = 50, 100
+
+	wg := new(sync.WaitGroup)
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range increments {
+				if _, err := kv.Increment([]byte("counter"), 1); err != nil {
+					t.Errorf("Increment failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, err := kv.Get(ctx, []byte("counter"))
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if want := fmt.Sprint(goroutines * increments); string(value) != want {
+		t.Fatalf("expected %s after concurrent increments, got %s", want, value)
+	}
+}
+
+func TestInMemoryKV_CompareAndSwap(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewInMemoryKVEngine()
+
+	// nil ожидает отсутствия ключа
+	if ok, _ := kv.CompareAndSwap([]byte("k"), nil, []byte("v1")); !ok {
+		t.Fatalf("expected swap on absent key to succeed")
+	}
+	if ok, _ := kv.CompareAndSwap([]byte("k"), nil, []byte("v2")); ok {
+		t.Fatalf("expected swap expecting absent key to fail when key exists")
+	}
+	if ok, _ := kv.CompareAndSwap([]byte("k"), []byte("wrong"), []byte("v2")); ok {
+		t.Fatalf("expected swap with wrong expected value to fail")
+	}
+	if ok, _ := kv.CompareAndSwap([]byte("k"), []byte("v1"), []byte("v2")); !ok {
+		t.Fatalf("expected swap with matching value to succeed")
+	}
+	value, _ := kv.Get(ctx, []byte("k"))
+	if string(value) != "v2" {
+		t.Fatalf("expected %q, got %q", "v2", value)
+	}
+}
+
+func TestInMemoryKV_CompareAndSwap_Concurrency(t *testing.T) {
+	t.Parallel()
+	testCompareAndSwapGenerations(t, storage.NewInMemoryKVEngine())
+}
+
+// testCompareAndSwapGenerations проверяет, что в каждом поколении из множества
+// конкурирующих CompareAndSwap одного ключа успешен ровно один.
+func testCompareAndSwapGenerations(t *testing.T, kv storage.Engine) {
+	ctx := context.Background()
+	const generations, goroutines = 20, 16
+	key := []byte("counter")
+
+	for gen := range generations {
+		var expected []byte
+		if gen > 0 {
+			expected = []byte(fmt.Sprint(gen))
+		}
+		next := []byte(fmt.Sprint(gen + 1))
+
+		var wins atomic.Int32
+		wg := new(sync.WaitGroup)
+		for range goroutines {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, err := kv.CompareAndSwap(key, expected, next)
+				if err != nil {
+					t.Errorf("CompareAndSwap failed: %v", err)
+					return
+				}
+				if ok {
+					wins.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if wins.Load() != 1 {
+			t.Fatalf("generation %d: expected exactly one winner, got %d", gen, wins.Load())
+		}
+	}
+
+	value, err := kv.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if want := fmt.Sprint(generations); string(value) != want {
+		t.Fatalf("expected %s, got %s", want, value)
+	}
+}
+
+func TestInMemoryKV_Expire(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clk := clock.NewManual(time.Unix(1000, 0))
+	kv := storage.NewInMemoryKVEngine(storage.WithClock(clk))
+
+	if ok, _ := kv.Expire([]byte("missing"), time.Second); ok {
+		t.Fatalf("expected Expire on a missing key to report false")
+	}
+	if err := kv.Set(ctx, []byte("session"), []byte("v")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := kv.Set(ctx, []byte("persistent"), []byte("v")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if ok, _ := kv.Expire([]byte("session"), 10*time.Second); !ok {
+		t.Fatalf("expected Expire on an existing key to report true")
+	}
+
+	clk.Advance(10*time.Second - time.Nanosecond)
+	if _, err := kv.Get(ctx, []byte("session")); err != nil {
+		t.Fatalf("expected key to live until its deadline, got %v", err)
+	}
+
+	clk.Advance(time.Nanosecond)
+	if _, err := kv.Get(ctx, []byte("session")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound for expired key, got %v", err)
+	}
+	var keys []string
+	kv.Keys(nil, func(key []byte) bool {
+		keys = append(keys, string(key))
+		return true
+	})
+	if !slices.Equal(keys, []string{"persistent"}) {
+		t.Fatalf("expected only persistent key to be listed, got %v", keys)
+	}
+	if n := kv.ReapExpired(); n != 1 {
+		t.Fatalf("expected 1 reaped key, got %d", n)
+	}
+
+	// Запись истекшего ключа создает его заново без срока жизни
+	if err := kv.Set(ctx, []byte("session"), []byte("v2")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	clk.Advance(time.Hour)
+	if value, err := kv.Get(ctx, []byte("session")); err != nil || string(value) != "v2" {
+		t.Fatalf("expected rewritten key to persist, got %q, %v", value, err)
+	}
+}
+
+func TestInMemoryKV_Append(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewInMemoryKVEngine()
+
+	suffix := []byte("hello")
+	n, err := kv.Append([]byte("k"), suffix)
+	if err != nil || n != 5 {
+		t.Fatalf("expected append to a missing key to return 5, got %d, %v", n, err)
+	}
+	// Изменение среза вызывающего не затрагивает хранилище
+	suffix[0] = 'J'
+
+	n, err = kv.Append([]byte("k"), []byte(", world"))
+	if err != nil || n != 12 {
+		t.Fatalf("expected append to an existing key to return 12, got %d, %v", n, err)
+	}
+	value, _ := kv.Get(ctx, []byte("k"))
+	if string(value) != "hello, world" {
+		t.Fatalf("expected %q, got %q", "hello, world", value)
+	}
+}
+
+func TestInMemoryKV_Append_SizeLimit(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewInMemoryKVEngine(storage.WithMaxValueSize(4))
+
+	if _, err := kv.Append([]byte("k"), []byte("abc")); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if _, err := kv.Append([]byte("k"), []byte("de")); !errors.Is(err, storage.ErrValueTooLarge) {
+		t.Fatalf("expected ErrValueTooLarge when the result exceeds the limit, got %v", err)
+	}
+	value, _ := kv.Get(ctx, []byte("k"))
+	if string(value) != "abc" {
+		t.Fatalf("expected rejected append to leave %q, got %q", "abc", value)
+	}
+}
+
+func TestInMemoryKV_Clear(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clk := clock.NewManual(time.Unix(0, 0))
+	kv := storage.NewInMemoryKVEngine(storage.WithClock(clk))
+	for i := range 5 {
+		kv.Set(ctx, []byte(fmt.Sprintf("key_%d", i)), []byte("v"))
+	}
+	kv.Expire([]byte("key_0"), time.Second)
+
+	if err := kv.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if stat, _ := kv.PrefixStats(nil); stat.Keys != 0 {
+		t.Fatalf("expected no keys after Clear, got %d", stat.Keys)
+	}
+
+	// Срок жизни ключа, удаленного Clear, не переносится на ключ, записанный заново
+	if err := kv.Set(ctx, []byte("key_0"), []byte("new")); err != nil {
+		t.Fatalf("Set after Clear failed: %v", err)
+	}
+	clk.Advance(time.Minute)
+	if value, err := kv.Get(ctx, []byte("key_0")); err != nil || string(value) != "new" {
+		t.Fatalf("expected key written after Clear to persist, got %q, %v", value, err)
+	}
+}
+
+func TestInMemoryKV_DeletePrefix(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clk := clock.NewManual(time.Unix(1000, 0))
+	kv := storage.NewInMemoryKVEngine(storage.WithClock(clk))
+	kv.SetMany(map[string][]byte{
+		"user:1": []byte("alice"), "user:2": []byte("bob"), "user:3": []byte("carol"),
+		"users": []byte("list"), "order:1": []byte("o"),
+	})
+	kv.Expire([]byte("user:3"), time.Second)
+	clk.Advance(time.Second)
+
+	tests := []struct {
+		prefix string
+		want   int
+		left   int
+	}{
+		// Истекший user:3 удаляется, но не считается
+		{prefix: "user:", want: 2, left: 2},
+		{prefix: "none:", want: 0, left: 2},
+		// Пустой префикс соответствует всем ключам
+		{prefix: "", want: 2, left: 0},
+	}
+	for _, tt := range tests {
+		deleted, err := kv.DeletePrefix([]byte(tt.prefix))
+		if err != nil {
+			t.Fatalf("DeletePrefix(%q) failed: %v", tt.prefix, err)
+		}
+		if deleted != tt.want {
+			t.Fatalf("DeletePrefix(%q): expected %d deleted, got %d", tt.prefix, tt.want, deleted)
+		}
+		if stat, _ := kv.PrefixStats(nil); stat.Keys != tt.left {
+			t.Fatalf("DeletePrefix(%q): expected %d keys left, got %d", tt.prefix, tt.left, stat.Keys)
+		}
+	}
+
+	// Удаленный ключ создается заново без прежнего срока жизни
+	kv.Set(ctx, []byte("user:3"), []byte("dave"))
+	if ttl, _ := kv.TTL([]byte("user:3")); ttl != storage.NoExpiry {
+		t.Fatalf("expected recreated key to have no TTL, got %v", ttl)
+	}
+}
+
+func TestInMemoryKV_GetSet(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewInMemoryKVEngine()
+
+	old, existed, err := kv.GetSet([]byte("leader"), []byte("a"))
+	if err != nil || existed || old != nil {
+		t.Fatalf("expected no previous value, got %q, %v, %v", old, existed, err)
+	}
+	old, existed, err = kv.GetSet([]byte("leader"), []byte("b"))
+	if err != nil || !existed || string(old) != "a" {
+		t.Fatalf("expected previous value %q, got %q, %v, %v", "a", old, existed, err)
+	}
+	value, _ := kv.Get(ctx, []byte("leader"))
+	if string(value) != "b" {
+		t.Fatalf("expected %q, got %q", "b", value)
+	}
+}
+
+func TestInMemoryKV_GetSet_Concurrency(t *testing.T) {
+	t.Parallel()
+	testGetSetHandoff(t, storage.NewInMemoryKVEngine())
+}
+
+// testGetSetHandoff проверяет, что конкурирующие GetSet одного ключа выстраиваются в цепочку:
+// каждое записанное значение ровно один раз возвращается как предыдущее, кроме последнего.
+func testGetSetHandoff(t *testing.T, kv storage.Engine) {
+	ctx := context.Background()
+	const goroutines, writes = 16, 50
+	key := []byte("leader")
+
+	var (
+		mu      sync.Mutex
+		seen    = make(map[string]int)
+		absents int
+	)
+	wg := new(sync.WaitGroup)
+	for g := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range writes {
+				old, existed, err := kv.GetSet(key, []byte(fmt.Sprintf("%d-%d", g, i)))
+				if err != nil {
+					t.Errorf("GetSet failed: %v", err)
+					return
+				}
+				mu.Lock()
+				if existed {
+					seen[string(old)]++
+				} else {
+					absents++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if absents != 1 {
+		t.Fatalf("expected exactly one GetSet to find the key absent, got %d", absents)
+	}
+	for old, n := range seen {
+		if n != 1 {
+			t.Fatalf("value %q was returned as previous %d times", old, n)
+		}
+	}
+	last, err := kv.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if _, ok := seen[string(last)]; ok || len(seen) != goroutines*writes-1 {
+		t.Fatalf("expected every value but the last %q to be handed off once, got %d handoffs", last, len(seen))
+	}
+}
+
+func TestInMemoryKV_Append_Concurrency(t *testing.T) {
+	t.Parallel()
+	testAppendConcurrency(t, storage.NewInMemoryKVEngine())
+}
+
+// testAppendConcurrency проверяет, что конкурирующие Append одного ключа не теряют дописанные данные.
+func testAppendConcurrency(t *testing.T, kv storage.Engine) {
+	ctx := context.Background()
+	const goroutines, appends = 16, 100
+	key := []byte("log")
+
+	wg := new(sync.WaitGroup)
+	for g := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Строки разной длины, чтобы потерянное дописывание меняло итоговую длину
+			line := bytes.Repeat([]byte{'a' + byte(g)}, g+1)
+			for range appends {
+				if _, err := kv.Append(key, line); err != nil {
+					t.Errorf("Append failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	want := 0
+	for g := range goroutines {
+		want += (g + 1) * appends
+	}
+	value, err := kv.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if len(value) != want {
+		t.Fatalf("expected final length %d, got %d", want, len(value))
+	}
+	for g := range goroutines {
+		if n := bytes.Count(value, []byte{'a' + byte(g)}); n != (g+1)*appends {
+			t.Fatalf("expected %d bytes from goroutine %d, got %d", (g+1)*appends, g, n)
+		}
+	}
+}
+
+func TestInMemoryKV_SetNX_Concurrency(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewInMemoryKVEngine()
+	const goroutines = 32
+
+	var winner atomic.Int32
+	winner.Store(-1)
+	var wins atomic.Int32
+	wg := new(sync.WaitGroup)
+	for g := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := kv.SetNX([]byte("lock"), []byte(fmt.Sprint(g)))
+			if err != nil {
+				t.Errorf("SetNX failed: %v", err)
+				return
+			}
+			if ok {
+				wins.Add(1)
+				winner.Store(int32(g))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if wins.Load() != 1 {
+		t.Fatalf("expected exactly one SetNX to succeed, got %d", wins.Load())
+	}
+	value, _ := kv.Get(ctx, []byte("lock"))
+	if want := fmt.Sprint(winner.Load()); string(value) != want {
+		t.Fatalf("expected the winner's value %q, got %q", want, value)
+	}
+}
+
+func TestInMemoryKV_TTL(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clk := clock.NewManual(time.Unix(1000, 0))
+	kv := storage.NewInMemoryKVEngine(storage.WithClock(clk))
+
+	if _, err := kv.TTL([]byte("missing")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound for a missing key, got %v", err)
+	}
+	kv.Set(ctx, []byte("persistent"), []byte("v"))
+	if ttl, err := kv.TTL([]byte("persistent")); err != nil || ttl != storage.NoExpiry {
+		t.Fatalf("expected NoExpiry for a key without TTL, got %v, %v", ttl, err)
+	}
+
+	kv.Set(ctx, []byte("session"), []byte("v"))
+	kv.Expire([]byte("session"), 30*time.Second)
+	clk.Advance(10 * time.Second)
+	if ttl, err := kv.TTL([]byte("session")); err != nil || ttl != 20*time.Second {
+		t.Fatalf("expected 20s left, got %v, %v", ttl, err)
+	}
+	clk.Advance(20 * time.Second)
+	if _, err := kv.TTL([]byte("session")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound for an expired key, got %v", err)
+	}
+}
+
+func TestInMemoryKV_ApplyBatch(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewInMemoryKVEngine()
+	kv.Set(ctx, []byte("stale"), []byte("v"))
+
+	var b storage.Batch
+	b.Set([]byte("a"), []byte("1"))
+	b.Set([]byte("b"), []byte("2"))
+	b.Delete([]byte("stale"))
+	b.Delete([]byte("missing"))
+	b.Set([]byte("a"), []byte("3"))
+	if b.Len() != 5 {
+		t.Fatalf("expected 5 staged operations, got %d", b.Len())
+	}
+	if _, err := kv.Get(ctx, []byte("a")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected staged writes to stay invisible before ApplyBatch, got %v", err)
+	}
+	if err := kv.ApplyBatch(&b); err != nil {
+		t.Fatalf("ApplyBatch failed: %v", err)
+	}
+
+	values, errs := kv.GetMany([][]byte{[]byte("a"), []byte("b"), []byte("stale")})
+	if string(values[0]) != "3" || string(values[1]) != "2" {
+		t.Fatalf("expected the last write per key to win, got a=%q b=%q", values[0], values[1])
+	}
+	if !errors.Is(errs[2], storage.ErrKeyNotFound) {
+		t.Fatalf("expected deleted key to be gone, got %q, %v", values[2], errs[2])
+	}
+}
+
+func TestInMemoryKV_ApplyBatch_RejectsWhole(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewInMemoryKVEngine(storage.WithMaxValueSize(4))
+	kv.Set(ctx, []byte("keep"), []byte("v"))
+
+	var b storage.Batch
+	b.Set([]byte("ok"), []byte("v"))
+	b.Delete([]byte("keep"))
+	b.Set([]byte("big"), []byte("too large"))
+	if err := kv.ApplyBatch(&b); !errors.Is(err, storage.ErrValueTooLarge) {
+		t.Fatalf("expected ErrValueTooLarge, got %v", err)
+	}
+
+	if _, err := kv.Get(ctx, []byte("ok")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected rejected batch to store nothing, got %v", err)
+	}
+	if value, err := kv.Get(ctx, []byte("keep")); err != nil || string(value) != "v" {
+		t.Fatalf("expected rejected batch to delete nothing, got %q, %v", value, err)
+	}
+}
+
+func TestInMemoryKV_ApplyBatch_Atomic(t *testing.T) {
+	t.Parallel()
+	kv := storage.NewInMemoryKVEngine()
+	const rounds = 1000
+	keys := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+
+	// Каждый пакет записывает один и тот же номер во все ключи, а на нечетных раундах
+	// удаляет их, поэтому согласованное чтение видит либо все ключи с равными значениями, либо ни одного
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var b storage.Batch
+		for i := range rounds {
+			b.Reset()
+			for _, key := range keys {
+				if i%2 == 0 {
+					b.Set(key, []byte(fmt.Sprint(i)))
+				} else {
+					b.Delete(key)
+				}
+			}
+			if err := kv.ApplyBatch(&b); err != nil {
+				t.Errorf("ApplyBatch failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		values, errs := kv.GetMany(keys)
+		for i := 1; i < len(keys); i++ {
+			if !bytes.Equal(values[i], values[0]) || !errors.Is(errs[i], errs[0]) {
+				t.Fatalf("observed a partial batch: %q, %v", values, errs)
+			}
+		}
+	}
+}
+
+func TestInMemoryKV_Versions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewInMemoryKVEngine()
+
+	if _, _, err := kv.GetVersioned([]byte("k")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+	if ok, err := kv.SetIfVersion([]byte("k"), []byte("v1"), 0); err != nil || !ok {
+		t.Fatalf("expected SetIfVersion with version 0 to create the key, got %v, %v", ok, err)
+	}
+	value, v1, err := kv.GetVersioned([]byte("k"))
+	if err != nil || string(value) != "v1" || v1 == 0 {
+		t.Fatalf("expected v1 with a non-zero version, got %q, %d, %v", value, v1, err)
+	}
+
+	kv.Set(ctx, []byte("k"), []byte("v2"))
+	_, v2, _ := kv.GetVersioned([]byte("k"))
+	if v2 <= v1 {
+		t.Fatalf("expected Set to bump the version past %d, got %d", v1, v2)
+	}
+	if ok, _ := kv.SetIfVersion([]byte("k"), []byte("stale"), v1); ok {
+		t.Fatal("expected SetIfVersion with a stale version to fail")
+	}
+	if ok, _ := kv.SetIfVersion([]byte("k"), []byte("v3"), v2); !ok {
+		t.Fatal("expected SetIfVersion with the current version to succeed")
+	}
+
+	// Пересозданный ключ не получает ни одну из прежних версий
+	_, v3, _ := kv.GetVersioned([]byte("k"))
+	kv.Clear()
+	kv.Set(ctx, []byte("k"), []byte("v4"))
+	if _, v4, _ := kv.GetVersioned([]byte("k")); v4 <= v3 {
+		t.Fatalf("expected a recreated key to get a version past %d, got %d", v3, v4)
+	}
+}
+
+func TestInMemoryKV_SetIfVersion_Concurrency(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewInMemoryKVEngine()
+	kv.Set(ctx, []byte("counter"), []byte("0"))
+	const goroutines, rounds = 16, 50
+
+	for round := range rounds {
+		value, version, err := kv.GetVersioned([]byte("counter"))
+		if err != nil {
+			t.Fatalf("GetVersioned failed: %v", err)
+		}
+		if want := fmt.Sprint(round); string(value) != want {
+			t.Fatalf("round %d: expected value %q, got %q", round, want, value)
+		}
+
+		// Все горутины обновляют ключ от одной и той же прочитанной версии
+		var wins atomic.Int32
+		wg := new(sync.WaitGroup)
+		for range goroutines {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, err := kv.SetIfVersion([]byte("counter"), []byte(fmt.Sprint(round+1)), version)
+				if err != nil {
+					t.Errorf("SetIfVersion failed: %v", err)
+					return
+				}
+				if ok {
+					wins.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if wins.Load() != 1 {
+			t.Fatalf("round %d: expected exactly one SetIfVersion to succeed, got %d", round, wins.Load())
+		}
+	}
+}
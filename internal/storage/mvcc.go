@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// version — значение ключа, записанное в момент ts.
+type version struct {
+	ts      uint64
+	value   []byte
+	deleted bool // Ключ удален в момент ts
+}
+
+// mvccKVEngine хранит все версии значений ключей, упорядоченные по возрастанию метки времени.
+// Запись добавляет новую версию с очередной меткой, не перезаписывая прежние,
+// а чтение видит последнюю версию не позже своей метки чтения.
+// Блокировка удерживается только на время поиска или добавления версии,
+// поэтому долгоживущие снимки не мешают записи. Старые версии не удаляются:
+// удаление ключа тоже добавляет версию, отмеченную как удаленная.
+type mvccKVEngine struct {
+	mtx   sync.RWMutex
+	data  map[string][]version
+	clock uint64 // Метка последней записи
+	opts  engineOptions
+}
+
+func NewMVCCKVEngine(opts ...Option) *mvccKVEngine {
+	return &mvccKVEngine{
+		data: make(map[string][]version),
+		opts: newEngineOptions(opts),
+	}
+}
+
+// mvccSnapshot — представление движка на момент метки ts.
+type mvccSnapshot struct {
+	kv *mvccKVEngine
+	ts uint64
+}
+
+// Snapshot возвращает снимок, который видит только записи, выполненные до его создания.
+func (kv *mvccKVEngine) Snapshot() *mvccSnapshot {
+	kv.mtx.RLock()
+	defer kv.mtx.RUnlock()
+	return &mvccSnapshot{kv: kv, ts: kv.clock}
+}
+
+// Timestamp возвращает метку чтения снимка.
+func (s *mvccSnapshot) Timestamp() uint64 {
+	return s.ts
+}
+
+func (s *mvccSnapshot) Get(key []byte) ([]byte, error) {
+	s.kv.mtx.RLock()
+	defer s.kv.mtx.RUnlock()
+	return s.kv.getAt(key, s.ts)
+}
+
+func (kv *mvccKVEngine) Set(ctx context.Context, key []byte, value []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := kv.opts.checkSize(key, value); err != nil {
+		return err
+	}
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	kv.put(string(key), value)
+	return nil
+}
+
+func (kv *mvccKVEngine) Get(ctx context.Context, key []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	kv.mtx.RLock()
+	defer kv.mtx.RUnlock()
+	return kv.getAt(key, kv.clock)
+}
+
+// SetMany записывает все пары с одной меткой, поэтому снимок видит либо все пары, либо ни одной.
+func (kv *mvccKVEngine) SetMany(pairs map[string][]byte) error {
+	if err := kv.opts.checkPairs(pairs); err != nil {
+		return err
+	}
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	kv.clock++
+	for k, v := range pairs {
+		kv.data[k] = append(kv.data[k], version{ts: kv.clock, value: bytes.Clone(v)})
+	}
+	return nil
+}
+
+func (kv *mvccKVEngine) GetMany(keys [][]byte) ([][]byte, []error) {
+	kv.mtx.RLock()
+	defer kv.mtx.RUnlock()
+	values := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		values[i], errs[i] = kv.getAt(key, kv.clock)
+	}
+	return values, errs
+}
+
+func (kv *mvccKVEngine) Increment(key []byte, delta int64) (int64, error) {
+	if err := kv.opts.checkSize(key, nil); err != nil {
+		return 0, err
+	}
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	current, _ := kv.getAt(key, kv.clock)
+	n, err := AddToValue(current, delta)
+	if err != nil {
+		return 0, err
+	}
+	kv.put(string(key), strconv.AppendInt(nil, n, 10))
+	return n, nil
+}
+
+func (kv *mvccKVEngine) CompareAndSwap(key, expected, new []byte) (bool, error) {
+	if err := kv.opts.checkSize(key, new); err != nil {
+		return false, err
+	}
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	current, err := kv.getAt(key, kv.clock)
+	if !ValueMatches(current, err == nil, expected) {
+		return false, nil
+	}
+	kv.put(string(key), new)
+	return true, nil
+}
+
+func (kv *mvccKVEngine) SetNX(key, value []byte) (bool, error) {
+	return kv.CompareAndSwap(key, nil, value)
+}
+
+func (kv *mvccKVEngine) GetSet(key, value []byte) ([]byte, bool, error) {
+	if err := kv.opts.checkSize(key, value); err != nil {
+		return nil, false, err
+	}
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	old, err := kv.getAt(key, kv.clock)
+	kv.put(string(key), value)
+	return old, err == nil, nil
+}
+
+// TTL — срок жизни ключей движком не поддерживается, поэтому существующий ключ бессрочен.
+func (kv *mvccKVEngine) TTL(key []byte) (time.Duration, error) {
+	kv.mtx.RLock()
+	defer kv.mtx.RUnlock()
+	if _, err := kv.getAt(key, kv.clock); err != nil {
+		return 0, err
+	}
+	return NoExpiry, nil
+}
+
+func (kv *mvccKVEngine) Append(key, suffix []byte) (int, error) {
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	current, _ := kv.getAt(key, kv.clock)
+	value := AppendValue(current, suffix)
+	if err := kv.opts.checkSize(key, value); err != nil {
+		return 0, err
+	}
+	kv.put(string(key), value)
+	return len(value), nil
+}
+
+// Clear удаляет все ключи одной меткой, поэтому снимки, созданные раньше, по-прежнему видят ключи.
+func (kv *mvccKVEngine) Clear() error {
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	kv.clock++
+	for k, versions := range kv.data {
+		if live(versions) {
+			kv.data[k] = append(versions, version{ts: kv.clock, deleted: true})
+		}
+	}
+	return nil
+}
+
+// DeletePrefix, как и Clear, удаляет ключи одной меткой.
+func (kv *mvccKVEngine) DeletePrefix(prefix []byte) (int, error) {
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	kv.clock++
+	deleted := 0
+	for k, versions := range kv.data {
+		if strings.HasPrefix(k, string(prefix)) && live(versions) {
+			kv.data[k] = append(versions, version{ts: kv.clock, deleted: true})
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (kv *mvccKVEngine) PrefixStats(prefix []byte) (PrefixStat, error) {
+	kv.mtx.RLock()
+	defer kv.mtx.RUnlock()
+	var stat PrefixStat
+	for k, versions := range kv.data {
+		if live(versions) && strings.HasPrefix(k, string(prefix)) {
+			stat.Keys++
+			stat.ValueBytes += len(versions[len(versions)-1].value)
+		}
+	}
+	return stat, nil
+}
+
+func (kv *mvccKVEngine) Keys(prefix []byte, fn func(key []byte) bool) error {
+	kv.mtx.RLock()
+	var keys []string
+	for k, versions := range kv.data {
+		if live(versions) && strings.HasPrefix(k, string(prefix)) {
+			keys = append(keys, k)
+		}
+	}
+	kv.mtx.RUnlock()
+
+	return visitKeys(keys, fn)
+}
+
+// Stats возвращает количество ключей, хранимых версий и метку последней записи.
+func (kv *mvccKVEngine) Stats() map[string]string {
+	kv.mtx.RLock()
+	defer kv.mtx.RUnlock()
+	keys, versions := 0, 0
+	for _, vs := range kv.data {
+		if live(vs) {
+			keys++
+		}
+		versions += len(vs)
+	}
+	return map[string]string{
+		"keys":     strconv.Itoa(keys),
+		"versions": strconv.Itoa(versions),
+		"clock":    strconv.FormatUint(kv.clock, 10),
+	}
+}
+
+// put добавляет копию значения версией со следующей меткой, чтобы изменение буфера
+// вызывающим кодом не переписало историю. Вызывается под kv.mtx.
+func (kv *mvccKVEngine) put(key string, value []byte) {
+	kv.clock++
+	kv.data[key] = append(kv.data[key], version{ts: kv.clock, value: bytes.Clone(value)})
+}
+
+// getAt возвращает копию последней версии значения с меткой не больше ts. Вызывается под kv.mtx.
+func (kv *mvccKVEngine) getAt(key []byte, ts uint64) ([]byte, error) {
+	versions := kv.data[string(key)]
+	// Индекс первой версии, записанной позже ts
+	i := sort.Search(len(versions), func(i int) bool {
+		return versions[i].ts > ts
+	})
+	if i == 0 || versions[i-1].deleted {
+		return nil, ErrKeyNotFound
+	}
+	return bytes.Clone(versions[i-1].value), nil
+}
+
+// live сообщает, существует ли ключ в последней из своих версий.
+func live(versions []version) bool {
+	return !versions[len(versions)-1].deleted
+}
@@ -0,0 +1,183 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Argentum88/godb/internal/storage"
+)
+
+func TestMVCCKV_SnapshotIsolation(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewMVCCKVEngine()
+
+	kv.Set(ctx, []byte("balance"), []byte("100"))
+	snap := kv.Snapshot()
+
+	kv.Set(ctx, []byte("balance"), []byte("50"))
+	kv.Set(ctx, []byte("created"), []byte("later"))
+
+	value, err := snap.Get([]byte("balance"))
+	if err != nil || string(value) != "100" {
+		t.Fatalf("expected snapshot to see %q, got %q, %v", "100", value, err)
+	}
+	if _, err := snap.Get([]byte("created")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected key written after snapshot to be invisible, got %v", err)
+	}
+	if value, _ := kv.Get(ctx, []byte("balance")); string(value) != "50" {
+		t.Fatalf("expected latest value %q, got %q", "50", value)
+	}
+	if later := kv.Snapshot(); later.Timestamp() <= snap.Timestamp() {
+		t.Fatalf("expected timestamps to grow, got %d after %d", later.Timestamp(), snap.Timestamp())
+	}
+}
+
+func TestMVCCKV_BuffersDoNotAliasHistory(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewMVCCKVEngine()
+
+	buf := []byte("old")
+	kv.Set(ctx, []byte("k"), buf)
+	pairs := map[string][]byte{"m": []byte("old")}
+	kv.SetMany(pairs)
+	snap := kv.Snapshot()
+
+	// Изменяем буферы записи и результаты чтения: история версий не должна меняться
+	copy(buf, "new")
+	copy(pairs["m"], "new")
+	got, err := kv.Get(ctx, []byte("k"))
+	if err != nil {
+		t.Fatalf("failed to get key: %v", err)
+	}
+	copy(got, "bad")
+	snapGot, err := snap.Get([]byte("m"))
+	if err != nil {
+		t.Fatalf("failed to get key from snapshot: %v", err)
+	}
+	copy(snapGot, "bad")
+
+	kv.Set(ctx, []byte("k"), []byte("newer"))
+	for _, key := range []string{"k", "m"} {
+		if value, err := snap.Get([]byte(key)); err != nil || string(value) != "old" {
+			t.Fatalf("expected snapshot to see %q for %q, got %q, %v", "old", key, value, err)
+		}
+	}
+}
+
+func TestMVCCKV_ClearKeepsSnapshots(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewMVCCKVEngine()
+
+	kv.SetMany(map[string][]byte{"a": []byte("1"), "b": []byte("2")})
+	snap := kv.Snapshot()
+	if err := kv.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+
+	if _, err := kv.Get(ctx, []byte("a")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected %v after Clear, got %v", storage.ErrKeyNotFound, err)
+	}
+	if stat, _ := kv.PrefixStats(nil); stat.Keys != 0 {
+		t.Fatalf("expected no keys after Clear, got %d", stat.Keys)
+	}
+	if value, err := snap.Get([]byte("b")); err != nil || string(value) != "2" {
+		t.Fatalf("expected snapshot taken before Clear to see %q, got %q, %v", "2", value, err)
+	}
+
+	kv.Set(ctx, []byte("a"), []byte("3"))
+	if value, err := kv.Get(ctx, []byte("a")); err != nil || string(value) != "3" {
+		t.Fatalf("expected key written after Clear to be visible, got %q, %v", value, err)
+	}
+}
+
+func TestMVCCKV_DeletePrefixKeepsSnapshots(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	kv := storage.NewMVCCKVEngine()
+
+	kv.SetMany(map[string][]byte{"user:1": []byte("alice"), "user:2": []byte("bob"), "order:1": []byte("o")})
+	snap := kv.Snapshot()
+	deleted, err := kv.DeletePrefix([]byte("user:"))
+	if err != nil || deleted != 2 {
+		t.Fatalf("expected 2 keys deleted, got %d, %v", deleted, err)
+	}
+	if deleted, _ := kv.DeletePrefix([]byte("user:")); deleted != 0 {
+		t.Fatalf("expected already deleted keys not to be counted again, got %d", deleted)
+	}
+
+	if _, err := kv.Get(ctx, []byte("user:1")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected %v after DeletePrefix, got %v", storage.ErrKeyNotFound, err)
+	}
+	if value, err := kv.Get(ctx, []byte("order:1")); err != nil || string(value) != "o" {
+		t.Fatalf("expected key without the prefix to stay, got %q, %v", value, err)
+	}
+	if value, err := snap.Get([]byte("user:2")); err != nil || string(value) != "bob" {
+		t.Fatalf("expected snapshot taken before DeletePrefix to see %q, got %q, %v", "bob", value, err)
+	}
+}
+
+func TestMVCCKV_SnapshotConsistentAcrossKeys(t *testing.T) {
+	t.Parallel()
+	kv := storage.NewMVCCKVEngine()
+	const accounts, transfers = 4, 500
+
+	// Перевод между счетами записывается одним SetMany, поэтому сумма в любом снимке постоянна
+	initial := make(map[string][]byte, accounts)
+	for i := range accounts {
+		initial[fmt.Sprintf("acc%d", i)] = []byte("100")
+	}
+	kv.SetMany(initial)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range transfers {
+			from, to := fmt.Sprintf("acc%d", i%accounts), fmt.Sprintf("acc%d", (i+1)%accounts)
+			values, _ := kv.GetMany([][]byte{[]byte(from), []byte(to)})
+			var a, b int
+			fmt.Sscan(string(values[0]), &a)
+			fmt.Sscan(string(values[1]), &b)
+			kv.SetMany(map[string][]byte{from: []byte(fmt.Sprint(a - 1)), to: []byte(fmt.Sprint(b + 1))})
+		}
+	}()
+
+	for range transfers {
+		snap := kv.Snapshot()
+		total := 0
+		for i := range accounts {
+			value, err := snap.Get([]byte(fmt.Sprintf("acc%d", i)))
+			if err != nil {
+				t.Fatalf("snapshot read failed: %v", err)
+			}
+			var n int
+			fmt.Sscan(string(value), &n)
+			total += n
+		}
+		if total != accounts*100 {
+			t.Fatalf("snapshot at %d saw inconsistent total %d", snap.Timestamp(), total)
+		}
+	}
+	wg.Wait()
+}
+
+func TestMVCCKV_CompareAndSwap_Concurrency(t *testing.T) {
+	t.Parallel()
+	testCompareAndSwapGenerations(t, storage.NewMVCCKVEngine())
+}
+
+func TestMVCCKV_GetSet_Concurrency(t *testing.T) {
+	t.Parallel()
+	testGetSetHandoff(t, storage.NewMVCCKVEngine())
+}
+
+func TestMVCCKV_Append_Concurrency(t *testing.T) {
+	t.Parallel()
+	testAppendConcurrency(t, storage.NewMVCCKVEngine())
+}
@@ -1,56 +1,225 @@
 package page
 
 import (
+	"cmp"
 	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"os"
+	"slices"
 	"sync"
+	"time"
 )
 
-const PageSize = 4 * 1024 // 4KB
+const (
+	DefaultPageSize = 4 * 1024 // 4KB
+	MinPageSize     = 512
+	// MaxPageSize ограничен 16-битным количеством слотов в заголовке слотовой страницы:
+	// столько 8-байтовых слотов в странице такого размера заведомо поместится
+	MaxPageSize = 256 * 1024
+)
+
+// Заголовок файла занимает физическую страницу 0:
+// [ Magic (4 байта) ] [ PageSize (4 байта) ] [ Version (4 байта) ] [ PageCount (8 байт) ]
+// PageCount обновляется при Sync, поэтому после сбоя в файле может оказаться больше страниц,
+// но не меньше. Версия 2 расширила указатель свободного места в заголовке слотовой страницы
+// до 4 байт, поэтому файлы версии 1 и файлы, созданные до появления версии (с нулем в Version),
+// не открываются.
+const (
+	fileMagic            = 0x42444F47 // "GODB"
+	fileVersion          = 2
+	fileMagicOffset      = 0
+	filePageSizeOffset   = 4
+	fileVersionOffset    = 8
+	filePageCountOffset  = 12
+	fileHeaderPrefixSize = 20
+)
+
+// maxConcurrentReads ограничивает количество параллельных чтений в ReadPages
+const maxConcurrentReads = 8
+
+// allocateChunkPages ограничивает количество страниц, обнуляемых в AllocatePages одной записью
+const allocateChunkPages = 256
+
+var ErrInvalidPageSize = errors.New("invalid page size")
+var ErrPageOutOfBounds = errors.New("page is out of bounds")
+var ErrPageSizeMismatch = errors.New("buffer size does not match page size")
+var ErrInvalidDatabaseFile = errors.New("not a valid database file")
+var ErrVersionMismatch = errors.New("unsupported database file version")
+var ErrPageNotAllocated = errors.New("page is not allocated")
 
 type PageID uint64
 
 type Manager interface {
 	AllocatePage(ctx context.Context) (PageID, error) // Расширить файл и выделить новую страницу
+	// AllocatePages выделяет n идущих подряд страниц и возвращает их номера по возрастанию.
+	AllocatePages(ctx context.Context, n int) ([]PageID, error)
+	// DeallocatePage возвращает страницу для повторной выдачи AllocatePage. Файл при этом не уменьшается.
+	DeallocatePage(ctx context.Context, pageID PageID) error
 	ReadPage(ctx context.Context, pageID PageID, p []byte) error
 	WritePage(ctx context.Context, pageID PageID, p []byte) error
-	Sync(ctx context.Context) error  // Принудительно сбросить буферы на диск
-	Close(ctx context.Context) error // Закрыть менеджер и освободить ресурсы
+	// WritePages записывает пакет страниц. Записи в смежные страницы объединяются в одну.
+	// При ошибке часть страниц пакета может быть уже записана.
+	WritePages(ctx context.Context, pages []PageWrite) error
+	Sync(ctx context.Context) error                // Принудительно сбросить буферы на диск
+	Close(ctx context.Context) error               // Закрыть менеджер и освободить ресурсы
+	PageSize() int                                 // Размер страницы в байтах
+	PageCount(ctx context.Context) (uint64, error) // Количество выделенных страниц
+	FileSize(ctx context.Context) (int64, error)   // Размер файла на диске в байтах, включая заголовок
+	// ForEachPage последовательно читает все выделенные страницы и вызывает для каждой fn.
+	// Буфер data переиспользуется между вызовами и не должен сохраняться после возврата из fn.
+	ForEachPage(ctx context.Context, fn func(pageID PageID, data []byte) error) error
+}
+
+// ReadRequest — запрос на чтение страницы PageID в буфер Buf размером в страницу.
+type ReadRequest struct {
+	PageID PageID
+	Buf    []byte
+}
+
+// PageWrite — запись данных Data размером в страницу в страницу PageID.
+type PageWrite struct {
+	PageID PageID
+	Data   []byte
 }
 
 type diskManager struct {
 	file     *os.File
+	pageSize int
 	nextPage PageID
 	mtx      sync.RWMutex
 	zeroPage []byte
+	// Освобожденные страницы в порядке освобождения. Хранятся только в памяти:
+	// после переоткрытия файла освобожденная страница остается выделенной и обнуленной.
+	freePages []PageID
+
+	groupCommit time.Duration // Окно объединения вызовов Sync, 0 — каждый Sync делает свой fsync
+	syncMu      sync.Mutex    // Защищает syncGroup
+	syncGroup   *syncGroup    // Группа, ожидающая fsync, или nil
+	fsync       func() error  // Сброс файла на диск, подменяется в тестах
+}
+
+// syncGroup — вызовы Sync, ожидающие одного общего fsync.
+type syncGroup struct {
+	done chan struct{} // Закрывается после fsync
+	err  error         // Результат fsync, читается после закрытия done
+}
+
+// Option настраивает diskManager при создании.
+type Option func(dm *diskManager)
+
+// WithGroupCommit включает групповой сброс: вызовы Sync в пределах окна window
+// объединяются в один fsync. Каждый вызов возвращается только после fsync,
+// начатого после его вызова, поэтому долговечность не ослабевает, а задержка Sync растет до window.
+func WithGroupCommit(window time.Duration) Option {
+	return func(dm *diskManager) {
+		dm.groupCommit = window
+	}
 }
 
-func NewDiskManager(ctx context.Context, filePath string) (*diskManager, error) {
+// WithPageSize задает размер страницы для нового файла.
+// Для существующего файла размер должен совпадать с сохраненным в заголовке.
+// Размер должен быть степенью двойки в диапазоне [MinPageSize, MaxPageSize].
+func WithPageSize(size int) Option {
+	return func(dm *diskManager) {
+		dm.pageSize = size
+	}
+}
+
+func NewDiskManager(ctx context.Context, filePath string, opts ...Option) (*diskManager, error) {
+	dm := &diskManager{}
+	for _, opt := range opts {
+		opt(dm)
+	}
+	if dm.pageSize != 0 && !isValidPageSize(dm.pageSize) {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidPageSize, dm.pageSize)
+	}
+
 	fd, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
+	dm.file = fd
+	dm.fsync = fd.Sync
+
+	if err := dm.init(); err != nil {
+		fd.Close()
+		return nil, err
+	}
 
-	dm := &diskManager{file: fd, zeroPage: make([]byte, PageSize)}
+	return dm, nil
+}
+
+// init читает заголовок существующего файла или записывает заголовок в новый файл
+func (dm *diskManager) init() error {
 	fileSize, err := dm.getFileSize()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get file size: %w", err)
+		return fmt.Errorf("failed to get file size: %w", err)
 	}
 
-	if (fileSize % PageSize) != 0 {
-		return nil, fmt.Errorf("file size %d is not aligned to page size %d", fileSize, PageSize)
+	var storedPageCount uint64
+	if fileSize == 0 {
+		if dm.pageSize == 0 {
+			dm.pageSize = DefaultPageSize
+		}
+		header := make([]byte, dm.pageSize)
+		binary.LittleEndian.PutUint32(header[fileMagicOffset:], fileMagic)
+		binary.LittleEndian.PutUint32(header[filePageSizeOffset:], uint32(dm.pageSize))
+		binary.LittleEndian.PutUint32(header[fileVersionOffset:], fileVersion)
+		if _, err := dm.file.WriteAt(header, 0); err != nil {
+			return fmt.Errorf("failed to write file header: %w", err)
+		}
+		fileSize = int64(dm.pageSize)
+	} else {
+		header := make([]byte, fileHeaderPrefixSize)
+		if _, err := dm.file.ReadAt(header, 0); err != nil {
+			return fmt.Errorf("%w: failed to read file header: %v", ErrInvalidDatabaseFile, err)
+		}
+		if magic := binary.LittleEndian.Uint32(header[fileMagicOffset:]); magic != fileMagic {
+			return fmt.Errorf("%w: header magic %#x", ErrInvalidDatabaseFile, magic)
+		}
+		version := binary.LittleEndian.Uint32(header[fileVersionOffset:])
+		if version != fileVersion {
+			return fmt.Errorf("%w: %d, expected %d", ErrVersionMismatch, version, fileVersion)
+		}
+		storedPageSize := int(binary.LittleEndian.Uint32(header[filePageSizeOffset:]))
+		if !isValidPageSize(storedPageSize) {
+			return fmt.Errorf("%w in file header: %d", ErrInvalidPageSize, storedPageSize)
+		}
+		if dm.pageSize != 0 && dm.pageSize != storedPageSize {
+			return fmt.Errorf("page size %d does not match page size %d stored in file header", dm.pageSize, storedPageSize)
+		}
+		dm.pageSize = storedPageSize
+		storedPageCount = binary.LittleEndian.Uint64(header[filePageCountOffset:])
 	}
 
-	dm.nextPage = PageID(fileSize / PageSize)
+	if (fileSize % int64(dm.pageSize)) != 0 {
+		return fmt.Errorf("%w: file size %d is not aligned to page size %d", ErrInvalidDatabaseFile, fileSize, dm.pageSize)
+	}
 
-	return dm, nil
+	dm.zeroPage = make([]byte, dm.pageSize)
+	dm.nextPage = PageID(fileSize/int64(dm.pageSize)) - 1 // без страницы заголовка
+	if storedPageCount > uint64(dm.nextPage) {
+		return fmt.Errorf("%w: header records %d pages, file holds %d", ErrInvalidDatabaseFile, storedPageCount, dm.nextPage)
+	}
+	return nil
 }
 
+// AllocatePage выдает первую из освобожденных страниц, а если их нет — расширяет файл.
 func (dm *diskManager) AllocatePage(ctx context.Context) (PageID, error) {
 	dm.mtx.Lock()
 	defer dm.mtx.Unlock()
 
+	if len(dm.freePages) > 0 {
+		pageID := dm.freePages[0]
+		if err := dm.writePage(pageID, dm.zeroPage); err != nil {
+			return 0, fmt.Errorf("failed to allocate page: %w", err)
+		}
+		dm.freePages = dm.freePages[1:]
+		return pageID, nil
+	}
+
 	nextPage := dm.nextPage
 	if err := dm.writePage(nextPage, dm.zeroPage); err != nil {
 		return 0, fmt.Errorf("failed to allocate page: %w", err)
@@ -60,16 +229,75 @@ func (dm *diskManager) AllocatePage(ctx context.Context) (PageID, error) {
 	return nextPage, nil
 }
 
+// AllocatePages расширяет файл на n обнуленных страниц, записывая их кусками
+// не больше allocateChunkPages страниц. Блокировка берется один раз, поэтому
+// страницы, выделенные одним вызовом, идут подряд и при параллельных вызовах.
+// Освобожденные страницы AllocatePages не использует, чтобы не нарушать этот порядок.
+func (dm *diskManager) AllocatePages(ctx context.Context, n int) ([]PageID, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("invalid page count %d", n)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	dm.mtx.Lock()
+	defer dm.mtx.Unlock()
+
+	first := dm.nextPage
+	zeros := make([]byte, min(n, allocateChunkPages)*dm.pageSize)
+	for done := 0; done < n; {
+		count := min(n-done, allocateChunkPages)
+		if err := dm.writePage(first+PageID(done), zeros[:count*dm.pageSize]); err != nil {
+			return nil, fmt.Errorf("failed to allocate pages: %w", err)
+		}
+		done += count
+	}
+	dm.nextPage += PageID(n)
+
+	pageIDs := make([]PageID, n)
+	for i := range pageIDs {
+		pageIDs[i] = first + PageID(i)
+	}
+	return pageIDs, nil
+}
+
+// DeallocatePage обнуляет страницу на диске и запоминает ее для повторной выдачи AllocatePage.
+func (dm *diskManager) DeallocatePage(ctx context.Context, pageID PageID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	dm.mtx.Lock()
+	defer dm.mtx.Unlock()
+
+	if pageID >= dm.nextPage {
+		return fmt.Errorf("%w: page %d, file has %d pages", ErrPageOutOfBounds, pageID, dm.nextPage)
+	}
+	if slices.Contains(dm.freePages, pageID) {
+		return fmt.Errorf("%w: page %d is already deallocated", ErrPageNotAllocated, pageID)
+	}
+	if err := dm.writePage(pageID, dm.zeroPage); err != nil {
+		return fmt.Errorf("failed to deallocate page: %w", err)
+	}
+	dm.freePages = append(dm.freePages, pageID)
+	return nil
+}
+
 func (dm *diskManager) ReadPage(ctx context.Context, pageID PageID, p []byte) error {
-	if len(p) != PageSize {
-		return fmt.Errorf("invalid page size: got %d, want %d", len(p), PageSize)
+	if len(p) != dm.pageSize {
+		return fmt.Errorf("%w: got %d, want %d", ErrPageSizeMismatch, len(p), dm.pageSize)
 	}
 
 	dm.mtx.RLock()
 	nextPage := dm.nextPage
 	dm.mtx.RUnlock()
 	if pageID >= nextPage {
-		return fmt.Errorf("pageID %d out of bounds (lastPage: %d)", pageID, nextPage-1)
+		return fmt.Errorf("%w: page %d, file has %d pages", ErrPageOutOfBounds, pageID, nextPage)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
 	_, err := dm.file.ReadAt(p, dm.calculateOffsetByPageID(pageID))
@@ -79,16 +307,30 @@ func (dm *diskManager) ReadPage(ctx context.Context, pageID PageID, p []byte) er
 	return nil
 }
 
+// ReadPageAlloc читает страницу в новый буфер размером в страницу.
+// Предназначен для утилит и тестов: на частых путях буфер передается в ReadPage.
+func (dm *diskManager) ReadPageAlloc(ctx context.Context, pageID PageID) ([]byte, error) {
+	p := make([]byte, dm.pageSize)
+	if err := dm.ReadPage(ctx, pageID, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
 func (dm *diskManager) WritePage(ctx context.Context, pageID PageID, p []byte) error {
-	if len(p) != PageSize {
-		return fmt.Errorf("invalid page size: got %d, want %d", len(p), PageSize)
+	if len(p) != dm.pageSize {
+		return fmt.Errorf("%w: got %d, want %d", ErrPageSizeMismatch, len(p), dm.pageSize)
 	}
 
 	dm.mtx.RLock()
 	nextPage := dm.nextPage
 	dm.mtx.RUnlock()
 	if pageID >= nextPage {
-		return fmt.Errorf("pageID %d out of bounds (lastPage: %d)", pageID, nextPage-1)
+		return fmt.Errorf("%w: page %d, file has %d pages", ErrPageOutOfBounds, pageID, nextPage)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
 	err := dm.writePage(pageID, p)
@@ -98,14 +340,229 @@ func (dm *diskManager) WritePage(ctx context.Context, pageID PageID, p []byte) e
 	return nil
 }
 
+// ReadPages читает пакет страниц. Запросы к идущим подряд страницам объединяются
+// в одно чтение, отдельные страницы и группы читаются параллельно,
+// не более maxConcurrentReads одновременно.
+func (dm *diskManager) ReadPages(ctx context.Context, reqs []ReadRequest) error {
+	dm.mtx.RLock()
+	nextPage := dm.nextPage
+	dm.mtx.RUnlock()
+
+	for _, req := range reqs {
+		if len(req.Buf) != dm.pageSize {
+			return fmt.Errorf("%w: got %d, want %d", ErrPageSizeMismatch, len(req.Buf), dm.pageSize)
+		}
+		if req.PageID >= nextPage {
+			return fmt.Errorf("%w: page %d, file has %d pages", ErrPageOutOfBounds, req.PageID, nextPage)
+		}
+	}
+
+	sorted := slices.Clone(reqs)
+	slices.SortFunc(sorted, func(a, b ReadRequest) int {
+		return cmp.Compare(a.PageID, b.PageID)
+	})
+
+	// Разбиваем запросы на серии смежных страниц
+	var runs [][]ReadRequest
+	for i := 0; i < len(sorted); {
+		j := i + 1
+		for j < len(sorted) && sorted[j].PageID == sorted[j-1].PageID+1 {
+			j++
+		}
+		runs = append(runs, sorted[i:j])
+		i = j
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		sem      = make(chan struct{}, maxConcurrentReads)
+	)
+	for _, run := range runs {
+		if err := ctx.Err(); err != nil {
+			errOnce.Do(func() { firstErr = err })
+			break
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := dm.readRun(run); err != nil {
+				errOnce.Do(func() { firstErr = err })
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// readRun читает серию смежных страниц одним вызовом ReadAt и раскладывает их по буферам запросов.
+func (dm *diskManager) readRun(run []ReadRequest) error {
+	first := run[0].PageID
+	if len(run) == 1 {
+		if _, err := dm.file.ReadAt(run[0].Buf, dm.calculateOffsetByPageID(first)); err != nil {
+			return fmt.Errorf("failed to read page %d: %w", first, err)
+		}
+		return nil
+	}
+
+	buf := make([]byte, len(run)*dm.pageSize)
+	if _, err := dm.file.ReadAt(buf, dm.calculateOffsetByPageID(first)); err != nil {
+		return fmt.Errorf("failed to read pages %d-%d: %w", first, run[len(run)-1].PageID, err)
+	}
+	for i, req := range run {
+		copy(req.Buf, buf[i*dm.pageSize:(i+1)*dm.pageSize])
+	}
+	return nil
+}
+
+// WritePages записывает пакет страниц. Записи в идущие подряд страницы объединяются
+// в один вызов WriteAt, отдельные страницы записываются по одной.
+// Отмена ctx проверяется между записями.
+func (dm *diskManager) WritePages(ctx context.Context, pages []PageWrite) error {
+	dm.mtx.RLock()
+	nextPage := dm.nextPage
+	dm.mtx.RUnlock()
+
+	for _, pw := range pages {
+		if len(pw.Data) != dm.pageSize {
+			return fmt.Errorf("%w: got %d, want %d", ErrPageSizeMismatch, len(pw.Data), dm.pageSize)
+		}
+		if pw.PageID >= nextPage {
+			return fmt.Errorf("%w: page %d, file has %d pages", ErrPageOutOfBounds, pw.PageID, nextPage)
+		}
+	}
+
+	sorted := slices.Clone(pages)
+	slices.SortFunc(sorted, func(a, b PageWrite) int {
+		return cmp.Compare(a.PageID, b.PageID)
+	})
+
+	for i := 0; i < len(sorted); {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		j := i + 1
+		for j < len(sorted) && sorted[j].PageID == sorted[j-1].PageID+1 {
+			j++
+		}
+		if err := dm.writeRun(sorted[i:j]); err != nil {
+			return err
+		}
+		i = j
+	}
+	return nil
+}
+
+// writeRun записывает серию смежных страниц одним вызовом WriteAt.
+func (dm *diskManager) writeRun(run []PageWrite) error {
+	first := run[0].PageID
+	if len(run) == 1 {
+		return dm.writePage(first, run[0].Data)
+	}
+
+	buf := make([]byte, 0, len(run)*dm.pageSize)
+	for _, pw := range run {
+		buf = append(buf, pw.Data...)
+	}
+	if _, err := dm.file.WriteAt(buf, dm.calculateOffsetByPageID(first)); err != nil {
+		return fmt.Errorf("failed to write pages %d-%d: %w", first, run[len(run)-1].PageID, err)
+	}
+	return nil
+}
+
+func (dm *diskManager) ForEachPage(ctx context.Context, fn func(pageID PageID, data []byte) error) error {
+	dm.mtx.RLock()
+	nextPage := dm.nextPage
+	dm.mtx.RUnlock()
+
+	buf := make([]byte, dm.pageSize)
+	for pageID := range nextPage {
+		if err := dm.ReadPage(ctx, pageID, buf); err != nil {
+			return err
+		}
+		if err := fn(pageID, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sync записывает в заголовок количество страниц и сбрасывает файл на диск.
+// С WithGroupCommit сброс может быть общим с параллельными вызовами Sync.
 func (dm *diskManager) Sync(ctx context.Context) error {
-	err := dm.file.Sync()
+	dm.mtx.RLock()
+	pageCount := binary.LittleEndian.AppendUint64(nil, uint64(dm.nextPage))
+	dm.mtx.RUnlock()
+	if _, err := dm.file.WriteAt(pageCount, filePageCountOffset); err != nil {
+		return fmt.Errorf("failed to write file header: %w", err)
+	}
+
+	var err error
+	if dm.groupCommit > 0 {
+		err = dm.groupSync(ctx)
+	} else {
+		err = dm.fsync()
+	}
 	if err != nil {
 		return fmt.Errorf("failed to sync file: %w", err)
 	}
 	return nil
 }
 
+// groupSync присоединяет вызов к группе, ожидающей fsync, или создает новую.
+// Создатель группы ждет окно groupCommit, отсоединяет группу и делает fsync за всех ее участников.
+// Группа отсоединяется до fsync, поэтому fsync начинается после записей всех участников,
+// а вызовы, пришедшие позже, попадают в следующую группу.
+func (dm *diskManager) groupSync(ctx context.Context) error {
+	dm.syncMu.Lock()
+	g := dm.syncGroup
+	leader := g == nil
+	if leader {
+		g = &syncGroup{done: make(chan struct{})}
+		dm.syncGroup = g
+	}
+	dm.syncMu.Unlock()
+
+	if leader {
+		// Окно не прерывается по ctx: участники группы ждут этот fsync
+		time.Sleep(dm.groupCommit)
+		dm.syncMu.Lock()
+		dm.syncGroup = nil
+		dm.syncMu.Unlock()
+
+		g.err = dm.fsync()
+		close(g.done)
+		return g.err
+	}
+
+	select {
+	case <-g.done:
+		return g.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (dm *diskManager) PageSize() int {
+	return dm.pageSize
+}
+
+func (dm *diskManager) PageCount(ctx context.Context) (uint64, error) {
+	dm.mtx.RLock()
+	defer dm.mtx.RUnlock()
+	return uint64(dm.nextPage), nil
+}
+
+func (dm *diskManager) FileSize(ctx context.Context) (int64, error) {
+	dm.mtx.RLock()
+	defer dm.mtx.RUnlock()
+	return dm.getFileSize()
+}
+
 func (dm *diskManager) Close(ctx context.Context) error {
 	err := dm.file.Close()
 	if err != nil {
@@ -122,8 +579,9 @@ func (dm *diskManager) writePage(pageID PageID, p []byte) error {
 	return nil
 }
 
+// calculateOffsetByPageID учитывает, что физическая страница 0 занята заголовком файла
 func (dm *diskManager) calculateOffsetByPageID(pageID PageID) int64 {
-	return int64(pageID) * int64(PageSize)
+	return (int64(pageID) + 1) * int64(dm.pageSize)
 }
 
 func (dm *diskManager) getFileSize() (int64, error) {
@@ -133,3 +591,7 @@ func (dm *diskManager) getFileSize() (int64, error) {
 	}
 	return fileInfo.Size(), nil
 }
+
+func isValidPageSize(size int) bool {
+	return size >= MinPageSize && size <= MaxPageSize && size&(size-1) == 0
+}
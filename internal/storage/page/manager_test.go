@@ -3,9 +3,15 @@ package page
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
+	"os"
 	"path/filepath"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func Test_diskManager_SequentialLifecycle(t *testing.T) {
@@ -37,7 +43,7 @@ func Test_diskManager_SequentialLifecycle(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to allocate page: %v", err)
 	}
-	bufForWrite := bytes.Repeat([]byte{'a'}, PageSize)
+	bufForWrite := bytes.Repeat([]byte{'a'}, DefaultPageSize)
 	err = pm.WritePage(ctx, pageID, bufForWrite)
 	if err != nil {
 		t.Fatalf("failed to write page: %v", err)
@@ -48,7 +54,7 @@ func Test_diskManager_SequentialLifecycle(t *testing.T) {
 	}
 	
 	// Read back the page and verify contents
-	bufForRead := make([]byte, PageSize)
+	bufForRead := make([]byte, DefaultPageSize)
 	err = pm.ReadPage(ctx, pageID, bufForRead)
 	if err != nil {
 		t.Fatalf("failed to read page: %v", err)
@@ -83,7 +89,7 @@ func Test_diskManager_ConcurrentWrite(t *testing.T) {
 			if err != nil {
 				t.Errorf("failed to allocate page: %v", err)
 			}
-			bufForWrite := bytes.Repeat([]byte{byte(pageID)}, PageSize)
+			bufForWrite := bytes.Repeat([]byte{byte(pageID)}, DefaultPageSize)
 			err = pm.WritePage(ctx, pageID, bufForWrite)
 			if err != nil {
 				t.Errorf("failed to write page: %v", err)
@@ -94,8 +100,8 @@ func Test_diskManager_ConcurrentWrite(t *testing.T) {
 
 	for i := range 10 {
 		pageID := PageID(i)
-		expectedBuffer := bytes.Repeat([]byte{byte(pageID)}, PageSize)
-		bufForRead := make([]byte, PageSize)
+		expectedBuffer := bytes.Repeat([]byte{byte(pageID)}, DefaultPageSize)
+		bufForRead := make([]byte, DefaultPageSize)
 		err = pm.ReadPage(ctx, pageID, bufForRead)
 		if err != nil {
 			t.Fatalf("failed to read page: %v", err)
@@ -105,3 +111,633 @@ func Test_diskManager_ConcurrentWrite(t *testing.T) {
 		}
 	}
 }
+
+func Test_diskManager_CanceledContext(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	tempDir := t.TempDir()
+	filePath := filepath.Join(tempDir, "test.db")
+	pm, err := NewDiskManager(ctx, filePath)
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+	t.Cleanup(func() {
+		pm.Close(ctx)
+	})
+
+	pageID, err := pm.AllocatePage(ctx)
+	if err != nil {
+		t.Fatalf("failed to allocate page: %v", err)
+	}
+
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	buf := make([]byte, DefaultPageSize)
+	if err := pm.ReadPage(canceledCtx, pageID, buf); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v from ReadPage, got %v", context.Canceled, err)
+	}
+	if err := pm.WritePage(canceledCtx, pageID, bytes.Repeat([]byte{'a'}, DefaultPageSize)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v from WritePage, got %v", context.Canceled, err)
+	}
+
+	if err := pm.ReadPage(ctx, pageID, buf); err != nil {
+		t.Fatalf("failed to read page: %v", err)
+	}
+	if !bytes.Equal(buf, make([]byte, DefaultPageSize)) {
+		t.Fatalf("page was modified by canceled WritePage")
+	}
+}
+
+func Test_diskManager_CustomPageSize(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const pageSize = 8 * 1024
+
+	tempDir := t.TempDir()
+	filePath := filepath.Join(tempDir, "test.db")
+	pm, err := NewDiskManager(ctx, filePath, WithPageSize(pageSize))
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+	if pm.PageSize() != pageSize {
+		t.Fatalf("expected page size %d, got %d", pageSize, pm.PageSize())
+	}
+
+	pageID, err := pm.AllocatePage(ctx)
+	if err != nil {
+		t.Fatalf("failed to allocate page: %v", err)
+	}
+	bufForWrite := bytes.Repeat([]byte{'a'}, pageSize)
+	if err := pm.WritePage(ctx, pageID, bufForWrite); err != nil {
+		t.Fatalf("failed to write page: %v", err)
+	}
+	if err := pm.WritePage(ctx, pageID, make([]byte, DefaultPageSize)); err == nil {
+		t.Fatalf("expected error writing buffer of default page size")
+	}
+	if err := pm.Close(ctx); err != nil {
+		t.Fatalf("failed to close DiskManager: %v", err)
+	}
+
+	// Размер страницы восстанавливается из заголовка файла
+	pm, err = NewDiskManager(ctx, filePath)
+	if err != nil {
+		t.Fatalf("failed to reopen DiskManager: %v", err)
+	}
+	t.Cleanup(func() {
+		pm.Close(ctx)
+	})
+	if pm.PageSize() != pageSize {
+		t.Fatalf("expected page size %d after reopen, got %d", pageSize, pm.PageSize())
+	}
+
+	bufForRead := make([]byte, pageSize)
+	if err := pm.ReadPage(ctx, pageID, bufForRead); err != nil {
+		t.Fatalf("failed to read page: %v", err)
+	}
+	if !bytes.Equal(bufForWrite, bufForRead) {
+		t.Fatalf("read data does not match written data")
+	}
+
+	if _, err := NewDiskManager(ctx, filePath, WithPageSize(DefaultPageSize)); err == nil {
+		t.Fatalf("expected error reopening with mismatched page size")
+	}
+}
+
+func Test_diskManager_InvalidPageSize(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	filePath := filepath.Join(t.TempDir(), "test.db")
+	if _, err := NewDiskManager(ctx, filePath, WithPageSize(5000)); !errors.Is(err, ErrInvalidPageSize) {
+		t.Fatalf("expected %v, got %v", ErrInvalidPageSize, err)
+	}
+}
+
+func Test_diskManager_FileHeader(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	filePath := filepath.Join(t.TempDir(), "test.db")
+	pm, err := NewDiskManager(ctx, filePath)
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+	for range 3 {
+		if _, err := pm.AllocatePage(ctx); err != nil {
+			t.Fatalf("failed to allocate page: %v", err)
+		}
+	}
+	if err := pm.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	pm.Close(ctx)
+
+	header := make([]byte, fileHeaderPrefixSize)
+	f, err := os.OpenFile(filePath, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("failed to open file: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.ReadAt(header, 0); err != nil {
+		t.Fatalf("failed to read header: %v", err)
+	}
+	if magic := binary.LittleEndian.Uint32(header[fileMagicOffset:]); magic != fileMagic {
+		t.Fatalf("expected magic %#x, got %#x", fileMagic, magic)
+	}
+	if version := binary.LittleEndian.Uint32(header[fileVersionOffset:]); version != fileVersion {
+		t.Fatalf("expected version %d, got %d", fileVersion, version)
+	}
+	if count := binary.LittleEndian.Uint64(header[filePageCountOffset:]); count != 3 {
+		t.Fatalf("expected 3 pages recorded in header, got %d", count)
+	}
+
+	pm, err = NewDiskManager(ctx, filePath)
+	if err != nil {
+		t.Fatalf("failed to reopen DiskManager: %v", err)
+	}
+	if count, _ := pm.PageCount(ctx); count != 3 {
+		t.Fatalf("expected 3 pages after reopen, got %d", count)
+	}
+	pm.Close(ctx)
+
+	// Порча заголовка: каждое изменение откатывается после проверки
+	corruptions := []struct {
+		name    string
+		offset  int64
+		data    []byte
+		wantErr error
+	}{
+		{name: "bad magic", offset: fileMagicOffset, data: []byte("NOPE"), wantErr: ErrInvalidDatabaseFile},
+		{name: "future version", offset: fileVersionOffset, data: binary.LittleEndian.AppendUint32(nil, fileVersion+1), wantErr: ErrVersionMismatch},
+		{name: "narrow page header version", offset: fileVersionOffset, data: binary.LittleEndian.AppendUint32(nil, 1), wantErr: ErrVersionMismatch},
+		{name: "unversioned", offset: fileVersionOffset, data: binary.LittleEndian.AppendUint32(nil, 0), wantErr: ErrVersionMismatch},
+		{name: "truncated", offset: filePageCountOffset, data: binary.LittleEndian.AppendUint64(nil, 4), wantErr: ErrInvalidDatabaseFile},
+	}
+	for _, tt := range corruptions {
+		original := make([]byte, len(tt.data))
+		f.ReadAt(original, tt.offset)
+		f.WriteAt(tt.data, tt.offset)
+		_, err := NewDiskManager(ctx, filePath)
+		f.WriteAt(original, tt.offset)
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: expected %v, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+
+	// Посторонний файл не открывается и не перезаписывается
+	otherPath := filepath.Join(t.TempDir(), "other.txt")
+	other := bytes.Repeat([]byte("not a database "), 1000)
+	if err := os.WriteFile(otherPath, other, 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := NewDiskManager(ctx, otherPath); !errors.Is(err, ErrInvalidDatabaseFile) {
+		t.Fatalf("expected %v for unrelated file, got %v", ErrInvalidDatabaseFile, err)
+	}
+	if data, _ := os.ReadFile(otherPath); !bytes.Equal(data, other) {
+		t.Fatalf("unrelated file was modified")
+	}
+}
+
+func Test_diskManager_AllocatePages(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const numPages, goroutines = 1000, 4
+
+	pm, err := NewDiskManager(ctx, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+	t.Cleanup(func() {
+		pm.Close(ctx)
+	})
+
+	first, err := pm.AllocatePage(ctx)
+	if err != nil {
+		t.Fatalf("failed to allocate page: %v", err)
+	}
+	pageIDs, err := pm.AllocatePages(ctx, numPages)
+	if err != nil {
+		t.Fatalf("AllocatePages failed: %v", err)
+	}
+	if len(pageIDs) != numPages {
+		t.Fatalf("expected %d pages, got %d", numPages, len(pageIDs))
+	}
+	for i, pageID := range pageIDs {
+		if pageID != first+1+PageID(i) {
+			t.Fatalf("expected contiguous pages after %d, got %d at index %d", first, pageID, i)
+		}
+	}
+	buf := make([]byte, DefaultPageSize)
+	for _, pageID := range pageIDs {
+		if err := pm.ReadPage(ctx, pageID, buf); err != nil {
+			t.Fatalf("failed to read allocated page %d: %v", pageID, err)
+		}
+		if !bytes.Equal(buf, make([]byte, DefaultPageSize)) {
+			t.Fatalf("allocated page %d is not zeroed", pageID)
+		}
+	}
+
+	// Параллельные вызовы получают непересекающиеся диапазоны подряд идущих страниц
+	ranges := make([][]PageID, goroutines)
+	wg := new(sync.WaitGroup)
+	for i := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := pm.AllocatePages(ctx, 300)
+			ranges[i] = r
+			if err != nil {
+				t.Errorf("AllocatePages failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	seen := make(map[PageID]bool)
+	for _, r := range ranges {
+		for j, pageID := range r {
+			if seen[pageID] {
+				t.Fatalf("page %d allocated twice", pageID)
+			}
+			seen[pageID] = true
+			if pageID != r[0]+PageID(j) {
+				t.Fatalf("expected a contiguous range starting at %d, got %d at index %d", r[0], pageID, j)
+			}
+		}
+	}
+	if count, _ := pm.PageCount(ctx); count != uint64(1+numPages+goroutines*300) {
+		t.Fatalf("expected %d pages, got %d", 1+numPages+goroutines*300, count)
+	}
+}
+
+func Test_diskManager_GroupCommit(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const callers = 20
+
+	pm, err := NewDiskManager(ctx, filepath.Join(t.TempDir(), "test.db"), WithGroupCommit(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+	t.Cleanup(func() {
+		pm.Close(ctx)
+	})
+	var started, finished atomic.Int64
+	pm.fsync = func() error {
+		started.Add(1)
+		time.Sleep(5 * time.Millisecond)
+		err := pm.file.Sync()
+		finished.Add(1)
+		return err
+	}
+
+	wg := new(sync.WaitGroup)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// fsync, начатые до вызова, могут не покрыть записи вызывающего
+			before := started.Load()
+			if err := pm.Sync(ctx); err != nil {
+				t.Errorf("Sync failed: %v", err)
+				return
+			}
+			if finished.Load() <= before {
+				t.Errorf("Sync returned before an fsync started after the call had finished")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := finished.Load(); n == 0 || n >= callers {
+		t.Fatalf("expected concurrent Sync calls to share fsyncs, got %d fsyncs for %d calls", n, callers)
+	}
+}
+
+func Test_diskManager_ReadPageAlloc(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const pageSize = 1024
+
+	pm, err := NewDiskManager(ctx, filepath.Join(t.TempDir(), "test.db"), WithPageSize(pageSize))
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+	t.Cleanup(func() {
+		pm.Close(ctx)
+	})
+	pageID, err := pm.AllocatePage(ctx)
+	if err != nil {
+		t.Fatalf("failed to allocate page: %v", err)
+	}
+	data := bytes.Repeat([]byte("alloc"), pageSize/5+1)[:pageSize]
+	if err := pm.WritePage(ctx, pageID, data); err != nil {
+		t.Fatalf("failed to write page: %v", err)
+	}
+
+	buf := make([]byte, pageSize)
+	if err := pm.ReadPage(ctx, pageID, buf); err != nil {
+		t.Fatalf("ReadPage failed: %v", err)
+	}
+	got, err := pm.ReadPageAlloc(ctx, pageID)
+	if err != nil {
+		t.Fatalf("ReadPageAlloc failed: %v", err)
+	}
+	if len(got) != pageSize || !bytes.Equal(got, buf) {
+		t.Fatalf("expected ReadPageAlloc to return the %d bytes read by ReadPage, got %d bytes", pageSize, len(got))
+	}
+}
+
+func Test_diskManager_PageErrors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	pm, err := NewDiskManager(ctx, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+	t.Cleanup(func() {
+		pm.Close(ctx)
+	})
+	pageID, err := pm.AllocatePage(ctx)
+	if err != nil {
+		t.Fatalf("failed to allocate page: %v", err)
+	}
+
+	buf := make([]byte, DefaultPageSize)
+	if err := pm.ReadPage(ctx, pageID+1, buf); !errors.Is(err, ErrPageOutOfBounds) {
+		t.Fatalf("expected %v from ReadPage, got %v", ErrPageOutOfBounds, err)
+	}
+	if err := pm.WritePage(ctx, pageID+1, buf); !errors.Is(err, ErrPageOutOfBounds) {
+		t.Fatalf("expected %v from WritePage, got %v", ErrPageOutOfBounds, err)
+	}
+	if _, err := pm.ReadPageAlloc(ctx, pageID+1); !errors.Is(err, ErrPageOutOfBounds) {
+		t.Fatalf("expected %v from ReadPageAlloc, got %v", ErrPageOutOfBounds, err)
+	}
+	short := make([]byte, DefaultPageSize-1)
+	if err := pm.ReadPage(ctx, pageID, short); !errors.Is(err, ErrPageSizeMismatch) {
+		t.Fatalf("expected %v from ReadPage, got %v", ErrPageSizeMismatch, err)
+	}
+	if err := pm.WritePage(ctx, pageID, short); !errors.Is(err, ErrPageSizeMismatch) {
+		t.Fatalf("expected %v from WritePage, got %v", ErrPageSizeMismatch, err)
+	}
+}
+
+func Test_diskManager_ForEachPage(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const numPages = 5
+
+	filePath := filepath.Join(t.TempDir(), "test.db")
+	pm, err := NewDiskManager(ctx, filePath)
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+	t.Cleanup(func() {
+		pm.Close(ctx)
+	})
+
+	for i := range numPages {
+		pageID, err := pm.AllocatePage(ctx)
+		if err != nil {
+			t.Fatalf("failed to allocate page: %v", err)
+		}
+		if err := pm.WritePage(ctx, pageID, bytes.Repeat([]byte{byte('a' + i)}, DefaultPageSize)); err != nil {
+			t.Fatalf("failed to write page: %v", err)
+		}
+	}
+
+	var visited []PageID
+	err = pm.ForEachPage(ctx, func(pageID PageID, data []byte) error {
+		expected := bytes.Repeat([]byte{byte('a' + int(pageID))}, DefaultPageSize)
+		if !bytes.Equal(data, expected) {
+			t.Errorf("page %d: read data does not match written data", pageID)
+		}
+		visited = append(visited, pageID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachPage failed: %v", err)
+	}
+	if !slices.Equal(visited, []PageID{0, 1, 2, 3, 4}) {
+		t.Fatalf("expected pages to be visited in order, got %v", visited)
+	}
+
+	errStop := errors.New("stop")
+	visited = nil
+	err = pm.ForEachPage(ctx, func(pageID PageID, data []byte) error {
+		visited = append(visited, pageID)
+		if pageID == 1 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("expected %v, got %v", errStop, err)
+	}
+	if len(visited) != 2 {
+		t.Fatalf("expected iteration to stop after page 1, visited %v", visited)
+	}
+}
+
+func Test_diskManager_ReadPages(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const numPages = 20
+
+	filePath := filepath.Join(t.TempDir(), "test.db")
+	pm, err := NewDiskManager(ctx, filePath)
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+	t.Cleanup(func() {
+		pm.Close(ctx)
+	})
+
+	for i := range numPages {
+		pageID, err := pm.AllocatePage(ctx)
+		if err != nil {
+			t.Fatalf("failed to allocate page: %v", err)
+		}
+		if err := pm.WritePage(ctx, pageID, bytes.Repeat([]byte{byte('a' + i)}, DefaultPageSize)); err != nil {
+			t.Fatalf("failed to write page: %v", err)
+		}
+	}
+
+	// Смесь смежных (3-6, 10-11) и разрозненных страниц в произвольном порядке
+	pageIDs := []PageID{5, 17, 3, 10, 0, 6, 11, 4, 19, 8}
+	reqs := make([]ReadRequest, len(pageIDs))
+	for i, pageID := range pageIDs {
+		reqs[i] = ReadRequest{PageID: pageID, Buf: make([]byte, DefaultPageSize)}
+	}
+	if err := pm.ReadPages(ctx, reqs); err != nil {
+		t.Fatalf("ReadPages failed: %v", err)
+	}
+	for _, req := range reqs {
+		expected := bytes.Repeat([]byte{byte('a' + int(req.PageID))}, DefaultPageSize)
+		if !bytes.Equal(req.Buf, expected) {
+			t.Fatalf("page %d: read data does not match written data", req.PageID)
+		}
+	}
+
+	outOfBounds := []ReadRequest{{PageID: numPages, Buf: make([]byte, DefaultPageSize)}}
+	if err := pm.ReadPages(ctx, outOfBounds); !errors.Is(err, ErrPageOutOfBounds) {
+		t.Fatalf("expected %v, got %v", ErrPageOutOfBounds, err)
+	}
+}
+
+func Test_diskManager_WritePages(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const numPages = 20
+
+	filePath := filepath.Join(t.TempDir(), "test.db")
+	pm, err := NewDiskManager(ctx, filePath)
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+	t.Cleanup(func() {
+		pm.Close(ctx)
+	})
+
+	for range numPages {
+		if _, err := pm.AllocatePage(ctx); err != nil {
+			t.Fatalf("failed to allocate page: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		pageIDs []PageID
+	}{
+		{name: "contiguous", pageIDs: []PageID{4, 2, 3, 5}},
+		{name: "gapped", pageIDs: []PageID{12, 7, 19, 8, 13, 0}},
+		{name: "single page", pageIDs: []PageID{16}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writes := make([]PageWrite, len(tt.pageIDs))
+			for j, pageID := range tt.pageIDs {
+				writes[j] = PageWrite{PageID: pageID, Data: bytes.Repeat([]byte{byte('a' + i*10 + j)}, DefaultPageSize)}
+			}
+			if err := pm.WritePages(ctx, writes); err != nil {
+				t.Fatalf("WritePages failed: %v", err)
+			}
+
+			buf := make([]byte, DefaultPageSize)
+			for _, w := range writes {
+				if err := pm.ReadPage(ctx, w.PageID, buf); err != nil {
+					t.Fatalf("failed to read page %d: %v", w.PageID, err)
+				}
+				if !bytes.Equal(buf, w.Data) {
+					t.Fatalf("page %d: read data does not match written data", w.PageID)
+				}
+			}
+		})
+	}
+
+	// Соседние страницы, не вошедшие в пакет, не затронуты
+	buf := make([]byte, DefaultPageSize)
+	for _, pageID := range []PageID{1, 6, 9, 11, 14} {
+		if err := pm.ReadPage(ctx, pageID, buf); err != nil {
+			t.Fatalf("failed to read page %d: %v", pageID, err)
+		}
+		if !bytes.Equal(buf, make([]byte, DefaultPageSize)) {
+			t.Fatalf("page %d was overwritten", pageID)
+		}
+	}
+
+	outOfBounds := []PageWrite{{PageID: numPages, Data: make([]byte, DefaultPageSize)}}
+	if err := pm.WritePages(ctx, outOfBounds); !errors.Is(err, ErrPageOutOfBounds) {
+		t.Fatalf("expected %v, got %v", ErrPageOutOfBounds, err)
+	}
+	shortData := []PageWrite{{PageID: 0, Data: make([]byte, DefaultPageSize-1)}}
+	if err := pm.WritePages(ctx, shortData); !errors.Is(err, ErrPageSizeMismatch) {
+		t.Fatalf("expected %v, got %v", ErrPageSizeMismatch, err)
+	}
+}
+
+func Test_diskManager_PageCount(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const numPages = 3
+
+	filePath := filepath.Join(t.TempDir(), "test.db")
+	pm, err := NewDiskManager(ctx, filePath)
+	if err != nil {
+		t.Fatalf("failed to create DiskManager: %v", err)
+	}
+
+	for i := range numPages + 1 {
+		count, err := pm.PageCount(ctx)
+		if err != nil {
+			t.Fatalf("PageCount failed: %v", err)
+		}
+		if count != uint64(i) {
+			t.Fatalf("expected %d pages, got %d", i, count)
+		}
+		// Файл содержит страницу заголовка и выделенные страницы
+		size, err := pm.FileSize(ctx)
+		if err != nil {
+			t.Fatalf("FileSize failed: %v", err)
+		}
+		if want := int64(i+1) * DefaultPageSize; size != want {
+			t.Fatalf("expected file size %d, got %d", want, size)
+		}
+		if i < numPages {
+			if _, err := pm.AllocatePage(ctx); err != nil {
+				t.Fatalf("failed to allocate page: %v", err)
+			}
+		}
+	}
+	if err := pm.Close(ctx); err != nil {
+		t.Fatalf("failed to close DiskManager: %v", err)
+	}
+
+	pm, err = NewDiskManager(ctx, filePath)
+	if err != nil {
+		t.Fatalf("failed to reopen DiskManager: %v", err)
+	}
+	t.Cleanup(func() {
+		pm.Close(ctx)
+	})
+	if count, err := pm.PageCount(ctx); err != nil || count != numPages {
+		t.Fatalf("expected %d pages after reopen, got %d, %v", numPages, count, err)
+	}
+}
+
+func Benchmark_diskManager_Allocate(b *testing.B) {
+	ctx := context.Background()
+	const batch = 64
+
+	newManager := func(b *testing.B) *diskManager {
+		pm, err := NewDiskManager(ctx, filepath.Join(b.TempDir(), "bench.db"))
+		if err != nil {
+			b.Fatalf("failed to create DiskManager: %v", err)
+		}
+		b.Cleanup(func() {
+			pm.Close(ctx)
+		})
+		return pm
+	}
+
+	b.Run("one by one", func(b *testing.B) {
+		pm := newManager(b)
+		for range b.N {
+			for range batch {
+				if _, err := pm.AllocatePage(ctx); err != nil {
+					b.Fatalf("failed to allocate page: %v", err)
+				}
+			}
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		pm := newManager(b)
+		for range b.N {
+			if _, err := pm.AllocatePages(ctx, batch); err != nil {
+				b.Fatalf("failed to allocate pages: %v", err)
+			}
+		}
+	})
+}
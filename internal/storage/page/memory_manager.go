@@ -0,0 +1,197 @@
+package page
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+var ErrManagerClosed = errors.New("page manager is closed")
+
+// memoryManager хранит страницы в памяти. Проверки размера буфера и границ те же, что у diskManager,
+// но данные не переживают Close. Подходит для тестов и встраивания без диска.
+type memoryManager struct {
+	pageSize int
+	pages    [][]byte
+	free     []PageID // Освобожденные страницы в порядке освобождения
+	closed   bool
+	mtx      sync.RWMutex
+}
+
+// NewMemoryManager создает пустой менеджер страниц в памяти с размером страницы pageSize.
+// Размер должен быть степенью двойки в диапазоне [MinPageSize, MaxPageSize].
+func NewMemoryManager(pageSize int) (*memoryManager, error) {
+	if !isValidPageSize(pageSize) {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidPageSize, pageSize)
+	}
+	return &memoryManager{pageSize: pageSize}, nil
+}
+
+// AllocatePage выдает первую из освобожденных страниц, а если их нет — добавляет новую.
+func (mm *memoryManager) AllocatePage(ctx context.Context) (PageID, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	mm.mtx.Lock()
+	if !mm.closed && len(mm.free) > 0 {
+		pageID := mm.free[0]
+		mm.free = mm.free[1:]
+		mm.mtx.Unlock()
+		return pageID, nil
+	}
+	mm.mtx.Unlock()
+
+	pageIDs, err := mm.AllocatePages(ctx, 1)
+	if err != nil {
+		return 0, err
+	}
+	return pageIDs[0], nil
+}
+
+func (mm *memoryManager) AllocatePages(ctx context.Context, n int) ([]PageID, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("invalid page count %d", n)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	mm.mtx.Lock()
+	defer mm.mtx.Unlock()
+	if mm.closed {
+		return nil, ErrManagerClosed
+	}
+
+	pageIDs := make([]PageID, n)
+	for i := range pageIDs {
+		pageIDs[i] = PageID(len(mm.pages))
+		mm.pages = append(mm.pages, make([]byte, mm.pageSize))
+	}
+	return pageIDs, nil
+}
+
+// DeallocatePage обнуляет страницу и запоминает ее для повторной выдачи AllocatePage.
+func (mm *memoryManager) DeallocatePage(ctx context.Context, pageID PageID) error {
+	mm.mtx.Lock()
+	defer mm.mtx.Unlock()
+	if mm.closed {
+		return ErrManagerClosed
+	}
+	if pageID >= PageID(len(mm.pages)) {
+		return fmt.Errorf("%w: page %d, file has %d pages", ErrPageOutOfBounds, pageID, len(mm.pages))
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if slices.Contains(mm.free, pageID) {
+		return fmt.Errorf("%w: page %d is already deallocated", ErrPageNotAllocated, pageID)
+	}
+	clear(mm.pages[pageID])
+	mm.free = append(mm.free, pageID)
+	return nil
+}
+
+func (mm *memoryManager) ReadPage(ctx context.Context, pageID PageID, p []byte) error {
+	mm.mtx.RLock()
+	defer mm.mtx.RUnlock()
+	if err := mm.check(ctx, pageID, p); err != nil {
+		return err
+	}
+	copy(p, mm.pages[pageID])
+	return nil
+}
+
+func (mm *memoryManager) WritePage(ctx context.Context, pageID PageID, p []byte) error {
+	mm.mtx.Lock()
+	defer mm.mtx.Unlock()
+	if err := mm.check(ctx, pageID, p); err != nil {
+		return err
+	}
+	copy(mm.pages[pageID], p)
+	return nil
+}
+
+// WritePages проверяет весь пакет до записи, поэтому при ошибке проверки ни одна страница не записывается.
+func (mm *memoryManager) WritePages(ctx context.Context, pages []PageWrite) error {
+	mm.mtx.Lock()
+	defer mm.mtx.Unlock()
+	for _, pw := range pages {
+		if err := mm.check(ctx, pw.PageID, pw.Data); err != nil {
+			return err
+		}
+	}
+	for _, pw := range pages {
+		copy(mm.pages[pw.PageID], pw.Data)
+	}
+	return nil
+}
+
+func (mm *memoryManager) ForEachPage(ctx context.Context, fn func(pageID PageID, data []byte) error) error {
+	mm.mtx.RLock()
+	count := len(mm.pages)
+	mm.mtx.RUnlock()
+
+	buf := make([]byte, mm.pageSize)
+	for pageID := range PageID(count) {
+		if err := mm.ReadPage(ctx, pageID, buf); err != nil {
+			return err
+		}
+		if err := fn(pageID, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sync ничего не делает: страницы в памяти не сбрасываются.
+func (mm *memoryManager) Sync(ctx context.Context) error {
+	mm.mtx.RLock()
+	defer mm.mtx.RUnlock()
+	if mm.closed {
+		return ErrManagerClosed
+	}
+	return nil
+}
+
+func (mm *memoryManager) PageSize() int {
+	return mm.pageSize
+}
+
+func (mm *memoryManager) PageCount(ctx context.Context) (uint64, error) {
+	mm.mtx.RLock()
+	defer mm.mtx.RUnlock()
+	return uint64(len(mm.pages)), nil
+}
+
+// FileSize возвращает объем памяти, занятый страницами. Заголовка у менеджера в памяти нет.
+func (mm *memoryManager) FileSize(ctx context.Context) (int64, error) {
+	mm.mtx.RLock()
+	defer mm.mtx.RUnlock()
+	return int64(len(mm.pages)) * int64(mm.pageSize), nil
+}
+
+// Close освобождает страницы. После Close операции со страницами возвращают ErrManagerClosed.
+func (mm *memoryManager) Close(ctx context.Context) error {
+	mm.mtx.Lock()
+	defer mm.mtx.Unlock()
+	mm.pages = nil
+	mm.closed = true
+	return nil
+}
+
+// check проверяет контекст, размер буфера и границы страницы. Вызывается под mm.mtx.
+func (mm *memoryManager) check(ctx context.Context, pageID PageID, p []byte) error {
+	if mm.closed {
+		return ErrManagerClosed
+	}
+	if len(p) != mm.pageSize {
+		return fmt.Errorf("%w: got %d, want %d", ErrPageSizeMismatch, len(p), mm.pageSize)
+	}
+	if pageID >= PageID(len(mm.pages)) {
+		return fmt.Errorf("%w: page %d, file has %d pages", ErrPageOutOfBounds, pageID, len(mm.pages))
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,166 @@
+package page
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// Менеджер в памяти должен вести себя как diskManager, поэтому оба проходят одни и те же проверки
+func Test_Manager_RoundTripAndBounds(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const pageSize = 1024
+
+	managers := []struct {
+		name string
+		open func(t *testing.T) Manager
+	}{
+		{name: "disk", open: func(t *testing.T) Manager {
+			pm, err := NewDiskManager(ctx, filepath.Join(t.TempDir(), "test.db"), WithPageSize(pageSize))
+			if err != nil {
+				t.Fatalf("failed to create DiskManager: %v", err)
+			}
+			return pm
+		}},
+		{name: "memory", open: func(t *testing.T) Manager {
+			pm, err := NewMemoryManager(pageSize)
+			if err != nil {
+				t.Fatalf("failed to create MemoryManager: %v", err)
+			}
+			return pm
+		}},
+	}
+	for _, m := range managers {
+		t.Run(m.name, func(t *testing.T) {
+			t.Parallel()
+			pm := m.open(t)
+			t.Cleanup(func() {
+				pm.Close(ctx)
+			})
+
+			first, err := pm.AllocatePage(ctx)
+			if err != nil {
+				t.Fatalf("failed to allocate page: %v", err)
+			}
+			rest, err := pm.AllocatePages(ctx, 3)
+			if err != nil {
+				t.Fatalf("failed to allocate pages: %v", err)
+			}
+			if first != 0 || rest[0] != 1 || rest[2] != 3 {
+				t.Fatalf("expected pages 0-3, got %d and %v", first, rest)
+			}
+			if count, _ := pm.PageCount(ctx); count != 4 {
+				t.Fatalf("expected 4 pages, got %d", count)
+			}
+
+			buf := make([]byte, pageSize)
+			if err := pm.ReadPage(ctx, 2, buf); err != nil || !bytes.Equal(buf, make([]byte, pageSize)) {
+				t.Fatalf("expected a zeroed new page, got err %v", err)
+			}
+			data := bytes.Repeat([]byte{'a'}, pageSize)
+			if err := pm.WritePage(ctx, 2, data); err != nil {
+				t.Fatalf("failed to write page: %v", err)
+			}
+			batch := []PageWrite{
+				{PageID: 3, Data: bytes.Repeat([]byte{'c'}, pageSize)},
+				{PageID: 1, Data: bytes.Repeat([]byte{'b'}, pageSize)},
+			}
+			if err := pm.WritePages(ctx, batch); err != nil {
+				t.Fatalf("failed to write pages: %v", err)
+			}
+			if err := pm.Sync(ctx); err != nil {
+				t.Fatalf("failed to sync: %v", err)
+			}
+
+			want := []byte{0, 'b', 'a', 'c'}
+			var visited int
+			err = pm.ForEachPage(ctx, func(pageID PageID, data []byte) error {
+				if !bytes.Equal(data, bytes.Repeat([]byte{want[pageID]}, pageSize)) {
+					t.Errorf("page %d: read data does not match written data", pageID)
+				}
+				visited++
+				return nil
+			})
+			if err != nil || visited != len(want) {
+				t.Fatalf("ForEachPage visited %d pages, err %v", visited, err)
+			}
+
+			if err := pm.ReadPage(ctx, 4, buf); !errors.Is(err, ErrPageOutOfBounds) {
+				t.Fatalf("expected %v from ReadPage, got %v", ErrPageOutOfBounds, err)
+			}
+			if err := pm.WritePage(ctx, 4, buf); !errors.Is(err, ErrPageOutOfBounds) {
+				t.Fatalf("expected %v from WritePage, got %v", ErrPageOutOfBounds, err)
+			}
+			if err := pm.WritePages(ctx, []PageWrite{{PageID: 4, Data: buf}}); !errors.Is(err, ErrPageOutOfBounds) {
+				t.Fatalf("expected %v from WritePages, got %v", ErrPageOutOfBounds, err)
+			}
+			if err := pm.ReadPage(ctx, 0, buf[:pageSize-1]); !errors.Is(err, ErrPageSizeMismatch) {
+				t.Fatalf("expected %v from ReadPage, got %v", ErrPageSizeMismatch, err)
+			}
+			if err := pm.WritePage(ctx, 0, buf[:pageSize-1]); !errors.Is(err, ErrPageSizeMismatch) {
+				t.Fatalf("expected %v from WritePage, got %v", ErrPageSizeMismatch, err)
+			}
+
+			// Освобожденные страницы обнуляются и выдаются снова в порядке освобождения
+			for _, pageID := range []PageID{2, 1} {
+				if err := pm.DeallocatePage(ctx, pageID); err != nil {
+					t.Fatalf("failed to deallocate page %d: %v", pageID, err)
+				}
+			}
+			if err := pm.DeallocatePage(ctx, 2); !errors.Is(err, ErrPageNotAllocated) {
+				t.Fatalf("expected %v on repeated deallocation, got %v", ErrPageNotAllocated, err)
+			}
+			if err := pm.DeallocatePage(ctx, 4); !errors.Is(err, ErrPageOutOfBounds) {
+				t.Fatalf("expected %v from DeallocatePage, got %v", ErrPageOutOfBounds, err)
+			}
+			for _, want := range []PageID{2, 1, 4} {
+				pageID, err := pm.AllocatePage(ctx)
+				if err != nil || pageID != want {
+					t.Fatalf("expected page %d to be allocated, got %d, %v", want, pageID, err)
+				}
+			}
+			if err := pm.ReadPage(ctx, 2, buf); err != nil || !bytes.Equal(buf, make([]byte, pageSize)) {
+				t.Fatalf("expected a zeroed reused page, got err %v", err)
+			}
+			if count, _ := pm.PageCount(ctx); count != 5 {
+				t.Fatalf("expected 5 pages, got %d", count)
+			}
+
+			canceled, cancel := context.WithCancel(ctx)
+			cancel()
+			if err := pm.ReadPage(canceled, 0, buf); !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected %v from ReadPage, got %v", context.Canceled, err)
+			}
+		})
+	}
+}
+
+func Test_memoryManager_Close(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	if _, err := NewMemoryManager(1000); !errors.Is(err, ErrInvalidPageSize) {
+		t.Fatalf("expected %v, got %v", ErrInvalidPageSize, err)
+	}
+
+	pm, err := NewMemoryManager(DefaultPageSize)
+	if err != nil {
+		t.Fatalf("failed to create MemoryManager: %v", err)
+	}
+	pageID, err := pm.AllocatePage(ctx)
+	if err != nil {
+		t.Fatalf("failed to allocate page: %v", err)
+	}
+	if err := pm.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := pm.ReadPage(ctx, pageID, make([]byte, DefaultPageSize)); !errors.Is(err, ErrManagerClosed) {
+		t.Fatalf("expected %v after Close, got %v", ErrManagerClosed, err)
+	}
+	if _, err := pm.AllocatePage(ctx); !errors.Is(err, ErrManagerClosed) {
+		t.Fatalf("expected %v after Close, got %v", ErrManagerClosed, err)
+	}
+}
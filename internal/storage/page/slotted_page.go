@@ -3,18 +3,92 @@ package page
 import (
 	"encoding/binary"
 	"fmt"
+	"strings"
+	"text/tabwriter"
 )
 
 var ErrPageFull = fmt.Errorf("page is full")
+var ErrTupleDeleted = fmt.Errorf("tuple is deleted")
+var ErrCorruptPage = fmt.Errorf("corrupt slotted page")
+var ErrPageTypeMismatch = fmt.Errorf("unexpected page type")
 
+// Заголовок страницы:
+// [ SlotCount (2 байта) ] [ FreeSpacePointer (4 байта) ] [ SlotFormat (1 байт) ] [ PageType (1 байт) ]
 const (
 	slotCountOffset        = 0
 	freeSpacePointerOffset = 2
+	slotFormatOffset       = 6
+	pageTypeOffset         = 7
 
 	slotCountSize        = 2
-	freeSpacePointerSize = 2
-	headerSize           = slotCountSize + freeSpacePointerSize
-	slotSize             = 4
+	freeSpacePointerSize = 4
+	slotFormatSize       = 1
+	pageTypeSize         = 1
+	headerSize           = slotCountSize + freeSpacePointerSize + slotFormatSize + pageTypeSize
+)
+
+// PageType — вид страницы, хранится в ее заголовке, чтобы при восстановлении и отладке
+// страницы разного назначения можно было отличить друг от друга.
+type PageType uint8
+
+const (
+	// PageTypeUnknown — тип непроинициализированной страницы, заполненной нулями
+	PageTypeUnknown PageType = iota
+	// PageTypeHeap — страница heap-файла
+	PageTypeHeap
+	// PageTypeIndex — упорядоченная страница индекса, см. NewSortedSlottedPage
+	PageTypeIndex
+)
+
+func (t PageType) String() string {
+	switch t {
+	case PageTypeUnknown:
+		return "unknown"
+	case PageTypeHeap:
+		return "heap"
+	case PageTypeIndex:
+		return "index"
+	default:
+		return fmt.Sprintf("PageType(%d)", uint8(t))
+	}
+}
+
+// SlotFormat — схема упаковки слота, выбирается при инициализации страницы и хранится в ее заголовке.
+type SlotFormat uint8
+
+const (
+	// SlotFormatCompact — 4-байтовый слот с 15-битными смещением и длиной, для страниц до 32KB
+	SlotFormatCompact SlotFormat = iota
+	// SlotFormatWide — 8-байтовый слот с 32-битным смещением и 30-битной длиной, для больших страниц
+	SlotFormatWide
+)
+
+// SlotFormatFor возвращает схему упаковки слотов для страниц размера pageSize:
+// компактную, если смещения помещаются в ее 15 бит, иначе широкую
+func SlotFormatFor(pageSize int) SlotFormat {
+	if pageSize <= maxCompactPageSize {
+		return SlotFormatCompact
+	}
+	return SlotFormatWide
+}
+
+func (f SlotFormat) String() string {
+	switch f {
+	case SlotFormatCompact:
+		return "compact"
+	case SlotFormatWide:
+		return "wide"
+	default:
+		return fmt.Sprintf("SlotFormat(%d)", uint8(f))
+	}
+}
+
+const (
+	compactSlotSize = 4
+	wideSlotSize    = 8
+
+	// maxCompactPageSize — наибольший размер страницы, смещения в которой помещаются в 15 бит
+	maxCompactPageSize = 1 << 15
 )
 
 type slotFlag uint8
@@ -25,6 +99,19 @@ const (
 	slotUnused slotFlag = 2
 )
 
+func (f slotFlag) String() string {
+	switch f {
+	case slotUsed:
+		return "used"
+	case slotDead:
+		return "dead"
+	case slotUnused:
+		return "unused"
+	default:
+		return fmt.Sprintf("slotFlag(%d)", uint8(f))
+	}
+}
+
 type slottedPage struct {
 	data []byte
 }
@@ -34,10 +121,67 @@ func NewSlottedPage(data []byte) *slottedPage {
 	return &slottedPage{data: data}
 }
 
-// Init инициализирует заголовки новой пустой страницы
-func (sp *slottedPage) Init() {
+// LoadSlottedPage создает обертку над содержимым страницы, прочитанной с диска,
+// и проверяет, что в заголовке записан тип want. Иначе возвращает ErrPageTypeMismatch.
+func LoadSlottedPage(data []byte, want PageType) (*slottedPage, error) {
+	sp := NewSlottedPage(data)
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("%w: page size %d is smaller than header", ErrCorruptPage, len(data))
+	}
+	if got := sp.PageType(); got != want {
+		return nil, fmt.Errorf("%w: %s, expected %s", ErrPageTypeMismatch, got, want)
+	}
+	return sp, nil
+}
+
+// MaxTupleSize возвращает длину наибольшего кортежа, который помещается в пустую страницу
+// размера pageSize со схемой упаковки слотов format
+func MaxTupleSize(pageSize int, format SlotFormat) int {
+	slotSize := compactSlotSize
+	if format == SlotFormatWide {
+		slotSize = wideSlotSize
+	}
+	return pageSize - headerSize - slotSize
+}
+
+// Init инициализирует заголовки новой пустой heap-страницы с заданной схемой упаковки слотов
+func (sp *slottedPage) Init(format SlotFormat) error {
+	return sp.initAs(PageTypeHeap, format)
+}
+
+// initAs инициализирует заголовки новой пустой страницы типа pageType
+func (sp *slottedPage) initAs(pageType PageType, format SlotFormat) error {
+	// Больше MaxPageSize страница быть не может: иначе количество слотов не поместится в SlotCount
+	if len(sp.data) > MaxPageSize {
+		return fmt.Errorf("page size %d is larger than %d", len(sp.data), MaxPageSize)
+	}
+	switch format {
+	case SlotFormatCompact:
+		if len(sp.data) > maxCompactPageSize {
+			return fmt.Errorf("page size %d is too large for compact slot format", len(sp.data))
+		}
+	case SlotFormatWide:
+	default:
+		return fmt.Errorf("unknown slot format %d", format)
+	}
+
 	sp.setSlotCount(0)
-	sp.setFreeSpacePointer(uint16(len(sp.data)))
+	sp.setFreeSpacePointer(len(sp.data))
+	sp.data[slotFormatOffset] = byte(format)
+	sp.data[pageTypeOffset] = byte(pageType)
+	return nil
+}
+
+// PageType возвращает тип страницы из заголовка
+func (sp *slottedPage) PageType() PageType {
+	return PageType(sp.data[pageTypeOffset])
+}
+
+// Initialized сообщает, проинициализирована ли страница. Страница, выделенная в файле,
+// но не сброшенная на диск до сбоя, читается нулями, а у проинициализированной страницы
+// указатель свободного места не бывает нулевым.
+func (sp *slottedPage) Initialized() bool {
+	return sp.freeSpacePointer() != 0
 }
 
 // InsertTuple добавляет кортеж и возвращает его SlotID
@@ -71,19 +215,19 @@ func (sp *slottedPage) findSlotID() uint16 {
 // isAvailableSpace быстрая проверка наличия свободного места на странице
 func (sp *slottedPage) isAvailableSpace(slotID uint16, tupleLen int) bool {
 	slotCount := sp.slotCount()
-	freeSpacePointer := sp.freeSpacePointer()
-	slotsEndPointer := headerSize + slotSize*slotCount
-	newSlotSize := slotSize
+	slotsEndPointer := sp.slotOffset(slotCount)
+	newSlotSize := sp.slotSize()
 	if slotID < slotCount {
 		newSlotSize = 0
 	}
-	return (freeSpacePointer - slotsEndPointer) >= uint16(tupleLen+newSlotSize)
+	return sp.freeSpacePointer()-slotsEndPointer >= tupleLen+newSlotSize
 }
 
 // isAvailableTotalSpace полная проверка наличия свободного места на странице
 func (sp *slottedPage) isAvailableTotalSpace(slotID uint16, tupleLen int) bool {
+	slotSize := sp.slotSize()
 	slotCount := sp.slotCount()
-	var liveTuplesSize uint16
+	liveTuplesSize := 0
 	for i := range slotCount {
 		_, length, flags := sp.unpackSlot(i)
 		if flags != slotUnused {
@@ -91,33 +235,55 @@ func (sp *slottedPage) isAvailableTotalSpace(slotID uint16, tupleLen int) bool {
 		}
 	}
 
-	availableTotalSpace := uint16(len(sp.data)) - uint16(headerSize) - (slotCount * slotSize) - liveTuplesSize
+	availableTotalSpace := len(sp.data) - headerSize - int(slotCount)*slotSize - liveTuplesSize
 	newSlotSize := slotSize
 	if slotID < slotCount {
 		newSlotSize = 0
 	}
-	return availableTotalSpace >= uint16(tupleLen+newSlotSize)
+	return availableTotalSpace >= tupleLen+newSlotSize
+}
+
+// FreeSpace возвращает длину наибольшего кортежа, который InsertTuple разместит на странице,
+// с учетом места, освобождаемого compact
+func (sp *slottedPage) FreeSpace() int {
+	slotSize := sp.slotSize()
+	slotCount := sp.slotCount()
+	liveTuplesSize := 0
+	for i := range slotCount {
+		_, length, flags := sp.unpackSlot(i)
+		if flags != slotUnused {
+			liveTuplesSize += length
+		}
+	}
+
+	free := len(sp.data) - headerSize - int(slotCount)*slotSize - liveTuplesSize
+	if sp.findSlotID() == slotCount {
+		free -= slotSize
+	}
+	return max(free, 0)
 }
 
 func (sp *slottedPage) insertTuple(slotID uint16, tuple []byte) {
+	slotSize := sp.slotSize()
 	slotCount := sp.slotCount()
-	freeSpacePointer := sp.freeSpacePointer()
-	newSlotPointer := headerSize + slotSize*slotID
+	offset := sp.freeSpacePointer() - len(tuple)
+	newSlotPointer := sp.slotOffset(slotID)
 
 	// Вставляем кортеж
-	copy(sp.data[freeSpacePointer-uint16(len(tuple)):freeSpacePointer], tuple)
+	copy(sp.data[offset:offset+len(tuple)], tuple)
 
 	// Вставляем слот
-	writeSlot(freeSpacePointer-uint16(len(tuple)), len(tuple), slotUsed, sp.data[newSlotPointer:newSlotPointer+slotSize])
+	writeSlot(sp.slotFormat(), offset, len(tuple), slotUsed, sp.data[newSlotPointer:newSlotPointer+slotSize])
 
 	// Обновляем заголовки
-	sp.setFreeSpacePointer(freeSpacePointer - uint16(len(tuple)))
+	sp.setFreeSpacePointer(offset)
 	if slotID >= slotCount {
 		sp.setSlotCount(slotCount + 1)
 	}
 }
 
 func (sp *slottedPage) compact() {
+	slotSize := sp.slotSize()
 	type usedTuple struct {
 		slotID uint16
 		flags  slotFlag
@@ -142,26 +308,34 @@ func (sp *slottedPage) compact() {
 	}
 
 	// Перезаписываем страницу
-	freeSpacePointer := uint16(len(sp.data))
+	freeSpacePointer := len(sp.data)
 	sp.setFreeSpacePointer(freeSpacePointer)
 	for _, usedTuple := range usedTuples {
-		copy(sp.data[freeSpacePointer-uint16(len(usedTuple.tuple)):freeSpacePointer], usedTuple.tuple)
+		copy(sp.data[freeSpacePointer-len(usedTuple.tuple):freeSpacePointer], usedTuple.tuple)
 
-		pointerToSlot := headerSize + slotSize*usedTuple.slotID
-		writeSlot(freeSpacePointer-uint16(len(usedTuple.tuple)), len(usedTuple.tuple), usedTuple.flags, sp.data[pointerToSlot:pointerToSlot+slotSize])
+		pointerToSlot := sp.slotOffset(usedTuple.slotID)
+		writeSlot(sp.slotFormat(), freeSpacePointer-len(usedTuple.tuple), len(usedTuple.tuple), usedTuple.flags, sp.data[pointerToSlot:pointerToSlot+slotSize])
 
-		freeSpacePointer -= uint16(len(usedTuple.tuple))
+		freeSpacePointer -= len(usedTuple.tuple)
 	}
 	sp.setFreeSpacePointer(freeSpacePointer)
 }
 
-// GetTuple возвращает данные кортежа по SlotID
+// GetTuple возвращает данные кортежа по SlotID.
+// Для удаленного или неиспользуемого слота возвращает ErrTupleDeleted,
+// для слота, выходящего за границу страницы, — ErrCorruptPage.
 func (sp *slottedPage) GetTuple(slotID uint16) ([]byte, error) {
-	if slotID > sp.slotCount() {
+	if slotID >= sp.slotCount() {
 		return nil, fmt.Errorf("slotID %d is out of bounds", slotID)
 	}
 
-	offset, length, _ := sp.unpackSlot(slotID)
+	offset, length, flags := sp.unpackSlot(slotID)
+	if flags != slotUsed {
+		return nil, ErrTupleDeleted
+	}
+	if offset+length > len(sp.data) {
+		return nil, fmt.Errorf("%w: slot %d points to [%d, %d) outside of page", ErrCorruptPage, slotID, offset, offset+length)
+	}
 	return sp.data[offset : offset+length], nil
 }
 
@@ -176,19 +350,94 @@ func (sp *slottedPage) SetTupleAsUnused(slotID uint16) error {
 }
 
 func (sp *slottedPage) setFlagToSlot(slotID uint16, flag slotFlag) error {
-	if slotID > sp.slotCount() {
+	slotSize := sp.slotSize()
+	if slotID >= sp.slotCount() {
 		return fmt.Errorf("slotID %d is out of bounds", slotID)
 	}
 
-	pointerToSlot := headerSize + slotSize*slotID
+	pointerToSlot := sp.slotOffset(slotID)
+	// В обеих схемах флаги занимают два младших бита первого байта слота
 	slot := sp.data[pointerToSlot : pointerToSlot+slotSize]
-	val := binary.LittleEndian.Uint32(slot)
-	val = val &^ 3           // маска для очистки двух младших бит
-	val = val | uint32(flag) // установка флага
-	binary.LittleEndian.PutUint32(slot, val)
+	slot[0] = slot[0]&^3 | byte(flag)
+	return nil
+}
+
+// Validate проверяет структурную целостность страницы: известную схему слотов,
+// указатель свободного места и границы кортежей всех используемых слотов
+func (sp *slottedPage) Validate() error {
+	if len(sp.data) < headerSize {
+		return fmt.Errorf("%w: page size %d is smaller than header", ErrCorruptPage, len(sp.data))
+	}
+	if format := sp.slotFormat(); format != SlotFormatCompact && format != SlotFormatWide {
+		return fmt.Errorf("%w: unknown slot format %d", ErrCorruptPage, format)
+	}
+	if pageType := sp.PageType(); pageType != PageTypeHeap && pageType != PageTypeIndex {
+		return fmt.Errorf("%w: unknown page type %d", ErrCorruptPage, pageType)
+	}
+
+	slotsEnd := sp.slotOffset(sp.slotCount())
+	freeSpacePointer := sp.freeSpacePointer()
+	if slotsEnd > len(sp.data) {
+		return fmt.Errorf("%w: %d slots do not fit into page", ErrCorruptPage, sp.slotCount())
+	}
+	if freeSpacePointer < slotsEnd || freeSpacePointer > len(sp.data) {
+		return fmt.Errorf("%w: free space pointer %d is out of range [%d, %d]", ErrCorruptPage, freeSpacePointer, slotsEnd, len(sp.data))
+	}
+
+	for i := range sp.slotCount() {
+		offset, length, flags := sp.unpackSlot(i)
+		if flags == slotUnused {
+			continue
+		}
+		if offset < freeSpacePointer || offset+length > len(sp.data) {
+			return fmt.Errorf("%w: slot %d points to [%d, %d) outside of tuple area", ErrCorruptPage, i, offset, offset+length)
+		}
+	}
 	return nil
 }
 
+// Dump выводит заголовок страницы и таблицу слотов со смещением, длиной и флагом каждого.
+// Предназначен для отладки: поврежденная страница выводится, насколько это возможно,
+// с результатом Validate, а слоты, выходящие за границу страницы, пропускаются.
+func (sp *slottedPage) Dump() string {
+	if len(sp.data) < headerSize {
+		return fmt.Sprintf("page size %d is smaller than header", len(sp.data))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "page type: %s\n", sp.PageType())
+	fmt.Fprintf(&b, "slot format: %s\n", sp.slotFormat())
+	fmt.Fprintf(&b, "slot count: %d\n", sp.slotCount())
+	fmt.Fprintf(&b, "free space pointer: %d\n", sp.freeSpacePointer())
+	err := sp.Validate()
+	if err != nil {
+		fmt.Fprintf(&b, "validate: %v\n", err)
+	} else {
+		// FreeSpace обходит все слоты, поэтому на поврежденной странице не вызывается
+		fmt.Fprintf(&b, "free space: %d\n", sp.FreeSpace())
+		b.WriteString("validate: ok\n")
+	}
+
+	slotSize := sp.slotSize()
+	fitting := min(int(sp.slotCount()), (len(sp.data)-headerSize)/slotSize)
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "slot\toffset\tlength\tflag")
+	for i := range uint16(fitting) {
+		offset, length, flags := sp.unpackSlot(i)
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%s\n", i, offset, length, flags)
+	}
+	tw.Flush()
+	if fitting < int(sp.slotCount()) {
+		fmt.Fprintf(&b, "slots %d-%d do not fit into page\n", fitting, sp.slotCount()-1)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// SlotCount возвращает количество слотов на странице, включая удаленные
+func (sp *slottedPage) SlotCount() uint16 {
+	return sp.slotCount()
+}
+
 func (sp *slottedPage) setSlotCount(c uint16) {
 	binary.LittleEndian.PutUint16(sp.data[slotCountOffset:slotCountOffset+slotCountSize], c)
 }
@@ -197,31 +446,64 @@ func (sp *slottedPage) slotCount() uint16 {
 	return binary.LittleEndian.Uint16(sp.data[slotCountOffset : slotCountOffset+slotCountSize])
 }
 
-func (sp *slottedPage) setFreeSpacePointer(p uint16) {
-	binary.LittleEndian.PutUint16(sp.data[freeSpacePointerOffset:freeSpacePointerOffset+freeSpacePointerSize], p)
+func (sp *slottedPage) setFreeSpacePointer(p int) {
+	binary.LittleEndian.PutUint32(sp.data[freeSpacePointerOffset:freeSpacePointerOffset+freeSpacePointerSize], uint32(p))
+}
+
+func (sp *slottedPage) freeSpacePointer() int {
+	return int(binary.LittleEndian.Uint32(sp.data[freeSpacePointerOffset : freeSpacePointerOffset+freeSpacePointerSize]))
 }
 
-func (sp *slottedPage) freeSpacePointer() uint16 {
-	return binary.LittleEndian.Uint16(sp.data[freeSpacePointerOffset : freeSpacePointerOffset+freeSpacePointerSize])
+// slotOffset возвращает смещение слота slotID от начала страницы
+func (sp *slottedPage) slotOffset(slotID uint16) int {
+	return headerSize + sp.slotSize()*int(slotID)
 }
 
 // unpackSlot распаковывает слот
-func (sp *slottedPage) unpackSlot(slotID uint16) (offset uint16, length uint16, flags slotFlag) {
-	pointerToSlot := headerSize + slotSize*slotID
-	slot := sp.data[pointerToSlot : pointerToSlot+slotSize]
-	val := binary.LittleEndian.Uint32(slot)
+func (sp *slottedPage) unpackSlot(slotID uint16) (offset int, length int, flags slotFlag) {
+	pointerToSlot := sp.slotOffset(slotID)
+	slot := sp.data[pointerToSlot : pointerToSlot+sp.slotSize()]
+
+	if sp.slotFormat() == SlotFormatCompact {
+		val := binary.LittleEndian.Uint32(slot)
+		offset = int(val >> 17)
+		length = int(val>>2) & 0x7FFF // маска для 15 бит
+		flags = slotFlag(val) & 3     // маска для 2 бит
+		return
+	}
 
-	offset = uint16(val >> 17)
-	length = uint16(val>>2) & 0x7FFF // маска для 15 бит
-	flags = slotFlag(val) & 3        // маска для 2 бит
+	val := binary.LittleEndian.Uint64(slot)
+	offset = int(val >> 32)
+	length = int(val>>2) & 0x3FFFFFFF // маска для 30 бит
+	flags = slotFlag(val) & 3         // маска для 2 бит
 	return
 }
 
-// writeSlot формирует слот
-func writeSlot(offset uint16, length int, flags slotFlag, data []byte) {
+func (sp *slottedPage) slotFormat() SlotFormat {
+	return SlotFormat(sp.data[slotFormatOffset])
+}
+
+func (sp *slottedPage) slotSize() int {
+	if sp.slotFormat() == SlotFormatCompact {
+		return compactSlotSize
+	}
+	return wideSlotSize
+}
+
+// writeSlot формирует слот в заданной схеме упаковки
+func writeSlot(format SlotFormat, offset int, length int, flags slotFlag, data []byte) {
+	if format == SlotFormatCompact {
+		// Схема упаковки:
+		// [ Offset (15 бит) ] [ Length (15 бит) ] [ Flags (2 бита) ]
+		// Биты: 31.........17 16................2 1................0
+		packed := (uint32(offset) << 17) | (uint32(length) << 2) | uint32(flags)
+		binary.LittleEndian.PutUint32(data, packed)
+		return
+	}
+
 	// Схема упаковки:
-	// [ Offset (15 бит) ] [ Length (15 бит) ] [ Flags (2 бита) ]
-	// Биты: 31.........17 16................2 1................0
-	packed := (uint32(offset) << 17) | (uint32(length) << 2) | uint32(flags)
-	binary.LittleEndian.PutUint32(data, packed)
+	// [ Offset (32 бита) ] [ Length (30 бит) ] [ Flags (2 бита) ]
+	// Биты: 63..........32 31................2 1................0
+	packed := (uint64(offset) << 32) | (uint64(length) << 2) | uint64(flags)
+	binary.LittleEndian.PutUint64(data, packed)
 }
@@ -2,7 +2,9 @@ package page
 
 import (
 	"bytes"
+	"errors"
 	"math/rand"
+	"strings"
 	"testing"
 	"time"
 )
@@ -13,7 +15,7 @@ func Test_slottedPage(t *testing.T) {
 
 	pageData := make([]byte, 100)
 	slottedPage := NewSlottedPage(pageData)
-	slottedPage.Init()
+	slottedPage.Init(SlotFormatCompact)
 
 	tuple1 := make([]byte, 5)
 	rnd.Read(tuple1)
@@ -38,7 +40,7 @@ func Test_slottedPage_compact(t *testing.T) {
 
 	pageData := make([]byte, 70)
 	sp := NewSlottedPage(pageData)
-	sp.Init()
+	sp.Init(SlotFormatCompact)
 
 	tupleA := bytes.Repeat([]byte{0xAA}, 10)
 	slotA, err := sp.InsertTuple(tupleA)
@@ -81,9 +83,10 @@ func Test_slottedPage_full(t *testing.T) {
 	t.Parallel()
 	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
 
-	pageData := make([]byte, 20)
+	// Заголовок, один слот и один кортеж
+	pageData := make([]byte, headerSize+compactSlotSize+10)
 	sp := NewSlottedPage(pageData)
-	sp.Init()
+	sp.Init(SlotFormatCompact)
 
 	tuple1 := make([]byte, 10)
 	rnd.Read(tuple1)
@@ -99,3 +102,274 @@ func Test_slottedPage_full(t *testing.T) {
 		t.Fatalf("expected PageFullErr, got %v", err)
 	}
 }
+
+func Test_slottedPage_FreeSpace(t *testing.T) {
+	t.Parallel()
+
+	pageData := make([]byte, 100)
+	sp := NewSlottedPage(pageData)
+	sp.Init(SlotFormatCompact)
+
+	if got, want := sp.FreeSpace(), 100-headerSize-compactSlotSize; got != want {
+		t.Fatalf("empty page: expected %d, got %d", want, got)
+	}
+
+	slotID, err := sp.InsertTuple(make([]byte, sp.FreeSpace()))
+	if err != nil {
+		t.Fatalf("insert tuple of FreeSpace bytes: %v", err)
+	}
+	if got := sp.FreeSpace(); got != 0 {
+		t.Fatalf("full page: expected 0, got %d", got)
+	}
+
+	// Удаленный кортеж занимает место до тех пор, пока слот не станет неиспользуемым
+	sp.DeleteTuple(slotID)
+	if got := sp.FreeSpace(); got != 0 {
+		t.Fatalf("page with dead tuple: expected 0, got %d", got)
+	}
+	sp.SetTupleAsUnused(slotID)
+	if got, want := sp.FreeSpace(), 100-headerSize-compactSlotSize; got != want {
+		t.Fatalf("page with unused slot: expected %d, got %d", want, got)
+	}
+	if _, err := sp.InsertTuple(make([]byte, sp.FreeSpace())); err != nil {
+		t.Fatalf("insert into reclaimed page: %v", err)
+	}
+}
+
+func Test_slottedPage_outOfBounds(t *testing.T) {
+	t.Parallel()
+
+	pageData := make([]byte, 100)
+	sp := NewSlottedPage(pageData)
+	sp.Init(SlotFormatCompact)
+
+	if _, err := sp.InsertTuple(bytes.Repeat([]byte{0xAA}, 10)); err != nil {
+		t.Fatalf("insert tuple: %v", err)
+	}
+
+	slotCount := sp.slotCount()
+	if _, err := sp.GetTuple(slotCount); err == nil {
+		t.Fatalf("expected out of bounds error for GetTuple(%d)", slotCount)
+	}
+	if err := sp.DeleteTuple(slotCount); err == nil {
+		t.Fatalf("expected out of bounds error for DeleteTuple(%d)", slotCount)
+	}
+}
+
+func Test_slottedPage_largePage(t *testing.T) {
+	t.Parallel()
+
+	// Смещение первого кортежа и длина второго не помещаются в 16 бит
+	pageData := make([]byte, MaxPageSize)
+	sp := NewSlottedPage(pageData)
+	if err := sp.Init(SlotFormatWide); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	small := bytes.Repeat([]byte{0xAA}, 10)
+	smallID, err := sp.InsertTuple(small)
+	if err != nil {
+		t.Fatalf("insert small tuple: %v", err)
+	}
+
+	large := bytes.Repeat([]byte{0xBB}, 100_000)
+	largeID, err := sp.InsertTuple(large)
+	if err != nil {
+		t.Fatalf("insert large tuple: %v", err)
+	}
+
+	gotSmall, err := sp.GetTuple(smallID)
+	if err != nil {
+		t.Fatalf("get small tuple: %v", err)
+	}
+	if !bytes.Equal(gotSmall, small) {
+		t.Fatalf("small tuple corrupted: expected %d bytes of 0xAA, got %v", len(small), gotSmall)
+	}
+
+	gotLarge, err := sp.GetTuple(largeID)
+	if err != nil {
+		t.Fatalf("get large tuple: %v", err)
+	}
+	if !bytes.Equal(gotLarge, large) {
+		t.Fatalf("large tuple corrupted: expected %d bytes, got %d", len(large), len(gotLarge))
+	}
+}
+
+func Test_slottedPage_slotFormats(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		format   SlotFormat
+		pageSize int
+	}{
+		{name: "compact", format: SlotFormatCompact, pageSize: DefaultPageSize},
+		{name: "wide", format: SlotFormatWide, pageSize: MaxPageSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sp := NewSlottedPage(make([]byte, tt.pageSize))
+			if err := sp.Init(tt.format); err != nil {
+				t.Fatalf("init: %v", err)
+			}
+
+			tuples := [][]byte{
+				bytes.Repeat([]byte{0x11}, 100),
+				bytes.Repeat([]byte{0x22}, 7),
+				bytes.Repeat([]byte{0x33}, 1000),
+			}
+			slotIDs := make([]uint16, len(tuples))
+			for i, tuple := range tuples {
+				slotID, err := sp.InsertTuple(tuple)
+				if err != nil {
+					t.Fatalf("insert tuple %d: %v", i, err)
+				}
+				slotIDs[i] = slotID
+			}
+
+			if err := sp.DeleteTuple(slotIDs[1]); err != nil {
+				t.Fatalf("delete tuple: %v", err)
+			}
+			if _, _, flags := sp.unpackSlot(slotIDs[1]); flags != slotDead {
+				t.Fatalf("expected slot to be dead, got flags %d", flags)
+			}
+
+			if _, err := sp.GetTuple(slotIDs[1]); !errors.Is(err, ErrTupleDeleted) {
+				t.Fatalf("expected %v for deleted tuple, got %v", ErrTupleDeleted, err)
+			}
+
+			for i, tuple := range tuples {
+				if i == 1 {
+					continue
+				}
+				got, err := sp.GetTuple(slotIDs[i])
+				if err != nil {
+					t.Fatalf("get tuple %d: %v", i, err)
+				}
+				if !bytes.Equal(got, tuple) {
+					t.Fatalf("tuple %d corrupted: expected %d bytes, got %d", i, len(tuple), len(got))
+				}
+			}
+		})
+	}
+}
+
+func Test_slottedPage_compactFormatTooLarge(t *testing.T) {
+	t.Parallel()
+
+	sp := NewSlottedPage(make([]byte, 40000))
+	if err := sp.Init(SlotFormatCompact); err == nil {
+		t.Fatalf("expected error initializing large page with compact slot format")
+	}
+	if got := SlotFormatFor(40000); got != SlotFormatWide {
+		t.Fatalf("expected %s slot format for a large page, got %s", SlotFormatWide, got)
+	}
+	if got := SlotFormatFor(DefaultPageSize); got != SlotFormatCompact {
+		t.Fatalf("expected %s slot format for a default page, got %s", SlotFormatCompact, got)
+	}
+
+	// Слоты страницы больше MaxPageSize не поместились бы в 16-битный SlotCount
+	sp = NewSlottedPage(make([]byte, 2*MaxPageSize))
+	if err := sp.Init(SlotFormatWide); err == nil {
+		t.Fatalf("expected error initializing page larger than MaxPageSize")
+	}
+}
+
+func Test_slottedPage_Validate(t *testing.T) {
+	t.Parallel()
+
+	sp := NewSlottedPage(make([]byte, 100))
+	sp.Init(SlotFormatCompact)
+	slotID, err := sp.InsertTuple(bytes.Repeat([]byte{0xAA}, 10))
+	if err != nil {
+		t.Fatalf("insert tuple: %v", err)
+	}
+	if err := sp.Validate(); err != nil {
+		t.Fatalf("expected valid page, got %v", err)
+	}
+
+	// Слот указывает за пределы страницы
+	pointerToSlot := headerSize + compactSlotSize*slotID
+	writeSlot(SlotFormatCompact, 95, 10, slotUsed, sp.data[pointerToSlot:pointerToSlot+compactSlotSize])
+	if err := sp.Validate(); !errors.Is(err, ErrCorruptPage) {
+		t.Fatalf("expected %v for slot out of bounds, got %v", ErrCorruptPage, err)
+	}
+
+	// Указатель свободного места за пределами страницы
+	sp.Init(SlotFormatCompact)
+	sp.setFreeSpacePointer(200)
+	if err := sp.Validate(); !errors.Is(err, ErrCorruptPage) {
+		t.Fatalf("expected %v for free space pointer out of range, got %v", ErrCorruptPage, err)
+	}
+}
+
+func Test_slottedPage_PageType(t *testing.T) {
+	t.Parallel()
+
+	data := make([]byte, 200)
+	sp := NewSlottedPage(data)
+	if got := sp.PageType(); got != PageTypeUnknown {
+		t.Fatalf("expected zeroed page to have type %v, got %v", PageTypeUnknown, got)
+	}
+	sp.Init(SlotFormatCompact)
+	for i := range 5 {
+		if _, err := sp.InsertTuple(bytes.Repeat([]byte{byte(i)}, 20)); err != nil {
+			t.Fatalf("insert tuple: %v", err)
+		}
+	}
+	sp.DeleteTuple(1)
+	sp.compact()
+
+	// Тип переживает изменения страницы и копирование ее содержимого, как при записи на диск
+	loaded, err := LoadSlottedPage(bytes.Clone(data), PageTypeHeap)
+	if err != nil {
+		t.Fatalf("expected heap page to load, got %v", err)
+	}
+	if got := loaded.PageType(); got != PageTypeHeap {
+		t.Fatalf("expected type %v, got %v", PageTypeHeap, got)
+	}
+	if _, err := LoadSlottedPage(data, PageTypeIndex); !errors.Is(err, ErrPageTypeMismatch) {
+		t.Fatalf("expected %v loading heap page as index, got %v", ErrPageTypeMismatch, err)
+	}
+
+	index := make([]byte, 200)
+	NewSortedSlottedPage(index, firstByteKey).Init(SlotFormatCompact)
+	if _, err := LoadSlottedPage(index, PageTypeHeap); !errors.Is(err, ErrPageTypeMismatch) {
+		t.Fatalf("expected %v loading index page as heap, got %v", ErrPageTypeMismatch, err)
+	}
+
+	data[pageTypeOffset] = 0xFF
+	if err := sp.Validate(); !errors.Is(err, ErrCorruptPage) {
+		t.Fatalf("expected %v for unknown page type, got %v", ErrCorruptPage, err)
+	}
+}
+
+func Test_slottedPage_Dump(t *testing.T) {
+	t.Parallel()
+	sp := NewSlottedPage(make([]byte, 100))
+	sp.Init(SlotFormatCompact)
+	sp.InsertTuple([]byte("hello"))
+	sp.InsertTuple([]byte("world!"))
+	sp.DeleteTuple(0)
+
+	expected := `page type: heap
+slot format: compact
+slot count: 2
+free space pointer: 89
+free space: 69
+validate: ok
+slot  offset  length  flag
+0     95      5       dead
+1     89      6       used`
+	if got := sp.Dump(); got != expected {
+		t.Fatalf("expected dump\n%s\ngot\n%s", expected, got)
+	}
+
+	// Слоты, не помещающиеся в страницу, не читаются за ее границей
+	sp.setSlotCount(1000)
+	if got := sp.Dump(); !strings.Contains(got, "validate: corrupt slotted page") || !strings.Contains(got, "slots 23-999 do not fit into page") {
+		t.Fatalf("expected dump of a corrupt page to report it, got\n%s", got)
+	}
+}
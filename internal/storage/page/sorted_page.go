@@ -0,0 +1,103 @@
+package page
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// KeyFunc извлекает из кортежа ключ, по которому упорядочиваются слоты
+type KeyFunc func(tuple []byte) []byte
+
+// sortedSlottedPage — слотовая страница, у которой массив слотов упорядочен по ключу кортежа.
+// Кортежи по-прежнему лежат в порядке вставки, при вставке сдвигаются только слоты.
+// Используется как основа для листьев B+Tree.
+type sortedSlottedPage struct {
+	sp  *slottedPage
+	key KeyFunc
+}
+
+// NewSortedSlottedPage создает обертку над срезом байт для работы с упорядоченной слотовой страницей
+func NewSortedSlottedPage(data []byte, key KeyFunc) *sortedSlottedPage {
+	return &sortedSlottedPage{sp: NewSlottedPage(data), key: key}
+}
+
+// Init инициализирует заголовки новой пустой индексной страницы с заданной схемой упаковки слотов
+func (ssp *sortedSlottedPage) Init(format SlotFormat) error {
+	return ssp.sp.initAs(PageTypeIndex, format)
+}
+
+// InsertTuple вставляет кортеж, сохраняя упорядоченность слотов, и возвращает его SlotID.
+// Кортеж с уже существующим ключом встает после равных ему.
+// SlotID остальных кортежей при вставке могут сдвигаться.
+func (ssp *sortedSlottedPage) InsertTuple(tuple []byte) (uint16, error) {
+	slotCount := ssp.sp.slotCount()
+	if !ssp.sp.isAvailableSpace(slotCount, len(tuple)) {
+		if !ssp.sp.isAvailableTotalSpace(slotCount, len(tuple)) {
+			return 0, ErrPageFull
+		}
+		ssp.sp.compact()
+	}
+
+	slotSize := ssp.sp.slotSize()
+	key := ssp.key(tuple)
+	slotID := uint16(sort.Search(int(slotCount), func(i int) bool {
+		return bytes.Compare(ssp.keyAt(uint16(i)), key) > 0
+	}))
+
+	// Сдвигаем слоты правее позиции вставки
+	slotsStart := ssp.sp.slotOffset(slotID)
+	slotsEnd := ssp.sp.slotOffset(slotCount)
+	copy(ssp.sp.data[slotsStart+slotSize:slotsEnd+slotSize], ssp.sp.data[slotsStart:slotsEnd])
+
+	freeSpacePointer := ssp.sp.freeSpacePointer() - len(tuple)
+	copy(ssp.sp.data[freeSpacePointer:], tuple)
+	writeSlot(ssp.sp.slotFormat(), freeSpacePointer, len(tuple), slotUsed, ssp.sp.data[slotsStart:slotsStart+slotSize])
+
+	ssp.sp.setFreeSpacePointer(freeSpacePointer)
+	ssp.sp.setSlotCount(slotCount + 1)
+	return slotID, nil
+}
+
+// FindTuple бинарным поиском ищет первый кортеж с заданным ключом
+func (ssp *sortedSlottedPage) FindTuple(key []byte) (uint16, bool) {
+	slotCount := ssp.sp.slotCount()
+	slotID := uint16(sort.Search(int(slotCount), func(i int) bool {
+		return bytes.Compare(ssp.keyAt(uint16(i)), key) >= 0
+	}))
+	if slotID == slotCount || !bytes.Equal(ssp.keyAt(slotID), key) {
+		return 0, false
+	}
+	return slotID, true
+}
+
+// GetTuple возвращает данные кортежа по SlotID
+func (ssp *sortedSlottedPage) GetTuple(slotID uint16) ([]byte, error) {
+	return ssp.sp.GetTuple(slotID)
+}
+
+// DeleteTuple удаляет слот, сдвигая последующие слоты влево.
+// Место кортежа освобождается при следующем compact.
+func (ssp *sortedSlottedPage) DeleteTuple(slotID uint16) error {
+	slotCount := ssp.sp.slotCount()
+	if slotID >= slotCount {
+		return fmt.Errorf("slotID %d is out of bounds", slotID)
+	}
+
+	slotSize := ssp.sp.slotSize()
+	slotsStart := ssp.sp.slotOffset(slotID)
+	slotsEnd := ssp.sp.slotOffset(slotCount)
+	copy(ssp.sp.data[slotsStart:slotsEnd-slotSize], ssp.sp.data[slotsStart+slotSize:slotsEnd])
+	ssp.sp.setSlotCount(slotCount - 1)
+	return nil
+}
+
+// SlotCount возвращает количество кортежей на странице
+func (ssp *sortedSlottedPage) SlotCount() uint16 {
+	return ssp.sp.slotCount()
+}
+
+func (ssp *sortedSlottedPage) keyAt(slotID uint16) []byte {
+	offset, length, _ := ssp.sp.unpackSlot(slotID)
+	return ssp.key(ssp.sp.data[offset : offset+length])
+}
@@ -0,0 +1,82 @@
+package page
+
+import (
+	"bytes"
+	"testing"
+)
+
+// firstByteKey использует первый байт кортежа в качестве ключа
+func firstByteKey(tuple []byte) []byte {
+	return tuple[:1]
+}
+
+func Test_sortedSlottedPage_orderedInsert(t *testing.T) {
+	t.Parallel()
+
+	sp := NewSortedSlottedPage(make([]byte, 200), firstByteKey)
+	sp.Init(SlotFormatCompact)
+
+	for _, k := range []byte{'d', 'a', 'c', 'e', 'b'} {
+		if _, err := sp.InsertTuple([]byte{k, 'x', 'y'}); err != nil {
+			t.Fatalf("insert %c: %v", k, err)
+		}
+	}
+
+	for i, want := range []byte("abcde") {
+		got, err := sp.GetTuple(uint16(i))
+		if err != nil {
+			t.Fatalf("get slot %d: %v", i, err)
+		}
+		if !bytes.Equal(got, []byte{want, 'x', 'y'}) {
+			t.Fatalf("slot %d: expected key %c, got %v", i, want, got)
+		}
+	}
+}
+
+func Test_sortedSlottedPage_FindTuple(t *testing.T) {
+	t.Parallel()
+
+	sp := NewSortedSlottedPage(make([]byte, 200), firstByteKey)
+	sp.Init(SlotFormatCompact)
+
+	for _, k := range []byte{'m', 'c', 'x', 'a'} {
+		if _, err := sp.InsertTuple([]byte{k, k}); err != nil {
+			t.Fatalf("insert %c: %v", k, err)
+		}
+	}
+
+	slotID, ok := sp.FindTuple([]byte{'m'})
+	if !ok {
+		t.Fatalf("expected to find key m")
+	}
+	got, err := sp.GetTuple(slotID)
+	if err != nil {
+		t.Fatalf("get slot %d: %v", slotID, err)
+	}
+	if !bytes.Equal(got, []byte{'m', 'm'}) {
+		t.Fatalf("expected tuple %v, got %v", []byte{'m', 'm'}, got)
+	}
+}
+
+func Test_sortedSlottedPage_FindTuple_notFound(t *testing.T) {
+	t.Parallel()
+
+	sp := NewSortedSlottedPage(make([]byte, 200), firstByteKey)
+	sp.Init(SlotFormatCompact)
+
+	if _, ok := sp.FindTuple([]byte{'a'}); ok {
+		t.Fatalf("expected not to find key in empty page")
+	}
+
+	for _, k := range []byte{'b', 'd'} {
+		if _, err := sp.InsertTuple([]byte{k}); err != nil {
+			t.Fatalf("insert %c: %v", k, err)
+		}
+	}
+
+	for _, k := range []byte{'a', 'c', 'e'} {
+		if _, ok := sp.FindTuple([]byte{k}); ok {
+			t.Fatalf("expected not to find key %c", k)
+		}
+	}
+}
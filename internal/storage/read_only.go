@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrReadOnly = errors.New("database is read-only")
+
+// readOnlyEngine передает чтения внутреннему движку, а любую запись отклоняет с ErrReadOnly,
+// не обращаясь к внутреннему движку.
+type readOnlyEngine struct {
+	inner Engine
+}
+
+// NewReadOnlyEngine оборачивает inner так, что через обертку его данные нельзя изменить.
+// Изменения, сделанные напрямую через inner, видны через обертку сразу.
+func NewReadOnlyEngine(inner Engine) *readOnlyEngine {
+	return &readOnlyEngine{inner: inner}
+}
+
+func (ro *readOnlyEngine) Set(ctx context.Context, key []byte, value []byte) error {
+	return ErrReadOnly
+}
+
+func (ro *readOnlyEngine) Get(ctx context.Context, key []byte) ([]byte, error) {
+	return ro.inner.Get(ctx, key)
+}
+
+func (ro *readOnlyEngine) PrefixStats(prefix []byte) (PrefixStat, error) {
+	return ro.inner.PrefixStats(prefix)
+}
+
+func (ro *readOnlyEngine) Keys(prefix []byte, fn func(key []byte) bool) error {
+	return ro.inner.Keys(prefix, fn)
+}
+
+func (ro *readOnlyEngine) Increment(key []byte, delta int64) (int64, error) {
+	return 0, ErrReadOnly
+}
+
+func (ro *readOnlyEngine) CompareAndSwap(key, expected, new []byte) (bool, error) {
+	return false, ErrReadOnly
+}
+
+func (ro *readOnlyEngine) SetNX(key, value []byte) (bool, error) {
+	return false, ErrReadOnly
+}
+
+func (ro *readOnlyEngine) GetSet(key, value []byte) ([]byte, bool, error) {
+	return nil, false, ErrReadOnly
+}
+
+func (ro *readOnlyEngine) TTL(key []byte) (time.Duration, error) {
+	return ro.inner.TTL(key)
+}
+
+func (ro *readOnlyEngine) Append(key, suffix []byte) (int, error) {
+	return 0, ErrReadOnly
+}
+
+func (ro *readOnlyEngine) SetMany(pairs map[string][]byte) error {
+	return ErrReadOnly
+}
+
+func (ro *readOnlyEngine) GetMany(keys [][]byte) ([][]byte, []error) {
+	return ro.inner.GetMany(keys)
+}
+
+func (ro *readOnlyEngine) Clear() error {
+	return ErrReadOnly
+}
+
+func (ro *readOnlyEngine) DeletePrefix(prefix []byte) (int, error) {
+	return 0, ErrReadOnly
+}
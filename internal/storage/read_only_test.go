@@ -0,0 +1,54 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Argentum88/godb/internal/storage"
+)
+
+func TestReadOnlyEngine(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	inner := storage.NewInMemoryKVEngine()
+	inner.Set(ctx, []byte("foo"), []byte("bar"))
+	ro := storage.NewReadOnlyEngine(inner)
+
+	writes := map[string]func() error{
+		"Set":            func() error { return ro.Set(ctx, []byte("foo"), []byte("baz")) },
+		"SetMany":        func() error { return ro.SetMany(map[string][]byte{"foo": []byte("baz")}) },
+		"Increment":      func() error { _, err := ro.Increment([]byte("n"), 1); return err },
+		"CompareAndSwap": func() error { _, err := ro.CompareAndSwap([]byte("foo"), []byte("bar"), []byte("baz")); return err },
+		"SetNX":          func() error { _, err := ro.SetNX([]byte("new"), []byte("v")); return err },
+		"GetSet":         func() error { _, _, err := ro.GetSet([]byte("foo"), []byte("baz")); return err },
+		"Append":         func() error { _, err := ro.Append([]byte("foo"), []byte("baz")); return err },
+		"Clear":          ro.Clear,
+		"DeletePrefix":   func() error { _, err := ro.DeletePrefix([]byte("f")); return err },
+	}
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, storage.ErrReadOnly) {
+			t.Errorf("%s: expected ErrReadOnly, got %v", name, err)
+		}
+	}
+
+	value, err := ro.Get(ctx, []byte("foo"))
+	if err != nil || string(value) != "bar" {
+		t.Fatalf("expected reads to pass through unchanged data, got %q, %v", value, err)
+	}
+	if _, err := ro.Get(ctx, []byte("new")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected rejected writes to store nothing, got %v", err)
+	}
+
+	// Запись напрямую во внутренний движок видна через обертку
+	inner.Set(ctx, []byte("other"), []byte("v"))
+	var keys []string
+	ro.Keys(nil, func(key []byte) bool {
+		keys = append(keys, string(key))
+		return true
+	})
+	if want := []string{"foo", "other"}; !slices.Equal(keys, want) {
+		t.Fatalf("expected keys %q, got %q", want, keys)
+	}
+}
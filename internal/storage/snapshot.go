@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Снимок содержимого движка в памяти.
+//
+// Формат: [ Magic (4 байта) ] [ Version (1 байт) ] [ Count (4 байта) ],
+// затем для каждой пары в порядке ключей:
+// [ KeyLen (4 байта) ] [ Key ] [ ValueLen (4 байта) ] [ Value ]
+const (
+	snapshotMagic      = 0x474B5653 // "GKVS"
+	snapshotVersion    = 1
+	snapshotHeaderSize = 9
+)
+
+var ErrInvalidSnapshot = errors.New("invalid key-value snapshot")
+
+// Dump записывает в w все пары ключ-значение. Истекшие ключи пропускаются,
+// а срок жизни остальных в снимок не попадает.
+// Блокировка удерживается только на время копирования ссылок на данные, но не на время записи в w.
+func (kv *inMemoryKVEngine) Dump(w io.Writer) error {
+	kv.mtx.RLock()
+	data := maps.Clone(kv.data)
+	now := kv.opts.clock.Now()
+	for k := range data {
+		if kv.expired(k, now) {
+			delete(data, k)
+		}
+	}
+	kv.mtx.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	header := make([]byte, 0, snapshotHeaderSize)
+	header = binary.LittleEndian.AppendUint32(header, snapshotMagic)
+	header = append(header, snapshotVersion)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(data)))
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	lenBuf := make([]byte, 4)
+	writeChunk := func(chunk []byte) error {
+		binary.LittleEndian.PutUint32(lenBuf, uint32(len(chunk)))
+		if _, err := bw.Write(lenBuf); err != nil {
+			return err
+		}
+		_, err := bw.Write(chunk)
+		return err
+	}
+	for _, k := range slices.Sorted(maps.Keys(data)) {
+		if err := writeChunk([]byte(k)); err != nil {
+			return err
+		}
+		if err := writeChunk(data[k]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Load заменяет содержимое движка снимком, записанным Dump.
+// Снимок разбирается целиком до замены, поэтому при ошибке содержимое не меняется.
+func (kv *inMemoryKVEngine) Load(r io.Reader) error {
+	br := bufio.NewReader(r)
+	header := make([]byte, snapshotHeaderSize)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+	}
+	if binary.LittleEndian.Uint32(header[0:4]) != snapshotMagic {
+		return fmt.Errorf("%w: bad magic", ErrInvalidSnapshot)
+	}
+	if version := header[4]; version != snapshotVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, version)
+	}
+	count := int(binary.LittleEndian.Uint32(header[5:9]))
+
+	lenBuf := make([]byte, 4)
+	readChunk := func() ([]byte, error) {
+		if _, err := io.ReadFull(br, lenBuf); err != nil {
+			return nil, err
+		}
+		n := int64(binary.LittleEndian.Uint32(lenBuf))
+		chunk, err := io.ReadAll(io.LimitReader(br, n))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(chunk)) != n {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return chunk, nil
+	}
+	// Память выделяется по мере чтения, а не по длинам из снимка,
+	// чтобы поврежденный снимок не приводил к огромным аллокациям
+	data := make(map[string][]byte)
+	for i := range count {
+		key, err := readChunk()
+		if err != nil {
+			return fmt.Errorf("%w: pair %d: %w", ErrInvalidSnapshot, i, err)
+		}
+		value, err := readChunk()
+		if err != nil {
+			return fmt.Errorf("%w: pair %d: %w", ErrInvalidSnapshot, i, err)
+		}
+		data[string(key)] = value
+	}
+
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	kv.reset(data, make(map[string]time.Time))
+	return nil
+}
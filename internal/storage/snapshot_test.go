@@ -0,0 +1,104 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Argentum88/godb/internal/storage"
+)
+
+func TestInMemoryKV_SnapshotRoundTrip(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	pairs := map[string][]byte{
+		"":            []byte("empty key"),
+		"empty value": {},
+		"binary":      {0x00, 0xff, 0xfe, 0x80, '\n', 0x00},
+		"\xff\x00key": []byte("non-UTF8 key"),
+		"text":        []byte("hello world"),
+	}
+
+	src := storage.NewInMemoryKVEngine()
+	if err := src.SetMany(pairs); err != nil {
+		t.Fatalf("SetMany failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := src.Dump(&buf); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+
+	dst := storage.NewInMemoryKVEngine()
+	dst.Set(ctx, []byte("stale"), []byte("replaced by load"))
+	if err := dst.Load(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	for k, want := range pairs {
+		got, err := dst.Get(ctx, []byte(k))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("key %q: expected %q, got %q, %v", k, want, got, err)
+		}
+	}
+	if _, err := dst.Get(ctx, []byte("stale")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected Load to replace existing contents, got %v", err)
+	}
+
+	// Обрезанный снимок отвергается целиком, содержимое движка не меняется
+	if err := dst.Load(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); !errors.Is(err, storage.ErrInvalidSnapshot) {
+		t.Fatalf("expected ErrInvalidSnapshot for truncated snapshot, got %v", err)
+	}
+	if got, _ := dst.Get(ctx, []byte("text")); string(got) != "hello world" {
+		t.Fatalf("expected contents to survive failed load, got %q", got)
+	}
+
+	empty := storage.NewInMemoryKVEngine()
+	buf.Reset()
+	if err := empty.Dump(&buf); err != nil {
+		t.Fatalf("Dump of empty engine failed: %v", err)
+	}
+	if err := dst.Load(&buf); err != nil {
+		t.Fatalf("Load of empty snapshot failed: %v", err)
+	}
+	if stat, _ := dst.PrefixStats(nil); stat.Keys != 0 {
+		t.Fatalf("expected no keys after loading empty snapshot, got %d", stat.Keys)
+	}
+}
+
+func TestInMemoryKV_LoadRejectsCorruptHeader(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	src := storage.NewInMemoryKVEngine()
+	src.Set(ctx, []byte("key"), []byte("value"))
+	var buf bytes.Buffer
+	if err := src.Dump(&buf); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+
+	corrupt := func(offset int) []byte {
+		data := bytes.Clone(buf.Bytes())
+		data[offset] ^= 0xff
+		return data
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "bad magic", data: corrupt(0)},
+		{name: "unsupported version", data: corrupt(4)},
+		{name: "short header", data: buf.Bytes()[:6]},
+		{name: "empty", data: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := storage.NewInMemoryKVEngine()
+			dst.Set(ctx, []byte("kept"), []byte("value"))
+			if err := dst.Load(bytes.NewReader(tt.data)); !errors.Is(err, storage.ErrInvalidSnapshot) {
+				t.Fatalf("expected ErrInvalidSnapshot, got %v", err)
+			}
+			if _, err := dst.Get(ctx, []byte("kept")); err != nil {
+				t.Fatalf("expected contents to survive rejected load, got %v", err)
+			}
+		})
+	}
+}
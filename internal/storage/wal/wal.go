@@ -0,0 +1,256 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// Журнал упреждающей записи.
+//
+// Формат файла: [ Magic (4 байта) ] [ BaseLSN (8 байт) ], затем записи:
+// [ Length (4 байта) ] [ CRC32C данных (4 байта) ] [ Data ]
+// LSN записи равен BaseLSN плюс ее порядковый номер в файле.
+const (
+	logMagic         = 0x57414C31 // "WAL1"
+	fileHeaderSize   = 12
+	recordHeaderSize = 8
+)
+
+var ErrCorruptLog = errors.New("corrupt write-ahead log")
+var ErrLogClosed = errors.New("write-ahead log is closed")
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Log — журнал упреждающей записи в одном файле. Записи добавляются в конец
+// и становятся надежными после Sync.
+type Log struct {
+	mu      sync.Mutex
+	f       *os.File
+	size    int64  // Длина файла, включая заголовок
+	baseLSN uint64 // LSN первой записи файла
+	count   uint64 // Количество записей в файле
+	closed  bool
+}
+
+// Open открывает журнал по пути path, создавая его при отсутствии.
+// Недописанная или поврежденная запись в конце файла, оставшаяся после сбоя,
+// и все записи после нее отбрасываются.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open write-ahead log: %w", err)
+	}
+
+	l := &Log{f: f}
+	if err := l.init(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// init читает заголовок нового или существующего файла и находит конец последней целой записи.
+func (l *Log) init() error {
+	fi, err := l.f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat write-ahead log: %w", err)
+	}
+	// Файл короче заголовка остается после сбоя при создании журнала
+	if fi.Size() < fileHeaderSize {
+		return l.reset(1)
+	}
+
+	header := make([]byte, fileHeaderSize)
+	if _, err := l.f.ReadAt(header, 0); err != nil {
+		return fmt.Errorf("%w: header: %w", ErrCorruptLog, err)
+	}
+	if binary.LittleEndian.Uint32(header[0:4]) != logMagic {
+		return fmt.Errorf("%w: bad magic", ErrCorruptLog)
+	}
+	l.baseLSN = binary.LittleEndian.Uint64(header[4:12])
+
+	offset := int64(fileHeaderSize)
+	for {
+		n, err := readRecordAt(l.f, offset, fi.Size(), nil)
+		if errors.Is(err, ErrCorruptLog) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		offset += n
+		l.count++
+	}
+	if offset < fi.Size() {
+		slog.Warn("truncating torn write-ahead log tail", "offset", offset, "size", fi.Size())
+		if err := l.f.Truncate(offset); err != nil {
+			return fmt.Errorf("failed to truncate write-ahead log: %w", err)
+		}
+	}
+	l.size = offset
+	return nil
+}
+
+// Append дописывает запись в конец журнала и возвращает ее LSN.
+// Запись надежна только после последующего Sync.
+func (l *Log) Append(record []byte) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return 0, ErrLogClosed
+	}
+
+	buf := make([]byte, 0, recordHeaderSize+len(record))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(record)))
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(record, crcTable))
+	buf = append(buf, record...)
+	if _, err := l.f.WriteAt(buf, l.size); err != nil {
+		return 0, fmt.Errorf("failed to append to write-ahead log: %w", err)
+	}
+
+	lsn := l.baseLSN + l.count
+	l.size += int64(len(buf))
+	l.count++
+	return lsn, nil
+}
+
+// Sync сбрасывает дописанные записи на диск.
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrLogClosed
+	}
+	return l.f.Sync()
+}
+
+// Truncate удаляет все записи журнала, например после того как их действие сброшено на диск.
+// Нумерация LSN продолжается с места остановки.
+func (l *Log) Truncate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrLogClosed
+	}
+	return l.reset(l.baseLSN + l.count)
+}
+
+// reset переписывает файл пустым журналом с первой записью baseLSN. Вызывается под l.mu или при открытии.
+func (l *Log) reset(baseLSN uint64) error {
+	header := make([]byte, 0, fileHeaderSize)
+	header = binary.LittleEndian.AppendUint32(header, logMagic)
+	header = binary.LittleEndian.AppendUint64(header, baseLSN)
+	if err := l.f.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate write-ahead log: %w", err)
+	}
+	if _, err := l.f.WriteAt(header, 0); err != nil {
+		return fmt.Errorf("failed to write write-ahead log header: %w", err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync write-ahead log: %w", err)
+	}
+	l.baseLSN = baseLSN
+	l.count = 0
+	l.size = fileHeaderSize
+	return nil
+}
+
+// Close закрывает файл журнала. Несброшенные записи сбрасываются на диск.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	if err := l.f.Sync(); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
+
+// Iterator — последовательный обход записей журнала от начала.
+// Видит записи, добавленные до его создания.
+type Iterator struct {
+	r      io.ReaderAt
+	offset int64
+	end    int64
+	next   uint64 // LSN следующей записи
+	lsn    uint64
+	data   []byte
+	err    error
+}
+
+// Iterator возвращает итератор по всем записям журнала.
+func (l *Log) Iterator() *Iterator {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	it := &Iterator{r: l.f, offset: fileHeaderSize, end: l.size, next: l.baseLSN}
+	if l.closed {
+		it.err = ErrLogClosed
+	}
+	return it
+}
+
+// Next переходит к следующей записи и сообщает, есть ли она.
+func (it *Iterator) Next() bool {
+	if it.err != nil || it.offset >= it.end {
+		return false
+	}
+	var data []byte
+	n, err := readRecordAt(it.r, it.offset, it.end, &data)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.offset += n
+	it.lsn = it.next
+	it.next++
+	it.data = data
+	return true
+}
+
+// Record возвращает LSN и данные текущей записи.
+func (it *Iterator) Record() (uint64, []byte) {
+	return it.lsn, it.data
+}
+
+// Err возвращает ошибку, прервавшую обход.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// readRecordAt проверяет запись по смещению offset и возвращает ее полную длину.
+// Если data не nil, в него записываются данные записи.
+func readRecordAt(r io.ReaderAt, offset, end int64, data *[]byte) (int64, error) {
+	if offset+recordHeaderSize > end {
+		return 0, fmt.Errorf("%w: truncated record header at %d", ErrCorruptLog, offset)
+	}
+	header := make([]byte, recordHeaderSize)
+	if _, err := r.ReadAt(header, offset); err != nil {
+		return 0, fmt.Errorf("failed to read record at %d: %w", offset, err)
+	}
+	length := int64(binary.LittleEndian.Uint32(header[0:4]))
+	if offset+recordHeaderSize+length > end {
+		return 0, fmt.Errorf("%w: truncated record at %d", ErrCorruptLog, offset)
+	}
+
+	buf := make([]byte, length)
+	if _, err := r.ReadAt(buf, offset+recordHeaderSize); err != nil {
+		return 0, fmt.Errorf("failed to read record at %d: %w", offset, err)
+	}
+	if crc32.Checksum(buf, crcTable) != binary.LittleEndian.Uint32(header[4:8]) {
+		return 0, fmt.Errorf("%w: checksum mismatch at %d", ErrCorruptLog, offset)
+	}
+	if data != nil {
+		*data = buf
+	}
+	return recordHeaderSize + length, nil
+}
@@ -0,0 +1,127 @@
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLog_AppendAndReplay(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "test.wal")
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	records := [][]byte{[]byte("first"), {}, bytes.Repeat([]byte{0xAB}, 10_000), []byte("last")}
+	for i, record := range records {
+		lsn, err := l.Append(record)
+		if err != nil {
+			t.Fatalf("Append %d failed: %v", i, err)
+		}
+		if lsn != uint64(i+1) {
+			t.Fatalf("record %d: expected LSN %d, got %d", i, i+1, lsn)
+		}
+	}
+	if err := l.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	l, err = Open(path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer l.Close()
+	assertRecords(t, l, 1, records)
+
+	// После очистки нумерация продолжается, в том числе после переоткрытия
+	if err := l.Truncate(); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	assertRecords(t, l, 0, nil)
+	if lsn, _ := l.Append([]byte("after truncate")); lsn != uint64(len(records)+1) {
+		t.Fatalf("expected LSN %d after truncate, got %d", len(records)+1, lsn)
+	}
+}
+
+func TestLog_TornTail(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "test.wal")
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	for i := range 3 {
+		l.Append([]byte(fmt.Sprintf("record-%d", i)))
+	}
+	l.Close()
+	goodSize := fileSize(t, path)
+
+	tails := map[string][]byte{
+		"partial header": {0x10, 0x00},
+		"partial data":   {0x10, 0x00, 0x00, 0x00, 0x01, 0x02, 0x03, 0x04, 'x'},
+		"bad checksum":   {0x01, 0x00, 0x00, 0x00, 0xDE, 0xAD, 0xBE, 0xEF, 'x'},
+	}
+	for name, tail := range tails {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			t.Fatalf("%s: failed to open log: %v", name, err)
+		}
+		f.Write(tail)
+		f.Close()
+
+		l, err := Open(path)
+		if err != nil {
+			t.Fatalf("%s: Open failed: %v", name, err)
+		}
+		assertRecords(t, l, 1, [][]byte{[]byte("record-0"), []byte("record-1"), []byte("record-2")})
+		l.Close()
+		if size := fileSize(t, path); size != goodSize {
+			t.Fatalf("%s: expected torn tail to be truncated to %d bytes, got %d", name, goodSize, size)
+		}
+	}
+
+	os.WriteFile(path, []byte("not a log file"), 0o644)
+	if _, err := Open(path); !errors.Is(err, ErrCorruptLog) {
+		t.Fatalf("expected %v for foreign file, got %v", ErrCorruptLog, err)
+	}
+}
+
+func assertRecords(t *testing.T, l *Log, firstLSN uint64, want [][]byte) {
+	t.Helper()
+	it := l.Iterator()
+	var n int
+	for it.Next() {
+		lsn, data := it.Record()
+		if n >= len(want) {
+			t.Fatalf("unexpected record %d", lsn)
+		}
+		if lsn != firstLSN+uint64(n) || !bytes.Equal(data, want[n]) {
+			t.Fatalf("record %d: expected LSN %d with %d bytes, got LSN %d with %d bytes", n, firstLSN+uint64(n), len(want[n]), lsn, len(data))
+		}
+		n++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("iteration failed: %v", err)
+	}
+	if n != len(want) {
+		t.Fatalf("expected %d records, got %d", len(want), n)
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat %s: %v", path, err)
+	}
+	return fi.Size()
+}
@@ -0,0 +1,280 @@
+package txn
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Argentum88/godb/internal/storage"
+)
+
+var ErrTxnNotActive = errors.New("transaction is not active")
+var ErrClearInTxn = errors.New("cannot clear the store inside a transaction")
+var ErrDeleteInTxn = errors.New("cannot delete keys inside a transaction")
+var ErrAtomicInTxn = errors.New("atomic read-modify-write is not supported inside a transaction")
+
+// TxnID — номер транзакции, уникальный в пределах TransactionManager.
+type TxnID uint64
+
+// TransactionManager выдает номера транзакций и отслеживает активные транзакции над движком.
+type TransactionManager struct {
+	engine storage.Engine
+	mu     sync.Mutex
+	nextID TxnID
+	active map[TxnID]*Transaction
+}
+
+func NewTransactionManager(engine storage.Engine) *TransactionManager {
+	return &TransactionManager{
+		engine: engine,
+		nextID: 1,
+		active: make(map[TxnID]*Transaction),
+	}
+}
+
+// Begin начинает новую транзакцию.
+func (m *TransactionManager) Begin() *Transaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := &Transaction{
+		id:     m.nextID,
+		engine: m.engine,
+		writes: make(map[string][]byte),
+	}
+	m.nextID++
+	m.active[t.id] = t
+	return t
+}
+
+// Commit атомарно применяет накопленные изменения транзакции к движку.
+// Если применить изменения не удалось, транзакция остается активной.
+func (m *TransactionManager) Commit(t *Transaction) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return ErrTxnNotActive
+	}
+	if len(t.writes) > 0 {
+		if err := m.engine.SetMany(t.writes); err != nil {
+			return err
+		}
+	}
+	m.finish(t)
+	return nil
+}
+
+// Rollback отбрасывает изменения транзакции.
+func (m *TransactionManager) Rollback(t *Transaction) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return ErrTxnNotActive
+	}
+	m.finish(t)
+	return nil
+}
+
+// Active возвращает номера активных транзакций по возрастанию.
+func (m *TransactionManager) Active() []TxnID {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Sorted(maps.Keys(m.active))
+}
+
+// finish завершает транзакцию. Вызывается под t.mu.
+func (m *TransactionManager) finish(t *Transaction) {
+	t.done = true
+	t.writes = nil
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.active, t.id)
+}
+
+// Transaction копит изменения в памяти до Commit и реализует storage.Engine:
+// чтения видят зафиксированное состояние движка с наложенными изменениями самой транзакции.
+// Конфликты с параллельными изменениями движка не обнаруживаются — при Commit побеждают
+// значения транзакции. Поэтому атомарные операции чтения-изменения-записи (Increment,
+// CompareAndSwap, SetNX, GetSet, Append) в транзакции не поддерживаются: их проверка
+// выполнялась бы по состоянию на момент команды, а не на момент Commit.
+type Transaction struct {
+	id     TxnID
+	engine storage.Engine
+	mu     sync.Mutex
+	writes map[string][]byte // Измененные ключи и их новые значения
+	done   bool
+}
+
+// ID возвращает номер транзакции.
+func (t *Transaction) ID() TxnID {
+	return t.id
+}
+
+func (t *Transaction) Set(ctx context.Context, key []byte, value []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return ErrTxnNotActive
+	}
+	t.writes[string(key)] = value
+	return nil
+}
+
+func (t *Transaction) Get(ctx context.Context, key []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return nil, ErrTxnNotActive
+	}
+	return t.get(ctx, key)
+}
+
+func (t *Transaction) SetMany(pairs map[string][]byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return ErrTxnNotActive
+	}
+	maps.Copy(t.writes, pairs)
+	return nil
+}
+
+func (t *Transaction) GetMany(keys [][]byte) ([][]byte, []error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	values := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		if t.done {
+			errs[i] = ErrTxnNotActive
+			continue
+		}
+		values[i], errs[i] = t.get(context.Background(), key)
+	}
+	return values, errs
+}
+
+// Increment не поддерживается: параллельные приращения в разных транзакциях потеряли бы обновление.
+func (t *Transaction) Increment(key []byte, delta int64) (int64, error) {
+	return 0, ErrAtomicInTxn
+}
+
+// CompareAndSwap не поддерживается: сравнение с состоянием на момент команды
+// не гарантирует, что значение не изменится до Commit.
+func (t *Transaction) CompareAndSwap(key, expected, new []byte) (bool, error) {
+	return false, ErrAtomicInTxn
+}
+
+// SetNX не поддерживается по той же причине, что и CompareAndSwap.
+func (t *Transaction) SetNX(key, value []byte) (bool, error) {
+	return false, ErrAtomicInTxn
+}
+
+// GetSet не поддерживается: возвращенное значение могло быть перезаписано до Commit.
+func (t *Transaction) GetSet(key, value []byte) ([]byte, bool, error) {
+	return nil, false, ErrAtomicInTxn
+}
+
+// TTL ключа, измененного транзакцией, — NoExpiry: запись снимает срок жизни.
+func (t *Transaction) TTL(key []byte) (time.Duration, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return 0, ErrTxnNotActive
+	}
+	if _, ok := t.writes[string(key)]; ok {
+		return storage.NoExpiry, nil
+	}
+	return t.engine.TTL(key)
+}
+
+// Append не поддерживается по той же причине, что и Increment.
+func (t *Transaction) Append(key, suffix []byte) (int, error) {
+	return 0, ErrAtomicInTxn
+}
+
+// Clear не поддерживается: изменения транзакции применяются через SetMany, который не удаляет ключи.
+func (t *Transaction) Clear() error {
+	return ErrClearInTxn
+}
+
+// DeletePrefix не поддерживается по той же причине, что и Clear.
+func (t *Transaction) DeletePrefix(prefix []byte) (int, error) {
+	return 0, ErrDeleteInTxn
+}
+
+func (t *Transaction) PrefixStats(prefix []byte) (storage.PrefixStat, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return storage.PrefixStat{}, ErrTxnNotActive
+	}
+	stat, err := t.engine.PrefixStats(prefix)
+	if err != nil {
+		return storage.PrefixStat{}, err
+	}
+	for k, v := range t.writes {
+		if !strings.HasPrefix(k, string(prefix)) {
+			continue
+		}
+		old, err := t.engine.Get(context.Background(), []byte(k))
+		switch {
+		case err == nil:
+			stat.ValueBytes -= len(old)
+		case errors.Is(err, storage.ErrKeyNotFound):
+			stat.Keys++
+		default:
+			return storage.PrefixStat{}, err
+		}
+		stat.ValueBytes += len(v)
+	}
+	return stat, nil
+}
+
+func (t *Transaction) Keys(prefix []byte, fn func(key []byte) bool) error {
+	t.mu.Lock()
+	if t.done {
+		t.mu.Unlock()
+		return ErrTxnNotActive
+	}
+	var keys []string
+	for k := range t.writes {
+		if strings.HasPrefix(k, string(prefix)) {
+			keys = append(keys, k)
+		}
+	}
+	t.mu.Unlock()
+
+	err := t.engine.Keys(prefix, func(key []byte) bool {
+		keys = append(keys, string(key))
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	slices.Sort(keys)
+	for _, k := range slices.Compact(keys) {
+		if !fn([]byte(k)) {
+			break
+		}
+	}
+	return nil
+}
+
+// get читает значение с учетом изменений транзакции. Вызывается под t.mu.
+func (t *Transaction) get(ctx context.Context, key []byte) ([]byte, error) {
+	if v, ok := t.writes[string(key)]; ok {
+		return v, nil
+	}
+	return t.engine.Get(ctx, key)
+}
@@ -0,0 +1,131 @@
+package txn_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Argentum88/godb/internal/storage"
+	"github.com/Argentum88/godb/internal/txn"
+)
+
+func TestTransaction_Rollback(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := storage.NewInMemoryKVEngine()
+	m := txn.NewTransactionManager(engine)
+
+	tx := m.Begin()
+	if err := tx.Set(ctx, []byte("key"), []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if value, err := tx.Get(ctx, []byte("key")); err != nil || string(value) != "value" {
+		t.Fatalf("expected transaction to read its own write, got %q, %v", value, err)
+	}
+	if _, err := engine.Get(ctx, []byte("key")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected uncommitted write to be invisible, got %v", err)
+	}
+
+	if err := m.Rollback(tx); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if _, err := engine.Get(ctx, []byte("key")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("expected key to be absent after rollback, got %v", err)
+	}
+	if err := tx.Set(ctx, []byte("key"), []byte("late")); !errors.Is(err, txn.ErrTxnNotActive) {
+		t.Fatalf("expected %v after rollback, got %v", txn.ErrTxnNotActive, err)
+	}
+	if err := m.Commit(tx); !errors.Is(err, txn.ErrTxnNotActive) {
+		t.Fatalf("expected %v on commit after rollback, got %v", txn.ErrTxnNotActive, err)
+	}
+}
+
+func TestTransaction_RejectsReadModifyWrite(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := storage.NewInMemoryKVEngine()
+	engine.Set(ctx, []byte("counter"), []byte("1"))
+
+	// Обе транзакции увидели бы counter=1 и записали бы 2, потеряв одно приращение
+	tx := txn.NewTransactionManager(engine).Begin()
+	checks := map[string]func() error{
+		"Increment": func() error {
+			_, err := tx.Increment([]byte("counter"), 1)
+			return err
+		},
+		"CompareAndSwap": func() error {
+			_, err := tx.CompareAndSwap([]byte("counter"), []byte("1"), []byte("2"))
+			return err
+		},
+		"SetNX": func() error {
+			_, err := tx.SetNX([]byte("lock"), []byte("x"))
+			return err
+		},
+		"GetSet": func() error {
+			_, _, err := tx.GetSet([]byte("counter"), []byte("2"))
+			return err
+		},
+		"Append": func() error {
+			_, err := tx.Append([]byte("counter"), []byte("0"))
+			return err
+		},
+	}
+	for name, check := range checks {
+		if err := check(); !errors.Is(err, txn.ErrAtomicInTxn) {
+			t.Fatalf("%s: expected %v, got %v", name, txn.ErrAtomicInTxn, err)
+		}
+	}
+}
+
+func TestTransaction_Commit(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+
+	engine, err := storage.NewDiskKVEngine(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	engine.Set(ctx, []byte("counter"), []byte("1"))
+
+	m := txn.NewTransactionManager(engine)
+	tx := m.Begin()
+	other := m.Begin()
+	if got, want := m.Active(), []txn.TxnID{tx.ID(), other.ID()}; !slices.Equal(got, want) {
+		t.Fatalf("expected active transactions %v, got %v", want, got)
+	}
+
+	tx.Set(ctx, []byte("key"), []byte("value"))
+	tx.Set(ctx, []byte("counter"), []byte("2"))
+	var keys []string
+	tx.Keys(nil, func(key []byte) bool {
+		keys = append(keys, string(key))
+		return true
+	})
+	if want := []string{"counter", "key"}; !slices.Equal(keys, want) {
+		t.Fatalf("expected keys %v, got %v", want, keys)
+	}
+
+	if err := m.Commit(tx); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if got, want := m.Active(), []txn.TxnID{other.ID()}; !slices.Equal(got, want) {
+		t.Fatalf("expected active transactions %v, got %v", want, got)
+	}
+	if err := engine.Close(ctx); err != nil {
+		t.Fatalf("failed to close engine: %v", err)
+	}
+
+	reopened, err := storage.NewDiskKVEngine(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("failed to reopen engine: %v", err)
+	}
+	defer reopened.Close(ctx)
+	for key, want := range map[string]string{"key": "value", "counter": "2"} {
+		if value, err := reopened.Get(ctx, []byte(key)); err != nil || string(value) != want {
+			t.Fatalf("expected committed %s=%q to persist, got %q, %v", key, want, value, err)
+		}
+	}
+}